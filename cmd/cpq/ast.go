@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+)
+
+// astCommand prints the AST of a CPL file as JSON. If the file has syntax errors,
+// the partial AST that the parser recovered is printed as well.
+func astCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("cpq ast", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = usage(flags, stderr)
+
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	infile, code, exitCode := readSource(flags, stderr)
+	if exitCode != ExitSuccess {
+		return exitCode
+	}
+
+	ast, parseErrors := parser.Parse(code)
+
+	renderer := diagnostic.NewRenderer(infile, code)
+	renderer.Color = isTerminal(stderr)
+	renderer.RenderAll(stderr, parseErrors)
+
+	output, err := json.MarshalIndent(ast, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "Cannot encode AST: %s\n", err.Error())
+		return ExitInternal
+	}
+	fmt.Fprintln(stdout, string(output))
+
+	if diagnostic.HasErrors(parseErrors) {
+		return ExitParse
+	}
+
+	return ExitSuccess
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAstCommand(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ input(a); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	stdout := new(bytes.Buffer)
+	code := cpq([]string{"ast", infile}, strings.NewReader(""), stdout, new(bytes.Buffer))
+	assert.EqualValues(t, ExitSuccess, code)
+
+	node, err := parser.UnmarshalNode(stdout.Bytes())
+	assert.NoError(t, err)
+
+	expected, _ := parser.Parse("a : int;\n{ input(a); }")
+	assert.EqualValues(t, expected, node)
+}
+
+func TestAstCommandParseErrors(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ input(a) }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := cpq([]string{"ast", infile}, strings.NewReader(""), stdout, stderr)
+
+	assert.EqualValues(t, ExitParse, code)
+	assert.Contains(t, stderr.String(), "error[P001]: found }, expected ;")
+	assert.Contains(t, stdout.String(), `"kind": "InputStatement"`)
+}
@@ -1,57 +1,247 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 
 	"github.com/alongubkin/cpl-compiler/pkg/codegen"
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/optimize"
 	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/alongubkin/cpl-compiler/pkg/semantic"
 )
 
 // Signature of the author :)
 var Signature = "CPL Compiler by Alon Gubkin"
 
+// Exit codes of the cpq process.
+const (
+	ExitSuccess  = 0 // The program was compiled (or executed) successfully
+	ExitUsage    = 1 // Invalid command line arguments
+	ExitIO       = 2 // The input file can't be read, or the output file can't be written
+	ExitParse    = 3 // Lexical or syntax errors
+	ExitSemantic = 4 // Semantic errors, e.g. undefined variables
+	ExitRuntime  = 5 // The Quad interpreter or the VM failed while executing the program
+	ExitInternal = 6 // The generated Quad code is invalid, which is a compiler bug
+
+	ExitUnformatted = 7 // cpq fmt --check found files that aren't formatted
+)
+
 func main() {
-	fmt.Fprintln(os.Stderr, Signature)
+	os.Exit(cpq(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// cpq runs the compiler with the given command line arguments, and returns the
+// process exit code.
+func cpq(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fmt.Fprintln(stderr, Signature)
+
+	// Check which command to run
+	command := ""
+	if len(args) > 0 {
+		switch args[0] {
+		case "run", "ast", "tokens", "fmt":
+			command, args = args[0], args[1:]
+		}
+	}
 
-	// Check args
-	if len(os.Args) != 2 {
-		fmt.Fprintln(os.Stderr, "USAGE: ./cpq <input-file>")
-		return
+	switch command {
+	case "ast":
+		return astCommand(args, stdout, stderr)
+	case "tokens":
+		return tokensCommand(args, stdout, stderr)
+	case "fmt":
+		return fmtCommand(args, stdin, stdout, stderr)
+	default:
+		return compileCommand(args, command == "run", stdin, stdout, stderr)
+	}
+}
+
+// usage prints the usage of every command, followed by the flags of the current one.
+func usage(flags *flag.FlagSet, stderr io.Writer) func() {
+	return func() {
+		fmt.Fprintln(stderr, "USAGE: ./cpq [flags] <input-file>")
+		fmt.Fprintln(stderr, "       ./cpq run [flags] <input-file>")
+		fmt.Fprintln(stderr, "       ./cpq run <bytecode-file>")
+		fmt.Fprintln(stderr, "       ./cpq ast <input-file>")
+		fmt.Fprintln(stderr, "       ./cpq tokens [flags] <input-file>")
+		fmt.Fprintln(stderr, "       ./cpq fmt [flags] [files or directories]")
+		flags.PrintDefaults()
+	}
+}
+
+// readSource reads the CPL file given as the only argument after the flags.
+func readSource(flags *flag.FlagSet, stderr io.Writer) (string, string, int) {
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return "", "", ExitUsage
 	}
 
 	// Make sure the input file ends with .ou
-	if path.Ext(os.Args[1]) != ".ou" {
-		fmt.Fprintln(os.Stderr, "Input file extension must be .ou")
-		return
+	infile := flags.Arg(0)
+	if path.Ext(infile) != ".ou" {
+		fmt.Fprintln(stderr, "Input file extension must be .ou")
+		return "", "", ExitUsage
 	}
 
 	// Read code file
-	infile := os.Args[1]
 	code, err := ioutil.ReadFile(infile)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Cannot open input CPL file.")
-		return
+		fmt.Fprintln(stderr, "Cannot open input CPL file.")
+		return "", "", ExitIO
 	}
 
+	return infile, string(code), ExitSuccess
+}
+
+// compileCommand compiles a CPL file to a Quad file (or another target), or executes it
+// if run is true. Bytecode files written by the vm target can be executed too.
+func compileCommand(args []string, run bool, stdin io.Reader, stdout io.Writer,
+	stderr io.Writer) int {
+	flags := flag.NewFlagSet("cpq", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = usage(flags, stderr)
+	format := flags.String("diagnostics-format", "text",
+		"format of compiler diagnostics: text, json or sarif")
+	targetName := flags.String("target", "quad", "format of the output file: "+targetNames())
+	optimizations := optimizeOptions{}
+	optimizations.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	if *format != "text" && *format != "json" && *format != "sarif" {
+		fmt.Fprintf(stderr, "Unknown diagnostics format %q.\n", *format)
+		return ExitUsage
+	}
+
+	target, ok := lookupTarget(*targetName)
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown target %q.\n", *targetName)
+		return ExitUsage
+	}
+	if run && target.run == nil {
+		fmt.Fprintln(stderr, "Only Quad code and bytecode can be executed with cpq run.")
+		return ExitUsage
+	}
+
+	pipeline, err := optimizations.pipeline()
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid optimization flags: %s.\n", err.Error())
+		return ExitUsage
+	}
+
+	// Bytecode files were already compiled, so they're executed as is
+	if run && flags.NArg() == 1 && path.Ext(flags.Arg(0)) == ".cplb" {
+		return runBytecodeFile(flags.Arg(0), stdin, stdout, stderr)
+	}
+
+	infile, code, exitCode := readSource(flags, stderr)
+	if exitCode != ExitSuccess {
+		return exitCode
+	}
+
+	program, diagnostics, exitCode := analyze(code)
+
+	// Report diagnostics. Machine readable formats are written to stdout; when running
+	// the program they are only written if the compilation failed, so they never mix
+	// with the program's output.
+	switch *format {
+	case "text":
+		renderer := diagnostic.NewRenderer(infile, code)
+		renderer.Color = isTerminal(stderr)
+		renderer.RenderAll(stderr, diagnostics)
+	case "json":
+		if !run || exitCode != ExitSuccess {
+			diagnostic.WriteJSON(stdout, infile, diagnostics)
+		}
+	case "sarif":
+		if !run || exitCode != ExitSuccess {
+			diagnostic.WriteSARIF(stdout, infile, diagnostics)
+		}
+	}
+
+	if exitCode != ExitSuccess {
+		return exitCode
+	}
+
+	// Execute the program instead of writing it to a file
+	if run {
+		return target.run(program, pipeline, stdin, stdout, stderr)
+	}
+
+	// Write the output file
+	output, exitCode := target.generate(program, pipeline, stderr)
+	if exitCode != ExitSuccess {
+		return exitCode
+	}
+
+	outfile := infile[0:len(infile)-3] + target.extension
+	if err := ioutil.WriteFile(outfile, []byte(output), 0644); err != nil {
+		fmt.Fprintf(stderr, "Cannot write output %s file.\n", target.description)
+		return ExitIO
+	}
+
+	return ExitSuccess
+}
+
+// analyze parses CPL code and checks it for semantic errors. It returns the diagnostics
+// of every stage that ran, and the exit code of the first stage that failed.
+//
+// Semantic analysis runs only if parsing succeeded: it's never performed on the partial
+// AST produced after parse errors.
+func analyze(code string) (*parser.Program, []diagnostic.Diagnostic, int) {
 	// Lex & Parse
-	ast, parseErrors := parser.Parse(string(code))
-	for _, err := range parseErrors {
-		fmt.Fprintf(os.Stderr, "ParseError: %s\n", err.Error())
+	program, diagnostics := parser.Parse(code)
+	if diagnostic.HasErrors(diagnostics) {
+		return nil, diagnostics, ExitParse
 	}
 
-	// Codegen
-	output, codegenErrors := codegen.Codegen(ast)
-	for _, err := range codegenErrors {
-		fmt.Fprintf(os.Stderr, "CodegenError: %s\n", err.Error())
+	// Semantic analysis
+	_, semanticErrors := semantic.Analyze(program)
+	diagnostics = append(diagnostics, semanticErrors...)
+	if diagnostic.HasErrors(semanticErrors) {
+		return nil, diagnostics, ExitSemantic
 	}
 
-	// Generate the filename for the output QUAD file
-	if len(parseErrors) == 0 && len(codegenErrors) == 0 {
-		// Write output to the QUAD file
-		outfile := infile[0:len(infile)-3] + ".qud"
-		ioutil.WriteFile(outfile, []byte(codegen.RemoveLabels(output)+"\n"+Signature), 0644)
+	return program, diagnostics, ExitSuccess
+}
+
+// generateQuad generates Quad code for a program that passed semantic analysis, and
+// optimizes it using the pipeline of passes. An empty pipeline leaves the generated code
+// exactly as codegen produced it.
+func generateQuad(program *parser.Program, pipeline []optimize.Pass,
+	stderr io.Writer) ([]quad.Instruction, int) {
+	output := optimize.Run(codegen.Codegen(program), pipeline)
+
+	// Replace labels with instruction numbers. Errors at this point are compiler bugs,
+	// so they aren't reported as diagnostics of the CPL program.
+	instructions, assemblerErrors := quad.Assemble(output)
+	for _, err := range assemblerErrors {
+		fmt.Fprintf(stderr, "AssemblerError: %s\n", err.Error())
 	}
+
+	if len(assemblerErrors) != 0 {
+		return nil, ExitInternal
+	}
+
+	return instructions, ExitSuccess
+}
+
+// isTerminal returns true if w is a terminal that supports colors. Colors can be
+// disabled using the NO_COLOR environment variable.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
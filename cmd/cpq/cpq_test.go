@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitUsage(t *testing.T) {
+	code, stderr := runCpq(t, "")
+	assert.EqualValues(t, ExitUsage, code)
+	assert.Contains(t, stderr, "USAGE")
+
+	code, stderr = runCpq(t, "", "program.c")
+	assert.EqualValues(t, ExitUsage, code)
+	assert.Contains(t, stderr, "Input file extension must be .ou")
+}
+
+func TestExitIO(t *testing.T) {
+	code, stderr := runCpq(t, "", filepath.Join(os.TempDir(), "does-not-exist.ou"))
+	assert.EqualValues(t, ExitIO, code)
+	assert.Contains(t, stderr, "Cannot open input CPL file.")
+}
+
+func TestExitParse(t *testing.T) {
+	// The undefined variable must not be reported, because semantic analysis
+	// doesn't run after parse errors.
+	infile := writeSource(t, "a : int;\n{ a = b + ; }")
+	defer os.RemoveAll(filepath.Dir(infile))
+	code, stderr := runCpq(t, "", infile)
+
+	assert.EqualValues(t, ExitParse, code)
+	assert.Contains(t, stderr, "error[P001]: found ;, expected (, ID, NUM")
+	assert.NotContains(t, stderr, "undefined variable")
+	assert.False(t, fileExists(strings.TrimSuffix(infile, ".ou")+".qud"))
+}
+
+func TestExitSemantic(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ a = b; }")
+	defer os.RemoveAll(filepath.Dir(infile))
+	code, stderr := runCpq(t, "", infile)
+
+	assert.EqualValues(t, ExitSemantic, code)
+	assert.Contains(t, stderr, `error[S002]: undefined variable b
+ --> `+infile+`:2:7
+  |
+2 | { a = b; }
+  |       ^
+`)
+	assert.False(t, fileExists(strings.TrimSuffix(infile, ".ou")+".qud"))
+}
+
+func TestExitRuntime(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ a = 0; output(5 / a); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+	code, stderr := runCpq(t, "", "run", infile)
+
+	assert.EqualValues(t, ExitRuntime, code)
+	assert.Contains(t, stderr, "RuntimeError: division by zero")
+}
+
+func TestExitSuccess(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ a = 5; output(a); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+	code, _ := runCpq(t, "", infile)
+
+	assert.EqualValues(t, ExitSuccess, code)
+	assert.FileExists(t, strings.TrimSuffix(infile, ".ou")+".qud")
+}
+
+func TestRun(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ input(a); output(a * 2); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+	stdout := new(bytes.Buffer)
+	code := cpq([]string{"run", infile}, strings.NewReader("21\n"), stdout, new(bytes.Buffer))
+
+	assert.EqualValues(t, ExitSuccess, code)
+	assert.EqualValues(t, "42\n", stdout.String())
+}
+
+func TestDiagnosticsFormatJSON(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ a = b; }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	stdout := new(bytes.Buffer)
+	code := cpq([]string{"--diagnostics-format=json", infile}, strings.NewReader(""), stdout,
+		new(bytes.Buffer))
+
+	assert.EqualValues(t, ExitSemantic, code)
+	assert.Contains(t, stdout.String(), `"code": "S002"`)
+	assert.Contains(t, stdout.String(), `"file": "`+infile+`"`)
+}
+
+func TestDiagnosticsFormatSARIF(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ a = 5 }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	stdout := new(bytes.Buffer)
+	code := cpq([]string{"run", "--diagnostics-format", "sarif", infile}, strings.NewReader(""),
+		stdout, new(bytes.Buffer))
+
+	assert.EqualValues(t, ExitParse, code)
+	assert.Contains(t, stdout.String(), `"version": "2.1.0"`)
+	assert.Contains(t, stdout.String(), `"ruleId": "P001"`)
+}
+
+func TestDiagnosticsFormatInvalid(t *testing.T) {
+	code, stderr := runCpq(t, "", "--diagnostics-format=xml", "program.ou")
+	assert.EqualValues(t, ExitUsage, code)
+	assert.Contains(t, stderr, `Unknown diagnostics format "xml".`)
+}
+
+func runCpq(t *testing.T, input string, args ...string) (int, string) {
+	stderr := new(bytes.Buffer)
+	code := cpq(args, strings.NewReader(input), new(bytes.Buffer), stderr)
+	return code, stderr.String()
+}
+
+func writeSource(t *testing.T, code string) string {
+	dir, err := ioutil.TempDir("", "cpq")
+	assert.NoError(t, err)
+
+	infile := filepath.Join(dir, "program.ou")
+	assert.NoError(t, ioutil.WriteFile(infile, []byte(code), 0644))
+	return infile
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiffEqual(t *testing.T) {
+	assert.Empty(t, unifiedDiff("a", "b", "x\ny\n", "x\ny\n"))
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	new := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n15\nsixteen\n"
+
+	assert.EqualValues(t, `--- old
++++ new
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -11,5 +11,5 @@
+ 11
+ 12
+ 13
+-14
+ 15
++sixteen
+`, unifiedDiff("old", "new", old, new))
+}
+
+func TestUnifiedDiffMergesCloseChanges(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	new := "A\nb\nc\nd\ne\nf\ng\nH\n"
+
+	assert.EqualValues(t, `--- old
++++ new
+@@ -1,8 +1,8 @@
+-a
++A
+ b
+ c
+ d
+ e
+ f
+ g
+-h
++H
+`, unifiedDiff("old", "new", old, new))
+}
+
+func TestUnifiedDiffNoNewlineAtEnd(t *testing.T) {
+	assert.EqualValues(t, `--- old
++++ new
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`, unifiedDiff("old", "new", "a\nb", "a\nb\n"))
+
+	assert.EqualValues(t, `--- old
++++ new
+@@ -0,0 +1,1 @@
++a
+`, unifiedDiff("old", "new", "", "a\n"))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/format"
+)
+
+// fmtOptions are the flags of the fmt command.
+type fmtOptions struct {
+	write bool
+	check bool
+	diff  bool
+}
+
+// fmtCommand formats CPL files in the canonical style. Directories are searched for .ou
+// files recursively, and if no files are given the code is read from stdin.
+func fmtCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("cpq fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = usage(flags, stderr)
+
+	options := fmtOptions{}
+	flags.BoolVar(&options.write, "w", false, "write the result to the source files instead of stdout")
+	flags.BoolVar(&options.check, "check", false,
+		"list the files that aren't formatted, and fail if there are any")
+	flags.BoolVar(&options.diff, "diff", false, "print diffs instead of the formatted code")
+
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	if flags.NArg() == 0 {
+		if options.write {
+			fmt.Fprintln(stderr, "Cannot use -w with standard input.")
+			return ExitUsage
+		}
+
+		code, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, "Cannot read standard input.")
+			return ExitIO
+		}
+
+		return formatFile("<stdin>", string(code), options, stdout, stderr)
+	}
+
+	exitCode := ExitSuccess
+	for _, arg := range flags.Args() {
+		files, err := sourceFiles(arg)
+		if err != nil {
+			fmt.Fprintf(stderr, "Cannot open %s.\n", arg)
+			exitCode = worseExitCode(exitCode, ExitIO)
+			continue
+		}
+
+		if len(files) == 1 && files[0] == arg && path.Ext(arg) != ".ou" {
+			fmt.Fprintln(stderr, "Input file extension must be .ou")
+			return ExitUsage
+		}
+
+		for _, file := range files {
+			code, err := ioutil.ReadFile(file)
+			if err != nil {
+				fmt.Fprintf(stderr, "Cannot open %s.\n", file)
+				exitCode = worseExitCode(exitCode, ExitIO)
+				continue
+			}
+
+			exitCode = worseExitCode(exitCode, formatFile(file, string(code), options, stdout, stderr))
+		}
+	}
+
+	return exitCode
+}
+
+// formatFile formats the code of a single file, and reports the result according to
+// the options.
+func formatFile(filename string, code string, options fmtOptions, stdout io.Writer,
+	stderr io.Writer) int {
+	formatted, diagnostics := format.Source(code)
+	if diagnostic.HasErrors(diagnostics) {
+		renderer := diagnostic.NewRenderer(filename, code)
+		renderer.Color = isTerminal(stderr)
+		renderer.RenderAll(stderr, diagnostics)
+		return ExitParse
+	}
+
+	if !options.write && !options.check && !options.diff {
+		fmt.Fprint(stdout, formatted)
+		return ExitSuccess
+	}
+
+	if formatted == code {
+		return ExitSuccess
+	}
+
+	if options.check {
+		fmt.Fprintln(stdout, filename)
+	}
+
+	if options.diff {
+		fmt.Fprint(stdout, unifiedDiff(filename+".orig", filename, code, formatted))
+	}
+
+	if options.write {
+		info, err := os.Stat(filename)
+		if err == nil {
+			err = ioutil.WriteFile(filename, []byte(formatted), info.Mode().Perm())
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Cannot write %s.\n", filename)
+			return ExitIO
+		}
+	}
+
+	if options.check {
+		return ExitUnformatted
+	}
+
+	return ExitSuccess
+}
+
+// sourceFiles returns the .ou files in a directory and its subdirectories, or the path
+// itself if it's a file.
+func sourceFiles(root string) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+
+	files := []string{}
+	err = filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(file) == ".ou" {
+			files = append(files, file)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// worseExitCode combines the exit codes of two files. Errors take precedence over
+// unformatted files, and otherwise the first failure is kept.
+func worseExitCode(current int, next int) int {
+	if current == ExitSuccess || (current == ExitUnformatted && next != ExitSuccess) {
+		return next
+	}
+	return current
+}
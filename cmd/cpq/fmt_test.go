@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	unformattedSource = "a:int;\n{input(a);output(a*2);}\n"
+	formattedSource   = "a : int;\n\n{\n  input(a);\n  output(a * 2);\n}\n"
+)
+
+func TestFmtCommand(t *testing.T) {
+	infile := writeSource(t, unformattedSource)
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	stdout := new(bytes.Buffer)
+	code := cpq([]string{"fmt", infile}, strings.NewReader(""), stdout, new(bytes.Buffer))
+
+	assert.EqualValues(t, ExitSuccess, code)
+	assert.EqualValues(t, formattedSource, stdout.String())
+	assertFileContent(t, infile, unformattedSource)
+}
+
+func TestFmtCommandStdin(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	code := cpq([]string{"fmt"}, strings.NewReader(unformattedSource), stdout, new(bytes.Buffer))
+
+	assert.EqualValues(t, ExitSuccess, code)
+	assert.EqualValues(t, formattedSource, stdout.String())
+
+	code, stderr := runCpq(t, unformattedSource, "fmt", "-w")
+	assert.EqualValues(t, ExitUsage, code)
+	assert.Contains(t, stderr, "Cannot use -w with standard input.")
+}
+
+func TestFmtCommandWrite(t *testing.T) {
+	infile := writeSource(t, unformattedSource)
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	stdout := new(bytes.Buffer)
+	code := cpq([]string{"fmt", "-w", infile}, strings.NewReader(""), stdout, new(bytes.Buffer))
+
+	assert.EqualValues(t, ExitSuccess, code)
+	assert.Empty(t, stdout.String())
+	assertFileContent(t, infile, formattedSource)
+}
+
+func TestFmtCommandCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpq")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	unformatted := filepath.Join(dir, "nested", "unformatted.ou")
+	formatted := filepath.Join(dir, "formatted.ou")
+	assert.NoError(t, os.Mkdir(filepath.Dir(unformatted), 0755))
+	assert.NoError(t, ioutil.WriteFile(unformatted, []byte(unformattedSource), 0644))
+	assert.NoError(t, ioutil.WriteFile(formatted, []byte(formattedSource), 0644))
+
+	stdout := new(bytes.Buffer)
+	code := cpq([]string{"fmt", "--check", dir}, strings.NewReader(""), stdout, new(bytes.Buffer))
+
+	assert.EqualValues(t, ExitUnformatted, code)
+	assert.EqualValues(t, unformatted+"\n", stdout.String())
+	assertFileContent(t, unformatted, unformattedSource)
+
+	code, _ = runCpq(t, "", "fmt", "--check", formatted)
+	assert.EqualValues(t, ExitSuccess, code)
+}
+
+func TestFmtCommandDiff(t *testing.T) {
+	infile := writeSource(t, unformattedSource)
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	stdout := new(bytes.Buffer)
+	code := cpq([]string{"fmt", "--diff", infile}, strings.NewReader(""), stdout, new(bytes.Buffer))
+
+	assert.EqualValues(t, ExitSuccess, code)
+	assert.EqualValues(t, `--- `+infile+`.orig
++++ `+infile+`
+@@ -1,2 +1,6 @@
+-a:int;
+-{input(a);output(a*2);}
++a : int;
++
++{
++  input(a);
++  output(a * 2);
++}
+`, stdout.String())
+}
+
+func TestFmtCommandParseErrors(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ input(a) }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := cpq([]string{"fmt", "-w", infile}, strings.NewReader(""), stdout, stderr)
+
+	assert.EqualValues(t, ExitParse, code)
+	assert.Contains(t, stderr.String(), "error[P001]: found }, expected ;")
+	assertFileContent(t, infile, "a : int;\n{ input(a) }")
+}
+
+func TestFmtCommandInvalidFiles(t *testing.T) {
+	code, stderr := runCpq(t, "", "fmt", "program.c")
+	assert.EqualValues(t, ExitIO, code)
+	assert.Contains(t, stderr, "Cannot open program.c.")
+
+	infile := writeSource(t, "")
+	defer os.RemoveAll(filepath.Dir(infile))
+	other := filepath.Join(filepath.Dir(infile), "program.c")
+	assert.NoError(t, ioutil.WriteFile(other, []byte(formattedSource), 0644))
+
+	code, stderr = runCpq(t, "", "fmt", other)
+	assert.EqualValues(t, ExitUsage, code)
+	assert.Contains(t, stderr, "Input file extension must be .ou")
+}
+
+func assertFileContent(t *testing.T, filename string, expected string) {
+	content, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.EqualValues(t, expected, string(content))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/optimize"
+)
+
+// levelDescriptions describe the optimization levels in the usage of cpq.
+var levelDescriptions = [optimize.MaxLevel + 1]string{
+	"don't optimize the generated code (default)",
+	"fold constants and remove dead code",
+	"like -O1, and also reuse temporaries",
+}
+
+// optimizeOptions are the flags that select the optimization passes.
+type optimizeOptions struct {
+	level   int
+	enable  passList
+	disable passList
+}
+
+// register adds the optimization flags to a flag set. The level flags are boolean
+// flags named -O0, -O1 etc., and if more than one is given the last one wins.
+func (options *optimizeOptions) register(flags *flag.FlagSet) {
+	for level := 0; level <= optimize.MaxLevel; level++ {
+		flags.Var(levelFlag{&options.level, level}, fmt.Sprintf("O%d", level),
+			levelDescriptions[level])
+	}
+
+	names := []string{}
+	for _, pass := range optimize.Passes {
+		names = append(names, pass.Name)
+	}
+
+	flags.Var(&options.enable, "pass",
+		"run an optimization `pass` even if the level doesn't include it: "+
+			strings.Join(names, ", ")+" (can be repeated)")
+	flags.Var(&options.disable, "disable-pass",
+		"don't run an optimization `pass` of the level (can be repeated)")
+}
+
+// pipeline returns the optimization passes selected by the flags.
+func (options *optimizeOptions) pipeline() ([]optimize.Pass, error) {
+	return optimize.Pipeline(options.level, options.enable, options.disable)
+}
+
+// levelFlag is a boolean flag that sets the optimization level when it's given.
+type levelFlag struct {
+	level *int
+	value int
+}
+
+func (f levelFlag) String() string {
+	return ""
+}
+
+func (f levelFlag) Set(s string) error {
+	set, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if set {
+		*f.level = f.value
+	}
+	return nil
+}
+
+func (f levelFlag) IsBoolFlag() bool {
+	return true
+}
+
+// passList is a flag that collects pass names. It can be repeated, and every value
+// may contain several names separated by commas.
+type passList []string
+
+func (l *passList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *passList) Set(s string) error {
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*l = append(*l, name)
+		}
+	}
+	return nil
+}
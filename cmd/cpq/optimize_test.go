@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const optimizeSource = `a, b : int;
+{
+    input(a);
+    b = 2 * 3 + 0;
+    if (b > 5) output(a + b); else output(a);
+}`
+
+func TestOptimizeO0(t *testing.T) {
+	infile := writeSource(t, optimizeSource)
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	assert.EqualValues(t, ExitSuccess, cpq([]string{infile}, strings.NewReader(""),
+		new(bytes.Buffer), new(bytes.Buffer)))
+	unoptimized := readQuad(t, infile)
+
+	assert.EqualValues(t, ExitSuccess, cpq([]string{"-O0", infile}, strings.NewReader(""),
+		new(bytes.Buffer), new(bytes.Buffer)))
+	assert.EqualValues(t, unoptimized, readQuad(t, infile))
+
+	// The last level wins
+	assert.EqualValues(t, ExitSuccess, cpq([]string{"-O2", "-O0", infile},
+		strings.NewReader(""), new(bytes.Buffer), new(bytes.Buffer)))
+	assert.EqualValues(t, unoptimized, readQuad(t, infile))
+}
+
+func TestOptimizeO2(t *testing.T) {
+	infile := writeSource(t, optimizeSource)
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	assert.EqualValues(t, ExitSuccess, cpq([]string{infile}, strings.NewReader(""),
+		new(bytes.Buffer), new(bytes.Buffer)))
+	unoptimized := readQuad(t, infile)
+
+	assert.EqualValues(t, ExitSuccess, cpq([]string{"-O2", infile}, strings.NewReader(""),
+		new(bytes.Buffer), new(bytes.Buffer)))
+	optimized := readQuad(t, infile)
+	assert.True(t, len(optimized) < len(unoptimized))
+	assert.NotContains(t, optimized, "IMLT")
+
+	for _, args := range [][]string{{"run", infile}, {"run", "-O2", infile}} {
+		stdout := new(bytes.Buffer)
+		code := cpq(args, strings.NewReader("4\n"), stdout, new(bytes.Buffer))
+		assert.EqualValues(t, ExitSuccess, code)
+		assert.EqualValues(t, "10\n", stdout.String())
+	}
+}
+
+func TestOptimizePasses(t *testing.T) {
+	infile := writeSource(t, optimizeSource)
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	assert.EqualValues(t, ExitSuccess, cpq([]string{"--pass", "fold", infile},
+		strings.NewReader(""), new(bytes.Buffer), new(bytes.Buffer)))
+	folded := readQuad(t, infile)
+	assert.NotContains(t, folded, "IMLT")
+	assert.Contains(t, folded, "JMPZ")
+
+	assert.EqualValues(t, ExitSuccess, cpq([]string{"-O2", "--disable-pass=dce,temps", infile},
+		strings.NewReader(""), new(bytes.Buffer), new(bytes.Buffer)))
+	assert.EqualValues(t, folded, readQuad(t, infile))
+}
+
+func TestOptimizeUnknownPass(t *testing.T) {
+	code, stderr := runCpq(t, "", "--pass", "inline", "program.ou")
+	assert.EqualValues(t, ExitUsage, code)
+	assert.Contains(t, stderr, `unknown optimization pass "inline"`)
+}
+
+func readQuad(t *testing.T, infile string) string {
+	output, err := ioutil.ReadFile(strings.TrimSuffix(infile, ".ou") + ".qud")
+	assert.NoError(t, err)
+	return string(output)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/amd64"
+	"github.com/alongubkin/cpl-compiler/pkg/cgen"
+	"github.com/alongubkin/cpl-compiler/pkg/codegen"
+	"github.com/alongubkin/cpl-compiler/pkg/llvm"
+	"github.com/alongubkin/cpl-compiler/pkg/optimize"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/alongubkin/cpl-compiler/pkg/vm"
+	"github.com/alongubkin/cpl-compiler/pkg/wat"
+)
+
+// target is an output format of the compiler, selected with the --target flag.
+type target struct {
+	name        string
+	description string // Used in error messages
+	extension   string
+	// generate returns the content of the output file for a program that passed
+	// semantic analysis, and an exit code.
+	generate func(program *parser.Program, pipeline []optimize.Pass, stderr io.Writer) (string, int)
+	// run executes a program that passed semantic analysis for cpq run, and returns an
+	// exit code. It's nil if the target can't be executed.
+	run func(program *parser.Program, pipeline []optimize.Pass, stdin io.Reader,
+		stdout io.Writer, stderr io.Writer) int
+}
+
+// targets contains every output format. The first one is the default. Targets that are
+// generated from the AST instead of the Quad code ignore -O, --pass and --disable-pass.
+var targets = []target{
+	{"quad", "QUAD", ".qud", generateQuadFile, runQuad},
+	{"c", "C", ".c", generateCFile, nil},
+	{"wat", "WAT", ".wat", generateWATFile, nil},
+	{"x86_64", "assembly", ".s", generateAmd64File, nil},
+	{"llvm", "LLVM IR", ".ll", generateLLVMFile, nil},
+	{"vm", "bytecode", ".cplb", generateBytecodeFile, runBytecode},
+}
+
+// lookupTarget returns the target with the given name.
+func lookupTarget(name string) (target, bool) {
+	for _, t := range targets {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return target{}, false
+}
+
+// targetNames returns the names of all targets, for the usage of the --target flag.
+func targetNames() string {
+	names := []string{}
+	for _, t := range targets {
+		names = append(names, t.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func generateQuadFile(program *parser.Program, pipeline []optimize.Pass,
+	stderr io.Writer) (string, int) {
+	instructions, exitCode := generateQuad(program, pipeline, stderr)
+	if exitCode != ExitSuccess {
+		return "", exitCode
+	}
+
+	return quad.Format(instructions) + "\n" + Signature, ExitSuccess
+}
+
+// runQuad executes the optimized Quad code of a program with the Quad interpreter.
+func runQuad(program *parser.Program, pipeline []optimize.Pass, stdin io.Reader,
+	stdout io.Writer, stderr io.Writer) int {
+	instructions, exitCode := generateQuad(program, pipeline, stderr)
+	if exitCode != ExitSuccess {
+		return exitCode
+	}
+
+	// Runtime errors refer to the lines of the CPL code, like in the vm target, instead of
+	// the instruction numbers.
+	for i := range instructions {
+		instructions[i].Line = instructions[i].Position.Line + 1
+	}
+
+	interpreter := quad.NewInterpreter(instructions, stdin, stdout)
+	interpreter.Prompt = stderr
+	if err := interpreter.Run(); err != nil {
+		fmt.Fprintf(stderr, "RuntimeError: %s\n", err.Error())
+		return ExitRuntime
+	}
+	return ExitSuccess
+}
+
+// generateCFile generates C code from the AST.
+func generateCFile(program *parser.Program, pipeline []optimize.Pass,
+	stderr io.Writer) (string, int) {
+	return cgen.Generate(program), ExitSuccess
+}
+
+// generateWATFile generates a WebAssembly module in the text format from the AST.
+func generateWATFile(program *parser.Program, pipeline []optimize.Pass,
+	stderr io.Writer) (string, int) {
+	return wat.Generate(program), ExitSuccess
+}
+
+// generateAmd64File generates x86-64 assembly from the optimized Quad code. Like in
+// generateQuad, errors at this point are compiler bugs.
+func generateAmd64File(program *parser.Program, pipeline []optimize.Pass,
+	stderr io.Writer) (string, int) {
+	output, err := amd64.Generate(optimize.Run(codegen.Codegen(program), pipeline))
+	if err != nil {
+		fmt.Fprintf(stderr, "AssemblyError: %s\n", err.Error())
+		return "", ExitInternal
+	}
+
+	return output, ExitSuccess
+}
+
+// generateLLVMFile generates LLVM IR from the AST.
+func generateLLVMFile(program *parser.Program, pipeline []optimize.Pass,
+	stderr io.Writer) (string, int) {
+	return llvm.Generate(program), ExitSuccess
+}
+
+// generateBytecodeFile compiles the AST to bytecode that can be executed with cpq run.
+func generateBytecodeFile(program *parser.Program, pipeline []optimize.Pass,
+	stderr io.Writer) (string, int) {
+	return string(vm.Encode(vm.Compile(program))), ExitSuccess
+}
+
+// runBytecode compiles the AST to bytecode, and executes it with the VM.
+func runBytecode(program *parser.Program, pipeline []optimize.Pass, stdin io.Reader,
+	stdout io.Writer, stderr io.Writer) int {
+	return runVM(vm.Compile(program), stdin, stdout, stderr)
+}
+
+// runBytecodeFile executes a bytecode file written by the vm target.
+func runBytecodeFile(infile string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	data, err := ioutil.ReadFile(infile)
+	if err != nil {
+		fmt.Fprintln(stderr, "Cannot open input bytecode file.")
+		return ExitIO
+	}
+
+	program, err := vm.Decode(data)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid bytecode file: %s.\n", err.Error())
+		return ExitIO
+	}
+
+	return runVM(program, stdin, stdout, stderr)
+}
+
+func runVM(program *vm.Program, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	machine := vm.NewVM(program, stdin, stdout)
+	machine.Prompt = stderr
+	if err := machine.Run(); err != nil {
+		fmt.Fprintf(stderr, "RuntimeError: %s\n", err.Error())
+		return ExitRuntime
+	}
+	return ExitSuccess
+}
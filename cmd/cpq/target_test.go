@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetC(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ input(a); output(a * 2); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	code, _ := runCpq(t, "", "--target=c", infile)
+	assert.EqualValues(t, ExitSuccess, code)
+	assert.False(t, fileExists(strings.TrimSuffix(infile, ".ou")+".qud"))
+
+	output, err := ioutil.ReadFile(strings.TrimSuffix(infile, ".ou") + ".c")
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), "int main(void) {")
+	assert.Contains(t, string(output), "cpl_output_int(v_a * 2);")
+}
+
+func TestTargetWAT(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ input(a); output(a * 2); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	code, _ := runCpq(t, "", "--target=wat", infile)
+	assert.EqualValues(t, ExitSuccess, code)
+
+	output, err := ioutil.ReadFile(strings.TrimSuffix(infile, ".ou") + ".wat")
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), `(func $main (export "main")`)
+	assert.Contains(t, string(output), "(call $output_int (i64.mul (local.get $a) (i64.const 2)))")
+}
+
+func TestTargetQuad(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ a = 5; output(a); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	code, _ := runCpq(t, "", "--target", "quad", infile)
+	assert.EqualValues(t, ExitSuccess, code)
+	assert.EqualValues(t, "IASN a 5\nIPRT a\nHALT\n"+Signature, readQuad(t, infile))
+}
+
+func TestTargetInvalid(t *testing.T) {
+	code, stderr := runCpq(t, "", "--target=java", "program.ou")
+	assert.EqualValues(t, ExitUsage, code)
+	assert.Contains(t, stderr, `Unknown target "java".`)
+
+	code, stderr = runCpq(t, "", "run", "--target=c", "program.ou")
+	assert.EqualValues(t, ExitUsage, code)
+	assert.Contains(t, stderr, "Only Quad code and bytecode can be executed with cpq run.")
+}
+
+func TestTargetX86_64(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ input(a); output(a * 2); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	code, _ := runCpq(t, "", "--target=x86_64", "-O1", infile)
+	assert.EqualValues(t, ExitSuccess, code)
+
+	output, err := ioutil.ReadFile(strings.TrimSuffix(infile, ".ou") + ".s")
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), "\t.globl main\n")
+	assert.Contains(t, string(output), "\t# IMLT _t1 a 2\n")
+	assert.Contains(t, string(output), "\tcall cpl_output_int\n")
+}
+
+func TestTargetLLVM(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ input(a); output(a * 2); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	code, _ := runCpq(t, "", "--target=llvm", infile)
+	assert.EqualValues(t, ExitSuccess, code)
+
+	output, err := ioutil.ReadFile(strings.TrimSuffix(infile, ".ou") + ".ll")
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), "define i32 @main() {\n")
+	assert.Contains(t, string(output), "%t3 = mul i64 %t2, 2\n")
+	assert.Contains(t, string(output), "call void @cpl_output_int(i64 %t3)\n")
+}
+
+func TestTargetVM(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ input(a); output(a * 2); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	code, _ := runCpq(t, "", "--target=vm", infile)
+	assert.EqualValues(t, ExitSuccess, code)
+
+	outfile := strings.TrimSuffix(infile, ".ou") + ".cplb"
+	output, err := ioutil.ReadFile(outfile)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(output), "CPLB"))
+
+	// The bytecode file can be executed without the source
+	stdout := new(bytes.Buffer)
+	code = cpq([]string{"run", outfile}, strings.NewReader("21\n"), stdout, new(bytes.Buffer))
+	assert.EqualValues(t, ExitSuccess, code)
+	assert.EqualValues(t, "42\n", stdout.String())
+}
+
+func TestTargetVMRun(t *testing.T) {
+	infile := writeSource(t, "a : int;\n{ input(a); output(a * 2); output(5 / (a - 21)); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := cpq([]string{"run", "--target=vm", infile}, strings.NewReader("x\n21\n"), stdout,
+		stderr)
+	assert.EqualValues(t, ExitRuntime, code)
+	assert.EqualValues(t, "42\n", stdout.String())
+	assert.Contains(t, stderr.String(), "a (int)? Invalid input!\na (int)? ")
+	assert.Contains(t, stderr.String(), "RuntimeError: division by zero at line 2")
+}
+
+func TestRuntimeErrorLine(t *testing.T) {
+	infile := writeSource(t, "a, b: int;\n{ a = 5; b = 0; output(a / b); }")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	for _, args := range [][]string{{"run"}, {"run", "-O2"}, {"run", "--target=vm"}} {
+		stderr := new(bytes.Buffer)
+		code := cpq(append(args, infile), strings.NewReader(""), new(bytes.Buffer), stderr)
+		assert.EqualValues(t, ExitRuntime, code, args)
+		assert.Contains(t, stderr.String(), "RuntimeError: division by zero at line 2", args)
+	}
+}
+
+func TestTargetVMInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpq")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	infile := filepath.Join(dir, "program.cplb")
+	assert.NoError(t, ioutil.WriteFile(infile, []byte("IPRT 5\nHALT\n"), 0644))
+
+	code, stderr := runCpq(t, "", "run", infile)
+	assert.EqualValues(t, ExitIO, code)
+	assert.Contains(t, stderr, "Invalid bytecode file: not a CPL bytecode file.")
+
+	code, stderr = runCpq(t, "", "run", filepath.Join(dir, "missing.cplb"))
+	assert.EqualValues(t, ExitIO, code)
+	assert.Contains(t, stderr, "Cannot open input bytecode file.")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+)
+
+// tokensCommand prints the tokens of a CPL file, either as a table or as JSON.
+func tokensCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("cpq tokens", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = usage(flags, stderr)
+	asJSON := flags.Bool("json", false, "print the tokens as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	infile, code, exitCode := readSource(flags, stderr)
+	if exitCode != ExitSuccess {
+		return exitCode
+	}
+
+	tokens, lexErrors := lexer.Tokenize(strings.NewReader(code))
+
+	renderer := diagnostic.NewRenderer(infile, code)
+	renderer.Color = isTerminal(stderr)
+	renderer.RenderAll(stderr, lexErrors)
+
+	if *asJSON {
+		output, err := json.MarshalIndent(tokens, "", "  ")
+		if err != nil {
+			fmt.Fprintf(stderr, "Cannot encode tokens: %s\n", err.Error())
+			return ExitInternal
+		}
+		fmt.Fprintln(stdout, string(output))
+	} else {
+		// Positions are one-based, like in diagnostics.
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "POSITION\tTYPE\tLEXEME")
+		for _, token := range tokens {
+			fmt.Fprintf(w, "%d:%d\t%s\t%q\n", token.Position.Line+1, token.Position.Column+1,
+				token.TokenType.Name(), token.Lexeme)
+		}
+		w.Flush()
+	}
+
+	if diagnostic.HasErrors(lexErrors) {
+		return ExitParse
+	}
+
+	return ExitSuccess
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokensCommand(t *testing.T) {
+	infile := writeSource(t, "a : int;")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	stdout := new(bytes.Buffer)
+	code := cpq([]string{"tokens", infile}, strings.NewReader(""), stdout, new(bytes.Buffer))
+
+	assert.EqualValues(t, ExitSuccess, code)
+	assert.EqualValues(t, `POSITION  TYPE       LEXEME
+1:1       ID         "a"
+1:3       COLON      ":"
+1:5       INT        "int"
+1:8       SEMICOLON  ";"
+1:9       EOF        "EOF"
+`, stdout.String())
+}
+
+func TestTokensCommandJSON(t *testing.T) {
+	infile := writeSource(t, "a | b")
+	defer os.RemoveAll(filepath.Dir(infile))
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := cpq([]string{"tokens", "--json", infile}, strings.NewReader(""), stdout, stderr)
+	assert.EqualValues(t, ExitParse, code)
+	assert.Contains(t, stderr.String(), "error[L001]: illegal character '|'")
+
+	// The source is a single line of ASCII characters, so offsets equal columns.
+	at := func(column int) lexer.Position {
+		return lexer.Position{Line: 0, Column: column, Offset: column}
+	}
+
+	var tokens []lexer.Token
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &tokens))
+	assert.EqualValues(t, []lexer.Token{
+		{TokenType: lexer.ID, Lexeme: "a", Position: at(0), End: at(1)},
+		{TokenType: lexer.ILLEGAL, Lexeme: "|", Position: at(2), End: at(3)},
+		{TokenType: lexer.ID, Lexeme: "b", Position: at(4), End: at(5)},
+		{TokenType: lexer.EOF, Lexeme: "EOF", Position: at(5), End: at(5)},
+	}, tokens)
+}
@@ -0,0 +1,384 @@
+// Package amd64 translates Quad code to x86-64 assembly in GNU assembler syntax, for
+// Linux and other systems that use the System V ABI. The output can be assembled and
+// linked with the C library using gcc or clang.
+//
+// Every Quad variable and temporary is stored in its own 8 byte slot in the .bss
+// section, so they start at 0. Each instruction loads its operands to registers,
+// computes its result and stores it back: ints use %rax and %rcx, and floats use
+// %xmm0 and %xmm1 with SSE2 instructions. Input and output go through small runtime
+// functions that call scanf and printf, and print floats like the Quad interpreter.
+// Division by zero and invalid input stop the program with a runtime error.
+package amd64
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+)
+
+// Generator translates labeled Quad instructions to assembly.
+type Generator struct {
+	text      strings.Builder
+	slots     []string
+	slotNames map[string]bool
+	constants []uint64
+	used      map[string]bool
+
+	// divides is true if the program divides, so it needs the division by zero handler.
+	divides bool
+}
+
+// NewGenerator returns a new instance of Generator.
+func NewGenerator() *Generator {
+	return &Generator{
+		slots:     []string{},
+		slotNames: map[string]bool{},
+		constants: []uint64{},
+		used:      map[string]bool{},
+	}
+}
+
+// Generate translates Quad code to an assembly file with a main function. The code must
+// use labels as jump targets, like the code that codegen generates, and not instruction
+// numbers.
+func Generate(instructions []quad.Instruction) (string, error) {
+	return NewGenerator().GenerateProgram(instructions)
+}
+
+// GenerateProgram translates Quad code to an assembly file with a main function.
+func (g *Generator) GenerateProgram(instructions []quad.Instruction) (string, error) {
+	for _, instruction := range instructions {
+		if err := g.GenerateInstruction(instruction); err != nil {
+			return "", err
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\t.text\n")
+	for _, function := range runtime {
+		if g.used[function.name] {
+			b.WriteString(function.source)
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("\t.globl main\n\t.type main, @function\nmain:\n")
+	b.WriteString("\tpushq %rbp\n\tmovq %rsp, %rbp\n")
+	b.WriteString(g.text.String())
+	b.WriteString(".Lhalt:\n\txorl %eax, %eax\n\tpopq %rbp\n\tret\n")
+	if g.divides {
+		b.WriteString(".Ldivision_by_zero:\n")
+		b.WriteString("\tleaq .Ldivision_by_zero_message(%rip), %rdi\n\tcall cpl_error\n")
+	}
+	b.WriteString("\t.size main, .-main\n")
+
+	if g.divides || len(g.constants) > 0 {
+		b.WriteString("\n\t.section .rodata\n")
+	}
+	if g.divides {
+		b.WriteString(".Ldivision_by_zero_message:\n\t.string \"division by zero\"\n")
+	}
+	if len(g.constants) > 0 {
+		b.WriteString("\t.align 8\n")
+	}
+	for i, bits := range g.constants {
+		fmt.Fprintf(&b, ".Lfloat%d:\n\t.quad %#x # %v\n", i, bits, math.Float64frombits(bits))
+	}
+
+	if len(g.slots) > 0 {
+		b.WriteString("\n\t.bss\n\t.align 8\n")
+	}
+	for _, slot := range g.slots {
+		fmt.Fprintf(&b, "%s:\n\t.zero 8\n", slot)
+	}
+
+	b.WriteString("\n\t.section .note.GNU-stack,\"\",@progbits\n")
+	return b.String(), nil
+}
+
+// GenerateInstruction translates a single Quad instruction. Every instruction is
+// preceded by a comment with its Quad code.
+func (g *Generator) GenerateInstruction(instruction quad.Instruction) error {
+	if err := validate(instruction); err != nil {
+		return err
+	}
+
+	if instruction.Opcode == quad.LABEL {
+		g.line("%s:", labelName(instruction.Operands[0]))
+		return nil
+	}
+
+	g.line("\t# %s", instruction)
+	operands := instruction.Operands
+
+	switch instruction.Opcode {
+	case quad.IASN:
+		g.loadInt(operands[1], "%rax")
+		g.storeInt("%rax", operands[0])
+
+	case quad.RASN:
+		g.loadFloat(operands[1], "%xmm0")
+		g.storeFloat("%xmm0", operands[0])
+
+	case quad.IPRT:
+		g.loadInt(operands[0], "%rdi")
+		g.call(outputIntFunction)
+
+	case quad.RPRT:
+		g.loadFloat(operands[0], "%xmm0")
+		g.call(outputFloatFunction)
+
+	case quad.IINP:
+		g.call(inputIntFunction)
+		g.storeInt("%rax", operands[0])
+
+	case quad.RINP:
+		g.call(inputFloatFunction)
+		g.storeFloat("%xmm0", operands[0])
+
+	case quad.IADD, quad.ISUB, quad.IMLT:
+		mnemonics := map[quad.Opcode]string{quad.IADD: "addq", quad.ISUB: "subq", quad.IMLT: "imulq"}
+		g.loadInt(operands[1], "%rax")
+		g.loadInt(operands[2], "%rcx")
+		g.line("\t%s %%rcx, %%rax", mnemonics[instruction.Opcode])
+		g.storeInt("%rax", operands[0])
+
+	case quad.IDIV:
+		// idiv faults when dividing the smallest int by -1, so negate instead, which
+		// wraps around like in Quad.
+		g.divides = true
+		g.use(errorFunction)
+		g.loadInt(operands[1], "%rax")
+		g.loadInt(operands[2], "%rcx")
+		g.line("\ttestq %%rcx, %%rcx")
+		g.line("\tjz .Ldivision_by_zero")
+		g.line("\tcmpq $-1, %%rcx")
+		g.line("\tjne 1f")
+		g.line("\tnegq %%rax")
+		g.line("\tjmp 2f")
+		g.line("1:")
+		g.line("\tcqto")
+		g.line("\tidivq %%rcx")
+		g.line("2:")
+		g.storeInt("%rax", operands[0])
+
+	case quad.RADD, quad.RSUB, quad.RMLT:
+		mnemonics := map[quad.Opcode]string{quad.RADD: "addsd", quad.RSUB: "subsd", quad.RMLT: "mulsd"}
+		g.loadFloat(operands[1], "%xmm0")
+		g.loadFloat(operands[2], "%xmm1")
+		g.line("\t%s %%xmm1, %%xmm0", mnemonics[instruction.Opcode])
+		g.storeFloat("%xmm0", operands[0])
+
+	case quad.RDIV:
+		// NaN isn't equal to 0, so the parity flag of an unordered comparison skips the
+		// division by zero check.
+		g.divides = true
+		g.use(errorFunction)
+		g.loadFloat(operands[1], "%xmm0")
+		g.loadFloat(operands[2], "%xmm1")
+		g.line("\txorpd %%xmm2, %%xmm2")
+		g.line("\tucomisd %%xmm2, %%xmm1")
+		g.line("\tjp 1f")
+		g.line("\tje .Ldivision_by_zero")
+		g.line("1:")
+		g.line("\tdivsd %%xmm1, %%xmm0")
+		g.storeFloat("%xmm0", operands[0])
+
+	case quad.IEQL, quad.INQL, quad.ILSS, quad.IGRT:
+		conditions := map[quad.Opcode]string{quad.IEQL: "e", quad.INQL: "ne", quad.ILSS: "l",
+			quad.IGRT: "g"}
+		g.loadInt(operands[1], "%rax")
+		g.loadInt(operands[2], "%rcx")
+		g.line("\tcmpq %%rcx, %%rax")
+		g.line("\tset%s %%al", conditions[instruction.Opcode])
+		g.line("\tmovzbq %%al, %%rax")
+		g.storeInt("%rax", operands[0])
+
+	case quad.REQL, quad.RNQL, quad.RLSS, quad.RGRT:
+		g.loadFloat(operands[1], "%xmm0")
+		g.loadFloat(operands[2], "%xmm1")
+		g.generateFloatComparison(instruction.Opcode)
+		g.line("\tmovzbq %%al, %%rax")
+		g.storeInt("%rax", operands[0])
+
+	case quad.ITOR:
+		g.loadInt(operands[1], "%rax")
+		g.line("\tcvtsi2sdq %%rax, %%xmm0")
+		g.storeFloat("%xmm0", operands[0])
+
+	case quad.RTOI:
+		g.loadFloat(operands[1], "%xmm0")
+		g.line("\tcvttsd2siq %%xmm0, %%rax")
+		g.storeInt("%rax", operands[0])
+
+	case quad.JUMP:
+		g.line("\tjmp %s", labelName(operands[0]))
+
+	case quad.JMPZ:
+		g.loadInt(operands[1], "%rax")
+		g.line("\ttestq %%rax, %%rax")
+		g.line("\tjz %s", labelName(operands[0]))
+
+	case quad.HALT:
+		g.line("\tjmp .Lhalt")
+	}
+
+	return nil
+}
+
+// generateFloatComparison compares %xmm0 with %xmm1, and sets %al to the result.
+// Comparisons with NaN are unordered: they set the parity flag, and are always false
+// except for RNQL.
+func (g *Generator) generateFloatComparison(opcode quad.Opcode) {
+	switch opcode {
+	case quad.REQL:
+		g.line("\tucomisd %%xmm1, %%xmm0")
+		g.line("\tsete %%al")
+		g.line("\tsetnp %%cl")
+		g.line("\tandb %%cl, %%al")
+	case quad.RNQL:
+		g.line("\tucomisd %%xmm1, %%xmm0")
+		g.line("\tsetne %%al")
+		g.line("\tsetp %%cl")
+		g.line("\torb %%cl, %%al")
+	case quad.RLSS:
+		// a < b is computed as b > a, because "above" is false for unordered operands.
+		g.line("\tucomisd %%xmm0, %%xmm1")
+		g.line("\tseta %%al")
+	case quad.RGRT:
+		g.line("\tucomisd %%xmm1, %%xmm0")
+		g.line("\tseta %%al")
+	}
+}
+
+// loadInt loads an int operand to a register.
+func (g *Generator) loadInt(operand quad.Operand, register string) {
+	switch {
+	case operand.Kind != quad.IntLiteral:
+		g.line("\tmovq %s(%%rip), %s", g.slot(operand), register)
+	case operand.Int >= math.MinInt32 && operand.Int <= math.MaxInt32:
+		g.line("\tmovq $%d, %s", operand.Int, register)
+	default:
+		g.line("\tmovabsq $%d, %s", operand.Int, register)
+	}
+}
+
+// loadFloat loads a float operand to an SSE register. Float literals are loaded from
+// constants in the read-only data section.
+func (g *Generator) loadFloat(operand quad.Operand, register string) {
+	if operand.Kind == quad.FloatLiteral {
+		g.line("\tmovsd %s(%%rip), %s", g.constant(operand.Float), register)
+		return
+	}
+	g.line("\tmovsd %s(%%rip), %s", g.slot(operand), register)
+}
+
+// storeInt stores a register in the slot of a variable.
+func (g *Generator) storeInt(register string, operand quad.Operand) {
+	g.line("\tmovq %s, %s(%%rip)", register, g.slot(operand))
+}
+
+// storeFloat stores an SSE register in the slot of a variable.
+func (g *Generator) storeFloat(register string, operand quad.Operand) {
+	g.line("\tmovsd %s, %s(%%rip)", register, g.slot(operand))
+}
+
+// call calls a runtime function. The stack is always aligned to 16 bytes in main.
+func (g *Generator) call(function string) {
+	g.use(function)
+	g.line("\tcall %s", function)
+}
+
+// use marks a runtime function, and the functions it calls, as used by the program.
+func (g *Generator) use(name string) {
+	for _, function := range runtime {
+		if function.name == name {
+			g.used[name] = true
+			for _, dependency := range function.dependencies {
+				g.use(dependency)
+			}
+		}
+	}
+}
+
+// slot returns the name of the slot that stores a variable or a temporary. The prefixes
+// keep the names from clashing with each other and with the names of functions.
+func (g *Generator) slot(operand quad.Operand) string {
+	name := "v_" + operand.Name
+	if operand.Kind == quad.Temporary {
+		name = fmt.Sprintf("t_%d", operand.Index)
+	}
+
+	if !g.slotNames[name] {
+		g.slotNames[name] = true
+		g.slots = append(g.slots, name)
+	}
+	return name
+}
+
+// constant returns the label of a float constant with the given value.
+func (g *Generator) constant(value float64) string {
+	bits := math.Float64bits(value)
+	for i, existing := range g.constants {
+		if existing == bits {
+			return fmt.Sprintf(".Lfloat%d", i)
+		}
+	}
+
+	g.constants = append(g.constants, bits)
+	return fmt.Sprintf(".Lfloat%d", len(g.constants)-1)
+}
+
+// line writes a line of assembly.
+func (g *Generator) line(format string, args ...interface{}) {
+	fmt.Fprintf(&g.text, format, args...)
+	g.text.WriteString("\n")
+}
+
+func labelName(label quad.Operand) string {
+	return fmt.Sprintf(".L%d", label.Index)
+}
+
+// validate makes sure the operands of an instruction can be translated: jump targets
+// must be labels, destinations must be variables or temporaries, and int and float
+// literals can only be used by instructions of their type.
+func validate(instruction quad.Instruction) error {
+	operands := instruction.Operands
+	if instruction.Opcode == quad.ILLEGAL || instruction.Opcode.String() == "" {
+		return fmt.Errorf("invalid opcode %d", instruction.Opcode)
+	}
+	if len(operands) != quad.OperandCount(instruction.Opcode) {
+		return fmt.Errorf("%s: expected %d operands", instruction.Opcode,
+			quad.OperandCount(instruction.Opcode))
+	}
+
+	for i, operand := range operands {
+		var valid bool
+		switch {
+		case instruction.Opcode == quad.LABEL || (i == 0 && (instruction.Opcode == quad.JUMP ||
+			instruction.Opcode == quad.JMPZ)):
+			valid = operand.Kind == quad.Label
+		case i == 0 && instruction.Opcode != quad.IPRT && instruction.Opcode != quad.RPRT:
+			valid = operand.Kind == quad.Variable || operand.Kind == quad.Temporary
+		case operand.Kind == quad.IntLiteral:
+			valid = !readsFloat(instruction.Opcode)
+		case operand.Kind == quad.FloatLiteral:
+			valid = readsFloat(instruction.Opcode)
+		default:
+			valid = operand.Kind == quad.Variable || operand.Kind == quad.Temporary
+		}
+
+		if !valid {
+			return fmt.Errorf("%s: invalid operand '%s'", instruction, operand)
+		}
+	}
+
+	return nil
+}
+
+// readsFloat returns true if the source operands of an instruction are floats.
+func readsFloat(opcode quad.Opcode) bool {
+	return (opcode >= quad.RASN && opcode <= quad.RDIV) || opcode == quad.RTOI
+}
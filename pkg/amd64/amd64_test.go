@@ -0,0 +1,333 @@
+package amd64_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/amd64"
+	"github.com/alongubkin/cpl-compiler/pkg/codegen"
+	"github.com/alongubkin/cpl-compiler/pkg/internal/cpltest"
+	"github.com/alongubkin/cpl-compiler/pkg/optimize"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, code string) []quad.Instruction {
+	instructions, err := quad.Parse(strings.NewReader(code))
+	assert.NoError(t, err)
+	return instructions
+}
+
+// mainBody returns the instructions of the generated main function, without the
+// prologue and the epilogue.
+func mainBody(t *testing.T, code string) string {
+	output, err := amd64.Generate(parse(t, code))
+	assert.NoError(t, err)
+
+	prologue := "main:\n\tpushq %rbp\n\tmovq %rsp, %rbp\n"
+	start := strings.Index(output, prologue)
+	end := strings.Index(output, ".Lhalt:\n")
+	if !assert.True(t, start >= 0 && end > start) {
+		return ""
+	}
+	return output[start+len(prologue) : end]
+}
+
+func TestGenerateProgram(t *testing.T) {
+	output, err := amd64.Generate(parse(t, "IASN a 5\nIPRT a\nHALT"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(output, "\t.text\n\t.section .rodata\n.Lint_output_format:\n"))
+	assert.Contains(t, output, "cpl_output_int:\n")
+	assert.NotContains(t, output, "cpl_error")
+	assert.NotContains(t, output, "cpl_input_int")
+	assert.True(t, strings.HasSuffix(output, `	.globl main
+	.type main, @function
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	# IASN a 5
+	movq $5, %rax
+	movq %rax, v_a(%rip)
+	# IPRT a
+	movq v_a(%rip), %rdi
+	call cpl_output_int
+	# HALT
+	jmp .Lhalt
+.Lhalt:
+	xorl %eax, %eax
+	popq %rbp
+	ret
+	.size main, .-main
+
+	.bss
+	.align 8
+v_a:
+	.zero 8
+
+	.section .note.GNU-stack,"",@progbits
+`), output)
+}
+
+func TestGenerateRuntimeDependencies(t *testing.T) {
+	output, err := amd64.Generate(parse(t, "RINP x\nHALT"))
+	assert.NoError(t, err)
+	assert.Contains(t, output, "cpl_input_float:\n")
+	assert.Contains(t, output, "cpl_error:\n")
+	assert.NotContains(t, output, "cpl_output_float:\n")
+	assert.NotContains(t, output, ".Ldivision_by_zero")
+
+	output, err = amd64.Generate(parse(t, "IDIV a a 2\nHALT"))
+	assert.NoError(t, err)
+	assert.Contains(t, output, "cpl_error:\n")
+	assert.Contains(t, output, ".Ldivision_by_zero:\n")
+	assert.Contains(t, output, ".Ldivision_by_zero_message:\n\t.string \"division by zero\"\n")
+}
+
+func TestGenerateIntArithmetic(t *testing.T) {
+	assert.EqualValues(t, `	# IMLT _t1 a 3000000000
+	movq v_a(%rip), %rax
+	movabsq $3000000000, %rcx
+	imulq %rcx, %rax
+	movq %rax, t_1(%rip)
+	# ISUB a _t1 40
+	movq t_1(%rip), %rax
+	movq $40, %rcx
+	subq %rcx, %rax
+	movq %rax, v_a(%rip)
+	# IDIV a 7 a
+	movq $7, %rax
+	movq v_a(%rip), %rcx
+	testq %rcx, %rcx
+	jz .Ldivision_by_zero
+	cmpq $-1, %rcx
+	jne 1f
+	negq %rax
+	jmp 2f
+1:
+	cqto
+	idivq %rcx
+2:
+	movq %rax, v_a(%rip)
+	# ILSS _t2 a 0
+	movq v_a(%rip), %rax
+	movq $0, %rcx
+	cmpq %rcx, %rax
+	setl %al
+	movzbq %al, %rax
+	movq %rax, t_2(%rip)
+	# HALT
+	jmp .Lhalt
+`, mainBody(t, "IMLT _t1 a 3000000000\nISUB a _t1 40\nIDIV a 7 a\nILSS _t2 a 0\nHALT"))
+}
+
+func TestGenerateFloatArithmetic(t *testing.T) {
+	output, err := amd64.Generate(parse(t, "RADD x x 2.5\nRDIV y 2.5 x\nRLSS _t1 x y\nHALT"))
+	assert.NoError(t, err)
+	assert.Contains(t, output, `	# RADD x x 2.500000
+	movsd v_x(%rip), %xmm0
+	movsd .Lfloat0(%rip), %xmm1
+	addsd %xmm1, %xmm0
+	movsd %xmm0, v_x(%rip)
+	# RDIV y 2.500000 x
+	movsd .Lfloat0(%rip), %xmm0
+	movsd v_x(%rip), %xmm1
+	xorpd %xmm2, %xmm2
+	ucomisd %xmm2, %xmm1
+	jp 1f
+	je .Ldivision_by_zero
+1:
+	divsd %xmm1, %xmm0
+	movsd %xmm0, v_y(%rip)
+	# RLSS _t1 x y
+	movsd v_x(%rip), %xmm0
+	movsd v_y(%rip), %xmm1
+	ucomisd %xmm0, %xmm1
+	seta %al
+	movzbq %al, %rax
+	movq %rax, t_1(%rip)
+`)
+
+	// Float literals with the same value share a constant.
+	assert.Equal(t, 1, strings.Count(output, ".Lfloat0:\n"))
+	assert.NotContains(t, output, ".Lfloat1")
+	assert.Contains(t, output, ".Lfloat0:\n\t.quad 0x4004000000000000 # 2.5\n")
+}
+
+func TestGenerateConversions(t *testing.T) {
+	assert.EqualValues(t, `	# ITOR x a
+	movq v_a(%rip), %rax
+	cvtsi2sdq %rax, %xmm0
+	movsd %xmm0, v_x(%rip)
+	# RTOI a x
+	movsd v_x(%rip), %xmm0
+	cvttsd2siq %xmm0, %rax
+	movq %rax, v_a(%rip)
+	# HALT
+	jmp .Lhalt
+`, mainBody(t, "ITOR x a\nRTOI a x\nHALT"))
+}
+
+func TestGenerateControlFlow(t *testing.T) {
+	assert.EqualValues(t, `.L1:
+	# JMPZ @2 a
+	movq v_a(%rip), %rax
+	testq %rax, %rax
+	jz .L2
+	# JUMP @1
+	jmp .L1
+.L2:
+	# HALT
+	jmp .Lhalt
+`, mainBody(t, "@1:\nJMPZ @2 a\nJUMP @1\n@2:\nHALT"))
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		code  string
+		error string
+	}{
+		{"JUMP 1\nHALT", "JUMP 1: invalid operand '1'"},
+		{"IASN 5 a\nHALT", "IASN 5 a: invalid operand '5'"},
+		{"IADD a b 2.5\nHALT", "IADD a b 2.500000: invalid operand '2.500000'"},
+		{"RADD x y 2\nHALT", "RADD x y 2: invalid operand '2'"},
+	}
+
+	for _, test := range tests {
+		_, err := amd64.Generate(parse(t, test.code))
+		assert.EqualError(t, err, test.error, test.code)
+	}
+
+	_, err := amd64.Generate([]quad.Instruction{{Opcode: quad.LABEL}})
+	assert.EqualError(t, err, "LABEL: expected 1 operands")
+}
+
+// build assembles and links the assembly of Quad code, and returns the path of the
+// executable.
+func build(t *testing.T, dir string, instructions []quad.Instruction) string {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("a C compiler is required to assemble the generated code")
+	}
+
+	output, err := amd64.Generate(instructions)
+	assert.NoError(t, err)
+
+	source := filepath.Join(dir, "program.s")
+	binary := filepath.Join(dir, "program")
+	assert.NoError(t, ioutil.WriteFile(source, []byte(output), 0644))
+
+	result, err := exec.Command(cc, "-o", binary, source).CombinedOutput()
+	assert.NoError(t, err, string(result))
+	return binary
+}
+
+func TestGenerateExamples(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amd64")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pipeline, err := optimize.Pipeline(optimize.MaxLevel, nil, nil)
+	assert.NoError(t, err)
+
+	for _, example := range cpltest.Examples(t) {
+		instructions := codegen.Codegen(example.Program)
+		for _, instructions := range [][]quad.Instruction{
+			instructions,
+			optimize.Run(instructions, pipeline),
+		} {
+			stdout, stderr, err := cpltest.Run(exec.Command(build(t, dir, instructions)),
+				example.Input)
+			assert.NoError(t, err, example.Name)
+			assert.Empty(t, stderr, example.Name)
+			assert.EqualValues(t, example.Output, stdout, example.Name)
+		}
+	}
+}
+
+func TestGenerateFloatOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amd64")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	instructions := codegen.Codegen(cpltest.Analyze(t, `x, y : float;
+{
+    output(0.1 + 0.2);
+    output(10000000000000000.0);
+    output(1000000000000000.0);
+    output(0.00001);
+    output(0.0001);
+    output(123456789.125);
+    output(1 / 3.0);
+    output(0.0 - 2.5);
+    input(x);
+    output(x * x);
+    output(0.0 - x * x);
+    y = x * x - x * x;
+    output(y);
+    if (y == y) output(1); else output(0);
+    if (y != y) output(1); else output(0);
+    if (y < 1.0) output(1); else output(0);
+    if (y > 1.0) output(1); else output(0);
+}`))
+
+	stdout, _, err := cpltest.Run(exec.Command(build(t, dir, instructions)), "1e200\n")
+	assert.NoError(t, err)
+	assert.EqualValues(t, cpltest.Interpret(t, instructions, "1e200\n"), stdout)
+}
+
+func TestGenerateIntOverflow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amd64")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	instructions := codegen.Codegen(cpltest.Analyze(t, `a : int;
+{
+    input(a);
+    output(a / (0 - 1));
+    output(a * 2);
+    output(a - 1);
+}`))
+
+	const input = "-9223372036854775808\n"
+	stdout, _, err := cpltest.Run(exec.Command(build(t, dir, instructions)), input)
+	assert.NoError(t, err)
+	assert.EqualValues(t, cpltest.Interpret(t, instructions, input), stdout)
+}
+
+func TestGenerateRuntimeErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amd64")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	binary := build(t, dir, codegen.Codegen(cpltest.Analyze(t, `a : int;
+x : float;
+{
+    input(a);
+    output(10 / a);
+    input(x);
+    output(x / (x - 1));
+}`)))
+
+	tests := []struct {
+		input  string
+		stdout string
+		stderr string
+	}{
+		{"4\n0.5\n", "2\n-1.0\n", ""},
+		{"0\n", "", "RuntimeError: division by zero\n"},
+		{"4\n1\n", "2\n", "RuntimeError: division by zero\n"},
+		{"4\nabc\n", "2\n", "RuntimeError: invalid input\n"},
+		{"abc\n", "", "RuntimeError: invalid input\n"},
+	}
+
+	for _, test := range tests {
+		stdout, stderr, err := cpltest.Run(exec.Command(binary), test.input)
+		assert.Equal(t, test.stderr == "", err == nil, test.input)
+		assert.EqualValues(t, test.stdout, stdout, test.input)
+		assert.EqualValues(t, test.stderr, stderr, test.input)
+	}
+}
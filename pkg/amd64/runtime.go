@@ -0,0 +1,210 @@
+package amd64
+
+// Runtime functions that the generated code may call. Only the functions that a program
+// uses are written to its output.
+const (
+	errorFunction       = "cpl_error"
+	inputIntFunction    = "cpl_input_int"
+	inputFloatFunction  = "cpl_input_float"
+	outputIntFunction   = "cpl_output_int"
+	outputFloatFunction = "cpl_output_float"
+)
+
+// runtimeFunction is the assembly source of a runtime function, and the runtime
+// functions it calls. Every function follows the System V calling convention, and
+// defines its own read-only data.
+type runtimeFunction struct {
+	name         string
+	dependencies []string
+	source       string
+}
+
+// runtime contains every runtime function, in the order they're written.
+var runtime = []runtimeFunction{
+	// cpl_error(message) prints a runtime error to stderr, and exits with status 1.
+	{errorFunction, nil, `	.section .rodata
+.Lerror_format:
+	.string "RuntimeError: %s\n"
+	.text
+cpl_error:
+	pushq %rbp
+	movq %rsp, %rbp
+	movq %rdi, %rdx
+	movl $2, %edi
+	leaq .Lerror_format(%rip), %rsi
+	xorl %eax, %eax
+	call dprintf@PLT
+	movl $1, %edi
+	call exit@PLT
+`},
+
+	// cpl_input_int() reads an int from stdin, and returns it in %rax.
+	{inputIntFunction, []string{errorFunction}, `	.section .rodata
+.Lint_input_format:
+	.string "%ld"
+.Linvalid_int_input:
+	.string "invalid input"
+	.text
+cpl_input_int:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	leaq .Lint_input_format(%rip), %rdi
+	leaq -8(%rbp), %rsi
+	xorl %eax, %eax
+	call scanf@PLT
+	cmpl $1, %eax
+	je 1f
+	leaq .Linvalid_int_input(%rip), %rdi
+	call cpl_error
+1:
+	movq -8(%rbp), %rax
+	leave
+	ret
+`},
+
+	// cpl_input_float() reads a float from stdin, and returns it in %xmm0.
+	{inputFloatFunction, []string{errorFunction}, `	.section .rodata
+.Lfloat_input_format:
+	.string "%lf"
+.Linvalid_float_input:
+	.string "invalid input"
+	.text
+cpl_input_float:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	leaq .Lfloat_input_format(%rip), %rdi
+	leaq -8(%rbp), %rsi
+	xorl %eax, %eax
+	call scanf@PLT
+	cmpl $1, %eax
+	je 1f
+	leaq .Linvalid_float_input(%rip), %rdi
+	call cpl_error
+1:
+	movsd -8(%rbp), %xmm0
+	leave
+	ret
+`},
+
+	// cpl_output_int(value) prints the int in %rdi.
+	{outputIntFunction, nil, `	.section .rodata
+.Lint_output_format:
+	.string "%ld\n"
+	.text
+cpl_output_int:
+	pushq %rbp
+	movq %rsp, %rbp
+	movq %rdi, %rsi
+	leaq .Lint_output_format(%rip), %rdi
+	xorl %eax, %eax
+	call printf@PLT
+	popq %rbp
+	ret
+`},
+
+	// cpl_output_float(value) prints the float in %xmm0 like the Quad interpreter: the
+	// shortest representation that round-trips, always with a decimal point or an
+	// exponent. It finds the shortest precision that round-trips with snprintf and
+	// strtod, and then uses the exponent to choose between the fixed and the scientific
+	// notation. %rbx holds the precision, -16(%rbp) the value and -48(%rbp) a buffer.
+	{outputFloatFunction, nil, `	.section .rodata
+.Lexponent_format:
+	.string "%.*e"
+.Lfixed_format:
+	.string "%.*f\n"
+.Lwhole_format:
+	.string "%.0f.0\n"
+.Lnan:
+	.string "nan"
+.Linf:
+	.string "inf"
+.Lnegative_inf:
+	.string "-inf"
+	.text
+cpl_output_float:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	subq $56, %rsp
+	movsd %xmm0, -16(%rbp)
+
+	ucomisd %xmm0, %xmm0
+	jp .Loutput_nan
+	movq %xmm0, %rax
+	btrq $63, %rax
+	movabsq $0x7ff0000000000000, %rcx
+	cmpq %rcx, %rax
+	je .Loutput_inf
+
+	xorl %ebx, %ebx
+.Lfind_precision:
+	leaq -48(%rbp), %rdi
+	movl $32, %esi
+	leaq .Lexponent_format(%rip), %rdx
+	movl %ebx, %ecx
+	movsd -16(%rbp), %xmm0
+	movl $1, %eax
+	call snprintf@PLT
+	leaq -48(%rbp), %rdi
+	xorl %esi, %esi
+	call strtod@PLT
+	ucomisd -16(%rbp), %xmm0
+	je .Lprecision_found
+	incl %ebx
+	cmpl $17, %ebx
+	jl .Lfind_precision
+
+.Lprecision_found:
+	leaq -48(%rbp), %rdi
+	movl $'e', %esi
+	call strchr@PLT
+	leaq 1(%rax), %rdi
+	call atoi@PLT
+	cmpl $-4, %eax
+	jl .Loutput_exponent
+	cmpl $16, %eax
+	jge .Loutput_exponent
+	cmpl %eax, %ebx
+	jle .Loutput_whole
+
+	subl %eax, %ebx
+	leaq .Lfixed_format(%rip), %rdi
+	movl %ebx, %esi
+	movsd -16(%rbp), %xmm0
+	movl $1, %eax
+	call printf@PLT
+	jmp .Loutput_done
+
+.Loutput_whole:
+	leaq .Lwhole_format(%rip), %rdi
+	movsd -16(%rbp), %xmm0
+	movl $1, %eax
+	call printf@PLT
+	jmp .Loutput_done
+
+.Loutput_exponent:
+	leaq -48(%rbp), %rdi
+	call puts@PLT
+	jmp .Loutput_done
+
+.Loutput_nan:
+	leaq .Lnan(%rip), %rdi
+	call puts@PLT
+	jmp .Loutput_done
+
+.Loutput_inf:
+	leaq .Linf(%rip), %rdi
+	cmpq $0, -16(%rbp)
+	jge 1f
+	leaq .Lnegative_inf(%rip), %rdi
+1:
+	call puts@PLT
+
+.Loutput_done:
+	movq -8(%rbp), %rbx
+	leave
+	ret
+`},
+}
@@ -0,0 +1,391 @@
+// Package cgen translates CPL programs to portable C99 source code, so they can be
+// compiled to native binaries by any C compiler.
+//
+// The generated program behaves like the Quad code of the same program: ints are 64
+// bit, floats are doubles, and floats are printed like the Quad interpreter prints them.
+// Division by zero and invalid input stop the program with a runtime error. Unlike in
+// Quad, variables start at 0, and integer overflow is undefined behavior.
+package cgen
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+)
+
+// indentation is the text that indents every nesting level of the generated code.
+const indentation = "    "
+
+// Precedences of the C operators that the generated expressions use. An operand is
+// parenthesized if its precedence is lower than the precedence its position requires.
+const (
+	additivePrecedence = iota + 1
+	multiplicativePrecedence
+	castPrecedence
+	primaryPrecedence
+)
+
+// Precedences of the C boolean operators.
+const (
+	orPrecedence = iota + 1
+	andPrecedence
+	comparePrecedence
+	notPrecedence
+)
+
+// Generator translates a CPL AST to C. The AST must be annotated by semantic analysis
+// first, and must not contain semantic errors.
+type Generator struct {
+	Variables map[string]parser.DataType
+	body      strings.Builder
+	indent    int
+	used      map[string]bool
+}
+
+// NewGenerator returns a new instance of Generator.
+func NewGenerator() *Generator {
+	return &Generator{
+		Variables: map[string]parser.DataType{},
+		indent:    1,
+		used:      map[string]bool{},
+	}
+}
+
+// Generate generates a C program from a CPL program that passed semantic analysis.
+func Generate(program *parser.Program) string {
+	return NewGenerator().GenerateProgram(program)
+}
+
+// GenerateProgram generates a C program with a main function that runs the statements
+// of the CPL program.
+func (g *Generator) GenerateProgram(node *parser.Program) string {
+	declarations := []string{}
+	for _, declaration := range node.Declarations {
+		names := []string{}
+		for _, name := range declaration.Names {
+			if _, exists := g.Variables[name]; !exists {
+				g.Variables[name] = declaration.Type
+				names = append(names, variableName(name)+" = 0")
+			}
+		}
+
+		if len(names) > 0 {
+			declarations = append(declarations, fmt.Sprintf("%s%s %s;\n", indentation,
+				typeName(declaration.Type), strings.Join(names, ", ")))
+		}
+	}
+
+	if node.StatementsBlock != nil {
+		for _, statement := range node.StatementsBlock.Statements {
+			g.GenerateStatement(statement)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("#include <inttypes.h>\n#include <math.h>\n#include <stdio.h>\n" +
+		"#include <stdlib.h>\n#include <string.h>\n\n")
+
+	for _, function := range runtime {
+		if g.used[function.name] {
+			b.WriteString(function.source)
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("int main(void) {\n")
+	for _, declaration := range declarations {
+		b.WriteString(declaration)
+	}
+	if len(declarations) > 0 && g.body.Len() > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString(g.body.String())
+	b.WriteString(indentation + "return 0;\n}\n")
+
+	return b.String()
+}
+
+// GenerateStatement generates code for a CPL statement.
+func (g *Generator) GenerateStatement(node parser.Statement) {
+	switch s := node.(type) {
+	case *parser.AssignmentStatement:
+		g.GenerateAssignmentStatement(s)
+	case *parser.InputStatement:
+		g.GenerateInputStatement(s)
+	case *parser.OutputStatement:
+		g.GenerateOutputStatement(s)
+	case *parser.IfStatement:
+		g.GenerateIfStatement(s)
+	case *parser.WhileStatement:
+		g.GenerateWhileStatement(s)
+	case *parser.SwitchStatement:
+		g.GenerateSwitchStatement(s)
+	case *parser.BreakStatement:
+		g.GenerateBreakStatement(s)
+	case *parser.StatementsBlock:
+		g.GenerateStatementsBlock(s)
+	}
+}
+
+// GenerateAssignmentStatement generates code for assignment statements. Assigning an
+// int to a float variable doesn't need a cast, because C converts it implicitly.
+func (g *Generator) GenerateAssignmentStatement(node *parser.AssignmentStatement) {
+	value := g.GenerateExpression(node.Value)
+	if node.CastType != parser.Unknown && node.CastType != parser.TypeOf(node.Value) {
+		value = fmt.Sprintf("(%s)%s", typeName(node.CastType),
+			g.operand(node.Value, castPrecedence))
+	}
+
+	g.line("%s = %s;", variableName(node.Variable), value)
+}
+
+// GenerateInputStatement generates code for input statements.
+func (g *Generator) GenerateInputStatement(node *parser.InputStatement) {
+	function := inputIntFunction
+	if g.Variables[node.Variable] == parser.Float {
+		function = inputFloatFunction
+	}
+
+	g.line("%s = %s();", variableName(node.Variable), g.use(function))
+}
+
+// GenerateOutputStatement generates code for output statements.
+func (g *Generator) GenerateOutputStatement(node *parser.OutputStatement) {
+	function := outputIntFunction
+	if parser.TypeOf(node.Value) == parser.Float {
+		function = outputFloatFunction
+	}
+
+	g.line("%s(%s);", g.use(function), g.GenerateExpression(node.Value))
+}
+
+// GenerateIfStatement generates code for if statements.
+func (g *Generator) GenerateIfStatement(node *parser.IfStatement) {
+	g.line("if (%s) {", g.GenerateBooleanExpression(node.Condition))
+	g.generateBody(node.IfBranch)
+
+	if node.ElseBranch != nil {
+		g.line("} else {")
+		g.generateBody(node.ElseBranch)
+	}
+
+	g.line("}")
+}
+
+// GenerateWhileStatement generates code for while statements.
+func (g *Generator) GenerateWhileStatement(node *parser.WhileStatement) {
+	g.line("while (%s) {", g.GenerateBooleanExpression(node.Condition))
+	g.generateBody(node.Body)
+	g.line("}")
+}
+
+// GenerateSwitchStatement generates code for switch statements. Like in C, a case
+// without a break falls through to the next case.
+func (g *Generator) GenerateSwitchStatement(node *parser.SwitchStatement) {
+	g.line("switch (%s) {", g.GenerateExpression(node.Expression))
+
+	// C doesn't allow duplicate case values, and only the first of them is jumped to.
+	cases := map[int64]bool{}
+	for _, switchCase := range node.Cases {
+		if !cases[switchCase.Value] {
+			cases[switchCase.Value] = true
+			g.line("case %d:", switchCase.Value)
+		}
+		g.generateCaseStatements(switchCase.Statements)
+	}
+
+	g.line("default:")
+	g.generateCaseStatements(node.DefaultCase)
+	g.line("}")
+}
+
+// GenerateBreakStatement generates code for break statements.
+func (g *Generator) GenerateBreakStatement(node *parser.BreakStatement) {
+	g.line("break;")
+}
+
+// GenerateStatementsBlock generates code for a statements block nested in another block.
+func (g *Generator) GenerateStatementsBlock(node *parser.StatementsBlock) {
+	g.line("{")
+	g.generateBody(node)
+	g.line("}")
+}
+
+// GenerateExpression returns the C code of a CPL expression.
+func (g *Generator) GenerateExpression(node parser.Expression) string {
+	return g.generateExpression(node).code
+}
+
+// GenerateBooleanExpression returns the C code of a CPL boolean expression.
+func (g *Generator) GenerateBooleanExpression(node parser.BooleanExpression) string {
+	return g.booleanExpression(node, orPrecedence)
+}
+
+// expression is the generated code of a CPL expression.
+type expression struct {
+	code       string
+	precedence int
+	// wide is true if the C type of the expression has at least 64 bits. Small int
+	// literals are 32 bit ints in C, so arithmetic on them alone could overflow.
+	wide bool
+}
+
+// parenthesize returns the code of the expression, parenthesized if its precedence is
+// lower than precedence.
+func (e expression) parenthesize(precedence int) string {
+	if e.precedence < precedence {
+		return "(" + e.code + ")"
+	}
+	return e.code
+}
+
+// operand returns the code of an expression, parenthesized if its precedence is lower
+// than precedence.
+func (g *Generator) operand(node parser.Expression, precedence int) string {
+	return g.generateExpression(node).parenthesize(precedence)
+}
+
+// generateExpression generates the code of an expression.
+func (g *Generator) generateExpression(node parser.Expression) expression {
+	switch s := node.(type) {
+	case *parser.ArithmeticExpression:
+		return g.generateArithmeticExpression(s)
+	case *parser.VariableExpression:
+		return expression{variableName(s.Variable), primaryPrecedence, true}
+	case *parser.IntLiteral:
+		return expression{strconv.FormatInt(s.Value, 10), primaryPrecedence,
+			s.Value > math.MaxInt32}
+	case *parser.FloatLiteral:
+		return expression{floatLiteral(s.Value), primaryPrecedence, true}
+	}
+
+	panic(fmt.Sprintf("cgen: unexpected expression %T", node))
+}
+
+// generateArithmeticExpression generates the code of an arithmetic expression.
+func (g *Generator) generateArithmeticExpression(node *parser.ArithmeticExpression) expression {
+	if node.Operator == parser.Divide {
+		function := intDivideFunction
+		if node.Type == parser.Float {
+			function = floatDivideFunction
+		}
+		return expression{fmt.Sprintf("%s(%s, %s)", g.use(function),
+			g.GenerateExpression(node.LHS), g.GenerateExpression(node.RHS)), primaryPrecedence, true}
+	}
+
+	// Operators are left associative, so the RHS is parenthesized if it has the same
+	// precedence as the operator, e.g in a - (b - c).
+	precedence := additivePrecedence
+	if node.Operator == parser.Multiply {
+		precedence = multiplicativePrecedence
+	}
+
+	lhs := g.generateExpression(node.LHS)
+	rhs := g.generateExpression(node.RHS)
+	lhsCode := lhs.parenthesize(precedence)
+	if !lhs.wide && !rhs.wide {
+		lhsCode = "(int64_t)" + lhs.parenthesize(castPrecedence)
+	}
+
+	return expression{fmt.Sprintf("%s %s %s", lhsCode, node.Operator,
+		rhs.parenthesize(precedence+1)), precedence, true}
+}
+
+// booleanExpression returns the code of a boolean expression, parenthesized if its
+// precedence is lower than precedence.
+func (g *Generator) booleanExpression(node parser.BooleanExpression, precedence int) string {
+	code, actual := g.generateBooleanExpression(node)
+	if actual < precedence {
+		return "(" + code + ")"
+	}
+	return code
+}
+
+// generateBooleanExpression returns the code of a boolean expression, and its precedence.
+func (g *Generator) generateBooleanExpression(node parser.BooleanExpression) (string, int) {
+	switch s := node.(type) {
+	case *parser.OrBooleanExpression:
+		// && inside || is always parenthesized, which C compilers recommend.
+		return fmt.Sprintf("%s || %s", g.booleanExpression(s.LHS, comparePrecedence),
+			g.booleanExpression(s.RHS, comparePrecedence)), orPrecedence
+	case *parser.AndBooleanExpression:
+		return fmt.Sprintf("%s && %s", g.booleanExpression(s.LHS, andPrecedence),
+			g.booleanExpression(s.RHS, comparePrecedence)), andPrecedence
+	case *parser.NotBooleanExpression:
+		// ! has a higher precedence than the comparison operators, so its operand is
+		// always parenthesized.
+		return fmt.Sprintf("!%s", g.booleanExpression(s.Value, notPrecedence+1)), notPrecedence
+	case *parser.CompareBooleanExpression:
+		return fmt.Sprintf("%s %s %s", g.GenerateExpression(s.LHS), s.Operator,
+			g.GenerateExpression(s.RHS)), comparePrecedence
+	}
+
+	panic(fmt.Sprintf("cgen: unexpected boolean expression %T", node))
+}
+
+// generateBody generates the statements of an if, a while or a block, one level deeper
+// than the current statement. A nested block doesn't need its own braces.
+func (g *Generator) generateBody(node parser.Statement) {
+	g.indent++
+	if block, ok := node.(*parser.StatementsBlock); ok {
+		for _, statement := range block.Statements {
+			g.GenerateStatement(statement)
+		}
+	} else {
+		g.GenerateStatement(node)
+	}
+	g.indent--
+}
+
+// generateCaseStatements generates the statements of a switch case.
+func (g *Generator) generateCaseStatements(statements []parser.Statement) {
+	g.indent++
+	for _, statement := range statements {
+		g.GenerateStatement(statement)
+	}
+	g.indent--
+}
+
+// line writes a line of code at the current indentation.
+func (g *Generator) line(format string, args ...interface{}) {
+	g.body.WriteString(strings.Repeat(indentation, g.indent))
+	fmt.Fprintf(&g.body, format, args...)
+	g.body.WriteString("\n")
+}
+
+// use marks a runtime function, and the functions it calls, as used by the program.
+func (g *Generator) use(name string) string {
+	for _, function := range runtime {
+		if function.name == name {
+			g.used[name] = true
+			for _, dependency := range function.dependencies {
+				g.use(dependency)
+			}
+		}
+	}
+	return name
+}
+
+// variableName returns the C name of a CPL variable, which can't clash with C keywords.
+func variableName(name string) string {
+	return "v_" + name
+}
+
+func typeName(dataType parser.DataType) string {
+	if dataType == parser.Float {
+		return "double"
+	}
+	return "int64_t"
+}
+
+// floatLiteral returns a C double literal with the exact value of f.
+func floatLiteral(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,262 @@
+package cgen_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/cgen"
+	"github.com/alongubkin/cpl-compiler/pkg/internal/cpltest"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+// mainBody returns the statements of the generated main function, without the
+// declarations and the return statement.
+func mainBody(t *testing.T, code string) string {
+	output := cgen.Generate(cpltest.Analyze(t, code))
+	start := strings.Index(output, "int main(void) {\n")
+	end := strings.LastIndex(output, "    return 0;\n")
+	if !assert.True(t, start >= 0 && end > start) {
+		return ""
+	}
+
+	body := output[start+len("int main(void) {\n") : end]
+	if blank := strings.Index(body, "\n\n"); blank >= 0 {
+		body = body[blank+2:]
+	}
+	return body
+}
+
+func TestGenerateProgram(t *testing.T) {
+	assert.EqualValues(t, `#include <inttypes.h>
+#include <math.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+static void cpl_output_int(int64_t value) {
+    printf("%" PRId64 "\n", value);
+}
+
+int main(void) {
+    int64_t v_a = 0, v_b = 0;
+    double v_x = 0;
+
+    v_a = 5;
+    cpl_output_int(v_a);
+    return 0;
+}
+`, cgen.Generate(cpltest.Analyze(t, "a, b : int;\nx : float;\n{ a = 5; output(a); }")))
+}
+
+func TestGenerateRuntimeDependencies(t *testing.T) {
+	output := cgen.Generate(cpltest.Analyze(t, "a : int;\n{ input(a); }"))
+	assert.Contains(t, output, "static void cpl_error(const char *message) {")
+	assert.Contains(t, output, "static int64_t cpl_input_int(void) {")
+	assert.NotContains(t, output, "cpl_input_float")
+	assert.NotContains(t, output, "cpl_output_int")
+	assert.True(t, strings.Index(output, "cpl_error(const") < strings.Index(output, "cpl_input_int"))
+}
+
+func TestGenerateArithmetic(t *testing.T) {
+	assert.EqualValues(t, `    v_a = v_a + v_b * 2;
+    v_a = (v_a + v_b) * 2;
+    v_a = v_a - (v_b - 1);
+    v_a = v_a - v_b - 1;
+    v_a = cpl_idiv(v_a + 1, v_b);
+    v_x = cpl_rdiv(v_x, 2);
+    v_x = v_x * 3.5 + 1e-07;
+    v_x = 2.0;
+    v_a = (int64_t)2 * 3;
+    v_a = ((int64_t)2 + 3) * 4;
+    v_a = 3000000000 * 3;
+`, mainBody(t, `a, b : int;
+x : float;
+{
+    a = a + b * 2;
+    a = (a + b) * 2;
+    a = a - (b - 1);
+    a = a - b - 1;
+    a = (a + 1) / b;
+    x = x / 2;
+    x = x * 3.5 + 0.0000001;
+    x = 2.0;
+    a = 2 * 3;
+    a = (2 + 3) * 4;
+    a = 3000000000 * 3;
+}`))
+}
+
+func TestGenerateCast(t *testing.T) {
+	assert.EqualValues(t, `    v_a = (int64_t)v_x;
+    v_a = (int64_t)(v_x * 2);
+    v_x = (double)v_a;
+    v_a = v_a;
+    v_x = v_a;
+`, mainBody(t, `a : int;
+x : float;
+{
+    a = static_cast(int) x;
+    a = static_cast(int) (x * 2);
+    x = static_cast(float) a;
+    a = static_cast(int) a;
+    x = a;
+}`))
+}
+
+func TestGenerateInputOutput(t *testing.T) {
+	assert.EqualValues(t, `    v_a = cpl_input_int();
+    v_x = cpl_input_float();
+    cpl_output_int(v_a * 2);
+    cpl_output_float(v_x + v_a);
+`, mainBody(t, `a : int;
+x : float;
+{
+    input(a);
+    input(x);
+    output(a * 2);
+    output(x + a);
+}`))
+}
+
+func TestGenerateControlFlow(t *testing.T) {
+	assert.EqualValues(t, `    if (v_a > 1 || (v_a < 0 && !(v_b == 2))) {
+        cpl_output_int(1);
+    } else {
+        {
+            cpl_output_int(2);
+        }
+    }
+    while (!(v_a > 1 || v_a < 0) && v_b != 0) {
+        v_b = v_b - 1;
+        if (v_b == 5) {
+            break;
+        } else {
+        }
+    }
+`, mainBody(t, `a, b : int;
+{
+    if (a > 1 || a < 0 && !(b == 2)) output(1); else { { output(2); } }
+    while (!(a > 1 || a < 0) && b != 0) {
+        b = b - 1;
+        if (b == 5) break; else { }
+    }
+}`))
+}
+
+func TestGenerateSwitch(t *testing.T) {
+	assert.EqualValues(t, `    switch (v_a + 1) {
+    case 1:
+        cpl_output_int(1);
+        break;
+    case 2:
+    case 3:
+        cpl_output_int(3);
+        cpl_output_int(4);
+    default:
+        cpl_output_int(0);
+    }
+`, mainBody(t, `a : int;
+{
+    switch (a + 1) {
+        case 1: output(1); break;
+        case 2:
+        case 3: output(3);
+        case 1: output(4);
+        default: output(0);
+    }
+}`))
+}
+
+// build compiles a generated C program, and returns the path of the executable. It
+// skips the test if there's no C compiler.
+func build(t *testing.T, dir string, program *parser.Program) string {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("a C compiler is required to test the generated code")
+	}
+
+	source := filepath.Join(dir, "program.c")
+	binary := filepath.Join(dir, "program")
+	assert.NoError(t, ioutil.WriteFile(source, []byte(cgen.Generate(program)), 0644))
+
+	// CPL programs may declare variables that they never use.
+	output, err := exec.Command(cc, "-std=c99", "-pedantic", "-Wall", "-Wextra", "-Werror",
+		"-Wno-unused", "-o", binary, source).CombinedOutput()
+	assert.NoError(t, err, string(output))
+	return binary
+}
+
+func TestGenerateExamples(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, example := range cpltest.Examples(t) {
+		stdout, stderr, err := cpltest.Run(exec.Command(build(t, dir, example.Program)),
+			example.Input)
+		assert.NoError(t, err, example.Name)
+		assert.Empty(t, stderr, example.Name)
+		assert.EqualValues(t, example.Output, stdout, example.Name)
+	}
+}
+
+func TestGenerateFloatOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	program := cpltest.Analyze(t, `x : float;
+{
+    output(0.1 + 0.2);
+    output(10000000000000000.0);
+    output(1000000000000000.0);
+    output(0.00001);
+    output(0.0001);
+    output(123456789.125);
+    output(1 / 3.0);
+    output(0.0 - 2.5);
+    input(x);
+    output(x * x);
+}`)
+
+	stdout, _, err := cpltest.Run(exec.Command(build(t, dir, program)), "1e200\n")
+	assert.NoError(t, err)
+	assert.EqualValues(t, cpltest.InterpretProgram(t, program, "1e200\n"), stdout)
+}
+
+func TestGenerateRuntimeErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	binary := build(t, dir, cpltest.Analyze(t, `a : int;
+x : float;
+{
+    input(a);
+    output(10 / a);
+    input(x);
+    output(x / 2);
+}`))
+
+	tests := []struct {
+		input  string
+		stdout string
+		stderr string
+	}{
+		{"4\n0.5\n", "2\n0.25\n", ""},
+		{"0\n", "", "RuntimeError: division by zero\n"},
+		{"4\nabc\n", "2\n", "RuntimeError: invalid input\n"},
+	}
+
+	for _, test := range tests {
+		stdout, stderr, err := cpltest.Run(exec.Command(binary), test.input)
+		assert.Equal(t, test.stderr == "", err == nil, test.input)
+		assert.EqualValues(t, test.stdout, stdout, test.input)
+		assert.EqualValues(t, test.stderr, stderr, test.input)
+	}
+}
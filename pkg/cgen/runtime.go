@@ -0,0 +1,100 @@
+package cgen
+
+// Runtime functions that the generated code may call. Only the functions that a program
+// uses are written to its output, so it compiles cleanly with -Wall.
+const (
+	errorFunction       = "cpl_error"
+	inputIntFunction    = "cpl_input_int"
+	inputFloatFunction  = "cpl_input_float"
+	outputIntFunction   = "cpl_output_int"
+	outputFloatFunction = "cpl_output_float"
+	intDivideFunction   = "cpl_idiv"
+	floatDivideFunction = "cpl_rdiv"
+)
+
+// runtimeFunction is the C source of a runtime function, and the runtime functions it
+// calls.
+type runtimeFunction struct {
+	name         string
+	dependencies []string
+	source       string
+}
+
+// runtime contains every runtime function, in the order they're written. A function
+// always comes after the functions it depends on.
+var runtime = []runtimeFunction{
+	{errorFunction, nil, `static void cpl_error(const char *message) {
+    fprintf(stderr, "RuntimeError: %s\n", message);
+    exit(EXIT_FAILURE);
+}
+`},
+	{inputIntFunction, []string{errorFunction}, `static int64_t cpl_input_int(void) {
+    int64_t value;
+    if (scanf("%" SCNd64, &value) != 1) {
+        cpl_error("invalid input");
+    }
+    return value;
+}
+`},
+	{inputFloatFunction, []string{errorFunction}, `static double cpl_input_float(void) {
+    double value;
+    if (scanf("%lf", &value) != 1) {
+        cpl_error("invalid input");
+    }
+    return value;
+}
+`},
+	{outputIntFunction, nil, `static void cpl_output_int(int64_t value) {
+    printf("%" PRId64 "\n", value);
+}
+`},
+	// Floats are printed like the Quad interpreter prints them: the shortest
+	// representation that round-trips, always with a decimal point or an exponent.
+	{outputFloatFunction, nil, `static void cpl_output_float(double value) {
+    char buffer[32];
+    int precision, exponent;
+
+    if (isnan(value)) {
+        puts("nan");
+        return;
+    }
+    if (isinf(value)) {
+        puts(value > 0 ? "inf" : "-inf");
+        return;
+    }
+
+    for (precision = 0; precision < 17; precision++) {
+        snprintf(buffer, sizeof(buffer), "%.*e", precision, value);
+        if (strtod(buffer, NULL) == value) {
+            break;
+        }
+    }
+
+    exponent = atoi(strchr(buffer, 'e') + 1);
+    if (exponent < -4 || exponent >= 16) {
+        puts(buffer);
+    } else if (precision > exponent) {
+        printf("%.*f\n", precision - exponent, value);
+    } else {
+        printf("%.0f.0\n", value);
+    }
+}
+`},
+	{intDivideFunction, []string{errorFunction}, `static int64_t cpl_idiv(int64_t a, int64_t b) {
+    if (b == 0) {
+        cpl_error("division by zero");
+    }
+    if (b == -1) {
+        return (int64_t)(0 - (uint64_t)a);
+    }
+    return a / b;
+}
+`},
+	{floatDivideFunction, []string{errorFunction}, `static double cpl_rdiv(double a, double b) {
+    if (b == 0) {
+        cpl_error("division by zero");
+    }
+    return a / b;
+}
+`},
+}
@@ -1,50 +1,45 @@
 package codegen
 
 import (
-	"bufio"
-	"bytes"
-	"fmt"
-	"io"
-	"strconv"
-	"strings"
-
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
 	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
 )
 
+// CodeGenerator translates a CPL AST to a list of Quad instructions. The AST must be
+// annotated by semantic analysis first, and must not contain semantic errors.
 type CodeGenerator struct {
-	Errors         []Error
-	output         *bufio.Writer
+	Instructions   []quad.Instruction
 	Variables      map[string]parser.DataType
 	temporaryIndex int
 	labelIndex     int
-	breakStack     []string
+	breakStack     []quad.Operand
 }
 
+// Expression is the result of generating code for a CPL expression: the operand
+// that holds its value, and its type.
 type Expression struct {
-	Code string
-	Type parser.DataType
+	Operand quad.Operand
+	Type    parser.DataType
 }
 
 // NewCodeGenerator returns a new instance of CodeGenerator.
-func NewCodeGenerator(output io.Writer) *CodeGenerator {
+func NewCodeGenerator() *CodeGenerator {
 	return &CodeGenerator{
-		Errors:         []Error{},
-		output:         bufio.NewWriterSize(output, 1),
+		Instructions:   []quad.Instruction{},
 		Variables:      map[string]parser.DataType{},
 		temporaryIndex: 0,
 		labelIndex:     0,
-		breakStack:     []string{},
+		breakStack:     []quad.Operand{},
 	}
 }
 
-// Codegen generates code to an output file
-func Codegen(program *parser.Program) (string, []Error) {
-	buf := new(bytes.Buffer)
-
-	c := NewCodeGenerator(buf)
+// Codegen generates Quad instructions for a CPL program that passed semantic analysis.
+func Codegen(program *parser.Program) []quad.Instruction {
+	c := NewCodeGenerator()
 	c.CodegenProgram(program)
 
-	return buf.String(), c.Errors
+	return c.Instructions
 }
 
 // CodegenProgram generates code for a CPL program.
@@ -52,20 +47,14 @@ func (c *CodeGenerator) CodegenProgram(node *parser.Program) {
 	// Go over variable declarations
 	for _, declaration := range node.Declarations {
 		for _, name := range declaration.Names {
-			if _, exists := c.Variables[name]; exists {
-				c.Errors = append(c.Errors, Error{
-					Message: fmt.Sprintf("variable %s already defined", name),
-					Pos:     declaration.Position,
-				})
-				continue
+			if _, exists := c.Variables[name]; !exists {
+				c.Variables[name] = declaration.Type
 			}
-
-			c.Variables[name] = declaration.Type
 		}
 	}
 
 	c.CodegenStatement(node.StatementsBlock)
-	c.output.WriteString("HALT\n")
+	c.emit(node.Position, quad.HALT)
 }
 
 // CodegenStatement generates code for a CPL statement.
@@ -93,62 +82,34 @@ func (c *CodeGenerator) CodegenStatement(node parser.Statement) {
 // CodegenAssignmentStatement generates code for assignment statements.
 func (c *CodeGenerator) CodegenAssignmentStatement(node *parser.AssignmentStatement) {
 	exp := c.CodegenExpression(node.Value)
-
-	// Make sure the variable is defined.
-	if _, exists := c.Variables[node.Variable]; !exists {
-		c.Errors = append(c.Errors, Error{
-			Message: fmt.Sprintf("undefined variable %s", node.Variable),
-			Pos:     node.Position,
-		})
-		return
-	}
-
 	if exp == nil {
 		return
 	}
 
 	// Cast type if there's a static_cast
 	if node.CastType != parser.Unknown && node.CastType != exp.Type {
-		exp = c.codegenCastExpression(exp, node.CastType)
-	}
-
-	// Make sure the expression's type is okay
-	if c.Variables[node.Variable] == parser.Integer && exp.Type == parser.Float {
-		c.Errors = append(c.Errors, Error{
-			Message: fmt.Sprintf("cannot assign float value to int variable %s", node.Variable),
-			Pos:     node.Position,
-		})
-		return
+		exp = c.codegenCastExpression(node.Position, exp, node.CastType)
 	}
 
 	// If the variable is float but the expression is integer, cast it to float.
 	if c.Variables[node.Variable] == parser.Float && exp.Type == parser.Integer {
-		exp = c.codegenCastExpression(exp, parser.Float)
+		exp = c.codegenCastExpression(node.Position, exp, parser.Float)
 	}
 
 	// Codegen
 	if c.Variables[node.Variable] == parser.Integer {
-		c.output.WriteString(fmt.Sprintf("IASN %s %s\n", node.Variable, exp.Code))
+		c.emit(node.Position, quad.IASN, quad.NewVariable(node.Variable), exp.Operand)
 	} else if c.Variables[node.Variable] == parser.Float {
-		c.output.WriteString(fmt.Sprintf("RASN %s %s\n", node.Variable, exp.Code))
+		c.emit(node.Position, quad.RASN, quad.NewVariable(node.Variable), exp.Operand)
 	}
 }
 
 // CodegenInputStatement generates code for input statements.
 func (c *CodeGenerator) CodegenInputStatement(node *parser.InputStatement) {
-	// Make sure the variable is defined.
-	if _, exists := c.Variables[node.Variable]; !exists {
-		c.Errors = append(c.Errors, Error{
-			Message: fmt.Sprintf("undefined variable %s", node.Variable),
-			Pos:     node.Position,
-		})
-		return
-	}
-
 	if c.Variables[node.Variable] == parser.Integer {
-		c.output.WriteString(fmt.Sprintf("IINP %s\n", node.Variable))
+		c.emit(node.Position, quad.IINP, quad.NewVariable(node.Variable))
 	} else if c.Variables[node.Variable] == parser.Float {
-		c.output.WriteString(fmt.Sprintf("RINP %s\n", node.Variable))
+		c.emit(node.Position, quad.RINP, quad.NewVariable(node.Variable))
 	}
 }
 
@@ -160,37 +121,36 @@ func (c *CodeGenerator) CodegenOutputStatement(node *parser.OutputStatement) {
 	}
 
 	if exp.Type == parser.Integer {
-		c.output.WriteString(fmt.Sprintf("IPRT %s\n", exp.Code))
+		c.emit(node.Position, quad.IPRT, exp.Operand)
 	} else if exp.Type == parser.Float {
-		c.output.WriteString(fmt.Sprintf("RPRT %s\n", exp.Code))
+		c.emit(node.Position, quad.RPRT, exp.Operand)
 	}
 }
 
 // CodegenIfStatement generates code for if statements.
 func (c *CodeGenerator) CodegenIfStatement(node *parser.IfStatement) {
-	condition := c.CodegenBooleanExpression(node.Condition)
 	endIfLabel := c.getNewLabel()
 
 	// Even though in CPL you can't write an if statement without an else, we still want
 	// to support that because switch statements, which are implemented through if statements,
 	// don't need else.
-	var elseLabel string
+	var elseLabel quad.Operand
 	if node.ElseBranch != nil {
 		elseLabel = c.getNewLabel()
-		c.output.WriteString(fmt.Sprintf("JMPZ %s %s\n", elseLabel, condition))
+		c.CodegenBooleanExpression(node.Condition, false, elseLabel)
 	} else {
-		c.output.WriteString(fmt.Sprintf("JMPZ %s %s\n", endIfLabel, condition))
+		c.CodegenBooleanExpression(node.Condition, false, endIfLabel)
 	}
 
 	c.CodegenStatement(node.IfBranch)
 
 	if node.ElseBranch != nil {
-		c.output.WriteString(fmt.Sprintf("JUMP %s\n", endIfLabel))
-		c.output.WriteString(fmt.Sprintf("%s:\n", elseLabel))
+		c.emit(node.Position, quad.JUMP, endIfLabel)
+		c.emitLabel(node.Position, elseLabel)
 		c.CodegenStatement(node.ElseBranch)
 	}
 
-	c.output.WriteString(fmt.Sprintf("%s:\n", endIfLabel))
+	c.emitLabel(node.Position, endIfLabel)
 }
 
 // CodegenWhileStatement generates code for while statements.
@@ -198,9 +158,8 @@ func (c *CodeGenerator) CodegenWhileStatement(node *parser.WhileStatement) {
 	conditionLabel := c.getNewLabel()
 	endLoopLabel := c.getNewLabel()
 
-	c.output.WriteString(fmt.Sprintf("%s:\n", conditionLabel))
-	condition := c.CodegenBooleanExpression(node.Condition)
-	c.output.WriteString(fmt.Sprintf("JMPZ %s %s\n", endLoopLabel, condition))
+	c.emitLabel(node.Position, conditionLabel)
+	c.CodegenBooleanExpression(node.Condition, false, endLoopLabel)
 
 	c.breakStack = append(c.breakStack, endLoopLabel)
 	c.CodegenStatement(node.Body)
@@ -208,8 +167,8 @@ func (c *CodeGenerator) CodegenWhileStatement(node *parser.WhileStatement) {
 		c.breakStack = c.breakStack[:len(c.breakStack)-1]
 	}
 
-	c.output.WriteString(fmt.Sprintf("JUMP %s\n", conditionLabel))
-	c.output.WriteString(fmt.Sprintf("%s:\n", endLoopLabel))
+	c.emit(node.Position, quad.JUMP, conditionLabel)
+	c.emitLabel(node.Position, endLoopLabel)
 }
 
 // CodegenSwitchStatement generates code for switch statements.
@@ -220,39 +179,32 @@ func (c *CodeGenerator) CodegenSwitchStatement(node *parser.SwitchStatement) {
 		return
 	}
 
-	if exp.Type != parser.Integer {
-		c.Errors = append(c.Errors, Error{
-			Message: fmt.Sprintf("switch expression must be an integer"),
-			Pos:     node.Position,
-		})
-	}
-
 	temp := c.getNewTemporary()
-	caseLabels := map[int]string{}
+	caseLabels := map[int]quad.Operand{}
 
 	// Generate if statement for each case
 	for i, switchCase := range node.Cases {
 		caseLabels[i] = c.getNewLabel()
-		c.output.WriteString(fmt.Sprintf("INQL %s %s %d\n", temp, exp.Code, switchCase.Value))
-		c.output.WriteString(fmt.Sprintf("JMPZ %s %s\n", caseLabels[i], temp))
+		c.emit(switchCase.Position, quad.INQL, temp, exp.Operand, quad.NewIntLiteral(switchCase.Value))
+		c.emit(switchCase.Position, quad.JMPZ, caseLabels[i], temp)
 	}
 
 	defaultLabel := c.getNewLabel()
 	endSwitchLabel := c.getNewLabel()
-	c.output.WriteString(fmt.Sprintf("JUMP %s\n", defaultLabel))
+	c.emit(node.Position, quad.JUMP, defaultLabel)
 
 	c.breakStack = append(c.breakStack, endSwitchLabel)
 
 	// Generate labels and code for each case
 	for i, switchCase := range node.Cases {
-		c.output.WriteString(fmt.Sprintf("%s:\n", caseLabels[i]))
+		c.emitLabel(switchCase.Position, caseLabels[i])
 		c.CodegenStatement(&parser.StatementsBlock{
 			Statements: switchCase.Statements,
 		})
 	}
 
 	// Default case
-	c.output.WriteString(fmt.Sprintf("%s:\n", defaultLabel))
+	c.emitLabel(node.Position, defaultLabel)
 	c.CodegenStatement(&parser.StatementsBlock{
 		Statements: node.DefaultCase,
 	})
@@ -261,20 +213,16 @@ func (c *CodeGenerator) CodegenSwitchStatement(node *parser.SwitchStatement) {
 		c.breakStack = c.breakStack[:len(c.breakStack)-1]
 	}
 
-	c.output.WriteString(fmt.Sprintf("%s:\n", endSwitchLabel))
+	c.emitLabel(node.Position, endSwitchLabel)
 }
 
 // CodegenBreakStatement generates code for break statements.
 func (c *CodeGenerator) CodegenBreakStatement(node *parser.BreakStatement) {
 	if len(c.breakStack) == 0 {
-		c.Errors = append(c.Errors, Error{
-			Message: fmt.Sprintf("break statement must be inside a while loop or a switch case"),
-			Pos:     node.Position,
-		})
 		return
 	}
 
-	c.output.WriteString(fmt.Sprintf("JUMP %s\n", c.breakStack[len(c.breakStack)-1]))
+	c.emit(node.Position, quad.JUMP, c.breakStack[len(c.breakStack)-1])
 }
 
 // CodegenStatementsBlock generates code for a statements block.
@@ -309,43 +257,43 @@ func (c *CodeGenerator) CodegenArithmeticExpression(node *parser.ArithmeticExpre
 	}
 
 	result := &Expression{
-		Code: c.getNewTemporary(),
-		Type: calculateExpressionType(lhs.Type, rhs.Type),
+		Operand: c.getNewTemporary(),
+		Type:    node.Type,
 	}
 
 	// Cast integer values to float if necessary
 	if result.Type == parser.Float {
-		lhs = c.codegenCastExpression(lhs, parser.Float)
-		rhs = c.codegenCastExpression(rhs, parser.Float)
+		lhs = c.codegenCastExpression(node.Position, lhs, parser.Float)
+		rhs = c.codegenCastExpression(node.Position, rhs, parser.Float)
 	}
 
 	switch node.Operator {
 	case parser.Add:
 		if result.Type == parser.Integer {
-			c.output.WriteString(fmt.Sprintf("IADD %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.IADD, result.Operand, lhs.Operand, rhs.Operand)
 		} else if result.Type == parser.Float {
-			c.output.WriteString(fmt.Sprintf("RADD %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.RADD, result.Operand, lhs.Operand, rhs.Operand)
 		}
 
 	case parser.Subtract:
 		if result.Type == parser.Integer {
-			c.output.WriteString(fmt.Sprintf("ISUB %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.ISUB, result.Operand, lhs.Operand, rhs.Operand)
 		} else if result.Type == parser.Float {
-			c.output.WriteString(fmt.Sprintf("RSUB %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.RSUB, result.Operand, lhs.Operand, rhs.Operand)
 		}
 
 	case parser.Multiply:
 		if result.Type == parser.Integer {
-			c.output.WriteString(fmt.Sprintf("IMLT %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.IMLT, result.Operand, lhs.Operand, rhs.Operand)
 		} else if result.Type == parser.Float {
-			c.output.WriteString(fmt.Sprintf("RMLT %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.RMLT, result.Operand, lhs.Operand, rhs.Operand)
 		}
 
 	case parser.Divide:
 		if result.Type == parser.Integer {
-			c.output.WriteString(fmt.Sprintf("IDIV %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.IDIV, result.Operand, lhs.Operand, rhs.Operand)
 		} else if result.Type == parser.Float {
-			c.output.WriteString(fmt.Sprintf("RDIV %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.RDIV, result.Operand, lhs.Operand, rhs.Operand)
 		}
 	}
 
@@ -354,150 +302,105 @@ func (c *CodeGenerator) CodegenArithmeticExpression(node *parser.ArithmeticExpre
 
 // CodegenVariableExpression generates code for a variable expression.
 func (c *CodeGenerator) CodegenVariableExpression(node *parser.VariableExpression) *Expression {
-	// Make sure the variable is defined.
-	if _, exists := c.Variables[node.Variable]; !exists {
-		c.Errors = append(c.Errors, Error{
-			Message: fmt.Sprintf("undefined variable %s", node.Variable),
-			Pos:     node.Position,
-		})
-		return nil
-	}
-
-	return &Expression{Code: node.Variable, Type: c.Variables[node.Variable]}
+	return &Expression{Operand: quad.NewVariable(node.Variable), Type: node.Type}
 }
 
 // CodegenIntLiteral generates code for an integer literal.
 func (c *CodeGenerator) CodegenIntLiteral(node *parser.IntLiteral) *Expression {
 	return &Expression{
-		Code: fmt.Sprintf("%d", node.Value),
-		Type: parser.Integer,
+		Operand: quad.NewIntLiteral(node.Value),
+		Type:    node.Type,
 	}
 }
 
 // CodegenFloatLiteral generates code for an float literal.
 func (c *CodeGenerator) CodegenFloatLiteral(node *parser.FloatLiteral) *Expression {
 	return &Expression{
-		Code: fmt.Sprintf("%f", node.Value),
-		Type: parser.Float,
+		Operand: quad.NewFloatLiteral(node.Value),
+		Type:    node.Type,
 	}
 }
 
-// CodegenBooleanExpression generates code for a CPL boolean expression, and returns
-// the temporary variable that stores its result.
-func (c *CodeGenerator) CodegenBooleanExpression(node parser.BooleanExpression) string {
+// CodegenBooleanExpression generates jumping code for a CPL boolean expression: if the
+// expression evaluates to jumpIf, control is transferred to label. Otherwise, control falls
+// through to the next instruction. Like in C, the RHS of && and || is only evaluated if the
+// LHS doesn't decide the result of the whole expression.
+func (c *CodeGenerator) CodegenBooleanExpression(node parser.BooleanExpression, jumpIf bool,
+	label quad.Operand) {
 	switch s := node.(type) {
 	case *parser.OrBooleanExpression:
-		return c.CodegenOrBooleanExpression(s)
+		c.CodegenOrBooleanExpression(s, jumpIf, label)
 	case *parser.AndBooleanExpression:
-		return c.CodegenAndBooleanExpression(s)
+		c.CodegenAndBooleanExpression(s, jumpIf, label)
 	case *parser.NotBooleanExpression:
-		return c.CodegenNotBooleanExpression(s)
+		c.CodegenNotBooleanExpression(s, jumpIf, label)
 	case *parser.CompareBooleanExpression:
-		return c.CodegenCompareBooleanExpression(s)
+		c.CodegenCompareBooleanExpression(s, jumpIf, label)
 	}
-
-	return ""
 }
 
-// CodegenOrBooleanExpression generates code for a boolean OR operation.
-func (c *CodeGenerator) CodegenOrBooleanExpression(node *parser.OrBooleanExpression) string {
-	lhs := c.CodegenBooleanExpression(node.LHS)
-	rhs := c.CodegenBooleanExpression(node.RHS)
-	if lhs == "" || rhs == "" {
-		return ""
+// CodegenOrBooleanExpression generates jumping code for a boolean OR operation.
+func (c *CodeGenerator) CodegenOrBooleanExpression(node *parser.OrBooleanExpression, jumpIf bool,
+	label quad.Operand) {
+	// lhs || rhs is true if either of them is true, so jump as soon as one of them is true.
+	if jumpIf {
+		c.CodegenBooleanExpression(node.LHS, true, label)
+		c.CodegenBooleanExpression(node.RHS, true, label)
+		return
 	}
 
-	result := c.getNewTemporary()
-
-	// After the following operation:
-	//   lhs=0 and rhs=0 => result will contain 0+0=0.
-	//   lhs=1 and rhs=0 => result will contain 1+0=1.
-	//   lhs=0 and rhs=1 => result will contain 0+1=1.
-	//   lhs=1 and rhs=1 => result will contain 1+1=2.
-	c.output.WriteString(fmt.Sprintf("IADD %s %s %s\n", result, lhs, rhs))
-
-	// If result > 0 (which is always the case unless lhs=rhs=0), make it 1.
-	// This is necessary because if lhs=rhs=1, then result is 2 which is an illegal boolean value.
-	c.output.WriteString(fmt.Sprintf("IGRT %s %s 0\n", result, result))
-
-	return result
+	// lhs || rhs is false only if both are false. If lhs is true, skip rhs entirely.
+	skipLabel := c.getNewLabel()
+	c.CodegenBooleanExpression(node.LHS, true, skipLabel)
+	c.CodegenBooleanExpression(node.RHS, false, label)
+	c.emitLabel(node.Position, skipLabel)
 }
 
-// CodegenAndBooleanExpression generates code for a boolean AND operation.
-func (c *CodeGenerator) CodegenAndBooleanExpression(node *parser.AndBooleanExpression) string {
-	lhs := c.CodegenBooleanExpression(node.LHS)
-	rhs := c.CodegenBooleanExpression(node.RHS)
-	if lhs == "" || rhs == "" {
-		return ""
+// CodegenAndBooleanExpression generates jumping code for a boolean AND operation.
+func (c *CodeGenerator) CodegenAndBooleanExpression(node *parser.AndBooleanExpression, jumpIf bool,
+	label quad.Operand) {
+	// lhs && rhs is false if either of them is false, so jump as soon as one of them is false.
+	if !jumpIf {
+		c.CodegenBooleanExpression(node.LHS, false, label)
+		c.CodegenBooleanExpression(node.RHS, false, label)
+		return
 	}
 
-	result := c.getNewTemporary()
-
-	// After the following operation:
-	//   lhs=0 and rhs=0 => result will contain 0*0=0.
-	//   lhs=1 and rhs=0 => result will contain 1*0=0.
-	//   lhs=0 and rhs=1 => result will contain 0*1=0.
-	//   lhs=1 and rhs=1 => result will contain 1*1=1.
-	c.output.WriteString(fmt.Sprintf("IMLT %s %s %s\n", result, lhs, rhs))
-
-	return result
+	// lhs && rhs is true only if both are true. If lhs is false, skip rhs entirely.
+	skipLabel := c.getNewLabel()
+	c.CodegenBooleanExpression(node.LHS, false, skipLabel)
+	c.CodegenBooleanExpression(node.RHS, true, label)
+	c.emitLabel(node.Position, skipLabel)
 }
 
-// CodegenNotBooleanExpression generates code for a boolean NOT operation.
-func (c *CodeGenerator) CodegenNotBooleanExpression(node *parser.NotBooleanExpression) string {
-	value := c.CodegenBooleanExpression(node.Value)
-	if value == "" {
-		return ""
-	}
-
-	result := c.getNewTemporary()
-
-	// After the following operation:
-	//   value=0 => result will contain 1-0=1.
-	//   value=1 => result will contain 1-1=0.
-	c.output.WriteString(fmt.Sprintf("ISUB %s 1 %s\n", result, value))
-
-	return result
+// CodegenNotBooleanExpression generates jumping code for a boolean NOT operation.
+func (c *CodeGenerator) CodegenNotBooleanExpression(node *parser.NotBooleanExpression, jumpIf bool,
+	label quad.Operand) {
+	// !value evaluates to jumpIf exactly when value evaluates to !jumpIf.
+	c.CodegenBooleanExpression(node.Value, !jumpIf, label)
 }
 
-// CodegenCompareBooleanExpression generates code for a expression comparison.
-func (c *CodeGenerator) CodegenCompareBooleanExpression(node *parser.CompareBooleanExpression) string {
-	// If the operator is x >= y, convert the AST to x == y || x > y
-	if node.Operator == parser.GreaterThanOrEqualTo {
-		return c.CodegenOrBooleanExpression(&parser.OrBooleanExpression{
-			LHS: &parser.CompareBooleanExpression{
-				LHS:      node.LHS,
-				Operator: parser.EqualTo,
-				RHS:      node.RHS,
-			},
-			RHS: &parser.CompareBooleanExpression{
-				LHS:      node.LHS,
-				Operator: parser.GreaterThan,
-				RHS:      node.RHS,
-			},
-		})
+// CodegenCompareBooleanExpression generates jumping code for an expression comparison.
+func (c *CodeGenerator) CodegenCompareBooleanExpression(node *parser.CompareBooleanExpression,
+	jumpIf bool, label quad.Operand) {
+	// JMPZ jumps when its operand is 0, so if we want to jump when the comparison is true,
+	// we have to calculate the opposite comparison.
+	result := c.codegenComparison(node, jumpIf)
+	if result == (quad.Operand{}) {
+		return
 	}
 
-	// If the operator is x <= y, convert the AST to x == y || x < y
-	if node.Operator == parser.LessThenOrEqualTo {
-		return c.CodegenOrBooleanExpression(&parser.OrBooleanExpression{
-			LHS: &parser.CompareBooleanExpression{
-				LHS:      node.LHS,
-				Operator: parser.EqualTo,
-				RHS:      node.RHS,
-			},
-			RHS: &parser.CompareBooleanExpression{
-				LHS:      node.LHS,
-				Operator: parser.LessThan,
-				RHS:      node.RHS,
-			},
-		})
-	}
+	c.emit(node.Position, quad.JMPZ, label, result)
+}
 
+// codegenComparison compares the two sides of node, and returns the temporary variable that
+// stores the result. If negate is true, the result is the opposite of the comparison.
+func (c *CodeGenerator) codegenComparison(node *parser.CompareBooleanExpression,
+	negate bool) quad.Operand {
 	lhs := c.CodegenExpression(node.LHS)
 	rhs := c.CodegenExpression(node.RHS)
 	if lhs == nil || rhs == nil {
-		return ""
+		return quad.Operand{}
 	}
 
 	// Calculate the type for the expression comparison
@@ -505,70 +408,136 @@ func (c *CodeGenerator) CodegenCompareBooleanExpression(node *parser.CompareBool
 
 	// If the comparison is on floats but one of the operands are integers, cast them to floats.
 	if compareType == parser.Float {
-		lhs = c.codegenCastExpression(lhs, parser.Float)
-		rhs = c.codegenCastExpression(rhs, parser.Float)
+		lhs = c.codegenCastExpression(node.Position, lhs, parser.Float)
+		rhs = c.codegenCastExpression(node.Position, rhs, parser.Float)
+	}
+
+	// Compare with the opposite operator if Quad has an instruction for it, and otherwise
+	// flip the result.
+	operator := node.Operator
+	flip := false
+	if negate {
+		operator, flip = oppositeOperator(operator, compareType)
 	}
 
 	result := c.getNewTemporary()
 
-	switch node.Operator {
+	switch operator {
 	case parser.EqualTo:
 		if compareType == parser.Integer {
-			c.output.WriteString(fmt.Sprintf("IEQL %s %s %s\n", result, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.IEQL, result, lhs.Operand, rhs.Operand)
 		} else if compareType == parser.Float {
-			c.output.WriteString(fmt.Sprintf("REQL %s %s %s\n", result, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.REQL, result, lhs.Operand, rhs.Operand)
 		}
 
 	case parser.NotEqualTo:
 		if compareType == parser.Integer {
-			c.output.WriteString(fmt.Sprintf("INQL %s %s %s\n", result, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.INQL, result, lhs.Operand, rhs.Operand)
 		} else if compareType == parser.Float {
-			c.output.WriteString(fmt.Sprintf("RNQL %s %s %s\n", result, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.RNQL, result, lhs.Operand, rhs.Operand)
 		}
 
 	case parser.GreaterThan:
 		if compareType == parser.Integer {
-			c.output.WriteString(fmt.Sprintf("IGRT %s %s %s\n", result, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.IGRT, result, lhs.Operand, rhs.Operand)
 		} else if compareType == parser.Float {
-			c.output.WriteString(fmt.Sprintf("RGRT %s %s %s\n", result, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.RGRT, result, lhs.Operand, rhs.Operand)
 		}
 
 	case parser.LessThan:
 		if compareType == parser.Integer {
-			c.output.WriteString(fmt.Sprintf("ILSS %s %s %s\n", result, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.ILSS, result, lhs.Operand, rhs.Operand)
+		} else if compareType == parser.Float {
+			c.emit(node.Position, quad.RLSS, result, lhs.Operand, rhs.Operand)
+		}
+
+	// Quad doesn't have instructions for x >= y and x <= y. For ints, x >= y is the opposite
+	// of x < y. A float comparison with NaN is false, so for floats x >= y is computed as
+	// (x > y) + (x == y), which are never both true.
+	case parser.GreaterThanOrEqualTo:
+		if compareType == parser.Integer {
+			c.emit(node.Position, quad.ILSS, result, lhs.Operand, rhs.Operand)
+			result = c.codegenFlip(node.Position, result)
+		} else if compareType == parser.Float {
+			c.emit(node.Position, quad.RGRT, result, lhs.Operand, rhs.Operand)
+			result = c.codegenFloatOrEqual(node.Position, result, lhs.Operand, rhs.Operand)
+		}
+
+	case parser.LessThenOrEqualTo:
+		if compareType == parser.Integer {
+			c.emit(node.Position, quad.IGRT, result, lhs.Operand, rhs.Operand)
+			result = c.codegenFlip(node.Position, result)
 		} else if compareType == parser.Float {
-			c.output.WriteString(fmt.Sprintf("RLSS %s %s %s\n", result, lhs.Code, rhs.Code))
+			c.emit(node.Position, quad.RLSS, result, lhs.Operand, rhs.Operand)
+			result = c.codegenFloatOrEqual(node.Position, result, lhs.Operand, rhs.Operand)
 		}
 	}
 
+	if flip {
+		result = c.codegenFlip(node.Position, result)
+	}
+	return result
+}
+
+// codegenFloatOrEqual returns a temporary variable that contains 1 if value is 1 or the
+// floats lhs and rhs are equal, and 0 otherwise.
+func (c *CodeGenerator) codegenFloatOrEqual(pos lexer.Position, value quad.Operand, lhs quad.Operand,
+	rhs quad.Operand) quad.Operand {
+	equal := c.getNewTemporary()
+	c.emit(pos, quad.REQL, equal, lhs, rhs)
+
+	result := c.getNewTemporary()
+	c.emit(pos, quad.IADD, result, value, equal)
+	return result
+}
+
+// codegenFlip returns a temporary variable that contains 1 if value is 0, and 0 if it's 1.
+func (c *CodeGenerator) codegenFlip(pos lexer.Position, value quad.Operand) quad.Operand {
+	result := c.getNewTemporary()
+	c.emit(pos, quad.ISUB, result, quad.NewIntLiteral(1), value)
 	return result
 }
 
-func (c *CodeGenerator) getNewTemporary() string {
+// emit appends an instruction to the generated code.
+func (c *CodeGenerator) emit(pos lexer.Position, opcode quad.Opcode, operands ...quad.Operand) {
+	c.Instructions = append(c.Instructions, quad.Instruction{
+		Opcode:   opcode,
+		Operands: operands,
+		Position: pos,
+	})
+}
+
+// emitLabel marks the position of the next instruction as the target of label.
+func (c *CodeGenerator) emitLabel(pos lexer.Position, label quad.Operand) {
+	c.emit(pos, quad.LABEL, label)
+}
+
+func (c *CodeGenerator) getNewTemporary() quad.Operand {
 	c.temporaryIndex++
-	return fmt.Sprintf("_t%d", c.temporaryIndex)
+	return quad.NewTemporary(c.temporaryIndex)
 }
 
-func (c *CodeGenerator) getNewLabel() string {
+func (c *CodeGenerator) getNewLabel() quad.Operand {
 	c.labelIndex++
-	return fmt.Sprintf("@%d", c.labelIndex)
+	return quad.NewLabel(c.labelIndex)
 }
 
-func (c *CodeGenerator) codegenCastExpression(exp *Expression, targetType parser.DataType) *Expression {
+func (c *CodeGenerator) codegenCastExpression(pos lexer.Position, exp *Expression,
+	targetType parser.DataType) *Expression {
 	if exp.Type == targetType {
 		return exp
 	}
 
 	result := &Expression{
-		Code: c.getNewTemporary(),
-		Type: targetType,
+		Operand: c.getNewTemporary(),
+		Type:    targetType,
 	}
 
 	switch targetType {
 	case parser.Integer:
-		c.output.WriteString(fmt.Sprintf("RTOI %s %s\n", result.Code, exp.Code))
+		c.emit(pos, quad.RTOI, result.Operand, exp.Operand)
 	case parser.Float:
-		c.output.WriteString(fmt.Sprintf("ITOR %s %s\n", result.Code, exp.Code))
+		c.emit(pos, quad.ITOR, result.Operand, exp.Operand)
 	default:
 		panic("Invalid type!")
 	}
@@ -576,6 +545,25 @@ func (c *CodeGenerator) codegenCastExpression(exp *Expression, targetType parser
 	return result
 }
 
+// oppositeOperator returns the comparison operator that is true exactly when operator is
+// false, if Quad has an instruction for it. Otherwise, it returns operator and true, which
+// means the result has to be flipped. Float comparisons with NaN are false for every
+// operator except !=, so only == and != are the opposites of each other for floats.
+func oppositeOperator(operator parser.Operator, compareType parser.DataType) (parser.Operator, bool) {
+	switch {
+	case operator == parser.EqualTo:
+		return parser.NotEqualTo, false
+	case operator == parser.NotEqualTo:
+		return parser.EqualTo, false
+	case compareType == parser.Integer && operator == parser.GreaterThanOrEqualTo:
+		return parser.LessThan, false
+	case compareType == parser.Integer && operator == parser.LessThenOrEqualTo:
+		return parser.GreaterThan, false
+	}
+
+	return operator, true
+}
+
 func calculateExpressionType(types ...parser.DataType) parser.DataType {
 	for _, t := range types {
 		if t == parser.Float {
@@ -585,21 +573,3 @@ func calculateExpressionType(types ...parser.DataType) parser.DataType {
 
 	return parser.Integer
 }
-
-// RemoveLabels removes any labels generated by this module.
-func RemoveLabels(quad string) string {
-	labels := 0
-	for i, line := range strings.Split(quad, "\n") {
-		if strings.HasSuffix(line, ":") {
-			label := line[:len(line)-1]
-			// Delete label line
-			quad = strings.ReplaceAll(quad, line+"\n", "")
-
-			// Replace all label references with the correct line number
-			quad = strings.ReplaceAll(quad, label, strconv.Itoa(i-labels+1))
-			labels++
-		}
-	}
-
-	return quad
-}
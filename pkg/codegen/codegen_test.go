@@ -2,52 +2,39 @@ package codegen_test
 
 import (
 	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/alongubkin/cpl-compiler/pkg/codegen"
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
 	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/alongubkin/cpl-compiler/pkg/semantic"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCodegenAddExpression(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 
-	exp := c.CodegenExpression(&parser.ArithmeticExpression{
+	exp := c.CodegenExpression(analyzeExpression(t, c, &parser.ArithmeticExpression{
 		LHS:      &parser.IntLiteral{Value: 5},
 		Operator: parser.Add,
 		RHS:      &parser.VariableExpression{Variable: "x"},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
-	assert.EqualValues(t, "IADD _t1 5 x", buf.String())
-	assert.EqualValues(t, exp, &codegen.Expression{Code: "_t1", Type: parser.Integer})
-}
-
-func TestCodegenAddExpressionVariableNotExists(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
-	c.CodegenExpression(&parser.ArithmeticExpression{
-		LHS:      &parser.IntLiteral{Value: 5},
-		Operator: parser.Add,
-		RHS:      &parser.VariableExpression{Variable: "x"},
-	})
-
-	assert.EqualValues(t, []codegen.Error{codegen.Error{Message: "undefined variable x"}}, c.Errors)
-	assert.EqualValues(t, "", buf.String())
+	assert.EqualValues(t, "IADD _t1 5 x", quad.Format(c.Instructions))
+	assert.EqualValues(t, exp, &codegen.Expression{Operand: quad.NewTemporary(1), Type: parser.Integer})
 }
 
 func TestCodegenComplexAddExpression(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 	c.Variables["y"] = parser.Integer
 
-	exp := c.CodegenExpression(&parser.ArithmeticExpression{
+	exp := c.CodegenExpression(analyzeExpression(t, c, &parser.ArithmeticExpression{
 		LHS: &parser.ArithmeticExpression{
 			LHS:      &parser.IntLiteral{Value: 16},
 			Operator: parser.Add,
@@ -59,23 +46,20 @@ func TestCodegenComplexAddExpression(t *testing.T) {
 		},
 		Operator: parser.Add,
 		RHS:      &parser.VariableExpression{Variable: "x"},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `IADD _t1 10 y
 IADD _t2 16 _t1
-IADD _t3 _t2 x`, buf.String())
-	assert.EqualValues(t, exp, &codegen.Expression{Code: "_t3", Type: parser.Integer})
+IADD _t3 _t2 x`, quad.Format(c.Instructions))
+	assert.EqualValues(t, exp, &codegen.Expression{Operand: quad.NewTemporary(3), Type: parser.Integer})
 }
 
 func TestCodegenComplexExpression(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Float
 	c.Variables["y"] = parser.Integer
 
-	c.CodegenExpression(&parser.ArithmeticExpression{
+	c.CodegenExpression(analyzeExpression(t, c, &parser.ArithmeticExpression{
 		LHS: &parser.ArithmeticExpression{
 			LHS:      &parser.FloatLiteral{Value: 16.5},
 			Operator: parser.Subtract,
@@ -87,23 +71,20 @@ func TestCodegenComplexExpression(t *testing.T) {
 		},
 		Operator: parser.Divide,
 		RHS:      &parser.VariableExpression{Variable: "x"},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `IMLT _t1 10 y
 ITOR _t3 _t1
 RSUB _t2 16.500000 _t3
-RDIV _t4 _t2 x`, buf.String())
+RDIV _t4 _t2 x`, quad.Format(c.Instructions))
 }
 
 func TestVariableType(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Float
 	c.Variables["y"] = parser.Float
 
-	c.CodegenExpression(&parser.ArithmeticExpression{
+	c.CodegenExpression(analyzeExpression(t, c, &parser.ArithmeticExpression{
 		LHS: &parser.ArithmeticExpression{
 			LHS:      &parser.IntLiteral{Value: 16},
 			Operator: parser.Subtract,
@@ -115,174 +96,122 @@ func TestVariableType(t *testing.T) {
 		},
 		Operator: parser.Divide,
 		RHS:      &parser.VariableExpression{Variable: "x"},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `ITOR _t2 10
 RMLT _t1 _t2 y
 ITOR _t4 16
 RSUB _t3 _t4 _t1
-RDIV _t5 _t3 x`, buf.String())
+RDIV _t5 _t3 x`, quad.Format(c.Instructions))
 }
 
 func TestSimpleAssignment(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 
-	c.CodegenStatement(&parser.AssignmentStatement{
+	c.CodegenStatement(analyzeStatement(t, c, &parser.AssignmentStatement{
 		Variable: "x",
 		Value:    &parser.IntLiteral{Value: 5},
-	})
-
-	assert.Empty(t, c.Errors)
-	assert.EqualValues(t, `IASN x 5`, buf.String())
-}
-
-func TestFloatToIntAssignment(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
-	c.Variables["x"] = parser.Integer
+	}))
 
-	c.CodegenStatement(&parser.AssignmentStatement{
-		Variable: "x",
-		Value:    &parser.FloatLiteral{Value: 5},
-	})
-
-	assert.EqualValues(t, []codegen.Error{codegen.Error{
-		Message: "cannot assign float value to int variable x"}}, c.Errors)
-	assert.EqualValues(t, ``, buf.String())
+	assert.EqualValues(t, `IASN x 5`, quad.Format(c.Instructions))
 }
 
 func TestIntToFloat(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Float
 
-	c.CodegenStatement(&parser.AssignmentStatement{
+	c.CodegenStatement(analyzeStatement(t, c, &parser.AssignmentStatement{
 		Variable: "x",
 		Value:    &parser.IntLiteral{Value: 5},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `ITOR _t1 5
-RASN x _t1`, buf.String())
+RASN x _t1`, quad.Format(c.Instructions))
 }
 
 func TestFloatToIntAssignmentWithCast(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 
-	c.CodegenStatement(&parser.AssignmentStatement{
+	c.CodegenStatement(analyzeStatement(t, c, &parser.AssignmentStatement{
 		Variable: "x",
 		Value:    &parser.FloatLiteral{Value: 5},
 		CastType: parser.Integer,
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `RTOI _t1 5.000000
-IASN x _t1`, buf.String())
-}
-
-func TestFloatByCastToIntAssignment(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
-	c.Variables["x"] = parser.Integer
-
-	c.CodegenStatement(&parser.AssignmentStatement{
-		Variable: "x",
-		Value:    &parser.IntLiteral{Value: 5},
-		CastType: parser.Float,
-	})
-
-	assert.EqualValues(t, []codegen.Error{codegen.Error{
-		Message: "cannot assign float value to int variable x"}}, c.Errors)
+IASN x _t1`, quad.Format(c.Instructions))
 }
 
 func TestCompareIntegersEquality(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 	c.Variables["y"] = parser.Integer
 
-	c.CodegenBooleanExpression(&parser.CompareBooleanExpression{
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.CompareBooleanExpression{
 		LHS:      &parser.VariableExpression{Variable: "x"},
 		Operator: parser.EqualTo,
 		RHS:      &parser.VariableExpression{Variable: "y"},
-	})
+	}), false, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
-	assert.EqualValues(t, `IEQL _t1 x y`, buf.String())
+	assert.EqualValues(t, `IEQL _t1 x y
+JMPZ @0 _t1`, quad.Format(c.Instructions))
 }
 
 func TestCompareFloatsInequality(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Float
 	c.Variables["y"] = parser.Float
 
-	c.CodegenBooleanExpression(&parser.CompareBooleanExpression{
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.CompareBooleanExpression{
 		LHS:      &parser.VariableExpression{Variable: "x"},
 		Operator: parser.NotEqualTo,
 		RHS:      &parser.VariableExpression{Variable: "y"},
-	})
+	}), false, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
-	assert.EqualValues(t, `RNQL _t1 x y`, buf.String())
+	assert.EqualValues(t, `RNQL _t1 x y
+JMPZ @0 _t1`, quad.Format(c.Instructions))
 }
 
 func TestCompareIntegerLessThanFloat(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 	c.Variables["y"] = parser.Float
 
-	c.CodegenBooleanExpression(&parser.CompareBooleanExpression{
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.CompareBooleanExpression{
 		LHS:      &parser.VariableExpression{Variable: "x"},
 		Operator: parser.LessThan,
 		RHS:      &parser.VariableExpression{Variable: "y"},
-	})
+	}), false, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `ITOR _t1 x
-RLSS _t2 _t1 y`, buf.String())
+RLSS _t2 _t1 y
+JMPZ @0 _t2`, quad.Format(c.Instructions))
 }
 
 func TestCompareFloatGreaterThanFloat(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Float
 	c.Variables["y"] = parser.Integer
 
-	c.CodegenBooleanExpression(&parser.CompareBooleanExpression{
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.CompareBooleanExpression{
 		LHS:      &parser.VariableExpression{Variable: "x"},
 		Operator: parser.GreaterThan,
 		RHS:      &parser.VariableExpression{Variable: "y"},
-	})
+	}), false, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `ITOR _t1 y
-RGRT _t2 x _t1`, buf.String())
+RGRT _t2 x _t1
+JMPZ @0 _t2`, quad.Format(c.Instructions))
 }
 
 func TestOrExpression(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 	c.Variables["y"] = parser.Integer
 
-	c.CodegenBooleanExpression(&parser.OrBooleanExpression{
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.OrBooleanExpression{
 		LHS: &parser.CompareBooleanExpression{
 			LHS:      &parser.VariableExpression{Variable: "x"},
 			Operator: parser.GreaterThan,
@@ -293,23 +222,22 @@ func TestOrExpression(t *testing.T) {
 			Operator: parser.EqualTo,
 			RHS:      &parser.VariableExpression{Variable: "x"},
 		},
-	})
+	}), false, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `IGRT _t1 x y
-IEQL _t2 y x
-IADD _t3 _t1 _t2
-IGRT _t3 _t3 0`, buf.String())
+ISUB _t2 1 _t1
+JMPZ @1 _t2
+IEQL _t3 y x
+JMPZ @0 _t3
+@1:`, quad.Format(c.Instructions))
 }
 
 func TestAndExpression(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 	c.Variables["y"] = parser.Integer
 
-	c.CodegenBooleanExpression(&parser.AndBooleanExpression{
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.AndBooleanExpression{
 		LHS: &parser.CompareBooleanExpression{
 			LHS:      &parser.VariableExpression{Variable: "x"},
 			Operator: parser.GreaterThan,
@@ -320,22 +248,20 @@ func TestAndExpression(t *testing.T) {
 			Operator: parser.EqualTo,
 			RHS:      &parser.VariableExpression{Variable: "x"},
 		},
-	})
+	}), false, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `IGRT _t1 x y
+JMPZ @0 _t1
 IEQL _t2 y x
-IMLT _t3 _t1 _t2`, buf.String())
+JMPZ @0 _t2`, quad.Format(c.Instructions))
 }
 
 func TestOrAndExpression(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 	c.Variables["y"] = parser.Integer
 
-	c.CodegenBooleanExpression(&parser.OrBooleanExpression{
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.OrBooleanExpression{
 		LHS: &parser.AndBooleanExpression{
 			LHS: &parser.CompareBooleanExpression{
 				LHS:      &parser.VariableExpression{Variable: "x"},
@@ -352,25 +278,24 @@ func TestOrAndExpression(t *testing.T) {
 			LHS:      &parser.VariableExpression{Variable: "y"},
 			Operator: parser.NotEqualTo,
 			RHS:      &parser.VariableExpression{Variable: "x"},
-		}})
+		}}), false, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `IGRT _t1 x y
-IEQL _t2 y x
-IMLT _t3 _t1 _t2
-INQL _t4 y x
-IADD _t5 _t3 _t4
-IGRT _t5 _t5 0`, buf.String())
+JMPZ @2 _t1
+INQL _t2 y x
+JMPZ @1 _t2
+@2:
+INQL _t3 y x
+JMPZ @0 _t3
+@1:`, quad.Format(c.Instructions))
 }
 
 func TestAndFloatExpression(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 	c.Variables["y"] = parser.Float
 
-	c.CodegenBooleanExpression(&parser.AndBooleanExpression{
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.AndBooleanExpression{
 		LHS: &parser.CompareBooleanExpression{
 			LHS:      &parser.VariableExpression{Variable: "x"},
 			Operator: parser.GreaterThan,
@@ -381,24 +306,22 @@ func TestAndFloatExpression(t *testing.T) {
 			Operator: parser.EqualTo,
 			RHS:      &parser.VariableExpression{Variable: "x"},
 		},
-	})
+	}), false, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `ITOR _t1 x
 RGRT _t2 _t1 y
+JMPZ @0 _t2
 ITOR _t3 x
 REQL _t4 y _t3
-IMLT _t5 _t2 _t4`, buf.String())
+JMPZ @0 _t4`, quad.Format(c.Instructions))
 }
 
 func TestNotAndFloatExpression(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 	c.Variables["y"] = parser.Float
 
-	c.CodegenBooleanExpression(&parser.NotBooleanExpression{
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.NotBooleanExpression{
 		Value: &parser.AndBooleanExpression{
 			LHS: &parser.CompareBooleanExpression{
 				LHS:      &parser.VariableExpression{Variable: "x"},
@@ -410,128 +333,160 @@ func TestNotAndFloatExpression(t *testing.T) {
 				Operator: parser.EqualTo,
 				RHS:      &parser.VariableExpression{Variable: "x"},
 			},
-		}})
+		}}), false, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `ITOR _t1 x
 RGRT _t2 _t1 y
+JMPZ @1 _t2
 ITOR _t3 x
-REQL _t4 y _t3
-IMLT _t5 _t2 _t4
-ISUB _t6 1 _t5`, buf.String())
+RNQL _t4 y _t3
+JMPZ @0 _t4
+@1:`, quad.Format(c.Instructions))
 }
 
 func TestCompareGreaterThanOrEqualTo(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 	c.Variables["y"] = parser.Integer
 
-	c.CodegenBooleanExpression(&parser.CompareBooleanExpression{
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.CompareBooleanExpression{
 		LHS:      &parser.VariableExpression{Variable: "x"},
 		Operator: parser.GreaterThanOrEqualTo,
 		RHS:      &parser.VariableExpression{Variable: "y"},
-	})
+	}), false, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
-	assert.EqualValues(t, `IEQL _t1 x y
-IGRT _t2 x y
-IADD _t3 _t1 _t2
-IGRT _t3 _t3 0`, buf.String())
+	assert.EqualValues(t, `ILSS _t1 x y
+ISUB _t2 1 _t1
+JMPZ @0 _t2`, quad.Format(c.Instructions))
 }
 
 func TestCompareLessThanOrEqualTo(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 	c.Variables["y"] = parser.Integer
 
-	c.CodegenBooleanExpression(&parser.CompareBooleanExpression{
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.CompareBooleanExpression{
 		LHS:      &parser.VariableExpression{Variable: "x"},
 		Operator: parser.LessThenOrEqualTo,
 		RHS:      &parser.VariableExpression{Variable: "y"},
-	})
+	}), false, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
-	assert.EqualValues(t, `IEQL _t1 x y
-ILSS _t2 x y
+	assert.EqualValues(t, `IGRT _t1 x y
+ISUB _t2 1 _t1
+JMPZ @0 _t2`, quad.Format(c.Instructions))
+}
+
+func TestCompareFloatGreaterThanOrEqualTo(t *testing.T) {
+	c := codegen.NewCodeGenerator()
+	c.Variables["x"] = parser.Float
+	c.Variables["y"] = parser.Float
+
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.CompareBooleanExpression{
+		LHS:      &parser.VariableExpression{Variable: "x"},
+		Operator: parser.GreaterThanOrEqualTo,
+		RHS:      &parser.VariableExpression{Variable: "y"},
+	}), false, quad.NewLabel(0))
+
+	assert.EqualValues(t, `RGRT _t1 x y
+REQL _t2 x y
 IADD _t3 _t1 _t2
-IGRT _t3 _t3 0`, buf.String())
+JMPZ @0 _t3`, quad.Format(c.Instructions))
 }
 
-func TestInputInteger(t *testing.T) {
-	buf := new(bytes.Buffer)
+func TestCompareFloatJumpIfTrue(t *testing.T) {
+	c := codegen.NewCodeGenerator()
+	c.Variables["x"] = parser.Float
+	c.Variables["y"] = parser.Float
+
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.CompareBooleanExpression{
+		LHS:      &parser.VariableExpression{Variable: "x"},
+		Operator: parser.LessThan,
+		RHS:      &parser.VariableExpression{Variable: "y"},
+	}), true, quad.NewLabel(0))
+
+	assert.EqualValues(t, `RLSS _t1 x y
+ISUB _t2 1 _t1
+JMPZ @0 _t2`, quad.Format(c.Instructions))
+}
 
-	c := codegen.NewCodeGenerator(buf)
+func TestCompareIntegerJumpIfTrue(t *testing.T) {
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
+	c.Variables["y"] = parser.Integer
 
-	c.CodegenStatement(&parser.InputStatement{
-		Variable: "x",
-	})
+	c.CodegenBooleanExpression(analyzeBooleanExpression(t, c, &parser.CompareBooleanExpression{
+		LHS:      &parser.VariableExpression{Variable: "x"},
+		Operator: parser.GreaterThanOrEqualTo,
+		RHS:      &parser.VariableExpression{Variable: "y"},
+	}), true, quad.NewLabel(0))
 
-	assert.Empty(t, c.Errors)
-	assert.EqualValues(t, `IINP x`, buf.String())
+	assert.EqualValues(t, `ILSS _t1 x y
+JMPZ @0 _t1`, quad.Format(c.Instructions))
 }
 
-func TestInputFloat(t *testing.T) {
-	buf := new(bytes.Buffer)
+func TestCompareNaN(t *testing.T) {
+	output := compileAndRun(t, `x : float;
+{
+  input(x);
+  if (x == x) output(1); else output(0);
+  if (x != x) output(1); else output(0);
+  if (x < 1.0) output(1); else output(0);
+  if (x > 1.0) output(1); else output(0);
+  if (x <= 1.0) output(1); else output(0);
+  if (x >= 1.0) output(1); else output(0);
+  if (x < 1.0 || x >= 1.0) output(1); else output(0);
+  if (!(x < 1.0) && !(x <= 1.0)) output(1); else output(0);
+}`, "nan\n")
 
-	c := codegen.NewCodeGenerator(buf)
-	c.Variables["x"] = parser.Float
+	assert.EqualValues(t, "0\n1\n0\n0\n0\n0\n0\n1\n", output)
+}
+
+func TestInputInteger(t *testing.T) {
+	c := codegen.NewCodeGenerator()
+	c.Variables["x"] = parser.Integer
 
-	c.CodegenStatement(&parser.InputStatement{
+	c.CodegenStatement(analyzeStatement(t, c, &parser.InputStatement{
 		Variable: "x",
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
-	assert.EqualValues(t, `RINP x`, buf.String())
+	assert.EqualValues(t, `IINP x`, quad.Format(c.Instructions))
 }
 
-func TestInputVariableNotExists(t *testing.T) {
-	buf := new(bytes.Buffer)
+func TestInputFloat(t *testing.T) {
+	c := codegen.NewCodeGenerator()
+	c.Variables["x"] = parser.Float
 
-	c := codegen.NewCodeGenerator(buf)
-	c.CodegenStatement(&parser.InputStatement{
+	c.CodegenStatement(analyzeStatement(t, c, &parser.InputStatement{
 		Variable: "x",
-	})
+	}))
 
-	assert.EqualValues(t, []codegen.Error{codegen.Error{Message: "undefined variable x"}}, c.Errors)
+	assert.EqualValues(t, `RINP x`, quad.Format(c.Instructions))
 }
 
 func TestOutputInteger(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
-	c.CodegenStatement(&parser.OutputStatement{
+	c := codegen.NewCodeGenerator()
+	c.CodegenStatement(analyzeStatement(t, c, &parser.OutputStatement{
 		Value: &parser.IntLiteral{Value: 5},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
-	assert.EqualValues(t, `IPRT 5`, buf.String())
+	assert.EqualValues(t, `IPRT 5`, quad.Format(c.Instructions))
 }
 
 func TestOutputFloat(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
-	c.CodegenStatement(&parser.OutputStatement{
+	c := codegen.NewCodeGenerator()
+	c.CodegenStatement(analyzeStatement(t, c, &parser.OutputStatement{
 		Value: &parser.FloatLiteral{Value: 5},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
-	assert.EqualValues(t, `RPRT 5.000000`, buf.String())
+	assert.EqualValues(t, `RPRT 5.000000`, quad.Format(c.Instructions))
 }
 
 func TestIfElse(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Float
 	c.Variables["y"] = parser.Float
 
-	c.CodegenStatement(&parser.IfStatement{
+	c.CodegenStatement(analyzeStatement(t, c, &parser.IfStatement{
 		Condition: &parser.CompareBooleanExpression{
 			LHS:      &parser.IntLiteral{Value: 0},
 			Operator: parser.EqualTo,
@@ -539,26 +494,23 @@ func TestIfElse(t *testing.T) {
 		},
 		IfBranch:   &parser.InputStatement{Variable: "x"},
 		ElseBranch: &parser.InputStatement{Variable: "y"},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `IEQL _t1 0 1
 JMPZ @2 _t1
 RINP x
 JUMP @1
 @2:
 RINP y
-@1:`, buf.String())
+@1:`, quad.Format(c.Instructions))
 }
 
 func TestIfElseIfElse(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Float
 	c.Variables["y"] = parser.Float
 
-	c.CodegenStatement(&parser.IfStatement{
+	c.CodegenStatement(analyzeStatement(t, c, &parser.IfStatement{
 		Condition: &parser.CompareBooleanExpression{
 			LHS:      &parser.IntLiteral{Value: 0},
 			Operator: parser.EqualTo,
@@ -574,9 +526,8 @@ func TestIfElseIfElse(t *testing.T) {
 			IfBranch:   &parser.InputStatement{Variable: "x"},
 			ElseBranch: &parser.InputStatement{Variable: "y"},
 		},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `IEQL _t1 0 1
 JMPZ @2 _t1
 RINP x
@@ -589,51 +540,37 @@ JUMP @3
 @4:
 RINP y
 @3:
-@1:`, buf.String())
-}
-
-func TestBreakStatementNoContext(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
-	c.CodegenStatement(&parser.BreakStatement{})
-	assert.EqualValues(t, []codegen.Error{codegen.Error{
-		Message: "break statement must be inside a while loop or a switch case"}}, c.Errors)
+@1:`, quad.Format(c.Instructions))
 }
 
 func TestWhileLoop(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Float
 	c.Variables["y"] = parser.Float
 
-	c.CodegenStatement(&parser.WhileStatement{
+	c.CodegenStatement(analyzeStatement(t, c, &parser.WhileStatement{
 		Condition: &parser.CompareBooleanExpression{
 			LHS:      &parser.IntLiteral{Value: 0},
 			Operator: parser.EqualTo,
 			RHS:      &parser.IntLiteral{Value: 1},
 		},
 		Body: &parser.InputStatement{Variable: "x"},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `@1:
 IEQL _t1 0 1
 JMPZ @2 _t1
 RINP x
 JUMP @1
-@2:`, buf.String())
+@2:`, quad.Format(c.Instructions))
 }
 
 func TestWhileLoopWithBreak(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Float
 	c.Variables["y"] = parser.Float
 
-	c.CodegenStatement(&parser.WhileStatement{
+	c.CodegenStatement(analyzeStatement(t, c, &parser.WhileStatement{
 		Condition: &parser.CompareBooleanExpression{
 			LHS:      &parser.IntLiteral{Value: 0},
 			Operator: parser.EqualTo,
@@ -643,26 +580,23 @@ func TestWhileLoopWithBreak(t *testing.T) {
 			&parser.InputStatement{Variable: "x"},
 			&parser.BreakStatement{},
 		}},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `@1:
 IEQL _t1 0 1
 JMPZ @2 _t1
 RINP x
 JUMP @2
 JUMP @1
-@2:`, buf.String())
+@2:`, quad.Format(c.Instructions))
 }
 
 func TestNestedWhileLoopWithBreak(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Float
 	c.Variables["y"] = parser.Float
 
-	c.CodegenStatement(&parser.WhileStatement{
+	c.CodegenStatement(analyzeStatement(t, c, &parser.WhileStatement{
 		Condition: &parser.CompareBooleanExpression{
 			LHS:      &parser.IntLiteral{Value: 0},
 			Operator: parser.EqualTo,
@@ -684,9 +618,8 @@ func TestNestedWhileLoopWithBreak(t *testing.T) {
 			},
 			&parser.BreakStatement{},
 		}},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `@1:
 IEQL _t1 0 1
 JMPZ @2 _t1
@@ -701,17 +634,15 @@ JUMP @3
 @4:
 JUMP @2
 JUMP @1
-@2:`, buf.String())
+@2:`, quad.Format(c.Instructions))
 }
 
 func TestSwitchStatement(t *testing.T) {
-	buf := new(bytes.Buffer)
-
-	c := codegen.NewCodeGenerator(buf)
+	c := codegen.NewCodeGenerator()
 	c.Variables["x"] = parser.Integer
 	c.Variables["y"] = parser.Float
 
-	c.CodegenStatement(&parser.SwitchStatement{
+	c.CodegenStatement(analyzeStatement(t, c, &parser.SwitchStatement{
 		Expression: &parser.VariableExpression{Variable: "x"},
 		Cases: []parser.SwitchCase{
 			parser.SwitchCase{
@@ -733,9 +664,8 @@ func TestSwitchStatement(t *testing.T) {
 			&parser.InputStatement{Variable: "x"},
 			&parser.BreakStatement{},
 		},
-	})
+	}))
 
-	assert.Empty(t, c.Errors)
 	assert.EqualValues(t, `INQL _t1 x 1
 JMPZ @1 _t1
 INQL _t1 x 2
@@ -750,5 +680,147 @@ JUMP @4
 @3:
 IINP x
 JUMP @4
-@4:`, buf.String())
+@4:`, quad.Format(c.Instructions))
+}
+
+func TestInstructionPositions(t *testing.T) {
+	c := codegen.NewCodeGenerator()
+	c.Variables["x"] = parser.Integer
+
+	c.CodegenStatement(analyzeStatement(t, c, &parser.OutputStatement{
+		Value: &parser.ArithmeticExpression{
+			LHS:      &parser.VariableExpression{Variable: "x", Position: lexer.Position{Line: 2, Column: 9}},
+			Operator: parser.Multiply,
+			RHS:      &parser.IntLiteral{Value: 2, Position: lexer.Position{Line: 2, Column: 13}},
+			Position: lexer.Position{Line: 2, Column: 11},
+		},
+		Position: lexer.Position{Line: 2, Column: 2},
+	}))
+
+	assert.EqualValues(t, []quad.Instruction{
+		{
+			Opcode:   quad.IMLT,
+			Operands: []quad.Operand{quad.NewTemporary(1), quad.NewVariable("x"), quad.NewIntLiteral(2)},
+			Position: lexer.Position{Line: 2, Column: 11},
+		},
+		{
+			Opcode:   quad.IPRT,
+			Operands: []quad.Operand{quad.NewTemporary(1)},
+			Position: lexer.Position{Line: 2, Column: 2},
+		},
+	}, c.Instructions)
+}
+
+func TestShortCircuitAnd(t *testing.T) {
+	output := compileAndRun(t, `x : int;
+{
+  input(x);
+  if (x != 0 && 10 / x > 1) output(1); else output(2);
+}`, "0\n")
+
+	assert.EqualValues(t, "2\n", output)
+}
+
+func TestShortCircuitOr(t *testing.T) {
+	output := compileAndRun(t, `x : int;
+{
+  input(x);
+  while (x == 0 || 10 / x > 1) {
+    output(x);
+    x = x + 1;
+  }
+}`, "0\n")
+
+	assert.EqualValues(t, "0\n1\n2\n3\n4\n5\n", output)
+}
+
+func TestShortCircuitNot(t *testing.T) {
+	output := compileAndRun(t, `x, y : int;
+{
+  input(x);
+  input(y);
+  if (!(x <= 0 || y / x >= 3) && x != y) output(1); else output(0);
+}`, "2\n5\n")
+
+	assert.EqualValues(t, "1\n", output)
+}
+
+// TestCodegenExamples makes sure the QUAD files in the examples directory are up to date.
+func TestCodegenExamples(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.qud")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	for _, file := range files {
+		code, err := ioutil.ReadFile(strings.TrimSuffix(file, ".qud") + ".ou")
+		assert.NoError(t, err)
+		expected, err := ioutil.ReadFile(file)
+		assert.NoError(t, err)
+
+		program, parseErrors := parser.Parse(string(code))
+		assert.Empty(t, parseErrors, file)
+		_, semanticErrors := semantic.Analyze(program)
+		assert.Empty(t, semanticErrors, file)
+
+		instructions, assemblerErrors := quad.Assemble(codegen.Codegen(program))
+		assert.Empty(t, assemblerErrors, file)
+
+		// The last line of the file is the signature of the compiler.
+		qud := string(expected)
+		assert.EqualValues(t, qud[:strings.LastIndex(qud, "\n")], quad.Format(instructions), file)
+	}
+}
+
+func compileAndRun(t *testing.T, code string, input string) string {
+	program, parseErrors := parser.Parse(code)
+	assert.Empty(t, parseErrors)
+
+	_, semanticErrors := semantic.Analyze(program)
+	assert.Empty(t, semanticErrors)
+
+	instructions, assemblerErrors := quad.Assemble(codegen.Codegen(program))
+	assert.Empty(t, assemblerErrors)
+
+	output := new(bytes.Buffer)
+	err := quad.NewInterpreter(instructions, strings.NewReader(input), output).Run()
+	assert.NoError(t, err)
+
+	return output.String()
+}
+
+// analyzeExpression annotates an expression with types, using the variables of c.
+func analyzeExpression(t *testing.T, c *codegen.CodeGenerator, node parser.Expression) parser.Expression {
+	a := newAnalyzer(c)
+	a.AnalyzeExpression(node)
+	assert.Empty(t, a.Errors)
+
+	return node
+}
+
+// analyzeBooleanExpression annotates a boolean expression with types, using the variables of c.
+func analyzeBooleanExpression(t *testing.T, c *codegen.CodeGenerator,
+	node parser.BooleanExpression) parser.BooleanExpression {
+	a := newAnalyzer(c)
+	a.AnalyzeBooleanExpression(node)
+	assert.Empty(t, a.Errors)
+
+	return node
+}
+
+// analyzeStatement annotates a statement with types, using the variables of c.
+func analyzeStatement(t *testing.T, c *codegen.CodeGenerator, node parser.Statement) parser.Statement {
+	a := newAnalyzer(c)
+	a.AnalyzeStatement(node)
+	assert.Empty(t, a.Errors)
+
+	return node
+}
+
+func newAnalyzer(c *codegen.CodeGenerator) *semantic.Analyzer {
+	a := semantic.NewAnalyzer()
+	for name, dataType := range c.Variables {
+		a.Symbols.Declare(name, dataType, lexer.Position{})
+	}
+
+	return a
 }
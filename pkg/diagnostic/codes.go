@@ -0,0 +1,49 @@
+package diagnostic
+
+// Code is a stable identifier of a kind of diagnostic. Codes never change meaning,
+// so tools can rely on them instead of parsing messages. The prefix specifies the
+// compiler stage that reports the diagnostic: L for the lexer, P for the parser and
+// S for semantic analysis.
+type Code string
+
+// Lexical errors
+const (
+	IllegalCharacter    Code = "L001" // A character that can't start any token
+	UnterminatedComment Code = "L002" // A /* comment without a closing */
+	IdentifierTooLong   Code = "L003" // An ID longer than lexer.MaxIdentifierLength
+	InvalidIdentifier   Code = "L004" // An ID that contains an underscore
+)
+
+// Syntax errors
+const (
+	UnexpectedToken Code = "P001" // A token that doesn't match the grammar
+	InvalidNumber   Code = "P002" // A number literal that can't be parsed
+)
+
+// Semantic errors
+const (
+	VariableRedefined     Code = "S001" // A variable that is declared more than once
+	UndefinedVariable     Code = "S002" // A variable that is used but never declared
+	FloatToIntAssignment  Code = "S003" // A float value assigned to an int variable
+	FloatSwitchExpression Code = "S004" // A switch on a float expression
+	BreakOutsideLoop      Code = "S005" // A break statement outside of a while or switch
+)
+
+var descriptions = map[Code]string{
+	IllegalCharacter:      "Illegal character",
+	UnterminatedComment:   "Unterminated comment",
+	IdentifierTooLong:     "Identifier is too long",
+	InvalidIdentifier:     "Identifier contains an underscore",
+	UnexpectedToken:       "Unexpected token",
+	InvalidNumber:         "Invalid number literal",
+	VariableRedefined:     "Variable is already defined",
+	UndefinedVariable:     "Undefined variable",
+	FloatToIntAssignment:  "Float value assigned to an int variable",
+	FloatSwitchExpression: "Switch expression is not an integer",
+	BreakOutsideLoop:      "Break statement outside of a while loop or a switch case",
+}
+
+// Description returns a short description of the code.
+func (c Code) Description() string {
+	return descriptions[c]
+}
@@ -0,0 +1,74 @@
+package diagnostic
+
+import (
+	"fmt"
+
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+)
+
+// Severity specifies how serious a diagnostic is.
+type Severity int
+
+// Diagnostic severities
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+var severities = [...]string{
+	Error:   "error",
+	Warning: "warning",
+	Note:    "note",
+}
+
+// String returns the string representation of the severity.
+func (s Severity) String() string {
+	if s >= 0 && s < Severity(len(severities)) {
+		return severities[s]
+	}
+	return ""
+}
+
+// Related is an additional source location that helps explain a diagnostic, e.g.
+// the previous declaration of a redefined variable.
+type Related struct {
+	Span    source.Span
+	Message string
+}
+
+// Diagnostic represents a message reported by the compiler about a CPL program.
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	Span     source.Span
+	Related  []Related
+}
+
+// NewError returns a new error diagnostic.
+func NewError(code Code, span source.Span, message string) Diagnostic {
+	return Diagnostic{Severity: Error, Code: code, Message: message, Span: span}
+}
+
+// NewWarning returns a new warning diagnostic.
+func NewWarning(code Code, span source.Span, message string) Diagnostic {
+	return Diagnostic{Severity: Warning, Code: code, Message: message, Span: span}
+}
+
+// Error returns the string representation of the diagnostic.
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s at line %d, char %d", d.Message, d.Span.Start.Line+1,
+		d.Span.Start.Column+1)
+}
+
+// HasErrors returns true if any of the diagnostics is an error.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == Error {
+			return true
+		}
+	}
+
+	return false
+}
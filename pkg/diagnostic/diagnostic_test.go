@@ -0,0 +1,32 @@
+package diagnostic_test
+
+import (
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnosticError(t *testing.T) {
+	d := diagnostic.NewError(diagnostic.UndefinedVariable,
+		source.NewSpan(source.Position{Line: 2, Column: 4}, 1), "undefined variable x")
+
+	assert.EqualValues(t, diagnostic.Error, d.Severity)
+	assert.EqualValues(t, "undefined variable x at line 3, char 5", d.Error())
+}
+
+func TestSeverityString(t *testing.T) {
+	assert.EqualValues(t, "error", diagnostic.Error.String())
+	assert.EqualValues(t, "warning", diagnostic.Warning.String())
+	assert.EqualValues(t, "note", diagnostic.Note.String())
+}
+
+func TestHasErrors(t *testing.T) {
+	warning := diagnostic.NewWarning("S999", source.Span{}, "warning")
+	err := diagnostic.NewError("S999", source.Span{}, "error")
+
+	assert.False(t, diagnostic.HasErrors(nil))
+	assert.False(t, diagnostic.HasErrors([]diagnostic.Diagnostic{warning}))
+	assert.True(t, diagnostic.HasErrors([]diagnostic.Diagnostic{warning, err}))
+}
@@ -0,0 +1,86 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+)
+
+// jsonDocument is the schema of the JSON diagnostics output. Lines and columns are
+// one-based, and the end position is exclusive.
+type jsonDocument struct {
+	Version     int              `json:"version"`
+	Diagnostics []jsonDiagnostic `json:"diagnostics"`
+}
+
+type jsonDiagnostic struct {
+	jsonLocation
+	Severity string         `json:"severity"`
+	Code     Code           `json:"code"`
+	Message  string         `json:"message"`
+	Related  []jsonLocation `json:"related,omitempty"`
+}
+
+type jsonLocation struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	Message   string `json:"message,omitempty"`
+}
+
+// WriteJSON writes diagnostics of a source file as a JSON document:
+//
+//	{
+//	  "version": 1,
+//	  "diagnostics": [
+//	    {
+//	      "file": "program.ou",
+//	      "line": 2,
+//	      "column": 7,
+//	      "endLine": 2,
+//	      "endColumn": 8,
+//	      "severity": "error",
+//	      "code": "S002",
+//	      "message": "undefined variable b"
+//	    }
+//	  ]
+//	}
+func WriteJSON(w io.Writer, filename string, diagnostics []Diagnostic) error {
+	document := jsonDocument{Version: 1, Diagnostics: []jsonDiagnostic{}}
+	for _, d := range diagnostics {
+		item := jsonDiagnostic{
+			jsonLocation: newJSONLocation(filename, d.Span, ""),
+			Severity:     d.Severity.String(),
+			Code:         d.Code,
+			Message:      d.Message,
+		}
+
+		for _, related := range d.Related {
+			item.Related = append(item.Related, newJSONLocation(filename, related.Span, related.Message))
+		}
+
+		document.Diagnostics = append(document.Diagnostics, item)
+	}
+
+	return writeIndented(w, document)
+}
+
+func newJSONLocation(filename string, span source.Span, message string) jsonLocation {
+	return jsonLocation{
+		File:      filename,
+		Line:      span.Start.Line + 1,
+		Column:    span.Start.Column + 1,
+		EndLine:   span.End.Line + 1,
+		EndColumn: span.End.Column + 1,
+		Message:   message,
+	}
+}
+
+func writeIndented(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
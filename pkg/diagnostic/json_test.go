@@ -0,0 +1,54 @@
+package diagnostic_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteJSON(t *testing.T) {
+	d := diagnostic.NewError(diagnostic.VariableRedefined,
+		source.NewSpan(source.Position{Line: 1, Column: 0}, 1), "variable b already defined")
+	d.Related = []diagnostic.Related{{
+		Span:    source.NewSpan(source.Position{Line: 0, Column: 3}, 1),
+		Message: "b is first defined here",
+	}}
+
+	output := new(bytes.Buffer)
+	assert.NoError(t, diagnostic.WriteJSON(output, "program.ou", []diagnostic.Diagnostic{d}))
+	assert.EqualValues(t, `{
+  "version": 1,
+  "diagnostics": [
+    {
+      "file": "program.ou",
+      "line": 2,
+      "column": 1,
+      "endLine": 2,
+      "endColumn": 2,
+      "severity": "error",
+      "code": "S001",
+      "message": "variable b already defined",
+      "related": [
+        {
+          "file": "program.ou",
+          "line": 1,
+          "column": 4,
+          "endLine": 1,
+          "endColumn": 5,
+          "message": "b is first defined here"
+        }
+      ]
+    }
+  ]
+}
+`, output.String())
+}
+
+func TestWriteJSONEmpty(t *testing.T) {
+	output := new(bytes.Buffer)
+	assert.NoError(t, diagnostic.WriteJSON(output, "program.ou", nil))
+	assert.EqualValues(t, "{\n  \"version\": 1,\n  \"diagnostics\": []\n}\n", output.String())
+}
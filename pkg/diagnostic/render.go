@@ -0,0 +1,131 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+)
+
+// ANSI escape codes used for colored output.
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[1;31m"
+	colorYellow = "\x1b[1;33m"
+	colorCyan   = "\x1b[1;36m"
+	colorBlue   = "\x1b[1;34m"
+)
+
+var severityColors = [...]string{
+	Error:   colorRed,
+	Warning: colorYellow,
+	Note:    colorCyan,
+}
+
+// Renderer prints diagnostics in a human readable format, together with an excerpt
+// of the source file that points at the exact location of the problem:
+//
+//	error[S002]: undefined variable b
+//	 --> program.ou:2:7
+//	  |
+//	2 | { a = b; }
+//	  |       ^
+type Renderer struct {
+	Filename string
+	Color    bool
+	lines    []string
+}
+
+// NewRenderer returns a new instance of Renderer for the given source file.
+func NewRenderer(filename string, src string) *Renderer {
+	return &Renderer{
+		Filename: filename,
+		lines:    strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(src), "\n"),
+	}
+}
+
+// Render prints a diagnostic and its related locations.
+func (r *Renderer) Render(w io.Writer, d Diagnostic) {
+	header := d.Severity.String()
+	if d.Code != "" {
+		header += "[" + string(d.Code) + "]"
+	}
+
+	r.renderMessage(w, d.Severity, header, d.Message)
+	r.renderExcerpt(w, d.Severity, d.Span)
+
+	for _, related := range d.Related {
+		r.renderMessage(w, Note, Note.String(), related.Message)
+		r.renderExcerpt(w, Note, related.Span)
+	}
+}
+
+// RenderAll prints a list of diagnostics, separated by empty lines.
+func (r *Renderer) RenderAll(w io.Writer, diagnostics []Diagnostic) {
+	for i, d := range diagnostics {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		r.Render(w, d)
+	}
+}
+
+func (r *Renderer) renderMessage(w io.Writer, severity Severity, header string, message string) {
+	fmt.Fprintf(w, "%s%s\n", r.paint(severityColors[severity], header+":"),
+		r.paint(colorBold, " "+message))
+}
+
+// renderExcerpt prints the location of the span, followed by its first line and a
+// caret underline below the span.
+func (r *Renderer) renderExcerpt(w io.Writer, severity Severity, span source.Span) {
+	lineNumber := strconv.Itoa(span.Start.Line + 1)
+	gutter := strings.Repeat(" ", len(lineNumber))
+
+	fmt.Fprintf(w, "%s%s %s:%d:%d\n", gutter, r.paint(colorBlue, "-->"), r.Filename,
+		span.Start.Line+1, span.Start.Column+1)
+
+	line := []rune{}
+	if span.Start.Line >= 0 && span.Start.Line < len(r.lines) {
+		line = []rune(r.lines[span.Start.Line])
+	}
+
+	// The underline ends at the end of the span, or at the end of the line if the
+	// span covers multiple lines.
+	start, end := span.Start.Column, span.End.Column
+	if span.End.Line != span.Start.Line {
+		end = len(line)
+	}
+	if start > len(line) {
+		start = len(line)
+	}
+	if end <= start {
+		end = start + 1
+	}
+
+	// Copy tabs from the source line so the underline stays aligned.
+	var padding strings.Builder
+	for i := 0; i < start; i++ {
+		if i < len(line) && line[i] == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+
+	fmt.Fprintf(w, "%s %s\n", gutter, r.paint(colorBlue, "|"))
+	fmt.Fprintf(w, "%s %s %s\n", r.paint(colorBlue, lineNumber), r.paint(colorBlue, "|"),
+		string(line))
+	fmt.Fprintf(w, "%s %s %s%s\n", gutter, r.paint(colorBlue, "|"), padding.String(),
+		r.paint(severityColors[severity], strings.Repeat("^", end-start)))
+}
+
+// paint wraps text with an ANSI color, if colors are enabled.
+func (r *Renderer) paint(color string, text string) string {
+	if !r.Color {
+		return text
+	}
+	return color + text + colorReset
+}
@@ -0,0 +1,100 @@
+package diagnostic_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+const program = `a, b : int;
+b : float;
+{
+	a = 15 | 3;
+}`
+
+func TestRenderDiagnostic(t *testing.T) {
+	output := new(bytes.Buffer)
+	renderer := diagnostic.NewRenderer("program.ou", program)
+	renderer.Render(output, diagnostic.NewError(diagnostic.UnexpectedToken,
+		source.NewSpan(source.Position{Line: 3, Column: 5}, 2), "found 15, expected ID"))
+
+	assert.EqualValues(t, `error[P001]: found 15, expected ID
+ --> program.ou:4:6
+  |
+4 | 	a = 15 | 3;
+  | 	    ^^
+`, output.String())
+}
+
+func TestRenderRelated(t *testing.T) {
+	d := diagnostic.NewError(diagnostic.VariableRedefined,
+		source.PointSpan(source.Position{Line: 1, Column: 0}), "variable b already defined")
+	d.Related = []diagnostic.Related{{
+		Span:    source.NewSpan(source.Position{Line: 0, Column: 3}, 1),
+		Message: "b is first defined here",
+	}}
+
+	output := new(bytes.Buffer)
+	diagnostic.NewRenderer("program.ou", program).Render(output, d)
+
+	assert.EqualValues(t, `error[S001]: variable b already defined
+ --> program.ou:2:1
+  |
+2 | b : float;
+  | ^
+note: b is first defined here
+ --> program.ou:1:4
+  |
+1 | a, b : int;
+  |    ^
+`, output.String())
+}
+
+func TestRenderMultilineSpan(t *testing.T) {
+	output := new(bytes.Buffer)
+	diagnostic.NewRenderer("program.ou", program).Render(output, diagnostic.NewWarning("S999",
+		source.Span{Start: source.Position{Line: 2, Column: 0}, End: source.Position{Line: 4, Column: 1}},
+		"multiline"))
+
+	assert.EqualValues(t, `warning[S999]: multiline
+ --> program.ou:3:1
+  |
+3 | {
+  | ^
+`, output.String())
+}
+
+func TestRenderColor(t *testing.T) {
+	output := new(bytes.Buffer)
+	renderer := diagnostic.NewRenderer("program.ou", program)
+	renderer.Color = true
+	renderer.Render(output, diagnostic.NewError(diagnostic.UndefinedVariable,
+		source.PointSpan(source.Position{Line: 3, Column: 1}), "undefined variable a"))
+
+	assert.Contains(t, output.String(), "\x1b[1;31merror[S002]:\x1b[0m\x1b[1m undefined variable a\x1b[0m")
+	assert.Contains(t, output.String(), "\x1b[1;31m^\x1b[0m")
+}
+
+func TestRenderAll(t *testing.T) {
+	output := new(bytes.Buffer)
+	diagnostic.NewRenderer("program.ou", "{}").RenderAll(output, []diagnostic.Diagnostic{
+		diagnostic.NewError("P001", source.PointSpan(source.Position{}), "first"),
+		diagnostic.NewError("P001", source.PointSpan(source.Position{Column: 2}), "second"),
+	})
+
+	assert.EqualValues(t, `error[P001]: first
+ --> program.ou:1:1
+  |
+1 | {}
+  | ^
+
+error[P001]: second
+ --> program.ou:1:3
+  |
+1 | {}
+  |   ^
+`, output.String())
+}
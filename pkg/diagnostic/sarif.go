@@ -0,0 +1,137 @@
+package diagnostic
+
+import (
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+)
+
+// SARIF 2.1.0 objects. Only the subset used by the compiler is defined, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// WriteSARIF writes diagnostics of a source file as a SARIF 2.1.0 log, which is
+// supported by most code scanning and review tools.
+func WriteSARIF(w io.Writer, filename string, diagnostics []Diagnostic) error {
+	uri := filepath.ToSlash(filename)
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "cpq",
+			InformationURI: "https://github.com/alongubkin/cpl-compiler",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	codes := map[Code]bool{}
+	for _, d := range diagnostics {
+		result := sarifResult{
+			RuleID:    string(d.Code),
+			Level:     d.Severity.String(),
+			Message:   sarifMessage{Text: d.Message},
+			Locations: []sarifLocation{newSARIFLocation(uri, d.Span)},
+		}
+
+		for i, related := range d.Related {
+			id := i
+			location := newSARIFLocation(uri, related.Span)
+			location.ID = &id
+			location.Message = &sarifMessage{Text: related.Message}
+			result.RelatedLocations = append(result.RelatedLocations, location)
+		}
+
+		run.Results = append(run.Results, result)
+		codes[d.Code] = true
+	}
+
+	// Describe every rule that has results.
+	for code := range codes {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               string(code),
+			ShortDescription: sarifMessage{Text: code.Description()},
+		})
+	}
+	sort.Slice(run.Tool.Driver.Rules, func(i, j int) bool {
+		return run.Tool.Driver.Rules[i].ID < run.Tool.Driver.Rules[j].ID
+	})
+
+	return writeIndented(w, sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+func newSARIFLocation(uri string, span source.Span) sarifLocation {
+	return sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: uri},
+			Region: sarifRegion{
+				StartLine:   span.Start.Line + 1,
+				StartColumn: span.Start.Column + 1,
+				EndLine:     span.End.Line + 1,
+				EndColumn:   span.End.Column + 1,
+			},
+		},
+	}
+}
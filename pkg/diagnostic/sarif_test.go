@@ -0,0 +1,127 @@
+package diagnostic_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	output := new(bytes.Buffer)
+	assert.NoError(t, diagnostic.WriteSARIF(output, "examples/program.ou", []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.UndefinedVariable,
+			source.NewSpan(source.Position{Line: 1, Column: 6}, 1), "undefined variable b"),
+		diagnostic.NewError(diagnostic.IllegalCharacter,
+			source.NewSpan(source.Position{Line: 2, Column: 8}, 1), "illegal character '|'"),
+	}))
+
+	assert.EqualValues(t, `{
+  "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+  "version": "2.1.0",
+  "runs": [
+    {
+      "tool": {
+        "driver": {
+          "name": "cpq",
+          "informationUri": "https://github.com/alongubkin/cpl-compiler",
+          "rules": [
+            {
+              "id": "L001",
+              "shortDescription": {
+                "text": "Illegal character"
+              }
+            },
+            {
+              "id": "S002",
+              "shortDescription": {
+                "text": "Undefined variable"
+              }
+            }
+          ]
+        }
+      },
+      "results": [
+        {
+          "ruleId": "S002",
+          "level": "error",
+          "message": {
+            "text": "undefined variable b"
+          },
+          "locations": [
+            {
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "examples/program.ou"
+                },
+                "region": {
+                  "startLine": 2,
+                  "startColumn": 7,
+                  "endLine": 2,
+                  "endColumn": 8
+                }
+              }
+            }
+          ]
+        },
+        {
+          "ruleId": "L001",
+          "level": "error",
+          "message": {
+            "text": "illegal character '|'"
+          },
+          "locations": [
+            {
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "examples/program.ou"
+                },
+                "region": {
+                  "startLine": 3,
+                  "startColumn": 9,
+                  "endLine": 3,
+                  "endColumn": 10
+                }
+              }
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}
+`, output.String())
+}
+
+func TestWriteSARIFRelatedLocations(t *testing.T) {
+	d := diagnostic.NewError(diagnostic.VariableRedefined,
+		source.PointSpan(source.Position{Line: 1, Column: 0}), "variable b already defined")
+	d.Related = []diagnostic.Related{{
+		Span:    source.NewSpan(source.Position{Line: 0, Column: 3}, 1),
+		Message: "b is first defined here",
+	}}
+
+	output := new(bytes.Buffer)
+	assert.NoError(t, diagnostic.WriteSARIF(output, "program.ou", []diagnostic.Diagnostic{d}))
+	assert.Contains(t, output.String(), `"relatedLocations": [
+            {
+              "id": 0,
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "program.ou"
+                },
+                "region": {
+                  "startLine": 1,
+                  "startColumn": 4,
+                  "endLine": 1,
+                  "endColumn": 5
+                }
+              },
+              "message": {
+                "text": "b is first defined here"
+              }
+            }
+          ]`)
+}
@@ -0,0 +1,535 @@
+// Package format implements the canonical formatting of CPL source code.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+)
+
+// indentation is the string used for a single level of indentation.
+const indentation = "  "
+
+// Source formats CPL source code in the canonical style:
+//
+//	a, b : int;
+//
+//	{
+//	  input(a);
+//	  if (a > 0) {
+//	    b = a * 2;
+//	  } else
+//	    b = 0;
+//	}
+//
+// Comments are preserved. A comment that shares a line with code is moved to the end
+// of that line, and own-line comments stay on their own lines. Single empty lines
+// between statements and declarations are preserved too.
+//
+// If the code has lexical or syntax errors it isn't formatted, and the errors are
+// returned instead.
+func Source(src string) (string, []diagnostic.Diagnostic) {
+	scanner := lexer.NewScanner(strings.NewReader(src))
+	p := parser.NewParser(scanner)
+	program := p.ParseProgram()
+	if diagnostic.HasErrors(p.Errors) {
+		return "", p.Errors
+	}
+
+	tokens, _ := lexer.Tokenize(strings.NewReader(src))
+
+	printer := newPrinter(tokens, scanner.Comments)
+	printer.program(program)
+	printer.flush(lexer.Position{Line: math.MaxInt32}, false)
+	return printer.buf.String(), nil
+}
+
+// Fprint writes the CPL source of an AST node in the canonical style. The node can
+// be a whole program, a declaration, a switch case, a statement or an expression.
+// The AST doesn't contain comments, so they are not printed.
+func Fprint(w io.Writer, node parser.Node) error {
+	p := newPrinter(nil, nil)
+
+	switch n := node.(type) {
+	case *parser.Program:
+		p.program(n)
+	case *parser.Declaration:
+		p.declaration(n)
+	case *parser.SwitchCase:
+		p.switchCase(n)
+	case parser.Statement:
+		p.statement(n)
+	case parser.Expression:
+		p.write(p.expression(n, 0))
+	case parser.BooleanExpression:
+		p.write(p.booleanExpression(n, 0))
+	default:
+		return fmt.Errorf("cannot format %T", node)
+	}
+
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// printer prints an AST, and interleaves the comments of the source file. The tokens
+// of the source file are used to find the positions of tokens that aren't stored in
+// the AST (e.g else), so comments before them can be printed in the right place.
+type printer struct {
+	buf      bytes.Buffer
+	depth    int
+	tokens   []lexer.Token
+	matching map[int]int // Index of the '}' token that closes every '{' token
+	comments []lexer.Comment
+	next     int // Index of the next comment to print
+
+	// lineStart is true if nothing was printed on the current line yet, and
+	// blockStart is true if nothing was printed since the start of a block.
+	lineStart  bool
+	blockStart bool
+}
+
+func newPrinter(tokens []lexer.Token, comments []lexer.Comment) *printer {
+	p := &printer{
+		tokens:     tokens,
+		matching:   map[int]int{},
+		comments:   comments,
+		lineStart:  true,
+		blockStart: true,
+	}
+
+	open := []int{}
+	for i, token := range tokens {
+		switch token.TokenType {
+		case lexer.LBRACKET:
+			open = append(open, i)
+		case lexer.RBRACKET:
+			if len(open) > 0 {
+				p.matching[open[len(open)-1]] = i
+				open = open[:len(open)-1]
+			}
+		}
+	}
+
+	return p
+}
+
+// write prints text on the current line, and indents the line if it's new.
+func (p *printer) write(text string) {
+	if p.lineStart {
+		p.buf.WriteString(strings.Repeat(indentation, p.depth))
+	}
+
+	p.buf.WriteString(text)
+	p.lineStart = false
+	p.blockStart = false
+}
+
+func (p *printer) newline() {
+	p.buf.WriteByte('\n')
+	p.lineStart = true
+}
+
+// emptyLine prints an empty line, unless it's the start of a block or there's already
+// an empty line.
+func (p *printer) emptyLine() {
+	if p.blockStart || p.buf.Len() == 0 || bytes.HasSuffix(p.buf.Bytes(), []byte("\n\n")) {
+		return
+	}
+	p.newline()
+}
+
+// startBlock increases the indentation for the next lines.
+func (p *printer) startBlock() {
+	p.newline()
+	p.depth++
+	p.blockStart = true
+}
+
+func (p *printer) endBlock() {
+	p.depth--
+	p.blockStart = false
+}
+
+// flush prints the comments that appear before pos in the source file. If emptyLine
+// is true, and the source file has an empty line before pos, it's preserved.
+func (p *printer) flush(pos lexer.Position, emptyLine bool) {
+	for p.next < len(p.comments) && p.comments[p.next].Span.Start.Before(pos) {
+		comment := p.comments[p.next]
+
+		if !p.lineStart {
+			p.write(" " + comment.Text)
+		} else if p.sharesLine(comment) && p.buf.Len() > 0 {
+			// Print the comment at the end of the line it was on.
+			blockStart := p.blockStart
+			p.buf.Truncate(p.buf.Len() - 1)
+			p.lineStart = false
+			p.write(" " + comment.Text)
+			p.newline()
+			p.blockStart = blockStart
+		} else {
+			if p.hasEmptyLineBefore(comment.Span.Start) {
+				p.emptyLine()
+			}
+			p.write(comment.Text)
+			p.newline()
+		}
+
+		p.next++
+	}
+
+	if emptyLine && p.hasEmptyLineBefore(pos) {
+		p.emptyLine()
+	}
+}
+
+// flushToken prints the comments that appear before the i-th token.
+func (p *printer) flushToken(i int, emptyLine bool) {
+	if i >= 0 && i < len(p.tokens) {
+		p.flush(p.tokens[i].Position, emptyLine)
+	}
+}
+
+// sharesLine returns true if a comment starts on the same line as the token or the
+// comment before it.
+func (p *printer) sharesLine(comment lexer.Comment) bool {
+	if i := p.tokenAt(comment.Span.Start) - 1; i >= 0 &&
+		p.tokens[i].Position.Line == comment.Span.Start.Line {
+		return true
+	}
+
+	return p.next > 0 && p.comments[p.next-1].Span.End.Line == comment.Span.Start.Line
+}
+
+// hasEmptyLineBefore returns true if there's an empty line between pos and the token
+// or comment before it in the source file.
+func (p *printer) hasEmptyLineBefore(pos lexer.Position) bool {
+	line := -1
+	if i := p.tokenAt(pos) - 1; i >= 0 {
+		line = p.tokens[i].Position.Line
+	}
+
+	i := sort.Search(len(p.comments), func(i int) bool {
+		return !p.comments[i].Span.Start.Before(pos)
+	}) - 1
+	if i >= 0 && p.comments[i].Span.End.Line > line {
+		line = p.comments[i].Span.End.Line
+	}
+
+	return line >= 0 && pos.Line-line > 1
+}
+
+// tokenAt returns the index of the first token at or after pos.
+func (p *printer) tokenAt(pos lexer.Position) int {
+	return sort.Search(len(p.tokens), func(i int) bool {
+		return !p.tokens[i].Position.Before(pos)
+	})
+}
+
+// closingBracket returns the index of the '}' token that closes the '{' token at or
+// after pos, or -1 if the source file is unknown.
+func (p *printer) closingBracket(pos lexer.Position) int {
+	for i := p.tokenAt(pos); i < len(p.tokens); i++ {
+		if p.tokens[i].TokenType == lexer.LBRACKET {
+			if closing, ok := p.matching[i]; ok {
+				return closing
+			}
+			break
+		}
+	}
+
+	return -1
+}
+
+// hasCommentsBefore returns true if there are comments left before the i-th token.
+func (p *printer) hasCommentsBefore(i int) bool {
+	return i >= 0 && i < len(p.tokens) && p.next < len(p.comments) &&
+		p.comments[p.next].Span.Start.Before(p.tokens[i].Position)
+}
+
+func (p *printer) program(program *parser.Program) {
+	for i := range program.Declarations {
+		p.flush(program.Declarations[i].Position, true)
+		p.declaration(&program.Declarations[i])
+	}
+
+	if program.StatementsBlock != nil {
+		p.flush(program.StatementsBlock.Position, true)
+		if len(program.Declarations) > 0 {
+			p.emptyLine()
+		}
+
+		p.block(program.StatementsBlock)
+		p.newline()
+	}
+}
+
+func (p *printer) declaration(declaration *parser.Declaration) {
+	p.write(fmt.Sprintf("%s : %s;", strings.Join(declaration.Names, ", "), declaration.Type))
+	p.newline()
+}
+
+// block prints a block of statements, without a newline after the closing bracket.
+func (p *printer) block(block *parser.StatementsBlock) {
+	closing := p.closingBracket(block.Position)
+
+	p.write("{")
+	if len(block.Statements) == 0 && !p.hasCommentsBefore(closing) {
+		p.write("}")
+		return
+	}
+
+	p.startBlock()
+	p.statements(block.Statements)
+	p.flushToken(closing, false)
+	p.endBlock()
+	p.write("}")
+}
+
+func (p *printer) statements(statements []parser.Statement) {
+	for _, statement := range statements {
+		p.flush(position(statement), true)
+		p.statement(statement)
+	}
+}
+
+// statement prints a statement, followed by a newline.
+func (p *printer) statement(statement parser.Statement) {
+	switch s := statement.(type) {
+	case *parser.AssignmentStatement:
+		value := p.expression(s.Value, precedenceLowest)
+		if s.CastType != parser.Unknown {
+			// The grammar requires parentheses around the operand of a cast.
+			value = fmt.Sprintf("static_cast(%s) (%s)", s.CastType, value)
+		}
+		p.write(fmt.Sprintf("%s = %s;", s.Variable, value))
+		p.newline()
+
+	case *parser.InputStatement:
+		p.write(fmt.Sprintf("input(%s);", s.Variable))
+		p.newline()
+
+	case *parser.OutputStatement:
+		p.write(fmt.Sprintf("output(%s);", p.expression(s.Value, 0)))
+		p.newline()
+
+	case *parser.BreakStatement:
+		p.write("break;")
+		p.newline()
+
+	case *parser.StatementsBlock:
+		p.block(s)
+		p.newline()
+
+	case *parser.IfStatement:
+		p.write(fmt.Sprintf("if (%s)", p.booleanExpression(s.Condition, 0)))
+		isBlock := p.body(s.IfBranch)
+
+		if s.ElseBranch == nil {
+			if isBlock {
+				p.newline()
+			}
+			return
+		}
+
+		// Print the comments before the else keyword.
+		p.flushToken(p.tokenAt(position(s.ElseBranch))-1, false)
+		if isBlock {
+			p.write(" else")
+		} else {
+			p.write("else")
+		}
+
+		if elseIf, ok := s.ElseBranch.(*parser.IfStatement); ok {
+			p.write(" ")
+			p.statement(elseIf)
+		} else if p.body(s.ElseBranch) {
+			p.newline()
+		}
+
+	case *parser.WhileStatement:
+		p.write(fmt.Sprintf("while (%s)", p.booleanExpression(s.Condition, 0)))
+		if p.body(s.Body) {
+			p.newline()
+		}
+
+	case *parser.SwitchStatement:
+		closing := p.closingBracket(s.Position)
+
+		p.write(fmt.Sprintf("switch (%s) {", p.expression(s.Expression, 0)))
+		p.startBlock()
+
+		for i := range s.Cases {
+			p.flush(s.Cases[i].Position, true)
+			p.switchCase(&s.Cases[i])
+		}
+
+		// The default keyword is two tokens before the first statement, or before
+		// the closing bracket.
+		if len(s.DefaultCase) > 0 {
+			p.flushToken(p.tokenAt(position(s.DefaultCase[0]))-2, true)
+		} else {
+			p.flushToken(closing-2, true)
+		}
+		p.write("default:")
+		p.startBlock()
+		p.statements(s.DefaultCase)
+		p.endBlock()
+
+		p.flushToken(closing, false)
+		p.endBlock()
+		p.write("}")
+		p.newline()
+	}
+}
+
+// body prints the body of an if or a while statement. Blocks are printed on the same
+// line, without a newline after them, and other statements are indented on the next
+// line. Returns true if the body is a block.
+func (p *printer) body(statement parser.Statement) bool {
+	if block, ok := statement.(*parser.StatementsBlock); ok {
+		p.write(" ")
+		p.block(block)
+		return true
+	}
+
+	p.startBlock()
+	p.flush(position(statement), false)
+	p.statement(statement)
+	p.endBlock()
+	return false
+}
+
+func (p *printer) switchCase(switchCase *parser.SwitchCase) {
+	p.write(fmt.Sprintf("case %d:", switchCase.Value))
+	p.startBlock()
+	p.statements(switchCase.Statements)
+	p.endBlock()
+}
+
+// Precedence of arithmetic operators. Boolean operators use the same levels for OR,
+// AND, and NOT/comparisons.
+const (
+	precedenceLowest = iota
+	precedenceAdd
+	precedenceMultiply
+	precedenceFactor
+)
+
+// expression returns the source of an expression. If the precedence of the
+// expression is lower than the given precedence, it's wrapped in parentheses.
+func (p *printer) expression(expr parser.Expression, precedence int) string {
+	switch e := expr.(type) {
+	case *parser.VariableExpression:
+		return e.Variable
+
+	case *parser.IntLiteral:
+		// CPL doesn't have negative numbers, but they may be produced by
+		// transformations of the AST.
+		if e.Value < 0 {
+			return parenthesize(fmt.Sprintf("0 - %d", -e.Value), precedenceAdd, precedence)
+		}
+		return strconv.FormatInt(e.Value, 10)
+
+	case *parser.FloatLiteral:
+		if e.Value < 0 {
+			return parenthesize("0 - "+formatFloat(-e.Value), precedenceAdd, precedence)
+		}
+		return formatFloat(e.Value)
+
+	case *parser.ArithmeticExpression:
+		operatorPrecedence := precedenceAdd
+		if e.Operator == parser.Multiply || e.Operator == parser.Divide {
+			operatorPrecedence = precedenceMultiply
+		}
+
+		// Operators are left-associative, so a right operand with the same
+		// precedence needs parentheses.
+		return parenthesize(fmt.Sprintf("%s %s %s",
+			p.expression(e.LHS, operatorPrecedence), e.Operator,
+			p.expression(e.RHS, operatorPrecedence+1)), operatorPrecedence, precedence)
+	}
+
+	return ""
+}
+
+func (p *printer) booleanExpression(expr parser.BooleanExpression, precedence int) string {
+	var result string
+	var exprPrecedence int
+
+	switch e := expr.(type) {
+	case *parser.OrBooleanExpression:
+		exprPrecedence = precedenceAdd
+		result = fmt.Sprintf("%s || %s", p.booleanExpression(e.LHS, exprPrecedence),
+			p.booleanExpression(e.RHS, exprPrecedence+1))
+
+	case *parser.AndBooleanExpression:
+		exprPrecedence = precedenceMultiply
+		result = fmt.Sprintf("%s && %s", p.booleanExpression(e.LHS, exprPrecedence),
+			p.booleanExpression(e.RHS, exprPrecedence+1))
+
+	case *parser.NotBooleanExpression:
+		exprPrecedence = precedenceFactor
+		result = fmt.Sprintf("!(%s)", p.booleanExpression(e.Value, precedenceLowest))
+
+	case *parser.CompareBooleanExpression:
+		exprPrecedence = precedenceFactor
+		result = fmt.Sprintf("%s %s %s", p.expression(e.LHS, precedenceLowest), e.Operator,
+			p.expression(e.RHS, precedenceLowest))
+	}
+
+	// CPL doesn't allow parentheses around boolean expressions, except after NOT.
+	// The parser never produces such trees, but transformations of the AST may.
+	if exprPrecedence < precedence {
+		return fmt.Sprintf("!(!(%s))", result)
+	}
+	return result
+}
+
+func parenthesize(expr string, exprPrecedence int, precedence int) string {
+	if exprPrecedence < precedence {
+		return "(" + expr + ")"
+	}
+	return expr
+}
+
+// formatFloat returns the shortest representation of a float that is still parsed as
+// a float, e.g 17.0.
+func formatFloat(value float64) string {
+	result := strconv.FormatFloat(value, 'f', -1, 64)
+	if !strings.Contains(result, ".") {
+		result += ".0"
+	}
+	return result
+}
+
+// position returns the position of the first token of a statement.
+func position(statement parser.Statement) lexer.Position {
+	switch s := statement.(type) {
+	case *parser.AssignmentStatement:
+		return s.Position
+	case *parser.InputStatement:
+		return s.Position
+	case *parser.OutputStatement:
+		return s.Position
+	case *parser.IfStatement:
+		return s.Position
+	case *parser.WhileStatement:
+		return s.Position
+	case *parser.SwitchStatement:
+		return s.Position
+	case *parser.BreakStatement:
+		return s.Position
+	case *parser.StatementsBlock:
+		return s.Position
+	}
+
+	return lexer.Position{}
+}
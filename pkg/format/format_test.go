@@ -0,0 +1,201 @@
+package format_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/format"
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource(t *testing.T) {
+	output, errors := format.Source(`a,b:int;c :float ;
+{input(a);b=a*(2+a)-(a-1); c = static_cast(float) b;
+if(a>b||!(a==b)&&b<=1){output(a);}else output(b);
+while(a<10) a=a+1;
+switch(a){case 1:output(1);break; case 2: default:output(0);}
+if (a > 1) {} else if (a > 0) { output(a); } else { }
+}`)
+
+	assert.Empty(t, errors)
+	assert.EqualValues(t, `a, b : int;
+c : float;
+
+{
+  input(a);
+  b = a * (2 + a) - (a - 1);
+  c = static_cast(float) (b);
+  if (a > b || !(a == b) && b <= 1) {
+    output(a);
+  } else
+    output(b);
+  while (a < 10)
+    a = a + 1;
+  switch (a) {
+    case 1:
+      output(1);
+      break;
+    case 2:
+    default:
+      output(0);
+  }
+  if (a > 1) {} else if (a > 0) {
+    output(a);
+  } else {}
+}
+`, output)
+}
+
+func TestSourceComments(t *testing.T) {
+	output, errors := format.Source(`/* header */
+
+
+a : int; /* declaration */
+{ /* start */
+/* own line */
+input(a) /* before semicolon */;
+
+if (a > 1) { output(a); } /* before else */ else { /* empty */ }
+  /* end of block */
+}
+/* end of file */`)
+
+	assert.Empty(t, errors)
+	assert.EqualValues(t, `/* header */
+
+a : int; /* declaration */
+
+{ /* start */
+  /* own line */
+  input(a); /* before semicolon */
+
+  if (a > 1) {
+    output(a);
+  } /* before else */ else { /* empty */
+  }
+  /* end of block */
+}
+/* end of file */
+`, output)
+}
+
+func TestSourceMultilineComment(t *testing.T) {
+	output, errors := format.Source("{\n    /* first\n       second */\n    output(1);\n}")
+
+	assert.Empty(t, errors)
+	assert.EqualValues(t, "{\n  /* first\n       second */\n  output(1);\n}\n", output)
+}
+
+func TestSourceCast(t *testing.T) {
+	output, errors := format.Source(`a : int; x : float;
+{ a = static_cast(int) (3.0 + 5.8); x = static_cast(float)(a) ; a = static_cast(int) x * 2; }`)
+
+	assert.Empty(t, errors)
+	assert.EqualValues(t, `a : int;
+x : float;
+
+{
+  a = static_cast(int) (3.0 + 5.8);
+  x = static_cast(float) (a);
+  a = static_cast(int) (x * 2);
+}
+`, output)
+}
+
+func TestSourceErrors(t *testing.T) {
+	output, errors := format.Source("{ output(1) }")
+
+	assert.Empty(t, output)
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.UnexpectedToken, source.NewSpan(lexer.Position{Line: 0, Column: 12, Offset: 12}, 1),
+			"found }, expected ;"),
+	}, errors)
+}
+
+// TestSourceExamples makes sure formatting doesn't change the meaning of the example
+// programs, that the operands of casts keep their parentheses, and that formatted code
+// stays the same when it's formatted again.
+func TestSourceExamples(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.ou")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	for _, file := range files {
+		code, err := ioutil.ReadFile(file)
+		assert.NoError(t, err)
+
+		// Some examples demonstrate syntax errors, so they can't be formatted.
+		original, errors := parser.Parse(string(code))
+		if len(errors) > 0 {
+			continue
+		}
+
+		output, errors := format.Source(string(code))
+		assert.Empty(t, errors, file)
+		assert.NotRegexp(t, `static_cast\(\w+\) [^(]`, output, file)
+
+		formatted, errors := parser.Parse(output)
+		assert.Empty(t, errors, file)
+		assert.EqualValues(t, withoutPositions(t, original), withoutPositions(t, formatted), file)
+
+		again, _ := format.Source(output)
+		assert.EqualValues(t, output, again, file)
+	}
+}
+
+func TestFprint(t *testing.T) {
+	var buf bytes.Buffer
+	err := format.Fprint(&buf, &parser.OutputStatement{
+		Value: &parser.ArithmeticExpression{
+			LHS:      &parser.IntLiteral{Value: -2},
+			Operator: parser.Multiply,
+			RHS: &parser.ArithmeticExpression{
+				LHS:      &parser.FloatLiteral{Value: 3},
+				Operator: parser.Divide,
+				RHS:      &parser.VariableExpression{Variable: "x"},
+			},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, "output((0 - 2) * (3.0 / x));\n", buf.String())
+}
+
+func TestFprintBooleanExpression(t *testing.T) {
+	compare := &parser.CompareBooleanExpression{
+		LHS:      &parser.VariableExpression{Variable: "x"},
+		Operator: parser.NotEqualTo,
+		RHS:      &parser.IntLiteral{Value: 1},
+	}
+
+	// CPL can't group boolean expressions with parentheses, so a double NOT is used.
+	var buf bytes.Buffer
+	err := format.Fprint(&buf, &parser.AndBooleanExpression{
+		LHS: &parser.OrBooleanExpression{LHS: compare, RHS: compare},
+		RHS: &parser.NotBooleanExpression{Value: compare},
+	})
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, "!(!(x != 1 || x != 1)) && !(x != 1)", buf.String())
+}
+
+func TestFprintUnsupportedNode(t *testing.T) {
+	err := format.Fprint(new(bytes.Buffer), nil)
+	assert.EqualError(t, err, "cannot format <nil>")
+}
+
+var positionRegexp = regexp.MustCompile(`,?"(position|end)":\{[^}]*\}`)
+
+func withoutPositions(t *testing.T, node parser.Node) string {
+	data, err := json.Marshal(node)
+	assert.NoError(t, err)
+	return positionRegexp.ReplaceAllString(string(data), "")
+}
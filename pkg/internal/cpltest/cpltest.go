@@ -0,0 +1,104 @@
+// Package cpltest contains helpers for the tests of the compiler backends: the example
+// programs with their input, and functions that compile CPL code and run its Quad code to
+// find the expected output.
+package cpltest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/codegen"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/alongubkin/cpl-compiler/pkg/semantic"
+	"github.com/stretchr/testify/assert"
+)
+
+// exampleInputs contains the input of every example that reads input.
+var exampleInputs = map[string]string{
+	"binary.ou": "0\n2000\n37\n",
+	"cnv.ou":    "7.5\n3\n",
+	"div.ou":    "100\n7\n",
+	"min.ou":    "12\n5\n",
+	"sin.ou":    "30\n",
+	"sqrt.ou":   "2\n",
+	"switch.ou": "7\n",
+}
+
+// Example is a program from the examples directory.
+type Example struct {
+	Name    string
+	Program *parser.Program
+	Input   string
+	// Output is the output of the Quad interpreter for the input.
+	Output string
+}
+
+// Examples returns the examples that compile. Some examples demonstrate syntax errors, so
+// they're skipped. It must be called from the tests of a package in pkg.
+func Examples(t assert.TestingT) []Example {
+	files, err := filepath.Glob("../../examples/*.ou")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	examples := []Example{}
+	for _, file := range files {
+		code, err := ioutil.ReadFile(file)
+		assert.NoError(t, err)
+
+		program, errors := parser.Parse(string(code))
+		if len(errors) > 0 {
+			continue
+		}
+		_, errors = semantic.Analyze(program)
+		assert.Empty(t, errors, file)
+
+		name := filepath.Base(file)
+		examples = append(examples, Example{
+			Name:    name,
+			Program: program,
+			Input:   exampleInputs[name],
+			Output:  Interpret(t, codegen.Codegen(program), exampleInputs[name]),
+		})
+	}
+
+	return examples
+}
+
+// Analyze parses CPL code and runs semantic analysis on it. The code must not have errors.
+func Analyze(t assert.TestingT, code string) *parser.Program {
+	program, errors := parser.Parse(code)
+	assert.Empty(t, errors)
+	_, errors = semantic.Analyze(program)
+	assert.Empty(t, errors)
+	return program
+}
+
+// Interpret runs Quad code with labels with the given input, and returns its output.
+func Interpret(t assert.TestingT, instructions []quad.Instruction, input string) string {
+	instructions, errors := quad.Assemble(instructions)
+	assert.Empty(t, errors)
+
+	output := new(bytes.Buffer)
+	assert.NoError(t, quad.NewInterpreter(instructions, strings.NewReader(input), output).Run())
+	return output.String()
+}
+
+// InterpretProgram runs the Quad code of a program with the given input, and returns its
+// output.
+func InterpretProgram(t assert.TestingT, program *parser.Program, input string) string {
+	return Interpret(t, codegen.Codegen(program), input)
+}
+
+// Run runs a command with the given input, and returns its stdout and stderr.
+func Run(command *exec.Cmd, input string) (string, string, error) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	command.Stdin = strings.NewReader(input)
+	command.Stdout = stdout
+	command.Stderr = stderr
+	err := command.Run()
+	return stdout.String(), stderr.String(), err
+}
@@ -3,8 +3,12 @@ package lexer
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
 )
 
 // MaxIdentifierLength is the maximum length of IDs in CPL.
@@ -12,6 +16,8 @@ const MaxIdentifierLength = 9
 
 // Scanner represents a lexical scanner.
 type Scanner struct {
+	Errors      []diagnostic.Diagnostic
+	Comments    []Comment
 	Reader      *bufio.Reader
 	position    Position
 	eof         bool
@@ -22,12 +28,35 @@ type Scanner struct {
 		position Position
 	}
 	DisablePositions bool // for testing.
+
+	// Trivia enables attaching comments to tokens. Comments that start on the same
+	// line after a token are its trailing comments, and the other comments before a
+	// token are its leading comments.
+	Trivia  bool
+	pending *Token
 }
 
 // NewScanner returns a new instance of Scanner.
 func NewScanner(reader io.Reader) *Scanner {
 	return &Scanner{
-		Reader: bufio.NewReader(reader),
+		Errors:   []diagnostic.Diagnostic{},
+		Comments: []Comment{},
+		Reader:   bufio.NewReader(reader),
+	}
+}
+
+// Tokenize scans CPL code and returns all of its tokens, including ILLEGAL tokens and
+// the final EOF token, along with the lexical errors.
+func Tokenize(r io.Reader) ([]Token, []diagnostic.Diagnostic) {
+	s := NewScanner(r)
+
+	tokens := []Token{}
+	for {
+		token := s.Scan()
+		tokens = append(tokens, token)
+		if token.TokenType == EOF {
+			return tokens, s.Errors
+		}
 	}
 }
 
@@ -42,7 +71,7 @@ func (s *Scanner) read() (rune, Position) {
 
 	// Read next rune from underlying reader.
 	// Any error (including io.EOF) should return as EOF.
-	ch, _, err := s.Reader.ReadRune()
+	ch, size, err := s.Reader.ReadRune()
 	if err != nil {
 		ch = eof
 	} else if ch == '\r' {
@@ -50,6 +79,8 @@ func (s *Scanner) read() (rune, Position) {
 			// nop
 		} else if ch != '\n' {
 			_ = s.Reader.UnreadRune()
+		} else {
+			size++
 		}
 		ch = '\n'
 	}
@@ -61,6 +92,7 @@ func (s *Scanner) read() (rune, Position) {
 
 	// Update position.
 	// Only count EOF once.
+	s.position.Offset += size
 	if ch == '\n' {
 		s.position.Line++
 		s.position.Column = 0
@@ -89,13 +121,58 @@ func (s *Scanner) curr() (ch rune, pos Position) {
 	return buffer.ch, buffer.position
 }
 
+// end returns the position right after the last read character.
+func (s *Scanner) end() Position {
+	if s.DisablePositions {
+		return Position{}
+	}
+
+	// If we have unread characters, the first one starts where the last read
+	// character ends.
+	if s.bufferSize > 0 {
+		bufferIndex := (s.bufferIndex - s.bufferSize + 1 + len(s.buffer)) % len(s.buffer)
+		return s.buffer[bufferIndex].position
+	}
+
+	// EOF doesn't take any space.
+	if ch, pos := s.curr(); ch == eof {
+		return pos
+	}
+	return s.position
+}
+
 // Unscan pushes the previously token back onto the buffer.
 func (s *Scanner) Unscan() {
 	s.bufferSize++
 }
 
-// Scan returns the next token and literal value.
+// Scan returns the next token and literal value. In Trivia mode, the comments around
+// the token are attached to it.
 func (s *Scanner) Scan() Token {
+	if s.pending != nil {
+		token := *s.pending
+		s.pending = nil
+		return token
+	}
+
+	commentCount := len(s.Comments)
+	token := s.scan()
+	token.End = s.end()
+
+	if s.Trivia {
+		if len(s.Comments) > commentCount {
+			token.Leading = append([]Comment{}, s.Comments[commentCount:]...)
+		}
+		if token.TokenType != EOF {
+			s.scanTrailingComments(&token)
+		}
+	}
+
+	return token
+}
+
+// scan returns the next token, skipping comments and whitespaces before it.
+func (s *Scanner) scan() Token {
 	// Read the next rune.
 	ch, pos := s.read()
 
@@ -104,8 +181,8 @@ func (s *Scanner) Scan() Token {
 		if ch == '/' {
 			ch2, _ := s.read()
 			if ch2 == '*' {
-				if err := s.skipUntilEndComment(); err != nil {
-					return Token{TokenType: ILLEGAL, Lexeme: "", Position: pos}
+				if !s.scanComment(pos) {
+					return s.unterminatedComment(pos)
 				}
 			} else {
 				s.Unscan()
@@ -168,7 +245,7 @@ func (s *Scanner) Scan() Token {
 		}
 
 		s.Unscan()
-		return Token{TokenType: ILLEGAL, Lexeme: string(ch), Position: pos}
+		return s.illegalCharacter(ch, pos)
 
 	case '&':
 		ch2, _ := s.read()
@@ -177,7 +254,7 @@ func (s *Scanner) Scan() Token {
 		}
 
 		s.Unscan()
-		return Token{TokenType: ILLEGAL, Lexeme: string(ch), Position: pos}
+		return s.illegalCharacter(ch, pos)
 
 	case '+', '-':
 		return Token{TokenType: ADDOP, Lexeme: string(ch), Position: pos}
@@ -207,7 +284,7 @@ func (s *Scanner) Scan() Token {
 		return Token{TokenType: COLON, Lexeme: string(ch), Position: pos}
 	}
 
-	return Token{TokenType: ILLEGAL, Lexeme: string(ch), Position: pos}
+	return s.illegalCharacter(ch, pos)
 }
 
 // scanWhitespace consumes the current rune and all contiguous whitespace.
@@ -215,9 +292,7 @@ func (s *Scanner) scanWhitespace() {
 	// Read every subsequent whitespace character into the buffer.
 	// Non-whitespace characters and EOF will cause the loop to exit.
 	for {
-		if ch, _ := s.read(); ch == eof {
-			break
-		} else if !isWhitespace(ch) {
+		if ch, _ := s.read(); !isWhitespace(ch) {
 			s.Unscan()
 			break
 		}
@@ -235,9 +310,7 @@ func (s *Scanner) scanIdentifier() Token {
 	// Read every subsequent ident character into the buffer.
 	// Non-ident characters and EOF will cause the loop to exit.
 	for {
-		if ch, _ = s.read(); ch == eof {
-			break
-		} else if !isLetter(ch) && !isDigit(ch) && ch != '_' {
+		if ch, _ = s.read(); !isLetter(ch) && !isDigit(ch) && ch != '_' {
 			s.Unscan()
 			break
 		} else {
@@ -275,11 +348,18 @@ func (s *Scanner) scanIdentifier() Token {
 
 	// Otherwise return as a regular identifier - just need to make sure its length is okay
 	// and it doesn't contain an underscore, which is an illegal character for IDs.
-	if len(buf.String()) <= MaxIdentifierLength && !strings.ContainsRune(buf.String(), '_') {
-		return Token{TokenType: ID, Lexeme: buf.String(), Position: pos}
+	span := source.Span{Start: pos, End: s.end()}
+	if strings.ContainsRune(buf.String(), '_') {
+		s.addError(diagnostic.InvalidIdentifier, span,
+			fmt.Sprintf("identifier %s must not contain an underscore", buf.String()))
+		return Token{TokenType: ILLEGAL, Lexeme: buf.String(), Position: pos}
+	} else if len(buf.String()) > MaxIdentifierLength {
+		s.addError(diagnostic.IdentifierTooLong, span,
+			fmt.Sprintf("identifier %s is longer than %d characters", buf.String(), MaxIdentifierLength))
+		return Token{TokenType: ILLEGAL, Lexeme: buf.String(), Position: pos}
 	}
 
-	return Token{TokenType: ILLEGAL, Lexeme: buf.String(), Position: pos}
+	return Token{TokenType: ID, Lexeme: buf.String(), Position: pos}
 }
 
 // scanNumber consumes a contiguous series of digits.
@@ -299,23 +379,97 @@ func (s *Scanner) scanNumber() Token {
 	return Token{TokenType: NUM, Lexeme: buf.String(), Position: pos}
 }
 
-// skipUntilEndComment skips characters until it reaches a '*/' symbol.
-func (s *Scanner) skipUntilEndComment() error {
+// scanTrailingComments attaches the comments that start on the same line after a token.
+// They are collected right after the token is scanned, so the next token only gets the
+// comments on the following lines as its leading comments.
+func (s *Scanner) scanTrailingComments(token *Token) {
 	for {
-		if ch, _ := s.read(); ch == '*' {
+		ch, pos := s.read()
+		switch ch {
+		case ' ', '\t':
+			continue
+
+		case '/':
+			if ch2, _ := s.read(); ch2 != '*' {
+				s.Unscan()
+				s.Unscan()
+				return
+			}
+
+			if !s.scanComment(pos) {
+				// Report the unterminated comment as the next token.
+				illegal := s.unterminatedComment(pos)
+				s.pending = &illegal
+				return
+			}
+			token.Trailing = append(token.Trailing, s.Comments[len(s.Comments)-1])
+
+		default:
+			s.Unscan()
+			return
+		}
+	}
+}
+
+// scanComment consumes a comment after its /* was read, and adds it to the comments.
+// Returns false if the comment is unterminated.
+func (s *Scanner) scanComment(pos Position) bool {
+	text, err := s.skipUntilEndComment()
+	if err != nil {
+		return false
+	}
+
+	s.Comments = append(s.Comments, Comment{Text: "/*" + text,
+		Span: source.Span{Start: pos, End: s.end()}})
+	return true
+}
+
+// unterminatedComment reports a comment without a closing */, which continues until
+// the end of the file.
+func (s *Scanner) unterminatedComment(pos Position) Token {
+	end := s.end()
+	s.addError(diagnostic.UnterminatedComment, source.Span{Start: pos, End: end},
+		"unterminated comment")
+	return Token{TokenType: ILLEGAL, Lexeme: "", Position: pos, End: end}
+}
+
+// skipUntilEndComment skips characters until it reaches a '*/' symbol, and returns
+// the skipped text including the '*/'.
+func (s *Scanner) skipUntilEndComment() (string, error) {
+	var buf bytes.Buffer
+	for {
+		ch, _ := s.read()
+		if ch == eof {
+			return buf.String(), io.EOF
+		}
+
+		buf.WriteRune(ch)
+		if ch == '*' {
 			// We might be at the end.
 		star:
 			ch2, _ := s.read()
+			if ch2 == eof {
+				return buf.String(), io.EOF
+			}
+
+			buf.WriteRune(ch2)
 			if ch2 == '/' {
-				return nil
+				return buf.String(), nil
 			} else if ch2 == '*' {
 				// We are back in the state machine since we see a star.
 				goto star
-			} else if ch2 == eof {
-				return io.EOF
 			}
-		} else if ch == eof {
-			return io.EOF
 		}
 	}
 }
+
+// illegalCharacter reports a character that can't start any token.
+func (s *Scanner) illegalCharacter(ch rune, pos Position) Token {
+	s.addError(diagnostic.IllegalCharacter, source.Span{Start: pos, End: s.end()},
+		fmt.Sprintf("illegal character '%c'", ch))
+	return Token{TokenType: ILLEGAL, Lexeme: string(ch), Position: pos}
+}
+
+func (s *Scanner) addError(code diagnostic.Code, span source.Span, message string) {
+	s.Errors = append(s.Errors, diagnostic.NewError(code, span, message))
+}
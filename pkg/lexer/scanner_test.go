@@ -1,10 +1,13 @@
 package lexer_test
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
 	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -156,6 +159,82 @@ func TestScannerNestedComments(t *testing.T) {
 	assertToken(t, s, lexer.EOF, "EOF")
 }
 
+func TestScannerCollectsComments(t *testing.T) {
+	s := lexer.NewScanner(strings.NewReader("a /* one */ b\n/* two\n ***/ c /* open"))
+	assertToken(t, s, lexer.ID, "a")
+	assertToken(t, s, lexer.ID, "b")
+	assertToken(t, s, lexer.ID, "c")
+	assertToken(t, s, lexer.ILLEGAL, "")
+
+	assert.EqualValues(t, []lexer.Comment{
+		{
+			Text: "/* one */",
+			Span: source.NewSpan(lexer.Position{Line: 0, Column: 2, Offset: 2}, 9),
+		},
+		{
+			Text: "/* two\n ***/",
+			Span: source.Span{
+				Start: lexer.Position{Line: 1, Column: 0, Offset: 14},
+				End:   lexer.Position{Line: 2, Column: 5, Offset: 26},
+			},
+		},
+	}, s.Comments)
+}
+
+func TestScannerTrivia(t *testing.T) {
+	s := lexer.NewScanner(strings.NewReader("/* a */ a /* b */ /* c */\n/* d */\nb; /* e\n */ /* f */"))
+	s.Trivia = true
+
+	texts := func(comments []lexer.Comment) []string {
+		result := []string{}
+		for _, comment := range comments {
+			result = append(result, comment.Text)
+		}
+		return result
+	}
+
+	token := s.Scan()
+	assert.EqualValues(t, "a", token.Lexeme)
+	assert.EqualValues(t, []string{"/* a */"}, texts(token.Leading))
+	assert.EqualValues(t, []string{"/* b */", "/* c */"}, texts(token.Trailing))
+
+	token = s.Scan()
+	assert.EqualValues(t, "b", token.Lexeme)
+	assert.EqualValues(t, []string{"/* d */"}, texts(token.Leading))
+	assert.Empty(t, token.Trailing)
+
+	token = s.Scan()
+	assert.EqualValues(t, ";", token.Lexeme)
+	assert.Empty(t, token.Leading)
+	assert.EqualValues(t, []string{"/* e\n */", "/* f */"}, texts(token.Trailing))
+
+	token = s.Scan()
+	assert.EqualValues(t, lexer.EOF, token.TokenType)
+	assert.Empty(t, token.Leading)
+	assert.Len(t, s.Comments, 6)
+}
+
+func TestScannerTriviaUnterminatedComment(t *testing.T) {
+	s := lexer.NewScanner(strings.NewReader("a /* b"))
+	s.Trivia = true
+
+	assertToken(t, s, lexer.ID, "a")
+	assertToken(t, s, lexer.ILLEGAL, "")
+	assertToken(t, s, lexer.EOF, "EOF")
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.UnterminatedComment, source.Span{
+			Start: lexer.Position{Line: 0, Column: 2, Offset: 2},
+			End:   lexer.Position{Line: 0, Column: 6, Offset: 6},
+		}, "unterminated comment"),
+	}, s.Errors)
+}
+
+func TestScannerWithoutTrivia(t *testing.T) {
+	token := lexer.NewScanner(strings.NewReader("/* a */ a /* b */")).Scan()
+	assert.Empty(t, token.Leading)
+	assert.Empty(t, token.Trailing)
+}
+
 func TestScannerWhitespace(t *testing.T) {
 	s := lexer.NewScanner(strings.NewReader("hello\n\t    \n\tbreak\t\t    \t\t test"))
 	assertToken(t, s, lexer.ID, "hello")
@@ -219,6 +298,88 @@ func TestScannerPosition(t *testing.T) {
 		"Invalid `==` position - Ln %d, Col %d", compare.Position.Line, compare.Position.Column)
 }
 
+func TestScannerErrors(t *testing.T) {
+	s := lexer.NewScanner(strings.NewReader("a | abcdefghij\nx_y /* comment"))
+	assertToken(t, s, lexer.ID, "a")
+	assertToken(t, s, lexer.ILLEGAL, "|")
+	assertToken(t, s, lexer.ILLEGAL, "abcdefghij")
+	assertToken(t, s, lexer.ILLEGAL, "x_y")
+	assertToken(t, s, lexer.ILLEGAL, "")
+	assertToken(t, s, lexer.EOF, "EOF")
+
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.IllegalCharacter,
+			source.NewSpan(lexer.Position{Line: 0, Column: 2, Offset: 2}, 1), "illegal character '|'"),
+		diagnostic.NewError(diagnostic.IdentifierTooLong,
+			source.NewSpan(lexer.Position{Line: 0, Column: 4, Offset: 4}, 10),
+			"identifier abcdefghij is longer than 9 characters"),
+		diagnostic.NewError(diagnostic.InvalidIdentifier,
+			source.NewSpan(lexer.Position{Line: 1, Column: 0, Offset: 15}, 3),
+			"identifier x_y must not contain an underscore"),
+		diagnostic.NewError(diagnostic.UnterminatedComment, source.Span{
+			Start: lexer.Position{Line: 1, Column: 4, Offset: 19},
+			End:   lexer.Position{Line: 1, Column: 14, Offset: 29},
+		}, "unterminated comment"),
+	}, s.Errors)
+}
+
+func TestTokenSpan(t *testing.T) {
+	s := lexer.NewScanner(strings.NewReader("  while\r\n\t\u00e9 x"))
+	assert.EqualValues(t, source.NewSpan(lexer.Position{Line: 0, Column: 2, Offset: 2}, 5), s.Scan().Span())
+
+	// Illegal characters may take more than one byte.
+	assert.EqualValues(t, source.Span{
+		Start: lexer.Position{Line: 1, Column: 1, Offset: 10},
+		End:   lexer.Position{Line: 1, Column: 2, Offset: 12},
+	}, s.Scan().Span())
+
+	assert.EqualValues(t, source.NewSpan(lexer.Position{Line: 1, Column: 3, Offset: 13}, 1), s.Scan().Span())
+	assert.EqualValues(t, source.PointSpan(lexer.Position{Line: 1, Column: 4, Offset: 14}), s.Scan().Span())
+}
+
+func TestTokenize(t *testing.T) {
+	tokens, errors := lexer.Tokenize(strings.NewReader("x = 1 & 2;"))
+	assert.EqualValues(t, []lexer.Token{
+		token(lexer.ID, "x", 0),
+		token(lexer.EQUALS, "=", 2),
+		token(lexer.NUM, "1", 4),
+		token(lexer.ILLEGAL, "&", 6),
+		token(lexer.NUM, "2", 8),
+		token(lexer.SEMICOLON, ";", 9),
+		{TokenType: lexer.EOF, Lexeme: "EOF", Position: lexer.Position{Column: 10, Offset: 10},
+			End: lexer.Position{Column: 10, Offset: 10}},
+	}, tokens)
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.IllegalCharacter,
+			source.NewSpan(lexer.Position{Line: 0, Column: 6, Offset: 6}, 1), "illegal character '&'"),
+	}, errors)
+}
+
+func TestTokenJSON(t *testing.T) {
+	token := lexer.Token{TokenType: lexer.STATICCAST, Lexeme: "static_cast",
+		Position: lexer.Position{Line: 2, Column: 4, Offset: 20},
+		End:      lexer.Position{Line: 2, Column: 15, Offset: 31}}
+
+	data, err := json.Marshal(token)
+	assert.NoError(t, err)
+	assert.EqualValues(t, `{"type":"STATICCAST","lexeme":"static_cast",`+
+		`"position":{"line":2,"column":4,"offset":20},"end":{"line":2,"column":15,"offset":31}}`,
+		string(data))
+
+	var decoded lexer.Token
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.EqualValues(t, token, decoded)
+
+	assert.EqualError(t, json.Unmarshal([]byte(`{"type":"GOTO"}`), &decoded),
+		`unknown token type "GOTO"`)
+}
+
+// token returns a token on the first line, which contains only single-byte characters.
+func token(tokenType lexer.TokenType, lexeme string, column int) lexer.Token {
+	span := source.NewSpan(lexer.Position{Column: column, Offset: column}, len(lexeme))
+	return lexer.Token{TokenType: tokenType, Lexeme: lexeme, Position: span.Start, End: span.End}
+}
+
 func assertToken(t *testing.T, s *lexer.Scanner, tokenType lexer.TokenType, lexeme string) lexer.Token {
 	token := s.Scan()
 	if token.TokenType != tokenType {
@@ -1,5 +1,11 @@
 package lexer
 
+import (
+	"fmt"
+
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+)
+
 // Token represents a lexical token.
 type TokenType int
 
@@ -48,15 +54,31 @@ const (
 
 // Position specifies the line and character position of a token.
 // The Column and Line are both zero-based indexes.
-type Position struct {
-	Line   int
-	Column int
-}
+type Position = source.Position
 
 type Token struct {
-	TokenType TokenType
-	Lexeme    string
-	Position  Position
+	TokenType TokenType `json:"type"`
+	Lexeme    string    `json:"lexeme"`
+	Position  Position  `json:"position"`
+	// End is the position right after the last character of the token.
+	End Position `json:"end"`
+	// Leading and Trailing are the comments around the token. They are only
+	// collected if the scanner is in Trivia mode.
+	Leading  []Comment `json:"leading,omitempty"`
+	Trailing []Comment `json:"trailing,omitempty"`
+}
+
+// Span returns the range of the token in the source file.
+func (t Token) Span() source.Span {
+	return source.Span{Start: t.Position, End: t.End}
+}
+
+// Comment is a /* ... */ comment in the source code. Comments are not tokens, so the
+// scanner collects them separately.
+type Comment struct {
+	// Text contains the whole comment, including the /* and */.
+	Text string      `json:"text"`
+	Span source.Span `json:"span"`
 }
 
 var tokens = [...]string{
@@ -100,6 +122,39 @@ var tokens = [...]string{
 	NUM: "NUM",
 }
 
+var tokenNames = [...]string{
+	ILLEGAL:    "ILLEGAL",
+	EOF:        "EOF",
+	LPAREN:     "LPAREN",
+	RPAREN:     "RPAREN",
+	LBRACKET:   "LBRACKET",
+	RBRACKET:   "RBRACKET",
+	COMMA:      "COMMA",
+	SEMICOLON:  "SEMICOLON",
+	COLON:      "COLON",
+	EQUALS:     "EQUALS",
+	BREAK:      "BREAK",
+	CASE:       "CASE",
+	DEFAULT:    "DEFAULT",
+	ELSE:       "ELSE",
+	FLOAT:      "FLOAT",
+	IF:         "IF",
+	INPUT:      "INPUT",
+	INT:        "INT",
+	OUTPUT:     "OUTPUT",
+	STATICCAST: "STATICCAST",
+	SWITCH:     "SWITCH",
+	WHILE:      "WHILE",
+	RELOP:      "RELOP",
+	ADDOP:      "ADDOP",
+	MULOP:      "MULOP",
+	OR:         "OR",
+	AND:        "AND",
+	NOT:        "NOT",
+	ID:         "ID",
+	NUM:        "NUM",
+}
+
 // String returns the string representation of the token.
 func (tok TokenType) String() string {
 	if tok >= 0 && tok < TokenType(len(tokens)) {
@@ -107,3 +162,28 @@ func (tok TokenType) String() string {
 	}
 	return ""
 }
+
+// Name returns the name of the token type constant, e.g LPAREN.
+func (tok TokenType) Name() string {
+	if tok >= 0 && tok < TokenType(len(tokenNames)) {
+		return tokenNames[tok]
+	}
+	return ""
+}
+
+// MarshalText encodes the token type as its name.
+func (tok TokenType) MarshalText() ([]byte, error) {
+	return []byte(tok.Name()), nil
+}
+
+// UnmarshalText decodes a token type from its name.
+func (tok *TokenType) UnmarshalText(text []byte) error {
+	for i, name := range tokenNames {
+		if name == string(text) {
+			*tok = TokenType(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown token type %q", text)
+}
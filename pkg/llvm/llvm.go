@@ -0,0 +1,500 @@
+// Package llvm translates CPL programs to LLVM IR in text format, so they can be
+// optimized and compiled to native code by clang, or run with lli.
+//
+// Every CPL variable is an alloca in the main function, which LLVM promotes to registers
+// when optimizing. ints are i64 and floats are double, like in Quad, and the runtime
+// functions that read and print them call the C library, so the program behaves like
+// its Quad code: floats are printed like the Quad interpreter prints them, and division
+// by zero and invalid input stop the program with a runtime error. Unlike in Quad,
+// variables start at 0, and converting a float that doesn't fit in an int saturates.
+//
+// The IR uses opaque pointers, which are the default since LLVM 15.
+package llvm
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+)
+
+// indentation is the text that indents every instruction of the generated code.
+const indentation = "  "
+
+// Generator translates a CPL AST to LLVM IR. The AST must be annotated by semantic
+// analysis first, and must not contain semantic errors.
+type Generator struct {
+	Variables  map[string]parser.DataType
+	body       strings.Builder
+	nameIndex  int
+	breakStack []string
+	used       map[string]bool
+	declared   map[string]bool
+}
+
+// Value is the result of generating code for a CPL expression: a register or a constant
+// that holds its value, and its type. Like codegen.Expression, the type comes from the
+// types that semantic analysis resolves.
+type Value struct {
+	Operand string
+	Type    parser.DataType
+}
+
+// NewGenerator returns a new instance of Generator.
+func NewGenerator() *Generator {
+	return &Generator{
+		Variables:  map[string]parser.DataType{},
+		nameIndex:  0,
+		breakStack: []string{},
+		used:       map[string]bool{},
+		declared:   map[string]bool{},
+	}
+}
+
+// Generate generates an LLVM module from a CPL program that passed semantic analysis.
+func Generate(program *parser.Program) string {
+	return NewGenerator().GenerateProgram(program)
+}
+
+// GenerateProgram generates an LLVM module with a main function that runs the statements
+// of the CPL program.
+func (g *Generator) GenerateProgram(node *parser.Program) string {
+	names := []string{}
+	for _, declaration := range node.Declarations {
+		for _, name := range declaration.Names {
+			if _, exists := g.Variables[name]; !exists {
+				g.Variables[name] = declaration.Type
+				names = append(names, name)
+			}
+		}
+	}
+
+	if node.StatementsBlock != nil {
+		for _, statement := range node.StatementsBlock.Statements {
+			g.GenerateStatement(statement)
+		}
+	}
+
+	var b strings.Builder
+	for _, function := range runtime {
+		if g.used[function.name] {
+			for _, name := range function.externals {
+				g.declared[name] = true
+			}
+		}
+	}
+	for _, external := range externals {
+		if g.declared[external.name] {
+			b.WriteString(external.declaration)
+			b.WriteString("\n")
+		}
+	}
+	if len(g.declared) > 0 {
+		b.WriteString("\n")
+	}
+
+	for _, function := range runtime {
+		if g.used[function.name] {
+			b.WriteString(function.source)
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("define i32 @main() {\nentry:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s%s = alloca %s\n", indentation, variableName(name),
+			typeName(g.Variables[name]))
+	}
+	for _, name := range names {
+		fmt.Fprintf(&b, "%sstore %s %s, ptr %s\n", indentation, typeName(g.Variables[name]),
+			zero(g.Variables[name]), variableName(name))
+	}
+	b.WriteString(g.body.String())
+	b.WriteString(indentation + "ret i32 0\n}\n")
+
+	return b.String()
+}
+
+// GenerateStatement generates code for a CPL statement.
+func (g *Generator) GenerateStatement(node parser.Statement) {
+	switch s := node.(type) {
+	case *parser.AssignmentStatement:
+		g.GenerateAssignmentStatement(s)
+	case *parser.InputStatement:
+		g.GenerateInputStatement(s)
+	case *parser.OutputStatement:
+		g.GenerateOutputStatement(s)
+	case *parser.IfStatement:
+		g.GenerateIfStatement(s)
+	case *parser.WhileStatement:
+		g.GenerateWhileStatement(s)
+	case *parser.SwitchStatement:
+		g.GenerateSwitchStatement(s)
+	case *parser.BreakStatement:
+		g.GenerateBreakStatement(s)
+	case *parser.StatementsBlock:
+		g.GenerateStatementsBlock(s)
+	}
+}
+
+// GenerateAssignmentStatement generates code for assignment statements.
+func (g *Generator) GenerateAssignmentStatement(node *parser.AssignmentStatement) {
+	value := g.GenerateExpression(node.Value)
+	if node.CastType != parser.Unknown {
+		value = g.convert(value, node.CastType)
+	}
+
+	dataType := g.Variables[node.Variable]
+	value = g.convert(value, dataType)
+	g.line("store %s %s, ptr %s", typeName(dataType), value.Operand, variableName(node.Variable))
+}
+
+// GenerateInputStatement generates code for input statements.
+func (g *Generator) GenerateInputStatement(node *parser.InputStatement) {
+	dataType := g.Variables[node.Variable]
+	function := inputIntFunction
+	if dataType == parser.Float {
+		function = inputFloatFunction
+	}
+
+	result := g.newRegister()
+	g.line("%s = call %s @%s()", result, typeName(dataType), g.use(function))
+	g.line("store %s %s, ptr %s", typeName(dataType), result, variableName(node.Variable))
+}
+
+// GenerateOutputStatement generates code for output statements.
+func (g *Generator) GenerateOutputStatement(node *parser.OutputStatement) {
+	value := g.GenerateExpression(node.Value)
+	function := outputIntFunction
+	if value.Type == parser.Float {
+		function = outputFloatFunction
+	}
+
+	g.line("call void @%s(%s %s)", g.use(function), typeName(value.Type), value.Operand)
+}
+
+// GenerateIfStatement generates code for if statements.
+func (g *Generator) GenerateIfStatement(node *parser.IfStatement) {
+	thenLabel := g.newLabel("then")
+	elseLabel := ""
+	if node.ElseBranch != nil {
+		elseLabel = g.newLabel("else")
+	}
+	endLabel := g.newLabel("endif")
+	if node.ElseBranch == nil {
+		elseLabel = endLabel
+	}
+
+	g.GenerateCondition(node.Condition, thenLabel, elseLabel)
+
+	g.label(thenLabel)
+	g.GenerateStatement(node.IfBranch)
+	g.branch(endLabel)
+
+	if node.ElseBranch != nil {
+		g.label(elseLabel)
+		g.GenerateStatement(node.ElseBranch)
+		g.branch(endLabel)
+	}
+
+	g.label(endLabel)
+}
+
+// GenerateWhileStatement generates code for while statements.
+func (g *Generator) GenerateWhileStatement(node *parser.WhileStatement) {
+	conditionLabel := g.newLabel("while")
+	bodyLabel := g.newLabel("body")
+	endLabel := g.newLabel("endwhile")
+
+	g.branch(conditionLabel)
+	g.label(conditionLabel)
+	g.GenerateCondition(node.Condition, bodyLabel, endLabel)
+
+	g.label(bodyLabel)
+	g.breakStack = append(g.breakStack, endLabel)
+	g.GenerateStatement(node.Body)
+	g.breakStack = g.breakStack[:len(g.breakStack)-1]
+	g.branch(conditionLabel)
+
+	g.label(endLabel)
+}
+
+// GenerateSwitchStatement generates code for switch statements. Like in Quad, a case
+// without a break falls through to the next case.
+func (g *Generator) GenerateSwitchStatement(node *parser.SwitchStatement) {
+	value := g.GenerateExpression(node.Expression)
+
+	caseLabels := make([]string, len(node.Cases))
+	for i := range node.Cases {
+		caseLabels[i] = g.newLabel("case")
+	}
+	defaultLabel := g.newLabel("default")
+	endLabel := g.newLabel("endswitch")
+
+	// LLVM doesn't allow duplicate case values, and only the first of them is jumped to.
+	g.line("switch i64 %s, label %%%s [", value.Operand, defaultLabel)
+	cases := map[int64]bool{}
+	for i, switchCase := range node.Cases {
+		if !cases[switchCase.Value] {
+			cases[switchCase.Value] = true
+			g.line("%si64 %d, label %%%s", indentation, switchCase.Value, caseLabels[i])
+		}
+	}
+	g.line("]")
+
+	g.breakStack = append(g.breakStack, endLabel)
+	for i, switchCase := range node.Cases {
+		next := defaultLabel
+		if i+1 < len(node.Cases) {
+			next = caseLabels[i+1]
+		}
+
+		g.label(caseLabels[i])
+		for _, statement := range switchCase.Statements {
+			g.GenerateStatement(statement)
+		}
+		g.branch(next)
+	}
+
+	g.label(defaultLabel)
+	for _, statement := range node.DefaultCase {
+		g.GenerateStatement(statement)
+	}
+	g.breakStack = g.breakStack[:len(g.breakStack)-1]
+	g.branch(endLabel)
+
+	g.label(endLabel)
+}
+
+// GenerateBreakStatement generates code for break statements. Every basic block ends
+// with a single branch, so the statements after the break start a new block, which is
+// unreachable.
+func (g *Generator) GenerateBreakStatement(node *parser.BreakStatement) {
+	g.branch(g.breakStack[len(g.breakStack)-1])
+	g.label(g.newLabel("afterbreak"))
+}
+
+// GenerateStatementsBlock generates code for a statements block.
+func (g *Generator) GenerateStatementsBlock(node *parser.StatementsBlock) {
+	for _, statement := range node.Statements {
+		g.GenerateStatement(statement)
+	}
+}
+
+// GenerateExpression generates code for a CPL expression, and returns its value.
+func (g *Generator) GenerateExpression(node parser.Expression) Value {
+	switch s := node.(type) {
+	case *parser.ArithmeticExpression:
+		return g.GenerateArithmeticExpression(s)
+	case *parser.VariableExpression:
+		result := g.newRegister()
+		g.line("%s = load %s, ptr %s", result, typeName(s.Type), variableName(s.Variable))
+		return Value{result, s.Type}
+	case *parser.IntLiteral:
+		return Value{strconv.FormatInt(s.Value, 10), s.Type}
+	case *parser.FloatLiteral:
+		return Value{floatLiteral(s.Value), s.Type}
+	}
+
+	panic(fmt.Sprintf("llvm: unexpected expression %T", node))
+}
+
+// GenerateArithmeticExpression generates code for an arithmetic expression. Integer
+// arithmetic wraps around like in Quad, and division calls a runtime function that
+// checks for division by zero.
+func (g *Generator) GenerateArithmeticExpression(node *parser.ArithmeticExpression) Value {
+	lhs := g.convert(g.GenerateExpression(node.LHS), node.Type)
+	rhs := g.convert(g.GenerateExpression(node.RHS), node.Type)
+	dataType := typeName(node.Type)
+	result := g.newRegister()
+
+	if node.Operator == parser.Divide {
+		function := intDivideFunction
+		if node.Type == parser.Float {
+			function = floatDivideFunction
+		}
+		g.line("%s = call %s @%s(%s %s, %s %s)", result, dataType, g.use(function),
+			dataType, lhs.Operand, dataType, rhs.Operand)
+		return Value{result, node.Type}
+	}
+
+	instructions := map[parser.Operator]string{parser.Add: "add", parser.Subtract: "sub",
+		parser.Multiply: "mul"}
+	instruction := instructions[node.Operator]
+	if node.Type == parser.Float {
+		instruction = "f" + instruction
+	}
+
+	g.line("%s = %s %s %s, %s", result, instruction, dataType, lhs.Operand, rhs.Operand)
+	return Value{result, node.Type}
+}
+
+// GenerateCondition generates code that evaluates a CPL boolean expression, and branches
+// to trueLabel if it's true or to falseLabel if it's false. Like in C, the RHS of && and
+// || is only evaluated if the LHS doesn't decide the result of the whole expression.
+func (g *Generator) GenerateCondition(node parser.BooleanExpression, trueLabel string,
+	falseLabel string) {
+	switch s := node.(type) {
+	case *parser.OrBooleanExpression:
+		rhsLabel := g.newLabel("or")
+		g.GenerateCondition(s.LHS, trueLabel, rhsLabel)
+		g.label(rhsLabel)
+		g.GenerateCondition(s.RHS, trueLabel, falseLabel)
+
+	case *parser.AndBooleanExpression:
+		rhsLabel := g.newLabel("and")
+		g.GenerateCondition(s.LHS, rhsLabel, falseLabel)
+		g.label(rhsLabel)
+		g.GenerateCondition(s.RHS, trueLabel, falseLabel)
+
+	case *parser.NotBooleanExpression:
+		g.GenerateCondition(s.Value, falseLabel, trueLabel)
+
+	case *parser.CompareBooleanExpression:
+		result := g.GenerateComparison(s)
+		g.line("br i1 %s, label %%%s, label %%%s", result, trueLabel, falseLabel)
+
+	default:
+		panic(fmt.Sprintf("llvm: unexpected boolean expression %T", node))
+	}
+}
+
+// GenerateComparison generates code for a comparison, and returns the i1 register that
+// holds its result. Like in Quad, a comparison with NaN is false, except for !=.
+func (g *Generator) GenerateComparison(node *parser.CompareBooleanExpression) string {
+	lhs := g.GenerateExpression(node.LHS)
+	rhs := g.GenerateExpression(node.RHS)
+
+	dataType := parser.Integer
+	if lhs.Type == parser.Float || rhs.Type == parser.Float {
+		dataType = parser.Float
+	}
+	lhs = g.convert(lhs, dataType)
+	rhs = g.convert(rhs, dataType)
+
+	instruction := "icmp"
+	conditions := map[parser.Operator]string{
+		parser.EqualTo: "eq", parser.NotEqualTo: "ne", parser.GreaterThan: "sgt",
+		parser.LessThan: "slt", parser.GreaterThanOrEqualTo: "sge", parser.LessThenOrEqualTo: "sle",
+	}
+	if dataType == parser.Float {
+		instruction = "fcmp"
+		conditions = map[parser.Operator]string{
+			parser.EqualTo: "oeq", parser.NotEqualTo: "une", parser.GreaterThan: "ogt",
+			parser.LessThan: "olt", parser.GreaterThanOrEqualTo: "oge", parser.LessThenOrEqualTo: "ole",
+		}
+	}
+
+	result := g.newRegister()
+	g.line("%s = %s %s %s %s, %s", result, instruction, conditions[node.Operator],
+		typeName(dataType), lhs.Operand, rhs.Operand)
+	return result
+}
+
+// convert converts a value to the given type, if it has a different type. Converting a
+// float to an int truncates it, and saturates if it doesn't fit.
+func (g *Generator) convert(value Value, dataType parser.DataType) Value {
+	if value.Type == dataType {
+		return value
+	}
+
+	// Int literals are converted when generating the code.
+	if literal, err := strconv.ParseInt(value.Operand, 10, 64); err == nil && dataType == parser.Float {
+		return Value{floatLiteral(float64(literal)), dataType}
+	}
+
+	result := g.newRegister()
+	if dataType == parser.Float {
+		g.line("%s = sitofp i64 %s to double", result, value.Operand)
+	} else {
+		g.declared[floatToIntExternal] = true
+		g.line("%s = call i64 @%s(double %s)", result, floatToIntExternal, value.Operand)
+	}
+	return Value{result, dataType}
+}
+
+// newRegister returns a new virtual register. Registers and labels are numbered
+// together, so their names are unique in the function.
+func (g *Generator) newRegister() string {
+	g.nameIndex++
+	return fmt.Sprintf("%%t%d", g.nameIndex)
+}
+
+// newLabel returns a new label of a basic block, with the given prefix.
+func (g *Generator) newLabel(prefix string) string {
+	g.nameIndex++
+	return fmt.Sprintf("%s%d", prefix, g.nameIndex)
+}
+
+// label starts a new basic block.
+func (g *Generator) label(name string) {
+	fmt.Fprintf(&g.body, "%s:\n", name)
+}
+
+// branch ends the current basic block with an unconditional branch.
+func (g *Generator) branch(label string) {
+	g.line("br label %%%s", label)
+}
+
+// line writes an instruction.
+func (g *Generator) line(format string, args ...interface{}) {
+	g.body.WriteString(indentation)
+	fmt.Fprintf(&g.body, format, args...)
+	g.body.WriteString("\n")
+}
+
+// use marks a runtime function, and the functions it calls, as used by the program.
+func (g *Generator) use(name string) string {
+	for _, function := range runtime {
+		if function.name == name {
+			g.used[name] = true
+			for _, dependency := range function.dependencies {
+				g.use(dependency)
+			}
+		}
+	}
+	return name
+}
+
+// variableName returns the name of the alloca of a CPL variable.
+func variableName(name string) string {
+	return "%v_" + name
+}
+
+func typeName(dataType parser.DataType) string {
+	if dataType == parser.Float {
+		return "double"
+	}
+	return "i64"
+}
+
+func zero(dataType parser.DataType) string {
+	if dataType == parser.Float {
+		return "0.0"
+	}
+	return "0"
+}
+
+// floatLiteral returns an LLVM double constant with the exact value of f. LLVM only
+// accepts decimal constants that are exactly representable, so other values are
+// written in hexadecimal.
+func floatLiteral(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if exact, ok := new(big.Rat).SetString(s); !ok || math.IsInf(f, 0) ||
+		exact.Cmp(new(big.Rat).SetFloat64(f)) != 0 {
+		return fmt.Sprintf("0x%016X", math.Float64bits(f))
+	}
+
+	// LLVM requires a decimal point in the mantissa.
+	mantissa, exponent := s, ""
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		mantissa, exponent = s[:i], s[i:]
+	}
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	return mantissa + exponent
+}
@@ -0,0 +1,341 @@
+package llvm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/internal/cpltest"
+	"github.com/alongubkin/cpl-compiler/pkg/llvm"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+// mainBody returns the instructions of the main function, without the allocas of the
+// variables and the return instruction.
+func mainBody(t *testing.T, code string) string {
+	output := llvm.Generate(cpltest.Analyze(t, code))
+	start := strings.Index(output, "define i32 @main() {\nentry:\n")
+	end := strings.LastIndex(output, "  ret i32 0\n")
+	if !assert.True(t, start >= 0 && end > start) {
+		return ""
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(output[start:end], "\n")[2:] {
+		if !strings.Contains(line, "= alloca ") && !strings.HasPrefix(line, "  store i64 0, ") &&
+			!strings.HasPrefix(line, "  store double 0.0, ") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestGenerateProgram(t *testing.T) {
+	assert.EqualValues(t, `declare i32 @printf(ptr, ...)
+
+@.int_output_format = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+
+define internal void @cpl_output_int(i64 %value) {
+entry:
+  call i32 (ptr, ...) @printf(ptr @.int_output_format, i64 %value)
+  ret void
+}
+
+define i32 @main() {
+entry:
+  %v_a = alloca i64
+  %v_b = alloca i64
+  %v_x = alloca double
+  store i64 0, ptr %v_a
+  store i64 0, ptr %v_b
+  store double 0.0, ptr %v_x
+  store i64 5, ptr %v_a
+  %t1 = load i64, ptr %v_a
+  call void @cpl_output_int(i64 %t1)
+  ret i32 0
+}
+`, llvm.Generate(cpltest.Analyze(t, "a, b : int;\nx : float;\n{ a = 5; output(a); }")))
+}
+
+func TestGenerateRuntimeDependencies(t *testing.T) {
+	output := llvm.Generate(cpltest.Analyze(t, "a : int;\n{ input(a); }"))
+	assert.Contains(t, output, "define internal void @cpl_error(ptr %message) noreturn {")
+	assert.Contains(t, output, "define internal i64 @cpl_input_int() {")
+	assert.Contains(t, output, "declare i32 @scanf(ptr, ...)\n")
+	assert.Contains(t, output, "declare void @exit(i32) noreturn\n")
+	assert.NotContains(t, output, "@cpl_output_int")
+	assert.NotContains(t, output, "@printf")
+
+	output = llvm.Generate(cpltest.Analyze(t, "x : float;\n{ x = x / 2; }"))
+	assert.Contains(t, output, "define internal double @cpl_rdiv(double %a, double %b) {")
+	assert.NotContains(t, output, "@cpl_idiv")
+}
+
+func TestGenerateArithmetic(t *testing.T) {
+	assert.EqualValues(t, `  %t1 = load i64, ptr %v_a
+  %t2 = load i64, ptr %v_a
+  %t3 = mul i64 %t2, 2
+  %t4 = sub i64 %t1, %t3
+  store i64 %t4, ptr %v_a
+  %t5 = load double, ptr %v_x
+  %t6 = load i64, ptr %v_a
+  %t7 = sitofp i64 %t6 to double
+  %t8 = fmul double %t5, %t7
+  %t9 = fadd double %t8, 0x3FB999999999999A
+  store double %t9, ptr %v_x
+  %t10 = load i64, ptr %v_a
+  %t11 = call i64 @cpl_idiv(i64 %t10, i64 3)
+  %t12 = sitofp i64 %t11 to double
+  store double %t12, ptr %v_x
+`, mainBody(t, `a : int;
+x : float;
+{
+    a = a - a * 2;
+    x = x * a + 0.1;
+    x = a / 3;
+}`))
+}
+
+func TestGenerateCast(t *testing.T) {
+	assert.EqualValues(t, `  %t1 = load double, ptr %v_x
+  %t2 = fmul double %t1, 2.0
+  %t3 = call i64 @llvm.fptosi.sat.i64.f64(double %t2)
+  store i64 %t3, ptr %v_a
+  %t4 = load double, ptr %v_x
+  %t5 = call i64 @llvm.fptosi.sat.i64.f64(double %t4)
+  %t6 = sitofp i64 %t5 to double
+  store double %t6, ptr %v_x
+  %t7 = load i64, ptr %v_a
+  %t8 = sitofp i64 %t7 to double
+  store double %t8, ptr %v_x
+`, mainBody(t, `a : int;
+x : float;
+{
+    a = static_cast(int) (x * 2.0);
+    x = static_cast(int) x;
+    x = static_cast(float) a;
+}`))
+
+	assert.Contains(t, llvm.Generate(cpltest.Analyze(t, "a : int;\n{ a = static_cast(int) 2.5; }")),
+		"declare i64 @llvm.fptosi.sat.i64.f64(double)\n")
+}
+
+func TestGenerateInputOutput(t *testing.T) {
+	assert.EqualValues(t, `  %t1 = call i64 @cpl_input_int()
+  store i64 %t1, ptr %v_a
+  %t2 = call double @cpl_input_float()
+  store double %t2, ptr %v_x
+  %t3 = load i64, ptr %v_a
+  %t4 = sitofp i64 %t3 to double
+  %t5 = fadd double %t4, 1.5
+  call void @cpl_output_float(double %t5)
+`, mainBody(t, "a : int;\nx : float;\n{ input(a); input(x); output(a + 1.5); }"))
+}
+
+func TestGenerateControlFlow(t *testing.T) {
+	assert.EqualValues(t, `  br label %while1
+while1:
+  %t5 = load i64, ptr %v_a
+  %t6 = icmp sgt i64 %t5, 0
+  br i1 %t6, label %and4, label %endwhile3
+and4:
+  %t7 = load double, ptr %v_x
+  %t8 = fcmp oge double %t7, 1.0
+  br i1 %t8, label %body2, label %endwhile3
+body2:
+  %t13 = load i64, ptr %v_a
+  %t14 = icmp eq i64 %t13, 5
+  br i1 %t14, label %then9, label %or12
+or12:
+  %t15 = load double, ptr %v_x
+  %t16 = fcmp une double %t15, 2.0
+  br i1 %t16, label %else10, label %then9
+then9:
+  br label %endwhile3
+afterbreak17:
+  br label %endif11
+else10:
+  %t18 = load i64, ptr %v_a
+  %t19 = sub i64 %t18, 1
+  store i64 %t19, ptr %v_a
+  br label %endif11
+endif11:
+  br label %while1
+endwhile3:
+`, mainBody(t, `a : int;
+x : float;
+{
+    while (a > 0 && x >= 1) {
+        if (a == 5 || !(x != 2.0)) break; else a = a - 1;
+    }
+}`))
+}
+
+func TestGenerateIfElse(t *testing.T) {
+	assert.EqualValues(t, `  %t4 = load i64, ptr %v_a
+  %t5 = icmp slt i64 %t4, 1
+  br i1 %t5, label %then1, label %else2
+then1:
+  call void @cpl_output_int(i64 1)
+  br label %endif3
+else2:
+  call void @cpl_output_int(i64 2)
+  br label %endif3
+endif3:
+`, mainBody(t, "a : int;\n{ if (a < 1) output(1); else output(2); }"))
+}
+
+func TestGenerateSwitch(t *testing.T) {
+	assert.EqualValues(t, `  %t1 = load i64, ptr %v_a
+  switch i64 %t1, label %default5 [
+    i64 1, label %case2
+    i64 2, label %case3
+  ]
+case2:
+  call void @cpl_output_int(i64 1)
+  br label %endswitch6
+afterbreak7:
+  br label %case3
+case3:
+  call void @cpl_output_int(i64 2)
+  br label %case4
+case4:
+  call void @cpl_output_int(i64 3)
+  br label %default5
+default5:
+  call void @cpl_output_int(i64 0)
+  br label %endswitch6
+endswitch6:
+`, mainBody(t, `a : int;
+{
+    switch (a) {
+        case 1: output(1); break;
+        case 2: output(2);
+        case 1: output(3);
+        default: output(0);
+    }
+}`))
+}
+
+// lli returns the command that runs LLVM IR with lli, or skips the test if lli isn't
+// installed. LLVM 14 supports opaque pointers only with a flag, and older versions
+// don't support them at all.
+func lli(t *testing.T, file string) *exec.Cmd {
+	path, err := exec.LookPath("lli")
+	if err != nil {
+		t.Skip("lli is required to test the generated code")
+	}
+
+	output, err := exec.Command(path, "--version").Output()
+	assert.NoError(t, err)
+	match := regexp.MustCompile(`LLVM version (\d+)`).FindSubmatch(output)
+	if match == nil {
+		t.Skip("unknown version of lli")
+	}
+
+	version, _ := strconv.Atoi(string(match[1]))
+	switch {
+	case version < 14:
+		t.Skip("LLVM 14 or newer is required to test the generated code")
+	case version == 14:
+		return exec.Command(path, "-opaque-pointers", file)
+	}
+	return exec.Command(path, file)
+}
+
+// execute runs LLVM IR with the given input, and returns its stdout and stderr.
+func execute(t *testing.T, dir string, program *parser.Program, input string) (string, string, error) {
+	source := filepath.Join(dir, "program.ll")
+	assert.NoError(t, ioutil.WriteFile(source, []byte(llvm.Generate(program)), 0644))
+
+	return cpltest.Run(lli(t, source), input)
+}
+
+func TestGenerateExamples(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llvm")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, example := range cpltest.Examples(t) {
+		stdout, stderr, err := execute(t, dir, example.Program, example.Input)
+		assert.NoError(t, err, example.Name)
+		assert.Empty(t, stderr, example.Name)
+		assert.EqualValues(t, example.Output, stdout, example.Name)
+	}
+}
+
+func TestGenerateFloats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llvm")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	program := cpltest.Analyze(t, `x, y : float;
+{
+    output(0.1 + 0.2);
+    output(10000000000000000.0);
+    output(1000000000000000.0);
+    output(100000000000000000000.0);
+    output(0.00001);
+    output(0.0001);
+    output(123456789.125);
+    output(1 / 3.0);
+    output(0.0 - 2.5);
+    input(x);
+    output(x * x);
+    output(0.0 - x * x);
+    y = x * x - x * x;
+    output(y);
+    if (y == y) output(1); else output(0);
+    if (y != y) output(1); else output(0);
+    if (y < 1.0) output(1); else output(0);
+    if (y >= 1.0) output(1); else output(0);
+    if (y <= 1.0) output(1); else output(0);
+}`)
+
+	assert.Contains(t, llvm.Generate(program), "call void @cpl_output_float(double 1.0e+20)\n")
+
+	stdout, _, err := execute(t, dir, program, "1e200\n")
+	assert.NoError(t, err)
+	assert.EqualValues(t, cpltest.InterpretProgram(t, program, "1e200\n"), stdout)
+}
+
+func TestGenerateRuntimeErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llvm")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	program := cpltest.Analyze(t, `a : int;
+x : float;
+{
+    input(a);
+    output(10 / a);
+    output(a / (0 - 1));
+    input(x);
+    output(x / (x - 1));
+}`)
+
+	tests := []struct {
+		input  string
+		stdout string
+		stderr string
+	}{
+		{"4\n0.5\n", "2\n-4\n-1.0\n", ""},
+		{"-9223372036854775808\n0.5\n", "0\n-9223372036854775808\n-1.0\n", ""},
+		{"0\n", "", "RuntimeError: division by zero\n"},
+		{"4\n1\n", "2\n-4\n", "RuntimeError: division by zero\n"},
+		{"4\nabc\n", "2\n-4\n", "RuntimeError: invalid input\n"},
+	}
+
+	for _, test := range tests {
+		stdout, stderr, err := execute(t, dir, program, test.input)
+		assert.Equal(t, test.stderr == "", err == nil, test.input)
+		assert.EqualValues(t, test.stdout, stdout, test.input)
+		assert.EqualValues(t, test.stderr, stderr, test.input)
+	}
+}
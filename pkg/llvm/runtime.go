@@ -0,0 +1,219 @@
+package llvm
+
+// Runtime functions that the generated code may call. Only the functions that a program
+// uses are written to its output.
+const (
+	errorFunction       = "cpl_error"
+	inputIntFunction    = "cpl_input_int"
+	inputFloatFunction  = "cpl_input_float"
+	outputIntFunction   = "cpl_output_int"
+	outputFloatFunction = "cpl_output_float"
+	intDivideFunction   = "cpl_idiv"
+	floatDivideFunction = "cpl_rdiv"
+)
+
+// External functions that the generated code may call: functions of the C library, and
+// LLVM intrinsics.
+const (
+	dprintfExternal    = "dprintf"
+	exitExternal       = "exit"
+	scanfExternal      = "scanf"
+	printfExternal     = "printf"
+	putsExternal       = "puts"
+	snprintfExternal   = "snprintf"
+	strtodExternal     = "strtod"
+	strchrExternal     = "strchr"
+	atoiExternal       = "atoi"
+	fabsExternal       = "llvm.fabs.f64"
+	floatToIntExternal = "llvm.fptosi.sat.i64.f64"
+)
+
+// external is the declaration of an external function.
+type external struct {
+	name        string
+	declaration string
+}
+
+// externals contains every external function, in the order they're declared.
+var externals = []external{
+	{dprintfExternal, "declare i32 @dprintf(i32, ptr, ...)"},
+	{exitExternal, "declare void @exit(i32) noreturn"},
+	{scanfExternal, "declare i32 @scanf(ptr, ...)"},
+	{printfExternal, "declare i32 @printf(ptr, ...)"},
+	{putsExternal, "declare i32 @puts(ptr)"},
+	{snprintfExternal, "declare i32 @snprintf(ptr, i64, ptr, ...)"},
+	{strtodExternal, "declare double @strtod(ptr, ptr)"},
+	{strchrExternal, "declare ptr @strchr(ptr, i32)"},
+	{atoiExternal, "declare i32 @atoi(ptr)"},
+	{fabsExternal, "declare double @llvm.fabs.f64(double)"},
+	{floatToIntExternal, "declare i64 @llvm.fptosi.sat.i64.f64(double)"},
+}
+
+// runtimeFunction is the LLVM IR of a runtime function, the runtime functions it calls,
+// and the external functions it calls. Every function defines its own constants.
+type runtimeFunction struct {
+	name         string
+	dependencies []string
+	externals    []string
+	source       string
+}
+
+// runtime contains every runtime function, in the order they're written.
+var runtime = []runtimeFunction{
+	// cpl_error(message) prints a runtime error to stderr, and exits with status 1. It also
+	// defines the messages of the other runtime functions.
+	{errorFunction, nil, []string{dprintfExternal, exitExternal}, `@.error_format = private unnamed_addr constant [18 x i8] c"RuntimeError: %s\0A\00"
+@.invalid_input = private unnamed_addr constant [14 x i8] c"invalid input\00"
+@.division_by_zero = private unnamed_addr constant [17 x i8] c"division by zero\00"
+
+define internal void @cpl_error(ptr %message) noreturn {
+entry:
+  call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @.error_format, ptr %message)
+  call void @exit(i32 1)
+  unreachable
+}
+`},
+
+	{inputIntFunction, []string{errorFunction}, []string{scanfExternal}, `@.int_input_format = private unnamed_addr constant [5 x i8] c"%lld\00"
+
+define internal i64 @cpl_input_int() {
+entry:
+  %value = alloca i64
+  %count = call i32 (ptr, ...) @scanf(ptr @.int_input_format, ptr %value)
+  %valid = icmp eq i32 %count, 1
+  br i1 %valid, label %done, label %invalid
+invalid:
+  call void @cpl_error(ptr @.invalid_input)
+  unreachable
+done:
+  %result = load i64, ptr %value
+  ret i64 %result
+}
+`},
+
+	{inputFloatFunction, []string{errorFunction}, []string{scanfExternal}, `@.float_input_format = private unnamed_addr constant [4 x i8] c"%lf\00"
+
+define internal double @cpl_input_float() {
+entry:
+  %value = alloca double
+  %count = call i32 (ptr, ...) @scanf(ptr @.float_input_format, ptr %value)
+  %valid = icmp eq i32 %count, 1
+  br i1 %valid, label %done, label %invalid
+invalid:
+  call void @cpl_error(ptr @.invalid_input)
+  unreachable
+done:
+  %result = load double, ptr %value
+  ret double %result
+}
+`},
+
+	{outputIntFunction, nil, []string{printfExternal}, `@.int_output_format = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+
+define internal void @cpl_output_int(i64 %value) {
+entry:
+  call i32 (ptr, ...) @printf(ptr @.int_output_format, i64 %value)
+  ret void
+}
+`},
+
+	// Floats are printed like the Quad interpreter prints them: the shortest
+	// representation that round-trips, always with a decimal point or an exponent. The
+	// shortest precision is found with snprintf and strtod, and the exponent decides
+	// between the fixed and the scientific notation.
+	{outputFloatFunction, nil, []string{putsExternal, printfExternal, snprintfExternal,
+		strtodExternal, strchrExternal, atoiExternal, fabsExternal}, `@.exponent_format = private unnamed_addr constant [5 x i8] c"%.*e\00"
+@.fixed_format = private unnamed_addr constant [6 x i8] c"%.*f\0A\00"
+@.whole_format = private unnamed_addr constant [8 x i8] c"%.0f.0\0A\00"
+@.nan = private unnamed_addr constant [4 x i8] c"nan\00"
+@.inf = private unnamed_addr constant [4 x i8] c"inf\00"
+@.negative_inf = private unnamed_addr constant [5 x i8] c"-inf\00"
+
+define internal void @cpl_output_float(double %value) {
+entry:
+  %buffer = alloca [32 x i8]
+  %nan = fcmp uno double %value, %value
+  br i1 %nan, label %print_nan, label %check_inf
+check_inf:
+  %abs = call double @llvm.fabs.f64(double %value)
+  %inf = fcmp oeq double %abs, 0x7FF0000000000000
+  br i1 %inf, label %print_inf, label %format
+format:
+  %precision = phi i32 [ 0, %check_inf ], [ %next_precision, %next ]
+  call i32 (ptr, i64, ptr, ...) @snprintf(ptr %buffer, i64 32, ptr @.exponent_format, i32 %precision, double %value)
+  %parsed = call double @strtod(ptr %buffer, ptr null)
+  %exact = fcmp oeq double %parsed, %value
+  br i1 %exact, label %found, label %next
+next:
+  %next_precision = add i32 %precision, 1
+  %last = icmp eq i32 %next_precision, 17
+  br i1 %last, label %found, label %format
+found:
+  %digits = phi i32 [ %precision, %format ], [ %next_precision, %next ]
+  %e = call ptr @strchr(ptr %buffer, i32 101)
+  %exponent_text = getelementptr i8, ptr %e, i64 1
+  %exponent = call i32 @atoi(ptr %exponent_text)
+  %small = icmp slt i32 %exponent, -4
+  %large = icmp sge i32 %exponent, 16
+  %scientific = or i1 %small, %large
+  br i1 %scientific, label %print_scientific, label %check_whole
+check_whole:
+  %fraction = icmp sgt i32 %digits, %exponent
+  br i1 %fraction, label %print_fixed, label %print_whole
+print_scientific:
+  call i32 @puts(ptr %buffer)
+  ret void
+print_fixed:
+  %decimals = sub i32 %digits, %exponent
+  call i32 (ptr, ...) @printf(ptr @.fixed_format, i32 %decimals, double %value)
+  ret void
+print_whole:
+  call i32 (ptr, ...) @printf(ptr @.whole_format, double %value)
+  ret void
+print_nan:
+  call i32 @puts(ptr @.nan)
+  ret void
+print_inf:
+  %negative = fcmp olt double %value, 0.0
+  %text = select i1 %negative, ptr @.negative_inf, ptr @.inf
+  call i32 @puts(ptr %text)
+  ret void
+}
+`},
+
+	// cpl_idiv(a, b) divides ints. sdiv is undefined when dividing the smallest int by
+	// -1, so it negates instead, which wraps around like in Quad.
+	{intDivideFunction, []string{errorFunction}, nil, `define internal i64 @cpl_idiv(i64 %a, i64 %b) {
+entry:
+  %zero = icmp eq i64 %b, 0
+  br i1 %zero, label %error, label %check_negative
+error:
+  call void @cpl_error(ptr @.division_by_zero)
+  unreachable
+check_negative:
+  %negative = icmp eq i64 %b, -1
+  br i1 %negative, label %negate, label %divide
+negate:
+  %negated = sub i64 0, %a
+  ret i64 %negated
+divide:
+  %result = sdiv i64 %a, %b
+  ret i64 %result
+}
+`},
+
+	// cpl_rdiv(a, b) divides floats. NaN isn't equal to 0, so dividing by NaN isn't an
+	// error.
+	{floatDivideFunction, []string{errorFunction}, nil, `define internal double @cpl_rdiv(double %a, double %b) {
+entry:
+  %zero = fcmp oeq double %b, 0.0
+  br i1 %zero, label %error, label %divide
+error:
+  call void @cpl_error(ptr @.division_by_zero)
+  unreachable
+divide:
+  %result = fdiv double %a, %b
+  ret double %result
+}
+`},
+}
@@ -0,0 +1,133 @@
+package optimize
+
+import "github.com/alongubkin/cpl-compiler/pkg/quad"
+
+// Block is a basic block: a sequence of instructions that can only be entered at its
+// start and left at its end. The LABEL pseudo-instructions that mark the start of the
+// block are its first instructions.
+type Block struct {
+	Index        int
+	Instructions []quad.Instruction
+	Successors   []*Block
+	Predecessors []*Block
+}
+
+// CFG is the control flow graph of a Quad program. Blocks are kept in the order of
+// the program, so the first block is the entry point, and a block that doesn't end
+// with a jump falls through to the next one.
+type CFG struct {
+	Blocks []*Block
+	// labels maps the index of every label to the block it marks.
+	labels map[int]*Block
+}
+
+// NewCFG splits a labeled Quad program into basic blocks, and connects them.
+func NewCFG(instructions []quad.Instruction) *CFG {
+	g := &CFG{Blocks: []*Block{}, labels: map[int]*Block{}}
+
+	var current *Block
+	for _, instruction := range instructions {
+		// Labels start a new block, unless the current block contains only labels.
+		if current == nil || (instruction.Opcode == quad.LABEL && !onlyLabels(current)) {
+			current = &Block{Index: len(g.Blocks)}
+			g.Blocks = append(g.Blocks, current)
+		}
+
+		current.Instructions = append(current.Instructions, instruction)
+		if instruction.Opcode == quad.LABEL {
+			g.labels[instruction.Operands[0].Index] = current
+		}
+
+		if isBranch(instruction.Opcode) {
+			current = nil
+		}
+	}
+
+	for i, block := range g.Blocks {
+		last := block.Instructions[len(block.Instructions)-1]
+		switch last.Opcode {
+		case quad.JUMP:
+			g.connect(block, g.labels[last.Operands[0].Index])
+			continue
+		case quad.JMPZ:
+			g.connect(block, g.labels[last.Operands[0].Index])
+		case quad.HALT:
+			continue
+		}
+
+		if i+1 < len(g.Blocks) {
+			g.connect(block, g.Blocks[i+1])
+		}
+	}
+
+	return g
+}
+
+// Instructions returns the instructions of all the blocks, in order.
+func (g *CFG) Instructions() []quad.Instruction {
+	instructions := []quad.Instruction{}
+	for _, block := range g.Blocks {
+		instructions = append(instructions, block.Instructions...)
+	}
+	return instructions
+}
+
+// Target returns the block that a label marks, or nil if the label isn't defined.
+func (g *CFG) Target(label quad.Operand) *Block {
+	return g.labels[label.Index]
+}
+
+// Reachable returns the blocks that can be reached from the entry point, indexed by
+// their Index.
+func (g *CFG) Reachable() []bool {
+	reachable := make([]bool, len(g.Blocks))
+	if len(g.Blocks) == 0 {
+		return reachable
+	}
+
+	stack := []*Block{g.Blocks[0]}
+	reachable[0] = true
+	for len(stack) > 0 {
+		block := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, successor := range block.Successors {
+			if !reachable[successor.Index] {
+				reachable[successor.Index] = true
+				stack = append(stack, successor)
+			}
+		}
+	}
+
+	return reachable
+}
+
+// connect adds an edge between two blocks. Jumps to undefined labels are reported by
+// the assembler, so they don't add edges.
+func (g *CFG) connect(from *Block, to *Block) {
+	if to == nil {
+		return
+	}
+
+	from.Successors = append(from.Successors, to)
+	to.Predecessors = append(to.Predecessors, from)
+}
+
+// Body returns the instructions of the block without its labels.
+func (b *Block) Body() []quad.Instruction {
+	for i, instruction := range b.Instructions {
+		if instruction.Opcode != quad.LABEL {
+			return b.Instructions[i:]
+		}
+	}
+	return nil
+}
+
+func onlyLabels(block *Block) bool {
+	return len(block.Body()) == 0
+}
+
+// isBranch returns true if the instruction ends a basic block.
+func isBranch(opcode quad.Opcode) bool {
+	return opcode == quad.JUMP || opcode == quad.JMPZ || opcode == quad.HALT
+}
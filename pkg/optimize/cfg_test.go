@@ -0,0 +1,77 @@
+package optimize_test
+
+import (
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/optimize"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/stretchr/testify/assert"
+)
+
+const loopProgram = `IINP a
+@1:
+@2:
+ILSS _t1 a 10
+JMPZ @3 _t1
+IADD a a 1
+JUMP @2
+@3:
+IPRT a
+JUMP @4
+IPRT 0
+@4:
+HALT`
+
+func TestCFGBlocks(t *testing.T) {
+	g := optimize.NewCFG(parse(t, loopProgram))
+
+	blocks := []string{}
+	for _, block := range g.Blocks {
+		blocks = append(blocks, quad.Format(block.Instructions))
+	}
+
+	assert.EqualValues(t, []string{
+		"IINP a",
+		"@1:\n@2:\nILSS _t1 a 10\nJMPZ @3 _t1",
+		"IADD a a 1\nJUMP @2",
+		"@3:\nIPRT a\nJUMP @4",
+		"IPRT 0",
+		"@4:\nHALT",
+	}, blocks)
+	assert.EqualValues(t, loopProgram, quad.Format(g.Instructions()))
+}
+
+func TestCFGEdges(t *testing.T) {
+	g := optimize.NewCFG(parse(t, loopProgram))
+
+	assert.EqualValues(t, []int{1}, indexes(g.Blocks[0].Successors))
+	assert.EqualValues(t, []int{3, 2}, indexes(g.Blocks[1].Successors))
+	assert.EqualValues(t, []int{0, 2}, indexes(g.Blocks[1].Predecessors))
+	assert.EqualValues(t, []int{1}, indexes(g.Blocks[2].Successors))
+	assert.EqualValues(t, []int{5}, indexes(g.Blocks[3].Successors))
+	assert.Empty(t, g.Blocks[4].Predecessors)
+	assert.EqualValues(t, []int{3, 4}, indexes(g.Blocks[5].Predecessors))
+	assert.Empty(t, g.Blocks[5].Successors)
+
+	assert.Equal(t, g.Blocks[1], g.Target(quad.NewLabel(2)))
+	assert.Nil(t, g.Target(quad.NewLabel(7)))
+}
+
+func TestCFGReachable(t *testing.T) {
+	g := optimize.NewCFG(parse(t, loopProgram))
+	assert.EqualValues(t, []bool{true, true, true, true, false, true}, g.Reachable())
+}
+
+func TestCFGEmpty(t *testing.T) {
+	g := optimize.NewCFG(nil)
+	assert.Empty(t, g.Blocks)
+	assert.Empty(t, g.Reachable())
+}
+
+func indexes(blocks []*optimize.Block) []int {
+	result := []int{}
+	for _, block := range blocks {
+		result = append(result, block.Index)
+	}
+	return result
+}
@@ -0,0 +1,124 @@
+package optimize
+
+import "github.com/alongubkin/cpl-compiler/pkg/quad"
+
+// EliminateDeadCode removes the instructions that can never be executed, and
+// simplifies jumps: a jump to another jump goes directly to its final target, jumps to
+// the next instruction are removed, and so are the labels that are no longer used.
+// Every simplification may enable others, so they are repeated until the code doesn't
+// shrink anymore.
+func EliminateDeadCode(instructions []quad.Instruction) []quad.Instruction {
+	for {
+		g := NewCFG(instructions)
+		threadJumps(g)
+
+		// Threading changes the edges of the graph, so it has to be rebuilt.
+		g = NewCFG(g.Instructions())
+		result := removeUnreachableBlocks(g)
+		result = removeFallthroughJumps(result)
+		result = removeUnusedLabels(result)
+		result = removeDeadTemporaries(result)
+
+		if len(result) == len(instructions) {
+			return result
+		}
+		instructions = result
+	}
+}
+
+// threadJumps replaces the targets of jumps that lead to blocks which only contain
+// another jump.
+func threadJumps(g *CFG) {
+	for _, block := range g.Blocks {
+		last := &block.Instructions[len(block.Instructions)-1]
+		if last.Opcode != quad.JUMP && last.Opcode != quad.JMPZ {
+			continue
+		}
+
+		operands := append([]quad.Operand{}, last.Operands...)
+		operands[0] = finalTarget(g, operands[0])
+		last.Operands = operands
+	}
+}
+
+// finalTarget follows a chain of jumps that starts at label, and returns the label
+// where it ends. Chains that loop forever are followed until the loop is detected.
+func finalTarget(g *CFG, label quad.Operand) quad.Operand {
+	visited := map[quad.Operand]bool{}
+	for !visited[label] {
+		visited[label] = true
+
+		block := g.Target(label)
+		if block == nil {
+			break
+		}
+
+		body := block.Body()
+		if len(body) != 1 || body[0].Opcode != quad.JUMP {
+			break
+		}
+		label = body[0].Operands[0]
+	}
+
+	return label
+}
+
+// removeUnreachableBlocks returns the instructions of the blocks that can be reached
+// from the entry point.
+func removeUnreachableBlocks(g *CFG) []quad.Instruction {
+	reachable := g.Reachable()
+
+	result := []quad.Instruction{}
+	for _, block := range g.Blocks {
+		if reachable[block.Index] {
+			result = append(result, block.Instructions...)
+		}
+	}
+	return result
+}
+
+// removeFallthroughJumps removes jumps to labels that immediately follow them, since
+// execution continues there anyway.
+func removeFallthroughJumps(instructions []quad.Instruction) []quad.Instruction {
+	result := []quad.Instruction{}
+	for i, instruction := range instructions {
+		if (instruction.Opcode == quad.JUMP || instruction.Opcode == quad.JMPZ) &&
+			labelFollows(instructions[i+1:], instruction.Operands[0]) {
+			continue
+		}
+		result = append(result, instruction)
+	}
+	return result
+}
+
+// labelFollows returns true if label is defined before the first instruction that
+// isn't a label.
+func labelFollows(instructions []quad.Instruction, label quad.Operand) bool {
+	for _, instruction := range instructions {
+		if instruction.Opcode != quad.LABEL {
+			return false
+		}
+		if instruction.Operands[0] == label {
+			return true
+		}
+	}
+	return false
+}
+
+// removeUnusedLabels removes the labels that aren't the target of any jump.
+func removeUnusedLabels(instructions []quad.Instruction) []quad.Instruction {
+	used := map[quad.Operand]bool{}
+	for _, instruction := range instructions {
+		if instruction.Opcode == quad.JUMP || instruction.Opcode == quad.JMPZ {
+			used[instruction.Operands[0]] = true
+		}
+	}
+
+	result := []quad.Instruction{}
+	for _, instruction := range instructions {
+		if instruction.Opcode != quad.LABEL || used[instruction.Operands[0]] {
+			result = append(result, instruction)
+		}
+	}
+	return result
+}
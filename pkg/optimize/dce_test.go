@@ -0,0 +1,111 @@
+package optimize_test
+
+import (
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/optimize"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEliminateUnreachableCode(t *testing.T) {
+	assertEliminated(t, `IINP a
+JUMP @1
+IPRT a
+IPRT 0
+@1:
+IPRT 1
+HALT
+IPRT 2`, `IINP a
+IPRT 1
+HALT`)
+}
+
+func TestEliminateJumpChains(t *testing.T) {
+	assertEliminated(t, `IINP x
+JMPZ @1 x
+IPRT 1
+JUMP @2
+@1:
+JUMP @3
+@2:
+IPRT 2
+@3:
+HALT`, `IINP x
+JMPZ @3 x
+IPRT 1
+IPRT 2
+@3:
+HALT`)
+}
+
+func TestEliminateJumpToNextInstruction(t *testing.T) {
+	assertEliminated(t, `IINP x
+ILSS _t1 x 5
+JMPZ @1 _t1
+@1:
+@2:
+JUMP @3
+@3:
+IPRT x
+HALT`, `IINP x
+IPRT x
+HALT`)
+}
+
+func TestEliminateKeepsLoops(t *testing.T) {
+	program := `IINP x
+@1:
+ILSS _t1 x 5
+JMPZ @2 _t1
+IADD x x 1
+JUMP @1
+@2:
+IPRT x
+HALT`
+	assertEliminated(t, program, program)
+}
+
+func TestEliminateInfiniteJumpLoop(t *testing.T) {
+	assertEliminated(t, `@1:
+JUMP @2
+@2:
+JUMP @1
+HALT`, `@1:
+JUMP @1`)
+}
+
+func TestEliminateAfterFolding(t *testing.T) {
+	instructions := compile(t, `a : int;
+{
+  if (1 < 2) output(1); else output(2);
+  while (0 > 1) { output(3); }
+  input(a);
+  switch (a) {
+    case 1: output(1); break;
+    default: output(a); break;
+  }
+}`)
+
+	optimized := optimize.EliminateDeadCode(optimize.FoldConstants(instructions))
+	assert.EqualValues(t, `IPRT 1
+IINP a
+INQL _t3 a 1
+JMPZ @5 _t3
+JUMP @6
+@5:
+IPRT 1
+JUMP @7
+@6:
+IPRT a
+@7:
+HALT`, quad.Format(optimized))
+
+	for _, input := range []string{"1", "2"} {
+		assert.EqualValues(t, run(t, instructions, input), run(t, optimized, input))
+	}
+}
+
+func assertEliminated(t *testing.T, program string, expected string) {
+	assert.EqualValues(t, expected, quad.Format(optimize.EliminateDeadCode(parse(t, program))))
+}
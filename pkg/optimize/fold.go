@@ -0,0 +1,277 @@
+package optimize
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+)
+
+// FoldConstants evaluates the instructions whose operands are known at compile time,
+// and simplifies arithmetic identities such as x + 0, x * 1 and x * 0. Their results
+// are propagated to the instructions that read them, and the temporaries that are no
+// longer read are removed. Conditional jumps on constants become unconditional jumps,
+// or are removed if they are never taken.
+//
+// Folding follows the semantics of the interpreter: integer division truncates toward
+// zero, and integers are converted to floats only where the code generator emitted an
+// ITOR. Instructions that would fail at runtime, e.g a division by zero, are left as
+// they are. Quad has no negative literals, and float literals are written with 6
+// decimal places, so results that can't be written exactly aren't folded either.
+func FoldConstants(instructions []quad.Instruction) []quad.Instruction {
+	result := make([]quad.Instruction, 0, len(instructions))
+
+	// values maps temporaries to the operands that hold their values: literals, or
+	// variables that weren't assigned since.
+	values := map[quad.Operand]quad.Operand{}
+
+	for _, instruction := range instructions {
+		// Values are only propagated in straight-line code.
+		if instruction.Opcode == quad.LABEL {
+			values = map[quad.Operand]quad.Operand{}
+		}
+
+		instruction = substitute(instruction, values)
+		if dest, ok := destination(instruction); ok {
+			forget(values, dest)
+		}
+
+		if value, ok := fold(instruction); ok {
+			if dest := instruction.Operands[0]; dest.Kind == quad.Temporary {
+				values[dest] = value
+			}
+			instruction = move(instruction, value)
+		}
+
+		if instruction.Opcode == quad.JMPZ && instruction.Operands[1].Kind == quad.IntLiteral {
+			if instruction.Operands[1].Int != 0 {
+				continue
+			}
+			instruction.Opcode = quad.JUMP
+			instruction.Operands = instruction.Operands[:1]
+		}
+
+		result = append(result, instruction)
+	}
+
+	return removeDeadTemporaries(result)
+}
+
+// substitute replaces the operands that an instruction reads with their known values.
+func substitute(instruction quad.Instruction, values map[quad.Operand]quad.Operand) quad.Instruction {
+	operands := append([]quad.Operand{}, instruction.Operands...)
+	for _, i := range sources(instruction) {
+		if value, ok := values[operands[i]]; ok {
+			operands[i] = value
+		}
+	}
+
+	instruction.Operands = operands
+	return instruction
+}
+
+// forget removes the values that become outdated when operand is assigned.
+func forget(values map[quad.Operand]quad.Operand, operand quad.Operand) {
+	delete(values, operand)
+	for temporary, value := range values {
+		if value == operand {
+			delete(values, temporary)
+		}
+	}
+}
+
+// move returns an assignment of value to the destination of an instruction.
+func move(instruction quad.Instruction, value quad.Operand) quad.Instruction {
+	opcode := quad.IASN
+	if isFloatResult(instruction.Opcode) {
+		opcode = quad.RASN
+	}
+
+	return quad.Instruction{
+		Opcode:   opcode,
+		Operands: []quad.Operand{instruction.Operands[0], value},
+		Position: instruction.Position,
+		Line:     instruction.Line,
+	}
+}
+
+// fold returns the operand that holds the result of an instruction, if it's known at
+// compile time.
+func fold(instruction quad.Instruction) (quad.Operand, bool) {
+	operands := instruction.Operands
+
+	switch instruction.Opcode {
+	case quad.IASN, quad.RASN:
+		return operands[1], true
+
+	case quad.ITOR:
+		if operands[1].Kind == quad.IntLiteral {
+			return floatValue(float64(operands[1].Int))
+		}
+
+	case quad.RTOI:
+		// Floats outside the range of int64 don't have a well defined conversion.
+		if value := operands[1]; value.Kind == quad.FloatLiteral && math.Abs(value.Float) < math.MaxInt64 {
+			return intValue(int64(value.Float))
+		}
+
+	case quad.IADD, quad.ISUB, quad.IMLT, quad.IDIV:
+		return foldIntArithmetic(instruction.Opcode, operands[1], operands[2])
+
+	case quad.RADD, quad.RSUB, quad.RMLT, quad.RDIV:
+		return foldFloatArithmetic(instruction.Opcode, operands[1], operands[2])
+
+	case quad.IEQL, quad.INQL, quad.ILSS, quad.IGRT, quad.REQL, quad.RNQL, quad.RLSS, quad.RGRT:
+		return foldComparison(instruction.Opcode, operands[1], operands[2])
+	}
+
+	return quad.Operand{}, false
+}
+
+func foldIntArithmetic(opcode quad.Opcode, lhs quad.Operand, rhs quad.Operand) (quad.Operand, bool) {
+	if lhs.Kind == quad.IntLiteral && rhs.Kind == quad.IntLiteral {
+		switch opcode {
+		case quad.IADD:
+			return intValue(lhs.Int + rhs.Int)
+		case quad.ISUB:
+			return intValue(lhs.Int - rhs.Int)
+		case quad.IMLT:
+			return intValue(lhs.Int * rhs.Int)
+		case quad.IDIV:
+			if rhs.Int != 0 {
+				return intValue(lhs.Int / rhs.Int)
+			}
+		}
+		return quad.Operand{}, false
+	}
+
+	switch {
+	case opcode == quad.IADD && isInt(rhs, 0), opcode == quad.ISUB && isInt(rhs, 0),
+		opcode == quad.IMLT && isInt(rhs, 1), opcode == quad.IDIV && isInt(rhs, 1):
+		return lhs, true
+	case opcode == quad.IADD && isInt(lhs, 0), opcode == quad.IMLT && isInt(lhs, 1):
+		return rhs, true
+	case opcode == quad.IMLT && (isInt(lhs, 0) || isInt(rhs, 0)):
+		return quad.NewIntLiteral(0), true
+	}
+
+	return quad.Operand{}, false
+}
+
+// foldFloatArithmetic folds float arithmetic. x + 0.0 and x * 0.0 are not simplified,
+// because their results differ from x and 0.0 when x is -0.0.
+func foldFloatArithmetic(opcode quad.Opcode, lhs quad.Operand, rhs quad.Operand) (quad.Operand, bool) {
+	if lhs.Kind == quad.FloatLiteral && rhs.Kind == quad.FloatLiteral {
+		switch opcode {
+		case quad.RADD:
+			return floatValue(lhs.Float + rhs.Float)
+		case quad.RSUB:
+			return floatValue(lhs.Float - rhs.Float)
+		case quad.RMLT:
+			return floatValue(lhs.Float * rhs.Float)
+		case quad.RDIV:
+			if rhs.Float != 0 {
+				return floatValue(lhs.Float / rhs.Float)
+			}
+		}
+		return quad.Operand{}, false
+	}
+
+	switch {
+	case opcode == quad.RSUB && isFloat(rhs, 0), opcode == quad.RMLT && isFloat(rhs, 1),
+		opcode == quad.RDIV && isFloat(rhs, 1):
+		return lhs, true
+	case opcode == quad.RMLT && isFloat(lhs, 1):
+		return rhs, true
+	}
+
+	return quad.Operand{}, false
+}
+
+func foldComparison(opcode quad.Opcode, lhs quad.Operand, rhs quad.Operand) (quad.Operand, bool) {
+	var less, equal bool
+	switch {
+	case lhs.Kind == quad.IntLiteral && rhs.Kind == quad.IntLiteral:
+		less, equal = lhs.Int < rhs.Int, lhs.Int == rhs.Int
+	case lhs.Kind == quad.FloatLiteral && rhs.Kind == quad.FloatLiteral:
+		less, equal = lhs.Float < rhs.Float, lhs.Float == rhs.Float
+	default:
+		return quad.Operand{}, false
+	}
+
+	var result bool
+	switch opcode {
+	case quad.IEQL, quad.REQL:
+		result = equal
+	case quad.INQL, quad.RNQL:
+		result = !equal
+	case quad.ILSS, quad.RLSS:
+		result = less
+	case quad.IGRT, quad.RGRT:
+		result = !less && !equal
+	}
+
+	if result {
+		return quad.NewIntLiteral(1), true
+	}
+	return quad.NewIntLiteral(0), true
+}
+
+// intValue returns an integer literal, if the value can be written as one.
+func intValue(value int64) (quad.Operand, bool) {
+	return quad.NewIntLiteral(value), value >= 0
+}
+
+// floatValue returns a float literal, if the value can be written as one.
+func floatValue(value float64) (quad.Operand, bool) {
+	operand := quad.NewFloatLiteral(value)
+	if math.Signbit(value) || math.IsInf(value, 0) || math.IsNaN(value) {
+		return operand, false
+	}
+
+	written, err := strconv.ParseFloat(operand.String(), 64)
+	return operand, err == nil && written == value
+}
+
+func isInt(operand quad.Operand, value int64) bool {
+	return operand.Kind == quad.IntLiteral && operand.Int == value
+}
+
+func isFloat(operand quad.Operand, value float64) bool {
+	return operand.Kind == quad.FloatLiteral && operand.Float == value
+}
+
+// removeDeadTemporaries removes the instructions that assign temporaries which are
+// never read, unless they may fail at runtime. Temporaries are read after they are
+// assigned, so a single backward pass also removes the instructions that only
+// computed the operands of removed instructions.
+func removeDeadTemporaries(instructions []quad.Instruction) []quad.Instruction {
+	reads := map[quad.Operand]int{}
+	for _, instruction := range instructions {
+		for _, i := range sources(instruction) {
+			reads[instruction.Operands[i]]++
+		}
+	}
+
+	dead := make([]bool, len(instructions))
+	for i := len(instructions) - 1; i >= 0; i-- {
+		instruction := instructions[i]
+		dest, ok := destination(instruction)
+		if !ok || dest.Kind != quad.Temporary || reads[dest] != 0 || canFail(instruction) {
+			continue
+		}
+
+		dead[i] = true
+		for _, j := range sources(instruction) {
+			reads[instruction.Operands[j]]--
+		}
+	}
+
+	result := make([]quad.Instruction, 0, len(instructions))
+	for i, instruction := range instructions {
+		if !dead[i] {
+			result = append(result, instruction)
+		}
+	}
+	return result
+}
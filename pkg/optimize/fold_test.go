@@ -0,0 +1,162 @@
+package optimize_test
+
+import (
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/optimize"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFoldIntArithmetic(t *testing.T) {
+	assertFolded(t, `IADD _t1 2 3
+IMLT _t2 _t1 4
+IDIV _t3 _t2 3
+IASN x _t3
+HALT`, `IASN x 6
+HALT`)
+}
+
+func TestFoldFloatArithmetic(t *testing.T) {
+	assertFolded(t, `ITOR _t1 8
+RDIV _t2 3.000000 _t1
+RMLT _t3 x _t2
+RASN x _t3
+HALT`, `RMLT _t3 x 0.375000
+RASN x _t3
+HALT`)
+}
+
+func TestFoldKeepsInexactFloats(t *testing.T) {
+	program := "RDIV _t1 3.141590 180.000000\nRMLT _t2 x _t1\nRPRT _t2\nHALT"
+	assertFolded(t, program, program)
+}
+
+func TestFoldIntToFloat(t *testing.T) {
+	assertFolded(t, `ITOR _t1 0
+RASN x _t1
+ITOR _t2 2
+RLSS _t3 x _t2
+JMPZ @1 _t3
+@1:
+HALT`, `RASN x 0.000000
+RLSS _t3 x 2.000000
+JMPZ @1 _t3
+@1:
+HALT`)
+}
+
+func TestFoldFloatToInt(t *testing.T) {
+	assertFolded(t, "RTOI _t1 7.900000\nIASN x _t1\nHALT", "IASN x 7\nHALT")
+}
+
+func TestFoldIdentities(t *testing.T) {
+	assertFolded(t, `IADD _t1 x 0
+IMLT _t2 1 _t1
+IDIV _t3 _t2 1
+IASN y _t3
+IMLT _t4 y 0
+IPRT _t4
+RMLT _t5 f 1.000000
+RSUB _t6 _t5 0.000000
+RPRT _t6
+HALT`, `IASN y x
+IPRT 0
+RPRT f
+HALT`)
+}
+
+func TestFoldKeepsNegativeZero(t *testing.T) {
+	program := "RADD _t1 f 0.000000\nRMLT _t2 f 0.000000\nRPRT _t1\nRPRT _t2\nHALT"
+	assertFolded(t, program, program)
+}
+
+func TestFoldKeepsRuntimeErrors(t *testing.T) {
+	assertFolded(t, `IDIV _t1 5 0
+IPRT _t1
+IDIV _t2 x y
+IMLT _t3 _t2 0
+IPRT _t3
+HALT`, `IDIV _t1 5 0
+IPRT _t1
+IDIV _t2 x y
+IPRT 0
+HALT`)
+}
+
+func TestFoldKeepsNegativeResults(t *testing.T) {
+	program := "ISUB _t1 0 1\nITOR _t2 _t1\nRPRT _t2\nHALT"
+	assertFolded(t, program, program)
+}
+
+func TestFoldComparisons(t *testing.T) {
+	assertFolded(t, `ILSS _t1 1 2
+JMPZ @1 _t1
+IPRT 1
+@1:
+RGRT _t2 1.500000 2.500000
+ISUB _t3 1 _t2
+JMPZ @2 _t3
+IPRT 2
+@2:
+HALT`, `IPRT 1
+@1:
+IPRT 2
+@2:
+HALT`)
+
+	assertFolded(t, `IEQL _t1 1 2
+JMPZ @1 _t1
+IPRT 1
+@1:
+HALT`, `JUMP @1
+IPRT 1
+@1:
+HALT`)
+}
+
+func TestFoldAfterAssignment(t *testing.T) {
+	assertFolded(t, `IADD _t1 x 0
+IASN x 5
+IPRT _t1
+HALT`, `IASN _t1 x
+IASN x 5
+IPRT _t1
+HALT`)
+}
+
+func TestFoldAcrossLabels(t *testing.T) {
+	assertFolded(t, `IADD _t1 2 3
+@1:
+IPRT _t1
+HALT`, `IASN _t1 5
+@1:
+IPRT _t1
+HALT`)
+}
+
+func TestFoldProgram(t *testing.T) {
+	code := `a, b : int;
+x, y : float;
+{
+  a = 17 / 5 * 2 + 0;
+  b = a * 1 - 0;
+  x = 3.5 * 2 / 7;
+  y = static_cast(int) (x * 10.0 + 0.9);
+  if (a > 5 && 2 < 3) output(a); else output(b);
+  while (b < 10 * 2) { b = b + 1 * 8; }
+  output(b);
+  output(y + x * 0.5);
+  switch (2 * 3) { case 6: output(6); break; default: output(0); }
+}`
+
+	instructions := compile(t, code)
+	optimized := optimize.FoldConstants(instructions)
+	assert.Contains(t, quad.Format(optimized), "IASN a 6")
+	assert.True(t, len(optimized) < len(instructions))
+	assert.EqualValues(t, run(t, instructions, ""), run(t, optimized, ""))
+}
+
+func assertFolded(t *testing.T, program string, expected string) {
+	assert.EqualValues(t, expected, quad.Format(optimize.FoldConstants(parse(t, program))))
+}
@@ -0,0 +1,82 @@
+package optimize
+
+import "github.com/alongubkin/cpl-compiler/pkg/quad"
+
+// Liveness holds the temporaries that are live at the start and at the end of every
+// block of a CFG. A temporary is live if its current value may be read later.
+// Variables are never considered live, because only temporaries can be renamed.
+type Liveness struct {
+	In  []map[quad.Operand]bool
+	Out []map[quad.Operand]bool
+}
+
+// NewLiveness computes the live temporaries of every block, by iterating the dataflow
+// equations until they reach a fixed point: the temporaries live at the end of a block
+// are the ones live at the start of its successors, and the temporaries live at its
+// start are the ones it reads before assigning them, or are live at its end and it
+// doesn't assign them.
+func NewLiveness(g *CFG) *Liveness {
+	l := &Liveness{
+		In:  make([]map[quad.Operand]bool, len(g.Blocks)),
+		Out: make([]map[quad.Operand]bool, len(g.Blocks)),
+	}
+	for i := range g.Blocks {
+		l.In[i] = map[quad.Operand]bool{}
+		l.Out[i] = map[quad.Operand]bool{}
+	}
+
+	for changed := true; changed; {
+		changed = false
+
+		// Liveness flows backwards, so visiting the blocks in reverse order converges
+		// faster.
+		for i := len(g.Blocks) - 1; i >= 0; i-- {
+			block := g.Blocks[i]
+			for _, successor := range block.Successors {
+				for temporary := range l.In[successor.Index] {
+					l.Out[i][temporary] = true
+				}
+			}
+
+			in := liveBefore(block.Instructions, l.Out[i])
+			if len(in) != len(l.In[i]) {
+				l.In[i] = in
+				changed = true
+			}
+		}
+	}
+
+	return l
+}
+
+// liveBefore returns the temporaries that are live before a list of instructions,
+// given the temporaries that are live after it.
+func liveBefore(instructions []quad.Instruction, out map[quad.Operand]bool) map[quad.Operand]bool {
+	live := copySet(out)
+	for i := len(instructions) - 1; i >= 0; i-- {
+		update(live, instructions[i])
+	}
+	return live
+}
+
+// update changes the live temporaries after an instruction to the live temporaries
+// before it.
+func update(live map[quad.Operand]bool, instruction quad.Instruction) {
+	if dest, ok := destination(instruction); ok {
+		delete(live, dest)
+	}
+
+	for _, i := range sources(instruction) {
+		if operand := instruction.Operands[i]; operand.Kind == quad.Temporary {
+			live[operand] = true
+		}
+	}
+}
+
+func copySet(set map[quad.Operand]bool) map[quad.Operand]bool {
+	result := make(map[quad.Operand]bool, len(set))
+	for operand := range set {
+		result[operand] = true
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package optimize_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/optimize"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveness(t *testing.T) {
+	g := optimize.NewCFG(parse(t, `IINP a
+IADD _t1 a 1
+@1:
+ILSS _t2 a 10
+JMPZ @2 _t2
+IADD a a _t1
+JUMP @1
+@2:
+IPRT _t1
+HALT`))
+	l := optimize.NewLiveness(g)
+
+	assert.Empty(t, names(l.In[0]))
+	assert.EqualValues(t, []string{"_t1"}, names(l.Out[0]))
+	assert.EqualValues(t, []string{"_t1"}, names(l.In[1]))
+	assert.EqualValues(t, []string{"_t1"}, names(l.Out[1]))
+	assert.EqualValues(t, []string{"_t1"}, names(l.In[2]))
+	assert.EqualValues(t, []string{"_t1"}, names(l.In[3]))
+	assert.Empty(t, names(l.Out[3]))
+}
+
+func TestLivenessIgnoresVariables(t *testing.T) {
+	l := optimize.NewLiveness(optimize.NewCFG(parse(t, "IPRT a\nHALT")))
+	assert.Empty(t, names(l.In[0]))
+}
+
+func names(set map[quad.Operand]bool) []string {
+	result := []string{}
+	for operand := range set {
+		result = append(result, operand.String())
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,142 @@
+// Package optimize implements optimization passes over the Quad code generated by
+// codegen. Passes work on the labeled instructions, before they are assembled.
+package optimize
+
+import (
+	"fmt"
+
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+)
+
+// Pass is an optimization pass that transforms labeled Quad code.
+type Pass struct {
+	Name        string
+	Description string
+	Run         func([]quad.Instruction) []quad.Instruction
+}
+
+// Passes contains all the available passes, in the order they run.
+var Passes = []Pass{
+	{"fold", "fold constants and simplify arithmetic identities", FoldConstants},
+	{"dce", "remove unreachable code and redundant jumps", EliminateDeadCode},
+	{"temps", "reuse temporaries whose values are no longer needed", ReuseTemporaries},
+}
+
+// MaxLevel is the highest optimization level.
+const MaxLevel = 2
+
+// levels contains the names of the passes that run at every optimization level. Level
+// 0 doesn't change the generated code at all.
+var levels = [MaxLevel + 1][]string{
+	{},
+	{"fold", "dce"},
+	{"fold", "dce", "temps"},
+}
+
+// Pipeline returns the passes that run at an optimization level, with additional
+// passes enabled and some of the passes of the level disabled. The passes are always
+// returned in the order of Passes.
+func Pipeline(level int, enable []string, disable []string) ([]Pass, error) {
+	if level < 0 || level > MaxLevel {
+		return nil, fmt.Errorf("invalid optimization level %d", level)
+	}
+
+	selected := map[string]bool{}
+	for _, name := range levels[level] {
+		selected[name] = true
+	}
+
+	for _, name := range enable {
+		if _, ok := lookupPass(name); !ok {
+			return nil, fmt.Errorf("unknown optimization pass %q", name)
+		}
+		selected[name] = true
+	}
+	for _, name := range disable {
+		if _, ok := lookupPass(name); !ok {
+			return nil, fmt.Errorf("unknown optimization pass %q", name)
+		}
+		selected[name] = false
+	}
+
+	pipeline := []Pass{}
+	for _, pass := range Passes {
+		if selected[pass.Name] {
+			pipeline = append(pipeline, pass)
+		}
+	}
+	return pipeline, nil
+}
+
+// Run runs a pipeline of passes on the instructions.
+func Run(instructions []quad.Instruction, pipeline []Pass) []quad.Instruction {
+	for _, pass := range pipeline {
+		instructions = pass.Run(instructions)
+	}
+	return instructions
+}
+
+func lookupPass(name string) (Pass, bool) {
+	for _, pass := range Passes {
+		if pass.Name == name {
+			return pass, true
+		}
+	}
+	return Pass{}, false
+}
+
+// destination returns the operand that an instruction writes to, if any.
+func destination(instruction quad.Instruction) (quad.Operand, bool) {
+	switch instruction.Opcode {
+	case quad.IPRT, quad.RPRT, quad.JUMP, quad.JMPZ, quad.HALT, quad.LABEL:
+		return quad.Operand{}, false
+	}
+
+	if len(instruction.Operands) == 0 {
+		return quad.Operand{}, false
+	}
+	return instruction.Operands[0], true
+}
+
+// sources returns the indexes of the operands that an instruction reads.
+func sources(instruction quad.Instruction) []int {
+	switch instruction.Opcode {
+	case quad.IPRT, quad.RPRT:
+		return []int{0}
+	case quad.JMPZ:
+		return []int{1}
+	case quad.IINP, quad.RINP, quad.JUMP, quad.HALT, quad.LABEL:
+		return nil
+	}
+
+	indexes := []int{}
+	for i := 1; i < len(instruction.Operands); i++ {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// isFloatResult returns true if the instruction writes a float to its destination.
+func isFloatResult(opcode quad.Opcode) bool {
+	switch opcode {
+	case quad.RASN, quad.RINP, quad.RADD, quad.RSUB, quad.RMLT, quad.RDIV, quad.ITOR:
+		return true
+	}
+	return false
+}
+
+// canFail returns true if executing the instruction may stop the program with a
+// runtime error, so it can't be removed even if its result isn't used.
+func canFail(instruction quad.Instruction) bool {
+	switch instruction.Opcode {
+	case quad.IINP, quad.RINP:
+		return true
+	case quad.IDIV:
+		divisor := instruction.Operands[2]
+		return divisor.Kind != quad.IntLiteral || divisor.Int == 0
+	case quad.RDIV:
+		divisor := instruction.Operands[2]
+		return divisor.Kind != quad.FloatLiteral || divisor.Float == 0
+	}
+	return false
+}
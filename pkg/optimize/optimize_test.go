@@ -0,0 +1,98 @@
+package optimize_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/codegen"
+	"github.com/alongubkin/cpl-compiler/pkg/optimize"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/alongubkin/cpl-compiler/pkg/semantic"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, code string) []quad.Instruction {
+	instructions, err := quad.Parse(strings.NewReader(code))
+	assert.NoError(t, err)
+	return instructions
+}
+
+func compile(t *testing.T, code string) []quad.Instruction {
+	program, errors := parser.Parse(code)
+	assert.Empty(t, errors)
+	_, errors = semantic.Analyze(program)
+	assert.Empty(t, errors)
+
+	return codegen.Codegen(program)
+}
+
+func run(t *testing.T, instructions []quad.Instruction, input string) string {
+	assembled, errors := quad.Assemble(instructions)
+	assert.Empty(t, errors)
+
+	output := new(bytes.Buffer)
+	assert.NoError(t, quad.NewInterpreter(assembled, strings.NewReader(input), output).Run())
+	return output.String()
+}
+
+func passNames(pipeline []optimize.Pass) []string {
+	names := []string{}
+	for _, pass := range pipeline {
+		names = append(names, pass.Name)
+	}
+	return names
+}
+
+func TestPipelineLevels(t *testing.T) {
+	pipeline, err := optimize.Pipeline(0, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, pipeline)
+
+	pipeline, err = optimize.Pipeline(1, nil, nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"fold", "dce"}, passNames(pipeline))
+
+	pipeline, err = optimize.Pipeline(2, nil, nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"fold", "dce", "temps"}, passNames(pipeline))
+}
+
+func TestPipelineSelectPasses(t *testing.T) {
+	// Enabled passes still run in their usual order
+	pipeline, err := optimize.Pipeline(0, []string{"temps", "fold"}, nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"fold", "temps"}, passNames(pipeline))
+
+	pipeline, err = optimize.Pipeline(2, nil, []string{"dce"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"fold", "temps"}, passNames(pipeline))
+
+	// Disabling wins over enabling
+	pipeline, err = optimize.Pipeline(0, []string{"fold"}, []string{"fold"})
+	assert.NoError(t, err)
+	assert.Empty(t, pipeline)
+}
+
+func TestPipelineErrors(t *testing.T) {
+	_, err := optimize.Pipeline(3, nil, nil)
+	assert.EqualError(t, err, "invalid optimization level 3")
+
+	_, err = optimize.Pipeline(1, []string{"inline"}, nil)
+	assert.EqualError(t, err, `unknown optimization pass "inline"`)
+
+	_, err = optimize.Pipeline(1, nil, []string{"inline"})
+	assert.EqualError(t, err, `unknown optimization pass "inline"`)
+}
+
+func TestRun(t *testing.T) {
+	instructions := compile(t, "a : int;\n{ a = 2 * 3; output(a + 1); }")
+	assert.EqualValues(t, instructions, optimize.Run(instructions, nil))
+
+	pipeline, err := optimize.Pipeline(2, nil, nil)
+	assert.NoError(t, err)
+	optimized := optimize.Run(instructions, pipeline)
+	assert.True(t, len(optimized) < len(instructions))
+	assert.EqualValues(t, "7\n", run(t, optimized, ""))
+}
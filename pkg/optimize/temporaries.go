@@ -0,0 +1,86 @@
+package optimize
+
+import "github.com/alongubkin/cpl-compiler/pkg/quad"
+
+// ReuseTemporaries renames temporaries so that a temporary whose value is no longer
+// needed can be reused by later instructions, like a register allocator does with
+// registers. Two temporaries share a name only if they are never live at the same
+// time, and they hold values of the same type, because the type of a Quad variable
+// can't change after it's assigned. The names are numbered from _t1, in the order of
+// their first appearance.
+func ReuseTemporaries(instructions []quad.Instruction) []quad.Instruction {
+	g := NewCFG(instructions)
+	liveness := NewLiveness(g)
+
+	// Two temporaries interfere if one of them is assigned while the other is live.
+	interference := map[quad.Operand]map[quad.Operand]bool{}
+	floats := map[quad.Operand]bool{}
+	for _, block := range g.Blocks {
+		live := copySet(liveness.Out[block.Index])
+		for i := len(block.Instructions) - 1; i >= 0; i-- {
+			instruction := block.Instructions[i]
+			if dest, ok := destination(instruction); ok && dest.Kind == quad.Temporary {
+				floats[dest] = isFloatResult(instruction.Opcode)
+				for other := range live {
+					if other != dest {
+						interfere(interference, dest, other)
+					}
+				}
+			}
+			update(live, instruction)
+		}
+	}
+
+	// Give every temporary the first name that none of its neighbours has, greedily.
+	names := map[quad.Operand]quad.Operand{}
+	nameIsFloat := []bool{}
+	for _, instruction := range instructions {
+		for _, operand := range instruction.Operands {
+			if _, ok := names[operand]; ok || operand.Kind != quad.Temporary {
+				continue
+			}
+
+			taken := map[quad.Operand]bool{}
+			for neighbour := range interference[operand] {
+				if name, ok := names[neighbour]; ok {
+					taken[name] = true
+				}
+			}
+
+			index := 0
+			for index < len(nameIsFloat) &&
+				(nameIsFloat[index] != floats[operand] || taken[quad.NewTemporary(index+1)]) {
+				index++
+			}
+			if index == len(nameIsFloat) {
+				nameIsFloat = append(nameIsFloat, floats[operand])
+			}
+
+			names[operand] = quad.NewTemporary(index + 1)
+		}
+	}
+
+	result := make([]quad.Instruction, len(instructions))
+	for i, instruction := range instructions {
+		operands := make([]quad.Operand, len(instruction.Operands))
+		for j, operand := range instruction.Operands {
+			if name, ok := names[operand]; ok {
+				operand = name
+			}
+			operands[j] = operand
+		}
+
+		instruction.Operands = operands
+		result[i] = instruction
+	}
+	return result
+}
+
+func interfere(interference map[quad.Operand]map[quad.Operand]bool, a quad.Operand, b quad.Operand) {
+	for _, pair := range [][2]quad.Operand{{a, b}, {b, a}} {
+		if interference[pair[0]] == nil {
+			interference[pair[0]] = map[quad.Operand]bool{}
+		}
+		interference[pair[0]][pair[1]] = true
+	}
+}
@@ -0,0 +1,103 @@
+package optimize_test
+
+import (
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/optimize"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReuseTemporaries(t *testing.T) {
+	assertRenamed(t, `IADD _t1 a b
+IMLT _t2 _t1 c
+IASN x _t2
+ISUB _t3 a 1
+IADD _t4 _t3 _t2
+IASN y _t4
+HALT`, `IADD _t1 a b
+IMLT _t1 _t1 c
+IASN x _t1
+ISUB _t2 a 1
+IADD _t1 _t2 _t1
+IASN y _t1
+HALT`)
+}
+
+func TestReuseTemporariesOfSameType(t *testing.T) {
+	assertRenamed(t, `IADD _t1 a 1
+ITOR _t2 _t1
+RADD _t3 _t2 f
+RASN f _t3
+IADD _t4 a 2
+IASN a _t4
+HALT`, `IADD _t1 a 1
+ITOR _t2 _t1
+RADD _t2 _t2 f
+RASN f _t2
+IADD _t1 a 2
+IASN a _t1
+HALT`)
+}
+
+func TestReuseTemporariesAcrossLoops(t *testing.T) {
+	assertRenamed(t, `IADD _t5 a 1
+@1:
+ILSS _t6 a 10
+JMPZ @2 _t6
+IADD _t7 a _t5
+IASN a _t7
+JUMP @1
+@2:
+IPRT _t5
+HALT`, `IADD _t1 a 1
+@1:
+ILSS _t2 a 10
+JMPZ @2 _t2
+IADD _t2 a _t1
+IASN a _t2
+JUMP @1
+@2:
+IPRT _t1
+HALT`)
+}
+
+func TestReuseTemporariesProgram(t *testing.T) {
+	instructions := compile(t, `a, b : int;
+x : float;
+{
+  input(a);
+  input(x);
+  b = (a + 1) * (a + 2) - (a + 3) / 2;
+  x = x * 2 + a / 3.0 - b;
+  while (a < 5 && b >= a || x > 2) {
+    a = a + 1;
+    x = x - 1;
+  }
+  output(a * 2 + b);
+  output(x);
+}`)
+
+	optimized := optimize.ReuseTemporaries(instructions)
+	assert.True(t, countTemporaries(optimized) < countTemporaries(instructions))
+
+	for _, input := range []string{"1\n1.5", "7\n10.25"} {
+		assert.EqualValues(t, run(t, instructions, input), run(t, optimized, input))
+	}
+}
+
+func assertRenamed(t *testing.T, program string, expected string) {
+	assert.EqualValues(t, expected, quad.Format(optimize.ReuseTemporaries(parse(t, program))))
+}
+
+func countTemporaries(instructions []quad.Instruction) int {
+	temporaries := map[quad.Operand]bool{}
+	for _, instruction := range instructions {
+		for _, operand := range instruction.Operands {
+			if operand.Kind == quad.Temporary {
+				temporaries[operand] = true
+			}
+		}
+	}
+	return len(temporaries)
+}
@@ -1,6 +1,9 @@
 package parser
 
-import "github.com/alongubkin/cpl-compiler/pkg/lexer"
+import (
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+)
 
 // DataType represents the primitive data types available in CPL.
 type DataType int
@@ -14,6 +17,20 @@ const (
 	Integer DataType = 2
 )
 
+var dataTypes = [...]string{
+	Unknown: "unknown",
+	Float:   "float",
+	Integer: "int",
+}
+
+// String returns the CPL keyword of the data type.
+func (t DataType) String() string {
+	if t >= 0 && t < DataType(len(dataTypes)) {
+		return dataTypes[t]
+	}
+	return ""
+}
+
 // Operator represents a boolean or arithmatic operator in CPL.
 type Operator int
 
@@ -31,8 +48,31 @@ const (
 	LessThenOrEqualTo                    // <=
 )
 
+var operators = [...]string{
+	Add:                  "+",
+	Subtract:             "-",
+	Multiply:             "*",
+	Divide:               "/",
+	EqualTo:              "==",
+	NotEqualTo:           "!=",
+	GreaterThan:          ">",
+	LessThan:             "<",
+	GreaterThanOrEqualTo: ">=",
+	LessThenOrEqualTo:    "<=",
+}
+
+// String returns the CPL symbol of the operator.
+func (o Operator) String() string {
+	if o >= 0 && o < Operator(len(operators)) {
+		return operators[o]
+	}
+	return ""
+}
+
 // Node represents a node in the CPL abstract syntax tree.
 type Node interface {
+	// Span returns the range of the node in the source file.
+	Span() source.Span
 	// node is unexported to ensure implementations of Node
 	// can only originate in this package.
 	node()
@@ -40,16 +80,18 @@ type Node interface {
 
 // Program represents the root node of a CPL program.
 type Program struct {
-	Declarations    []Declaration
-	StatementsBlock *StatementsBlock
-	Position        lexer.Position
+	Declarations    []Declaration    `json:"declarations"`
+	StatementsBlock *StatementsBlock `json:"statementsBlock"`
+	Position        lexer.Position   `json:"position"`
+	End             lexer.Position   `json:"end"`
 }
 
 // Declaration of one or more variables.
 type Declaration struct {
-	Names    []string
-	Type     DataType
-	Position lexer.Position
+	Names    []string       `json:"names"`
+	Type     DataType       `json:"type"`
+	Position lexer.Position `json:"position"`
+	End      lexer.Position `json:"end"`
 }
 
 // Statement represents a single command in CPL.
@@ -63,72 +105,81 @@ type Statement interface {
 // AssignmentStatement represents a command for assigning a value to a variable,
 // e.g: x = 5;
 type AssignmentStatement struct {
-	Variable string
-	Value    Expression
+	Variable string     `json:"variable"`
+	Value    Expression `json:"value"`
 	// If the assignment doesn't contain static_cast<>, then CastType will be Unknown.
 	// Otherwise, CastType will contain the type to cast to.
-	CastType DataType
-	Position lexer.Position
+	CastType DataType       `json:"castType,omitempty"`
+	Position lexer.Position `json:"position"`
+	End      lexer.Position `json:"end"`
 }
 
 // InputStatement represents a command for retrieving user input to a variable.
 // e.g: input(a);
 type InputStatement struct {
-	Variable string
-	Position lexer.Position
+	Variable string         `json:"variable"`
+	Position lexer.Position `json:"position"`
+	End      lexer.Position `json:"end"`
 }
 
 // OutputStatement represents a command for printing an expression.
 // e.g: output(x + y);
 type OutputStatement struct {
-	Value    Expression
-	Position lexer.Position
+	Value    Expression     `json:"value"`
+	Position lexer.Position `json:"position"`
+	End      lexer.Position `json:"end"`
 }
 
 // IfStatement represents a conditional command. In CPL, if statements must contain an else clause!
 // e.g: if (x == y) { output(x); } else { output(y); }
 type IfStatement struct {
-	Condition  BooleanExpression
-	IfBranch   Statement
-	ElseBranch Statement
-	Position   lexer.Position
+	Condition  BooleanExpression `json:"condition"`
+	IfBranch   Statement         `json:"ifBranch"`
+	ElseBranch Statement         `json:"elseBranch"`
+	Position   lexer.Position    `json:"position"`
+	End        lexer.Position    `json:"end"`
 }
 
 // WhileStatement is a control flow statement that allows code to be executed
 // repeatedly based on a given Boolean condition.
 type WhileStatement struct {
-	Condition BooleanExpression
-	Body      Statement
-	Position  lexer.Position
+	Condition BooleanExpression `json:"condition"`
+	Body      Statement         `json:"body"`
+	Position  lexer.Position    `json:"position"`
+	End       lexer.Position    `json:"end"`
 }
 
 // SwitchStatement is a type of selection control mechanism used to allow the value of
 // a variable or expression to change the control flow of program execution.
 type SwitchStatement struct {
-	Expression  Expression
-	Cases       []SwitchCase
-	DefaultCase []Statement
-	Position    lexer.Position
+	Expression  Expression     `json:"expression"`
+	Cases       []SwitchCase   `json:"cases"`
+	DefaultCase []Statement    `json:"defaultCase"`
+	Position    lexer.Position `json:"position"`
+	End         lexer.Position `json:"end"`
 }
 
 // SwitchCase represents a flow for a specific value in a switch statement.
 type SwitchCase struct {
-	Value      int64
-	Statements []Statement
-	Position   lexer.Position
+	Value      int64          `json:"value"`
+	Statements []Statement    `json:"statements"`
+	Position   lexer.Position `json:"position"`
+	End        lexer.Position `json:"end"`
 }
 
 // BreakStatement represents a statement that exits from a switch case
 // or a while loop.
 type BreakStatement struct {
-	Position lexer.Position
+	Position lexer.Position `json:"position"`
+	End      lexer.Position `json:"end"`
 }
 
 // StatementsBlock represents a block of sentences, e.g { s1; s2; s3; }.
 // It is itself a statement.
 type StatementsBlock struct {
-	Statements []Statement
-	Position   lexer.Position
+	Statements []Statement    `json:"statements"`
+	Position   lexer.Position `json:"position"`
+	End        lexer.Position `json:"end"`
 }
 
 // Expression is a combination of numbers, variables and operators that
@@ -151,57 +202,87 @@ type BooleanExpression interface {
 
 // VariableExpression is an expression that contains a single variable.
 type VariableExpression struct {
-	Variable string
-	Position lexer.Position
+	Variable string `json:"variable"`
+	// Type is the resolved type of the expression. It is Unknown until semantic analysis.
+	Type     DataType       `json:"type,omitempty"`
+	Position lexer.Position `json:"position"`
+	End      lexer.Position `json:"end"`
 }
 
 // IntLiteral is an expression that contains a single constant integer number.
 type IntLiteral struct {
-	Value    int64
-	Position lexer.Position
+	Value    int64          `json:"value"`
+	Type     DataType       `json:"type,omitempty"`
+	Position lexer.Position `json:"position"`
+	End      lexer.Position `json:"end"`
 }
 
 // FloatLiteral is an expression that contains a single constant integer number.
 type FloatLiteral struct {
-	Value    float64
-	Position lexer.Position
+	Value    float64        `json:"value"`
+	Type     DataType       `json:"type,omitempty"`
+	Position lexer.Position `json:"position"`
+	End      lexer.Position `json:"end"`
 }
 
 // ArithmeticExpression is an expression that contains a +, -, *, / operator.
 type ArithmeticExpression struct {
-	LHS      Expression
-	Operator Operator
-	RHS      Expression
-	Position lexer.Position
+	LHS      Expression     `json:"lhs"`
+	Operator Operator       `json:"operator"`
+	RHS      Expression     `json:"rhs"`
+	Type     DataType       `json:"type,omitempty"`
+	Position lexer.Position `json:"position"`
+	End      lexer.Position `json:"end"`
 }
 
 // OrBooleanExpression is a boolean expression that has an OR operator.
 type OrBooleanExpression struct {
-	LHS      BooleanExpression
-	RHS      BooleanExpression
-	Position lexer.Position
+	LHS      BooleanExpression `json:"lhs"`
+	RHS      BooleanExpression `json:"rhs"`
+	Position lexer.Position    `json:"position"`
+	End      lexer.Position    `json:"end"`
 }
 
 // AndBooleanExpression is a boolean expression that has an AND operator.
 type AndBooleanExpression struct {
-	LHS      BooleanExpression
-	RHS      BooleanExpression
-	Position lexer.Position
+	LHS      BooleanExpression `json:"lhs"`
+	RHS      BooleanExpression `json:"rhs"`
+	Position lexer.Position    `json:"position"`
+	End      lexer.Position    `json:"end"`
 }
 
 // NotBooleanExpression is a boolean expression that has a NOT operator.
 type NotBooleanExpression struct {
-	Value    BooleanExpression
-	Position lexer.Position
+	Value    BooleanExpression `json:"value"`
+	Position lexer.Position    `json:"position"`
+	End      lexer.Position    `json:"end"`
 }
 
 // CompareBooleanExpression is a boolean expression that compares between two expressions,
 // e.g x < y
 type CompareBooleanExpression struct {
-	LHS      Expression
-	Operator Operator
-	RHS      Expression
-	Position lexer.Position
+	LHS      Expression     `json:"lhs"`
+	Operator Operator       `json:"operator"`
+	RHS      Expression     `json:"rhs"`
+	Position lexer.Position `json:"position"`
+	End      lexer.Position `json:"end"`
+}
+
+// TypeOf returns the resolved type of an expression, or Unknown if the expression
+// wasn't analyzed yet.
+func TypeOf(expr Expression) DataType {
+	switch e := expr.(type) {
+	case *VariableExpression:
+		return e.Type
+	case *IntLiteral:
+		return e.Type
+	case *FloatLiteral:
+		return e.Type
+	case *ArithmeticExpression:
+		return e.Type
+	}
+
+	return Unknown
 }
 
 func (*Program) node()                  {}
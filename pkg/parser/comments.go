@@ -0,0 +1,118 @@
+package parser
+
+import "github.com/alongubkin/cpl-compiler/pkg/lexer"
+
+// Comments contains the comments that belong to an AST node.
+type Comments struct {
+	// Leading comments appear before the node.
+	Leading []lexer.Comment
+	// Trailing comments start on the same line after the end of the node.
+	Trailing []lexer.Comment
+	// Inner comments appear inside the node, but don't belong to any of its children,
+	// e.g comments before an else keyword or inside an expression.
+	Inner []lexer.Comment
+}
+
+// CommentMap maps AST nodes to their comments. Comments are attached to programs,
+// declarations, switch cases and statements.
+type CommentMap map[Node]*Comments
+
+// get returns the comments of a node, and creates them if needed.
+func (m CommentMap) get(node Node) *Comments {
+	comments, ok := m[node]
+	if !ok {
+		comments = &Comments{}
+		m[node] = comments
+	}
+	return comments
+}
+
+// openNode is a node that is being parsed.
+type openNode struct {
+	node Node
+	// start is the number of tokens that were matched before the node.
+	start int
+}
+
+// begin marks the start of a node that comments can be attached to.
+func (p *Parser) begin(node Node) {
+	p.open = append(p.open, openNode{node: node, start: p.matched})
+}
+
+// end marks the end of the innermost node. If it matched any tokens, it ends at the
+// last matched token, so it owns the trailing comments of that token unless an outer
+// node ends there too.
+func (p *Parser) end() {
+	node := p.open[len(p.open)-1]
+	p.open = p.open[:len(p.open)-1]
+
+	if node.start < p.matched {
+		p.ended = node.node
+	}
+}
+
+// attachComments attaches the comments of a matched token to the nodes that are
+// being parsed. Leading comments belong to the outermost node that starts with the
+// token, and trailing comments belong to the outermost node that ends with it, which
+// is only known when the next token is matched.
+func (p *Parser) attachComments(token *lexer.Token) {
+	p.attachTrailingComments()
+
+	if len(token.Leading) > 0 && len(p.open) > 0 {
+		comments := p.Comments.get(p.open[len(p.open)-1].node)
+		if token.TokenType == lexer.EOF {
+			// Comments at the end of the file follow the whole program.
+			comments = p.Comments.get(p.open[0].node)
+			comments.Trailing = append(comments.Trailing, token.Leading...)
+		} else if node, ok := p.startingNode(); ok {
+			comments = p.Comments.get(node)
+			comments.Leading = append(comments.Leading, token.Leading...)
+		} else {
+			comments.Inner = append(comments.Inner, token.Leading...)
+		}
+	}
+
+	p.matched++
+	p.trailing = token.Trailing
+	p.ended = nil
+}
+
+// attachTrailingComments attaches the trailing comments of the last matched token.
+func (p *Parser) attachTrailingComments() {
+	if len(p.trailing) == 0 {
+		return
+	}
+
+	if p.ended != nil {
+		comments := p.Comments.get(p.ended)
+		comments.Trailing = append(comments.Trailing, p.trailing...)
+	} else if len(p.open) > 0 {
+		comments := p.Comments.get(p.open[len(p.open)-1].node)
+		comments.Inner = append(comments.Inner, p.trailing...)
+	}
+
+	p.trailing = nil
+}
+
+// startingNode returns the outermost open node that didn't match any tokens yet.
+func (p *Parser) startingNode() (Node, bool) {
+	for _, node := range p.open {
+		if node.start == p.matched {
+			return node.node, true
+		}
+	}
+	return nil, false
+}
+
+// moveComments moves the comments of a node that was copied to a new address, e.g a
+// declaration that was appended to a slice.
+func (p *Parser) moveComments(from Node, to Node) {
+	if comments, ok := p.Comments[from]; ok {
+		delete(p.Comments, from)
+		p.Comments[to] = comments
+	}
+
+	if p.ended == from {
+		p.ended = to
+	}
+}
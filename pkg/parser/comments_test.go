@@ -0,0 +1,80 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWithComments(t *testing.T) {
+	program, comments, errors := parser.ParseWithComments(`/* header */
+a : int; /* a */
+/* b */
+b : float;
+{
+  /* input */
+  input(a); /* after input */
+  if (a > /* inner */ 1) {
+    b = 1.5;
+  } /* before else */ else
+    b = 2.5; /* after if */
+  switch (a) {
+    /* case */
+    case 1: break; /* after break */
+    default:
+  }
+  /* end of block */
+}
+/* end of file */`)
+	assert.Empty(t, errors)
+
+	block := program.StatementsBlock
+	input := block.Statements[0]
+	ifStatement := block.Statements[1].(*parser.IfStatement)
+	switchStatement := block.Statements[2].(*parser.SwitchStatement)
+
+	assert.EqualValues(t, []string{"/* header */"}, texts(comments[program].Leading))
+	assert.EqualValues(t, []string{"/* end of file */"}, texts(comments[program].Trailing))
+	assert.EqualValues(t, []string{"/* a */"}, texts(comments[&program.Declarations[0]].Trailing))
+	assert.EqualValues(t, []string{"/* b */"}, texts(comments[&program.Declarations[1]].Leading))
+	assert.EqualValues(t, []string{"/* end of block */"}, texts(comments[block].Inner))
+
+	assert.EqualValues(t, []string{"/* input */"}, texts(comments[input].Leading))
+	assert.EqualValues(t, []string{"/* after input */"}, texts(comments[input].Trailing))
+
+	assert.EqualValues(t, []string{"/* before else */"}, texts(comments[ifStatement.IfBranch].Trailing))
+	assert.EqualValues(t, []string{"/* inner */"}, texts(comments[ifStatement].Inner))
+	assert.EqualValues(t, []string{"/* after if */"}, texts(comments[ifStatement].Trailing))
+
+	switchCase := &switchStatement.Cases[0]
+	assert.EqualValues(t, []string{"/* case */"}, texts(comments[switchCase].Leading))
+	assert.EqualValues(t, []string{"/* after break */"}, texts(comments[switchCase].Trailing))
+	assert.Nil(t, comments[switchCase.Statements[0]])
+
+	// Every comment is attached exactly once.
+	count := 0
+	for _, c := range comments {
+		count += len(c.Leading) + len(c.Trailing) + len(c.Inner)
+	}
+	assert.EqualValues(t, 12, count)
+}
+
+func TestParseWithoutComments(t *testing.T) {
+	p := parser.NewParser(lexer.NewScanner(strings.NewReader(
+		"/* header */ { output(1); /* ignored */ }")))
+	p.ParseProgram()
+
+	assert.Empty(t, p.Errors)
+	assert.Empty(t, p.Comments)
+}
+
+func texts(comments []lexer.Comment) []string {
+	result := []string{}
+	for _, comment := range comments {
+		result = append(result, comment.Text)
+	}
+	return result
+}
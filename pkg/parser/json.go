@@ -0,0 +1,258 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// The AST is encoded to JSON as nested objects. Every node has a "kind" field with
+// the name of its type (e.g "IfStatement"), followed by the fields of the node:
+//
+//	{
+//	  "kind": "InputStatement",
+//	  "variable": "x",
+//	  "position": {"line": 3, "column": 7}
+//	}
+//
+// The kind is used to decode nodes that are stored in Statement, Expression and
+// BooleanExpression fields, so the encoding can be decoded back into the same AST.
+
+// nodeKinds maps the kind of every AST node to its type.
+var nodeKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{}, &Declaration{}, &AssignmentStatement{}, &InputStatement{},
+		&OutputStatement{}, &IfStatement{}, &WhileStatement{}, &SwitchStatement{},
+		&SwitchCase{}, &BreakStatement{}, &StatementsBlock{}, &VariableExpression{},
+		&IntLiteral{}, &FloatLiteral{}, &ArithmeticExpression{}, &OrBooleanExpression{},
+		&AndBooleanExpression{}, &NotBooleanExpression{}, &CompareBooleanExpression{},
+	} {
+		t := reflect.TypeOf(node).Elem()
+		nodeKinds[t.Name()] = t
+	}
+}
+
+// KindOf returns the kind of an AST node, e.g "IfStatement".
+func KindOf(node Node) string {
+	return reflect.TypeOf(node).Elem().Name()
+}
+
+// UnmarshalNode decodes an AST node of any kind from its JSON encoding.
+func UnmarshalNode(data []byte) (Node, error) {
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil, nil
+	}
+
+	var header struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	t, ok := nodeKinds[header.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown node kind %q", header.Kind)
+	}
+
+	node := reflect.New(t).Interface().(Node)
+	if err := json.Unmarshal(data, node); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// marshalNode encodes the fields of an AST node, preceded by its kind.
+func marshalNode(node Node) ([]byte, error) {
+	v := reflect.ValueOf(node).Elem()
+	t := v.Type()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"kind":%q`, t.Name())
+
+	for i := 0; i < t.NumField(); i++ {
+		name, omitEmpty := parseTag(t.Field(i))
+		if omitEmpty && v.Field(i).IsZero() {
+			continue
+		}
+
+		value, err := json.Marshal(v.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(&buf, ",%q:", name)
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// unmarshalNode decodes the fields of an AST node. Fields that hold an interface are
+// decoded according to the kind of their value.
+func unmarshalNode(data []byte, node Node) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(node).Elem()
+	t := v.Type()
+
+	if kind, ok := fields["kind"]; ok {
+		var name string
+		if err := json.Unmarshal(kind, &name); err != nil || name != t.Name() {
+			return fmt.Errorf("cannot decode %s as %s", kind, t.Name())
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		name, _ := parseTag(t.Field(i))
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Interface:
+			child, err := unmarshalChild(raw, field.Type())
+			if err != nil {
+				return err
+			}
+			field.Set(child)
+
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Interface:
+			var items []json.RawMessage
+			if err := json.Unmarshal(raw, &items); err != nil {
+				return err
+			}
+
+			slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+			for j, item := range items {
+				child, err := unmarshalChild(item, field.Type().Elem())
+				if err != nil {
+					return err
+				}
+				slice.Index(j).Set(child)
+			}
+			field.Set(slice)
+
+		default:
+			if err := json.Unmarshal(raw, field.Addr().Interface()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// unmarshalChild decodes a node that is stored in a field of an interface type, e.g
+// Statement, and makes sure it implements that interface.
+func unmarshalChild(data []byte, fieldType reflect.Type) (reflect.Value, error) {
+	node, err := UnmarshalNode(data)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	if node == nil {
+		return reflect.Zero(fieldType), nil
+	}
+
+	if !reflect.TypeOf(node).Implements(fieldType) {
+		return reflect.Value{}, fmt.Errorf("%s is not a valid %s", KindOf(node), fieldType.Name())
+	}
+
+	return reflect.ValueOf(node), nil
+}
+
+// parseTag returns the JSON name of a struct field, and whether it has omitempty.
+func parseTag(field reflect.StructField) (string, bool) {
+	parts := strings.Split(field.Tag.Get("json"), ",")
+	if parts[0] == "" {
+		return field.Name, false
+	}
+
+	return parts[0], len(parts) > 1 && parts[1] == "omitempty"
+}
+
+// MarshalText encodes the data type as its CPL keyword.
+func (t DataType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a data type from its CPL keyword.
+func (t *DataType) UnmarshalText(text []byte) error {
+	for i, name := range dataTypes {
+		if name == string(text) {
+			*t = DataType(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown data type %q", text)
+}
+
+// MarshalText encodes the operator as its CPL symbol.
+func (o Operator) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText decodes an operator from its CPL symbol.
+func (o *Operator) UnmarshalText(text []byte) error {
+	for i, symbol := range operators {
+		if symbol == string(text) {
+			*o = Operator(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown operator %q", text)
+}
+
+func (n *Program) MarshalJSON() ([]byte, error)                  { return marshalNode(n) }
+func (n *Declaration) MarshalJSON() ([]byte, error)              { return marshalNode(n) }
+func (n *AssignmentStatement) MarshalJSON() ([]byte, error)      { return marshalNode(n) }
+func (n *InputStatement) MarshalJSON() ([]byte, error)           { return marshalNode(n) }
+func (n *OutputStatement) MarshalJSON() ([]byte, error)          { return marshalNode(n) }
+func (n *IfStatement) MarshalJSON() ([]byte, error)              { return marshalNode(n) }
+func (n *WhileStatement) MarshalJSON() ([]byte, error)           { return marshalNode(n) }
+func (n *SwitchStatement) MarshalJSON() ([]byte, error)          { return marshalNode(n) }
+func (n *SwitchCase) MarshalJSON() ([]byte, error)               { return marshalNode(n) }
+func (n *BreakStatement) MarshalJSON() ([]byte, error)           { return marshalNode(n) }
+func (n *StatementsBlock) MarshalJSON() ([]byte, error)          { return marshalNode(n) }
+func (n *VariableExpression) MarshalJSON() ([]byte, error)       { return marshalNode(n) }
+func (n *IntLiteral) MarshalJSON() ([]byte, error)               { return marshalNode(n) }
+func (n *FloatLiteral) MarshalJSON() ([]byte, error)             { return marshalNode(n) }
+func (n *ArithmeticExpression) MarshalJSON() ([]byte, error)     { return marshalNode(n) }
+func (n *OrBooleanExpression) MarshalJSON() ([]byte, error)      { return marshalNode(n) }
+func (n *AndBooleanExpression) MarshalJSON() ([]byte, error)     { return marshalNode(n) }
+func (n *NotBooleanExpression) MarshalJSON() ([]byte, error)     { return marshalNode(n) }
+func (n *CompareBooleanExpression) MarshalJSON() ([]byte, error) { return marshalNode(n) }
+
+func (n *Program) UnmarshalJSON(data []byte) error                  { return unmarshalNode(data, n) }
+func (n *Declaration) UnmarshalJSON(data []byte) error              { return unmarshalNode(data, n) }
+func (n *AssignmentStatement) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, n) }
+func (n *InputStatement) UnmarshalJSON(data []byte) error           { return unmarshalNode(data, n) }
+func (n *OutputStatement) UnmarshalJSON(data []byte) error          { return unmarshalNode(data, n) }
+func (n *IfStatement) UnmarshalJSON(data []byte) error              { return unmarshalNode(data, n) }
+func (n *WhileStatement) UnmarshalJSON(data []byte) error           { return unmarshalNode(data, n) }
+func (n *SwitchStatement) UnmarshalJSON(data []byte) error          { return unmarshalNode(data, n) }
+func (n *SwitchCase) UnmarshalJSON(data []byte) error               { return unmarshalNode(data, n) }
+func (n *BreakStatement) UnmarshalJSON(data []byte) error           { return unmarshalNode(data, n) }
+func (n *StatementsBlock) UnmarshalJSON(data []byte) error          { return unmarshalNode(data, n) }
+func (n *VariableExpression) UnmarshalJSON(data []byte) error       { return unmarshalNode(data, n) }
+func (n *IntLiteral) UnmarshalJSON(data []byte) error               { return unmarshalNode(data, n) }
+func (n *FloatLiteral) UnmarshalJSON(data []byte) error             { return unmarshalNode(data, n) }
+func (n *ArithmeticExpression) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, n) }
+func (n *OrBooleanExpression) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, n) }
+func (n *AndBooleanExpression) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, n) }
+func (n *NotBooleanExpression) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, n) }
+func (n *CompareBooleanExpression) UnmarshalJSON(data []byte) error { return unmarshalNode(data, n) }
@@ -0,0 +1,113 @@
+package parser_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalNode(t *testing.T) {
+	data, err := json.Marshal(&parser.AssignmentStatement{
+		Variable: "x",
+		Value: &parser.ArithmeticExpression{
+			LHS: &parser.VariableExpression{Variable: "y",
+				Position: lexer.Position{Line: 1, Column: 4, Offset: 10},
+				End:      lexer.Position{Line: 1, Column: 5, Offset: 11}},
+			Operator: parser.Multiply,
+			RHS:      &parser.FloatLiteral{Value: 2.5, Type: parser.Float},
+		},
+		CastType: parser.Integer,
+	})
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"kind": "AssignmentStatement",
+		"variable": "x",
+		"value": {
+			"kind": "ArithmeticExpression",
+			"lhs": {"kind": "VariableExpression", "variable": "y",
+				"position": {"line": 1, "column": 4, "offset": 10},
+				"end": {"line": 1, "column": 5, "offset": 11}},
+			"operator": "*",
+			"rhs": {"kind": "FloatLiteral", "value": 2.5, "type": "float",
+				"position": {"line": 0, "column": 0, "offset": 0},
+				"end": {"line": 0, "column": 0, "offset": 0}},
+			"position": {"line": 0, "column": 0, "offset": 0},
+			"end": {"line": 0, "column": 0, "offset": 0}
+		},
+		"castType": "int",
+		"position": {"line": 0, "column": 0, "offset": 0},
+		"end": {"line": 0, "column": 0, "offset": 0}
+	}`, string(data))
+}
+
+func TestMarshalKindFirst(t *testing.T) {
+	data, err := json.Marshal(&parser.BreakStatement{})
+	assert.NoError(t, err)
+	assert.EqualValues(t, `{"kind":"BreakStatement",`+
+		`"position":{"line":0,"column":0,"offset":0},"end":{"line":0,"column":0,"offset":0}}`, string(data))
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.ou")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	for _, file := range files {
+		code, err := ioutil.ReadFile(file)
+		assert.NoError(t, err)
+
+		program, _ := parser.Parse(string(code))
+		data, err := json.Marshal(program)
+		assert.NoError(t, err)
+
+		decoded, err := parser.UnmarshalNode(data)
+		assert.NoError(t, err)
+		assert.EqualValues(t, program, decoded, file)
+	}
+}
+
+func TestUnmarshalPartialAST(t *testing.T) {
+	var statement parser.IfStatement
+	err := json.Unmarshal([]byte(`{
+		"kind": "IfStatement",
+		"condition": {
+			"kind": "NotBooleanExpression",
+			"value": {"kind": "CompareBooleanExpression", "lhs": null, "operator": ">=",
+				"rhs": {"kind": "IntLiteral", "value": 5}}
+		},
+		"ifBranch": {"kind": "BreakStatement"},
+		"elseBranch": null
+	}`), &statement)
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, parser.IfStatement{
+		Condition: &parser.NotBooleanExpression{
+			Value: &parser.CompareBooleanExpression{
+				Operator: parser.GreaterThanOrEqualTo,
+				RHS:      &parser.IntLiteral{Value: 5},
+			},
+		},
+		IfBranch: &parser.BreakStatement{},
+	}, statement)
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	_, err := parser.UnmarshalNode([]byte(`{"kind": "GotoStatement"}`))
+	assert.EqualError(t, err, `unknown node kind "GotoStatement"`)
+
+	_, err = parser.UnmarshalNode([]byte(`{"kind": "OutputStatement", "value": {"kind": "BreakStatement"}}`))
+	assert.EqualError(t, err, "BreakStatement is not a valid Expression")
+
+	_, err = parser.UnmarshalNode([]byte(`{"kind": "IntLiteral", "type": "double"}`))
+	assert.EqualError(t, err, `unknown data type "double"`)
+
+	var block parser.StatementsBlock
+	err = json.Unmarshal([]byte(`{"kind": "BreakStatement"}`), &block)
+	assert.EqualError(t, err, `cannot decode "BreakStatement" as StatementsBlock`)
+}
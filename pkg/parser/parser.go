@@ -5,36 +5,88 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
 	"github.com/alongubkin/cpl-compiler/pkg/lexer"
 )
 
 // Parser represents a CPL parser.
 type Parser struct {
-	Errors    []ParseError
+	Errors    []diagnostic.Diagnostic
 	scanner   *lexer.Scanner
 	lookahead lexer.Token
+	panicking bool
+	// lastEnd is the end position of the last matched token, where the nodes that
+	// are being parsed end.
+	lastEnd lexer.Position
+
+	// Comments contains the comments of the AST nodes, if the scanner is in
+	// Trivia mode.
+	Comments CommentMap
+	open     []openNode
+	matched  int
+	trailing []lexer.Comment
+	ended    Node
 }
 
+// Synchronization sets for panic-mode error recovery. After a syntax error the parser
+// stops reporting errors, skips tokens until it reaches a token from the set of the
+// construct that failed, and then continues parsing normally. This way a single typo
+// yields a single error, and independent errors later in the file are still reported.
+var (
+	// statementSync contains the tokens that can start or follow a statement.
+	statementSync = []lexer.TokenType{lexer.SEMICOLON, lexer.LBRACKET, lexer.RBRACKET,
+		lexer.IF, lexer.WHILE, lexer.SWITCH, lexer.INPUT, lexer.OUTPUT, lexer.BREAK,
+		lexer.CASE, lexer.DEFAULT, lexer.EOF}
+
+	// declarationSync contains the tokens that can end the declarations.
+	declarationSync = []lexer.TokenType{lexer.SEMICOLON, lexer.LBRACKET, lexer.EOF}
+
+	// resumeTokens are tokens that start or end a construct. Successfully matching one
+	// of them means the parser is back in sync, so it can report errors again.
+	resumeTokens = []lexer.TokenType{lexer.SEMICOLON, lexer.LBRACKET, lexer.RBRACKET,
+		lexer.IF, lexer.ELSE, lexer.WHILE, lexer.SWITCH, lexer.INPUT, lexer.OUTPUT,
+		lexer.BREAK, lexer.CASE, lexer.DEFAULT}
+)
+
 // NewParser returns a new instance of Parser.
 func NewParser(scanner *lexer.Scanner) *Parser {
-	return &Parser{
-		Errors:    []ParseError{},
-		scanner:   scanner,
-		lookahead: scanner.Scan(),
+	p := &Parser{
+		Errors:   []diagnostic.Diagnostic{},
+		scanner:  scanner,
+		Comments: CommentMap{},
 	}
+	p.scan()
+	return p
 }
 
-// Parse parses a CPL program and returns its AST representation.
-func Parse(s string) (*Program, []ParseError) {
+// Parse parses a CPL program and returns its AST representation. Lexical errors are
+// reported together with the syntax errors.
+func Parse(s string) (*Program, []diagnostic.Diagnostic) {
 	parser := NewParser(lexer.NewScanner(strings.NewReader(s)))
 	return parser.ParseProgram(), parser.Errors
 }
 
+// ParseWithComments parses a CPL program like Parse, and also returns the comments
+// that belong to its nodes.
+func ParseWithComments(s string) (*Program, CommentMap, []diagnostic.Diagnostic) {
+	scanner := lexer.NewScanner(strings.NewReader(s))
+	scanner.Trivia = true
+
+	parser := NewParser(scanner)
+	return parser.ParseProgram(), parser.Comments, parser.Errors
+}
+
 func (p *Parser) matchToken(tokenTypes ...lexer.TokenType) (*lexer.Token, bool) {
 	for _, tokType := range tokenTypes {
 		if tokType == p.lookahead.TokenType {
 			token := p.lookahead
-			p.lookahead = p.scanner.Scan()
+			p.attachComments(&token)
+			p.lastEnd = token.End
+			p.scan()
+
+			if isOneOf(tokType, resumeTokens) {
+				p.panicking = false
+			}
 			return &token, true
 		}
 	}
@@ -52,13 +104,42 @@ func (p *Parser) match(tokenTypes ...lexer.TokenType) (*lexer.Token, bool) {
 }
 
 func (p *Parser) skip() {
+	p.scan()
+}
+
+// scan reads the next token into the lookahead, and collects the errors that the
+// scanner reported while reading it. The parser can't match an illegal token, so it
+// enters panic mode instead of reporting it again as an unexpected token.
+func (p *Parser) scan() {
+	errorCount := len(p.scanner.Errors)
 	p.lookahead = p.scanner.Scan()
+
+	for _, err := range p.scanner.Errors[errorCount:] {
+		p.Errors = append(p.Errors, err)
+		p.panicking = true
+	}
+}
+
+// synchronize skips tokens until the lookahead is in the synchronization set, and
+// leaves panic mode. A semicolon ends the erroneous construct, so it is skipped too.
+func (p *Parser) synchronize(sync []lexer.TokenType) {
+	for !isOneOf(p.lookahead.TokenType, sync) {
+		p.skip()
+	}
+
+	if p.lookahead.TokenType == lexer.SEMICOLON {
+		p.skip()
+	}
+
+	p.panicking = false
 }
 
 // ParseProgram parses a CPL program and returns a Program AST object.
 // 	program -> declarations stmt_block
 func (p *Parser) ParseProgram() *Program {
 	program := &Program{Position: p.lookahead.Position}
+	p.begin(program)
+	defer p.end()
 
 	// Parse declarations.
 	program.Declarations = p.ParseDeclarations()
@@ -68,9 +149,10 @@ func (p *Parser) ParseProgram() *Program {
 
 	// Make sure there's an EOF at the end of the file.
 	if token, ok := p.match(lexer.EOF); !ok {
-		p.addError(newParseError(token.Lexeme, []string{"EOF"}, token.Position))
+		p.addError(newParseError(token, "EOF"))
 	}
 
+	program.End = p.lastEnd
 	return program
 }
 
@@ -78,8 +160,19 @@ func (p *Parser) ParseProgram() *Program {
 // 	declarations -> declaration declarations | ε
 func (p *Parser) ParseDeclarations() []Declaration {
 	declarations := []Declaration{}
+	parsed := []*Declaration{}
 	for p.lookahead.TokenType == lexer.ID {
-		declarations = append(declarations, *p.ParseDeclaration())
+		declaration := p.ParseDeclaration()
+		declarations = append(declarations, *declaration)
+		parsed = append(parsed, declaration)
+
+		if p.panicking {
+			p.synchronize(declarationSync)
+		}
+	}
+
+	for i := range declarations {
+		p.moveComments(parsed[i], &declarations[i])
 	}
 
 	return declarations
@@ -89,21 +182,22 @@ func (p *Parser) ParseDeclarations() []Declaration {
 // 	declaration -> idlist ':' type ';'
 func (p *Parser) ParseDeclaration() *Declaration {
 	declaration := &Declaration{Position: p.lookahead.Position}
+	p.begin(declaration)
+	defer p.end()
+
 	declaration.Names = p.ParseIDList()
 
 	if token, ok := p.match(lexer.COLON); !ok {
-		p.addError(newParseError(token.Lexeme, []string{":"}, token.Position))
+		p.addError(newParseError(token, ":"))
 	}
 
 	declaration.Type = p.ParseType()
-	if declaration.Type == Unknown {
-
-	}
 
 	if token, ok := p.match(lexer.SEMICOLON); !ok {
-		p.addError(newParseError(token.Lexeme, []string{";"}, token.Position))
+		p.addError(newParseError(token, ";"))
 	}
 
+	declaration.End = p.lastEnd
 	return declaration
 }
 
@@ -112,8 +206,7 @@ func (p *Parser) ParseDeclaration() *Declaration {
 func (p *Parser) ParseType() DataType {
 	token, ok := p.match(lexer.INT, lexer.FLOAT)
 	if !ok {
-		p.skip()
-		p.addError(newParseError(token.Lexeme, []string{"int", "float"}, token.Position))
+		p.addError(newParseError(token, "int", "float"))
 		return Unknown
 	}
 
@@ -137,7 +230,7 @@ func (p *Parser) ParseIDList() []string {
 	if token, ok := p.match(lexer.ID); ok {
 		names = append(names, token.Lexeme)
 	} else {
-		p.addError(newParseError(token.Lexeme, []string{"ID"}, token.Position))
+		p.addError(newParseError(token, "ID"))
 	}
 
 	// Parse other names if exist
@@ -147,7 +240,7 @@ func (p *Parser) ParseIDList() []string {
 		if token, ok := p.match(lexer.ID); ok {
 			names = append(names, token.Lexeme)
 		} else {
-			p.addError(newParseError(token.Lexeme, []string{"ID"}, token.Position))
+			p.addError(newParseError(token, "ID"))
 		}
 	}
 
@@ -193,17 +286,19 @@ func (p *Parser) ParseStatement() Statement {
 //   	| STATIC_CAST '(' type ')' '(' expression ')' ';
 func (p *Parser) ParseAssignmentStatement() *AssignmentStatement {
 	result := &AssignmentStatement{Position: p.lookahead.Position}
+	p.begin(result)
+	defer p.end()
 
 	// ID
 	if token, ok := p.match(lexer.ID); ok {
 		result.Variable = token.Lexeme
 	} else {
-		p.addError(newParseError(token.Lexeme, []string{"ID"}, token.Position))
+		p.addError(newParseError(token, "ID"))
 	}
 
 	// =
 	if token, ok := p.match(lexer.EQUALS); !ok {
-		p.addError(newParseError(token.Lexeme, []string{"ID"}, token.Position))
+		p.addError(newParseError(token, "="))
 	}
 
 	// Parse static_cast(type) if exists
@@ -212,14 +307,14 @@ func (p *Parser) ParseAssignmentStatement() *AssignmentStatement {
 
 		// (
 		if token, ok := p.match(lexer.LPAREN); !ok {
-			p.addError(newParseError(token.Lexeme, []string{"("}, token.Position))
+			p.addError(newParseError(token, "("))
 		}
 
 		result.CastType = p.ParseType()
 
 		// )
 		if token, ok := p.match(lexer.RPAREN); !ok {
-			p.addError(newParseError(token.Lexeme, []string{")"}, token.Position))
+			p.addError(newParseError(token, ")"))
 		}
 	}
 
@@ -228,9 +323,10 @@ func (p *Parser) ParseAssignmentStatement() *AssignmentStatement {
 
 	// ;
 	if token, ok := p.match(lexer.SEMICOLON); !ok {
-		p.addError(newParseError(token.Lexeme, []string{";"}, token.Position))
+		p.addError(newParseError(token, ";"))
 	}
 
+	result.End = p.lastEnd
 	return result
 }
 
@@ -238,34 +334,37 @@ func (p *Parser) ParseAssignmentStatement() *AssignmentStatement {
 // user input.
 // 	input_stmt -> INPUT '(' ID ')' ';'
 func (p *Parser) ParseInputStatement() *InputStatement {
+	result := &InputStatement{Position: p.lookahead.Position}
+	p.begin(result)
+	defer p.end()
+
 	if _, ok := p.match(lexer.INPUT); !ok {
 		return nil
 	}
 
-	result := &InputStatement{Position: p.lookahead.Position}
-
 	// (
 	if token, ok := p.match(lexer.LPAREN); !ok {
-		p.addError(newParseError(token.Lexeme, []string{"("}, token.Position))
+		p.addError(newParseError(token, "("))
 	}
 
 	// ID
 	if token, ok := p.match(lexer.ID); ok {
 		result.Variable = token.Lexeme
 	} else {
-		p.addError(newParseError(token.Lexeme, []string{"ID"}, token.Position))
+		p.addError(newParseError(token, "ID"))
 	}
 
 	// )
 	if token, ok := p.match(lexer.RPAREN); !ok {
-		p.addError(newParseError(token.Lexeme, []string{")"}, token.Position))
+		p.addError(newParseError(token, ")"))
 	}
 
 	// ;
 	if token, ok := p.match(lexer.SEMICOLON); !ok {
-		p.addError(newParseError(token.Lexeme, []string{";"}, token.Position))
+		p.addError(newParseError(token, ";"))
 	}
 
+	result.End = p.lastEnd
 	return result
 }
 
@@ -273,51 +372,56 @@ func (p *Parser) ParseInputStatement() *InputStatement {
 // expressions.
 // 	output_stmt -> OUTPUT '(' expression ')' ';'
 func (p *Parser) ParseOutputStatement() *OutputStatement {
+	result := &OutputStatement{Position: p.lookahead.Position}
+	p.begin(result)
+	defer p.end()
+
 	if _, ok := p.match(lexer.OUTPUT); !ok {
 		return nil
 	}
 
-	result := &OutputStatement{Position: p.lookahead.Position}
-
 	// (
 	if token, ok := p.match(lexer.LPAREN); !ok {
-		p.addError(newParseError(token.Lexeme, []string{"("}, token.Position))
+		p.addError(newParseError(token, "("))
 	}
 
 	result.Value = p.ParseExpression()
 
 	// )
 	if token, ok := p.match(lexer.RPAREN); !ok {
-		p.addError(newParseError(token.Lexeme, []string{")"}, token.Position))
+		p.addError(newParseError(token, ")"))
 	}
 
 	// ;
 	if token, ok := p.match(lexer.SEMICOLON); !ok {
-		p.addError(newParseError(token.Lexeme, []string{";"}, token.Position))
+		p.addError(newParseError(token, ";"))
 	}
 
+	result.End = p.lastEnd
 	return result
 }
 
 // ParseIfStatement parses a CPL if statement.
 // 	if_stmt -> IF '(' boolexpr ')' stmt ELSE stmt
 func (p *Parser) ParseIfStatement() *IfStatement {
+	result := &IfStatement{Position: p.lookahead.Position}
+	p.begin(result)
+	defer p.end()
+
 	if _, ok := p.match(lexer.IF); !ok {
 		return nil
 	}
 
-	result := &IfStatement{Position: p.lookahead.Position}
-
 	// (
 	if token, ok := p.match(lexer.LPAREN); !ok {
-		p.addError(newParseError(token.Lexeme, []string{"("}, token.Position))
+		p.addError(newParseError(token, "("))
 	}
 
 	result.Condition = p.ParseBooleanExpression()
 
 	// )
 	if token, ok := p.match(lexer.RPAREN); !ok {
-		p.addError(newParseError(token.Lexeme, []string{")"}, token.Position))
+		p.addError(newParseError(token, ")"))
 	}
 
 	// stmt
@@ -325,87 +429,95 @@ func (p *Parser) ParseIfStatement() *IfStatement {
 
 	// ELSE
 	if token, ok := p.match(lexer.ELSE); !ok {
-		p.addError(newParseError(token.Lexeme, []string{"else"}, token.Position))
+		p.addError(newParseError(token, "else"))
+		result.End = p.lastEnd
 		return result
 	}
 
 	// stmt
 	result.ElseBranch = p.ParseStatement()
 
+	result.End = p.lastEnd
 	return result
 }
 
 // ParseWhileStatement parses a CPL if statement.
 // 	while_stmt -> WHILE '(' boolexpr ')' stmt
 func (p *Parser) ParseWhileStatement() *WhileStatement {
+	result := &WhileStatement{Position: p.lookahead.Position}
+	p.begin(result)
+	defer p.end()
+
 	if _, ok := p.match(lexer.WHILE); !ok {
 		return nil
 	}
 
-	result := &WhileStatement{Position: p.lookahead.Position}
-
 	// (
 	if token, ok := p.match(lexer.LPAREN); !ok {
-		p.addError(newParseError(token.Lexeme, []string{"("}, token.Position))
+		p.addError(newParseError(token, "("))
 	}
 
 	result.Condition = p.ParseBooleanExpression()
 
 	// )
 	if token, ok := p.match(lexer.RPAREN); !ok {
-		p.addError(newParseError(token.Lexeme, []string{")"}, token.Position))
+		p.addError(newParseError(token, ")"))
 	}
 
 	// stmt
 	result.Body = p.ParseStatement()
+	result.End = p.lastEnd
 	return result
 }
 
 // ParseSwitchStatement parses a CPL switch statement.
 // 	switch_stmt -> SWITCH '(' expression ')' '{' caselist DEFAULT ':' stmtlist '}'
 func (p *Parser) ParseSwitchStatement() *SwitchStatement {
+	result := &SwitchStatement{Position: p.lookahead.Position}
+	p.begin(result)
+	defer p.end()
+
 	if _, ok := p.match(lexer.SWITCH); !ok {
 		return nil
 	}
 
-	result := &SwitchStatement{Position: p.lookahead.Position}
-
 	// (
 	if token, ok := p.match(lexer.LPAREN); !ok {
-		p.addError(newParseError(token.Lexeme, []string{"("}, token.Position))
+		p.addError(newParseError(token, "("))
 	}
 
 	result.Expression = p.ParseExpression()
 
 	// )
 	if token, ok := p.match(lexer.RPAREN); !ok {
-		p.addError(newParseError(token.Lexeme, []string{")"}, token.Position))
+		p.addError(newParseError(token, ")"))
 	}
 
 	// {
 	if token, ok := p.match(lexer.LBRACKET); !ok {
-		p.addError(newParseError(token.Lexeme, []string{"{"}, token.Position))
+		p.addError(newParseError(token, "{"))
 	}
 
 	result.Cases = p.ParseSwitchCases()
 
 	// DEFAULT
 	if token, ok := p.match(lexer.DEFAULT); !ok {
-		p.addError(newParseError(token.Lexeme, []string{"DEFAULT"}, token.Position))
+		p.addError(newParseError(token, "DEFAULT"))
 	}
 
 	// :
 	if token, ok := p.match(lexer.COLON); !ok {
-		p.addError(newParseError(token.Lexeme, []string{":"}, token.Position))
+		p.addError(newParseError(token, ":"))
 	}
 
 	result.DefaultCase = p.ParseStatements()
 
 	// }
 	if token, ok := p.match(lexer.RBRACKET); !ok {
-		p.addError(newParseError(token.Lexeme, []string{"}"}, token.Position))
+		p.addError(newParseError(token, "}"))
 	}
 
+	result.End = p.lastEnd
 	return result
 }
 
@@ -413,30 +525,40 @@ func (p *Parser) ParseSwitchStatement() *SwitchStatement {
 //	CASE NUM ':' stmtlist caselist
 func (p *Parser) ParseSwitchCases() []SwitchCase {
 	cases := []SwitchCase{}
+	parsed := []*SwitchCase{}
 	for p.lookahead.TokenType == lexer.CASE {
-		item := SwitchCase{Position: p.lookahead.Position}
+		item := &SwitchCase{Position: p.lookahead.Position}
+		p.begin(item)
 		p.match(lexer.CASE)
 
 		// NUM
 		if token, ok := p.match(lexer.NUM); ok {
 			value, err := strconv.ParseInt(token.Lexeme, 10, 64)
 			if err != nil {
-				p.addError(ParseError{Message: fmt.Sprintf("%s is not an int", token.Lexeme)})
+				p.addError(diagnostic.NewError(diagnostic.InvalidNumber, token.Span(),
+					fmt.Sprintf("%s is not an int", token.Lexeme)))
 			}
 
 			item.Value = value
 		} else {
-			p.addError(newParseError(token.Lexeme, []string{"NUM"}, token.Position))
+			p.addError(newParseError(token, "NUM"))
 		}
 
 		// :
 		if token, ok := p.match(lexer.COLON); !ok {
-			p.addError(newParseError(token.Lexeme, []string{":"}, token.Position))
+			p.addError(newParseError(token, ":"))
 		}
 
 		item.Statements = p.ParseStatements()
+		item.End = p.lastEnd
+		p.end()
+
+		cases = append(cases, *item)
+		parsed = append(parsed, item)
+	}
 
-		cases = append(cases, item)
+	for i := range cases {
+		p.moveComments(parsed[i], &cases[i])
 	}
 
 	return cases
@@ -446,38 +568,45 @@ func (p *Parser) ParseSwitchCases() []SwitchCase {
 // 	break_stmt -> BREAK ';'
 func (p *Parser) ParseBreakStatement() *BreakStatement {
 	result := &BreakStatement{Position: p.lookahead.Position}
+	p.begin(result)
+	defer p.end()
+
 	if _, ok := p.match(lexer.BREAK); !ok {
 		return nil
 	}
 
 	// ;
 	if token, ok := p.match(lexer.SEMICOLON); !ok {
-		p.addError(newParseError(token.Lexeme, []string{";"}, token.Position))
+		p.addError(newParseError(token, ";"))
 	}
 
+	result.End = p.lastEnd
 	return result
 }
 
 // ParseStatementsBlock parses a block of statements.
 //	stmt_block -> '{' stmtlist '}'
 func (p *Parser) ParseStatementsBlock() *StatementsBlock {
+	result := &StatementsBlock{Position: p.lookahead.Position}
+	p.begin(result)
+	defer p.end()
+
 	// Parse {
-	startBlock := false
 	startBlockToken, startBlock := p.match(lexer.LBRACKET)
 	if !startBlock {
-		p.addError(newParseError(startBlockToken.Lexeme,
-			[]string{"{"}, startBlockToken.Position))
+		p.addError(newParseError(startBlockToken, "{"))
 	}
 
-	statements := p.ParseStatements()
+	result.Statements = p.ParseStatements()
 
 	// Parse }
 	// Only show an error for the } if there was a {
 	if token, ok := p.match(lexer.RBRACKET); !ok && startBlock {
-		p.addError(newParseError(token.Lexeme, []string{"}"}, token.Position))
+		p.addError(newParseError(token, "}"))
 	}
 
-	return &StatementsBlock{Position: startBlockToken.Position, Statements: statements}
+	result.End = p.lastEnd
+	return result
 }
 
 // ParseStatements parses zero or more statements.
@@ -486,11 +615,19 @@ func (p *Parser) ParseStatements() []Statement {
 	statements := []Statement{}
 	for {
 		statement := p.ParseStatement()
-		if statement == nil {
+		if statement != nil {
+			statements = append(statements, statement)
+		} else if isOneOf(p.lookahead.TokenType, []lexer.TokenType{
+			lexer.RBRACKET, lexer.CASE, lexer.DEFAULT, lexer.EOF}) {
 			break
+		} else {
+			// The lookahead can't start a statement.
+			p.addError(newParseError(&p.lookahead, "statement"))
 		}
 
-		statements = append(statements, statement)
+		if p.panicking {
+			p.synchronize(statementSync)
+		}
 	}
 
 	return statements
@@ -507,6 +644,7 @@ func (p *Parser) ParseBooleanExpression() BooleanExpression {
 			Position: token.Position,
 			LHS:      result,
 			RHS:      p.ParseBooleanTerm(),
+			End:      p.lastEnd,
 		}
 	}
 
@@ -524,6 +662,7 @@ func (p *Parser) ParseBooleanTerm() BooleanExpression {
 			Position: token.Position,
 			LHS:      result,
 			RHS:      p.ParseBooleanFactor(),
+			End:      p.lastEnd,
 		}
 	}
 
@@ -540,16 +679,16 @@ func (p *Parser) ParseBooleanFactor() BooleanExpression {
 		p.match(lexer.NOT)
 
 		if token, ok := p.match(lexer.LPAREN); !ok {
-			p.addError(newParseError(token.Lexeme, []string{"("}, token.Position))
+			p.addError(newParseError(token, "("))
 		}
 
 		expr := p.ParseBooleanExpression()
 
 		if token, ok := p.match(lexer.RPAREN); !ok {
-			p.addError(newParseError(token.Lexeme, []string{")"}, token.Position))
+			p.addError(newParseError(token, ")"))
 		}
 
-		return &NotBooleanExpression{Position: position, Value: expr}
+		return &NotBooleanExpression{Position: position, Value: expr, End: p.lastEnd}
 
 	default:
 		lhs := p.ParseExpression()
@@ -571,14 +710,16 @@ func (p *Parser) ParseBooleanFactor() BooleanExpression {
 				operator = GreaterThanOrEqualTo
 			}
 		} else {
-			p.addError(newParseError(token.Lexeme, []string{"==", "!=", "<", ">", "<=", ">="}, token.Position))
+			p.addError(newParseError(token, "==", "!=", "<", ">", "<=", ">="))
 		}
 
+		rhs := p.ParseExpression()
 		return &CompareBooleanExpression{
 			Position: position,
 			LHS:      lhs,
 			Operator: operator,
-			RHS:      p.ParseExpression(),
+			RHS:      rhs,
+			End:      p.lastEnd,
 		}
 	}
 }
@@ -605,6 +746,7 @@ func (p *Parser) ParseExpression() Expression {
 			LHS:      result,
 			RHS:      rhs,
 			Operator: operator,
+			End:      p.lastEnd,
 		}
 	}
 
@@ -632,6 +774,7 @@ func (p *Parser) ParseTerm() Expression {
 			LHS:      result,
 			RHS:      p.ParseFactor(),
 			Operator: operator,
+			End:      p.lastEnd,
 		}
 	}
 
@@ -648,14 +791,15 @@ func (p *Parser) ParseFactor() Expression {
 		expr := p.ParseExpression()
 
 		if token, ok := p.match(lexer.RPAREN); !ok {
-			p.addError(newParseError(token.Lexeme, []string{")"}, token.Position))
+			p.addError(newParseError(token, ")"))
 		}
 
 		return expr
 
 	case lexer.ID:
 		token, _ := p.match(lexer.ID)
-		return &VariableExpression{Position: token.Position, Variable: token.Lexeme}
+		return &VariableExpression{Position: token.Position, End: token.End,
+			Variable: token.Lexeme}
 
 	case lexer.NUM:
 		token, _ := p.match(lexer.NUM)
@@ -664,33 +808,45 @@ func (p *Parser) ParseFactor() Expression {
 		if strings.Contains(token.Lexeme, ".") {
 			value, err := strconv.ParseFloat(token.Lexeme, 64)
 			if err != nil {
-				p.addError(ParseError{Message: fmt.Sprintf("%s is not number", token.Lexeme)})
+				p.addError(diagnostic.NewError(diagnostic.InvalidNumber, token.Span(),
+					fmt.Sprintf("%s is not number", token.Lexeme)))
 			}
 
-			return &FloatLiteral{Position: token.Position, Value: value}
+			return &FloatLiteral{Position: token.Position, End: token.End, Value: value}
 		}
 
 		// Otherwise, parse it as an integer.
 		value, err := strconv.ParseInt(token.Lexeme, 10, 64)
 		if err != nil {
-			p.addError(ParseError{Message: fmt.Sprintf("%s is not number", token.Lexeme)})
+			p.addError(diagnostic.NewError(diagnostic.InvalidNumber, token.Span(),
+				fmt.Sprintf("%s is not number", token.Lexeme)))
 		}
 
-		return &IntLiteral{Position: token.Position, Value: value}
+		return &IntLiteral{Position: token.Position, End: token.End, Value: value}
 
 	default:
-		p.addError(newParseError(p.lookahead.Lexeme, []string{"(", "ID", "NUM"},
-			p.lookahead.Position))
+		p.addError(newParseError(&p.lookahead, "(", "ID", "NUM"))
 		return nil
 	}
 }
 
-func (p *Parser) addError(e ParseError) {
-	for _, err := range p.Errors {
-		if err.Pos == e.Pos {
-			return
-		}
+// addError reports a syntax error and enters panic mode. Errors are not reported
+// while in panic mode, because they are most likely caused by the previous error.
+func (p *Parser) addError(e diagnostic.Diagnostic) {
+	if p.panicking {
+		return
 	}
 
 	p.Errors = append(p.Errors, e)
+	p.panicking = true
+}
+
+func isOneOf(tokenType lexer.TokenType, tokenTypes []lexer.TokenType) bool {
+	for _, t := range tokenTypes {
+		if t == tokenType {
+			return true
+		}
+	}
+
+	return false
 }
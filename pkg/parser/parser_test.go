@@ -6,8 +6,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
 	"github.com/alongubkin/cpl-compiler/pkg/lexer"
 	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,7 +20,9 @@ func TestEmptyProgram(t *testing.T) {
 		Declarations: []parser.Declaration{},
 		StatementsBlock: &parser.StatementsBlock{
 			Statements: []parser.Statement{},
+			End:        lexer.Position{Line: 0, Column: 2, Offset: 2},
 		},
+		End: lexer.Position{Line: 0, Column: 2, Offset: 2},
 	}, program)
 }
 
@@ -572,6 +576,79 @@ func TestSwitchStatement(t *testing.T) {
 	}, statement)
 }
 
+func TestLexicalErrors(t *testing.T) {
+	_, errors := parser.Parse("a : int;\n{ a = 5 | 3; }")
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.IllegalCharacter,
+			source.NewSpan(lexer.Position{Line: 1, Column: 8, Offset: 17}, 1), "illegal character '|'"),
+	}, errors)
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	_, errors := parser.Parse("a : int;\n{ a = 5 }")
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.UnexpectedToken,
+			source.NewSpan(lexer.Position{Line: 1, Column: 8, Offset: 17}, 1), "found }, expected ;"),
+	}, errors)
+}
+
+func TestErrorRecovery(t *testing.T) {
+	_, errors := parser.Parse(`a, b : int;
+c : flot;
+d e : float;
+{
+  a = 5 +;
+  b = (a * 2;
+  output(a)
+  if (a > ) output(1); else output(2);
+  while (a < 3 { a = a + ; }
+  a = 1 | 2;
+  ) b = 7;
+  switch (a) { case 1: output(1) break; default: break; }
+  b = 7
+}`)
+
+	messages := []string{}
+	for _, err := range errors {
+		messages = append(messages, err.Error())
+	}
+
+	assert.EqualValues(t, []string{
+		"found flot, expected int, float at line 2, char 5",
+		"found e, expected : at line 3, char 3",
+		"found ;, expected (, ID, NUM at line 5, char 10",
+		"found ;, expected ) at line 6, char 13",
+		"found if, expected ; at line 8, char 3",
+		"found ), expected (, ID, NUM at line 8, char 11",
+		"found {, expected ) at line 9, char 16",
+		"found ;, expected (, ID, NUM at line 9, char 26",
+		"illegal character '|' at line 10, char 9",
+		"found ), expected statement at line 11, char 3",
+		"found break, expected ; at line 12, char 34",
+		"found }, expected ; at line 14, char 1",
+	}, messages)
+}
+
+func TestErrorRecoveryMissingElse(t *testing.T) {
+	_, errors := parser.Parse(`x : int;
+{
+  if (x == 6) { output(6); }
+  switch (x) { default: break; }
+  if (x == 6) { output(6); }
+  output(999);
+}`)
+
+	messages := []string{}
+	for _, err := range errors {
+		messages = append(messages, err.Error())
+	}
+
+	assert.EqualValues(t, []string{
+		"found switch, expected else at line 4, char 3",
+		"found output, expected else at line 6, char 3",
+	}, messages)
+}
+
 func newParserNoPositions(reader io.Reader) *parser.Parser {
 	scanner := &lexer.Scanner{
 		Reader:           bufio.NewReader(reader),
@@ -0,0 +1,68 @@
+package parser
+
+import "github.com/alongubkin/cpl-compiler/pkg/source"
+
+// Every node stores the position of its first token, and the End position right after
+// its last token. Binary expressions are an exception: their Position is the position
+// of the operator, but their span starts at their left operand.
+
+func (n *Program) Span() source.Span                  { return span(n.Position, n.End) }
+func (n *Declaration) Span() source.Span              { return span(n.Position, n.End) }
+func (n *AssignmentStatement) Span() source.Span      { return span(n.Position, n.End) }
+func (n *InputStatement) Span() source.Span           { return span(n.Position, n.End) }
+func (n *OutputStatement) Span() source.Span          { return span(n.Position, n.End) }
+func (n *IfStatement) Span() source.Span              { return span(n.Position, n.End) }
+func (n *WhileStatement) Span() source.Span           { return span(n.Position, n.End) }
+func (n *SwitchStatement) Span() source.Span          { return span(n.Position, n.End) }
+func (n *SwitchCase) Span() source.Span               { return span(n.Position, n.End) }
+func (n *BreakStatement) Span() source.Span           { return span(n.Position, n.End) }
+func (n *StatementsBlock) Span() source.Span          { return span(n.Position, n.End) }
+func (n *VariableExpression) Span() source.Span       { return span(n.Position, n.End) }
+func (n *IntLiteral) Span() source.Span               { return span(n.Position, n.End) }
+func (n *FloatLiteral) Span() source.Span             { return span(n.Position, n.End) }
+func (n *ArithmeticExpression) Span() source.Span     { return span(startOf(n.LHS, n.Position), n.End) }
+func (n *OrBooleanExpression) Span() source.Span      { return span(startOf(n.LHS, n.Position), n.End) }
+func (n *AndBooleanExpression) Span() source.Span     { return span(startOf(n.LHS, n.Position), n.End) }
+func (n *NotBooleanExpression) Span() source.Span     { return span(n.Position, n.End) }
+func (n *CompareBooleanExpression) Span() source.Span { return span(n.Position, n.End) }
+
+// span returns the span between two positions. Nodes that were created without an end
+// position, e.g by transformations of the AST, get an empty span.
+func span(start source.Position, end source.Position) source.Span {
+	if end.Before(start) {
+		return source.PointSpan(start)
+	}
+	return source.Span{Start: start, End: end}
+}
+
+// startOf returns the start of the span of a node, or pos if the node is nil.
+func startOf(node Node, pos source.Position) source.Position {
+	if isNil(node) {
+		return pos
+	}
+	return node.Span().Start
+}
+
+// NodeAt returns the innermost node of the AST that contains pos, or nil if pos is
+// outside of the AST.
+func NodeAt(root Node, pos source.Position) Node {
+	path := PathAt(root, pos)
+	if len(path) == 0 {
+		return nil
+	}
+	return path[len(path)-1]
+}
+
+// PathAt returns the nodes that contain pos, from the root to the innermost node.
+func PathAt(root Node, pos source.Position) []Node {
+	path := []Node{}
+	Inspect(root, func(node Node) bool {
+		if node == nil || !node.Span().Contains(pos) {
+			return false
+		}
+
+		path = append(path, node)
+		return true
+	})
+	return path
+}
@@ -0,0 +1,105 @@
+package parser_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+const spanProgram = `a : int;
+{
+  a = a + 12 * 3;
+}`
+
+func TestSpans(t *testing.T) {
+	program, errors := parser.Parse(spanProgram)
+	assert.Empty(t, errors)
+
+	assignment := program.StatementsBlock.Statements[0].(*parser.AssignmentStatement)
+	assert.EqualValues(t, source.Span{
+		Start: lexer.Position{Line: 2, Column: 2, Offset: 13},
+		End:   lexer.Position{Line: 2, Column: 17, Offset: 28},
+	}, assignment.Span())
+
+	// Binary expressions start at their left operand, not at the operator.
+	assert.EqualValues(t, source.Span{
+		Start: lexer.Position{Line: 2, Column: 6, Offset: 17},
+		End:   lexer.Position{Line: 2, Column: 16, Offset: 27},
+	}, assignment.Value.Span())
+
+	assert.EqualValues(t, source.Span{
+		Start: lexer.Position{Line: 0, Column: 0, Offset: 0},
+		End:   lexer.Position{Line: 0, Column: 8, Offset: 8},
+	}, program.Declarations[0].Span())
+
+	assert.EqualValues(t, source.Span{
+		Start: lexer.Position{Line: 0, Column: 0, Offset: 0},
+		End:   lexer.Position{Line: 3, Column: 1, Offset: 30},
+	}, program.Span())
+}
+
+func TestSpanWithoutEnd(t *testing.T) {
+	position := lexer.Position{Line: 3, Column: 4, Offset: 20}
+	literal := &parser.IntLiteral{Position: position, Value: 5}
+	assert.EqualValues(t, source.PointSpan(position), literal.Span())
+}
+
+func TestNodeAt(t *testing.T) {
+	program, errors := parser.Parse(spanProgram)
+	assert.Empty(t, errors)
+
+	tests := []struct {
+		line     int
+		column   int
+		expected string
+	}{
+		{0, 2, "*parser.Declaration"},
+		{1, 0, "*parser.StatementsBlock"},
+		{2, 2, "*parser.AssignmentStatement"},
+		{2, 6, "*parser.VariableExpression"},
+		{2, 8, "*parser.ArithmeticExpression +"},
+		{2, 11, "*parser.IntLiteral"},
+		{2, 13, "*parser.ArithmeticExpression *"},
+		{2, 16, "*parser.AssignmentStatement"},
+		{3, 0, "*parser.StatementsBlock"},
+	}
+
+	for _, test := range tests {
+		node := parser.NodeAt(program, lexer.Position{Line: test.line, Column: test.column})
+		description := fmt.Sprintf("%T", node)
+		if expr, ok := node.(*parser.ArithmeticExpression); ok {
+			description += " " + expr.Operator.String()
+		}
+		assert.EqualValues(t, test.expected, description, "%d:%d", test.line, test.column)
+	}
+}
+
+func TestNodeAtOutside(t *testing.T) {
+	program, errors := parser.Parse(spanProgram)
+	assert.Empty(t, errors)
+
+	assert.Nil(t, parser.NodeAt(program, lexer.Position{Line: 10, Column: 0}))
+}
+
+func TestPathAt(t *testing.T) {
+	program, errors := parser.Parse(spanProgram)
+	assert.Empty(t, errors)
+
+	types := []string{}
+	for _, node := range parser.PathAt(program, lexer.Position{Line: 2, Column: 15}) {
+		types = append(types, fmt.Sprintf("%T", node))
+	}
+
+	assert.EqualValues(t, []string{
+		"*parser.Program",
+		"*parser.StatementsBlock",
+		"*parser.AssignmentStatement",
+		"*parser.ArithmeticExpression",
+		"*parser.ArithmeticExpression",
+		"*parser.IntLiteral",
+	}, types)
+}
@@ -0,0 +1,277 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order: It starts by calling v.Visit(node);
+// node must not be nil. If the visitor w returned by v.Visit(node) is not nil,
+// Walk is invoked recursively with visitor w for each of the non-nil children of
+// node, followed by a call of w.Visit(nil).
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for i := range n.Declarations {
+			Walk(v, &n.Declarations[i])
+		}
+		walkIfNotNil(v, n.StatementsBlock)
+
+	case *Declaration, *InputStatement, *BreakStatement, *VariableExpression,
+		*IntLiteral, *FloatLiteral:
+		// Leaf nodes
+
+	case *AssignmentStatement:
+		walkIfNotNil(v, n.Value)
+
+	case *OutputStatement:
+		walkIfNotNil(v, n.Value)
+
+	case *IfStatement:
+		walkIfNotNil(v, n.Condition)
+		walkIfNotNil(v, n.IfBranch)
+		walkIfNotNil(v, n.ElseBranch)
+
+	case *WhileStatement:
+		walkIfNotNil(v, n.Condition)
+		walkIfNotNil(v, n.Body)
+
+	case *SwitchStatement:
+		walkIfNotNil(v, n.Expression)
+		for i := range n.Cases {
+			Walk(v, &n.Cases[i])
+		}
+		walkStatements(v, n.DefaultCase)
+
+	case *SwitchCase:
+		walkStatements(v, n.Statements)
+
+	case *StatementsBlock:
+		walkStatements(v, n.Statements)
+
+	case *ArithmeticExpression:
+		walkIfNotNil(v, n.LHS)
+		walkIfNotNil(v, n.RHS)
+
+	case *OrBooleanExpression:
+		walkIfNotNil(v, n.LHS)
+		walkIfNotNil(v, n.RHS)
+
+	case *AndBooleanExpression:
+		walkIfNotNil(v, n.LHS)
+		walkIfNotNil(v, n.RHS)
+
+	case *NotBooleanExpression:
+		walkIfNotNil(v, n.Value)
+
+	case *CompareBooleanExpression:
+		walkIfNotNil(v, n.LHS)
+		walkIfNotNil(v, n.RHS)
+
+	default:
+		panic(fmt.Sprintf("parser.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+	for _, statement := range statements {
+		walkIfNotNil(v, statement)
+	}
+}
+
+// walkIfNotNil walks a child node. The parser may leave nil children in the AST
+// after syntax errors, so they are skipped.
+func walkIfNotNil(v Visitor, node Node) {
+	if !isNil(node) {
+		Walk(v, node)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling f(node);
+// node must not be nil. If f returns true, Inspect invokes f recursively for each
+// of the non-nil children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite traverses an AST in depth-first order, and replaces every node with the
+// result of f. The children of a node are rewritten before the node itself, so f
+// always sees a node whose children were already rewritten.
+//
+// The result of f must be usable in the place of the original node, e.g a statement
+// can only be replaced with another statement, and a Declaration or a SwitchCase
+// can only be replaced with a node of the same type. If f returns nil for a
+// statement in a list of statements (a block or a switch case), the statement is
+// removed from the list. Rewrite returns the rewritten root node.
+func Rewrite(node Node, f func(Node) Node) Node {
+	if isNil(node) {
+		return node
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for i := range n.Declarations {
+			n.Declarations[i] = *rewriteAs(&n.Declarations[i], f, "Declaration").(*Declaration)
+		}
+		if n.StatementsBlock != nil {
+			n.StatementsBlock = rewriteAs(n.StatementsBlock, f, "StatementsBlock").(*StatementsBlock)
+		}
+
+	case *Declaration, *InputStatement, *BreakStatement, *VariableExpression,
+		*IntLiteral, *FloatLiteral:
+		// Leaf nodes
+
+	case *AssignmentStatement:
+		n.Value = rewriteExpression(n.Value, f)
+
+	case *OutputStatement:
+		n.Value = rewriteExpression(n.Value, f)
+
+	case *IfStatement:
+		n.Condition = rewriteBooleanExpression(n.Condition, f)
+		n.IfBranch = rewriteStatement(n.IfBranch, f)
+		n.ElseBranch = rewriteStatement(n.ElseBranch, f)
+
+	case *WhileStatement:
+		n.Condition = rewriteBooleanExpression(n.Condition, f)
+		n.Body = rewriteStatement(n.Body, f)
+
+	case *SwitchStatement:
+		n.Expression = rewriteExpression(n.Expression, f)
+		for i := range n.Cases {
+			n.Cases[i] = *rewriteAs(&n.Cases[i], f, "SwitchCase").(*SwitchCase)
+		}
+		n.DefaultCase = rewriteStatements(n.DefaultCase, f)
+
+	case *SwitchCase:
+		n.Statements = rewriteStatements(n.Statements, f)
+
+	case *StatementsBlock:
+		n.Statements = rewriteStatements(n.Statements, f)
+
+	case *ArithmeticExpression:
+		n.LHS = rewriteExpression(n.LHS, f)
+		n.RHS = rewriteExpression(n.RHS, f)
+
+	case *OrBooleanExpression:
+		n.LHS = rewriteBooleanExpression(n.LHS, f)
+		n.RHS = rewriteBooleanExpression(n.RHS, f)
+
+	case *AndBooleanExpression:
+		n.LHS = rewriteBooleanExpression(n.LHS, f)
+		n.RHS = rewriteBooleanExpression(n.RHS, f)
+
+	case *NotBooleanExpression:
+		n.Value = rewriteBooleanExpression(n.Value, f)
+
+	case *CompareBooleanExpression:
+		n.LHS = rewriteExpression(n.LHS, f)
+		n.RHS = rewriteExpression(n.RHS, f)
+
+	default:
+		panic(fmt.Sprintf("parser.Rewrite: unexpected node type %T", n))
+	}
+
+	return f(node)
+}
+
+// rewriteAs rewrites a node whose replacement must have the same type.
+func rewriteAs(node Node, f func(Node) Node, typeName string) Node {
+	result := Rewrite(node, f)
+	if isNil(result) || reflect.TypeOf(result) != reflect.TypeOf(node) {
+		panic(fmt.Sprintf("parser.Rewrite: cannot replace %s with %T", typeName, result))
+	}
+	return result
+}
+
+func rewriteStatement(statement Statement, f func(Node) Node) Statement {
+	if isNil(statement) {
+		return statement
+	}
+
+	result := Rewrite(statement, f)
+	if result == nil {
+		return nil
+	}
+
+	replacement, ok := result.(Statement)
+	if !ok {
+		panic(fmt.Sprintf("parser.Rewrite: cannot replace statement with %T", result))
+	}
+	return replacement
+}
+
+func rewriteStatements(statements []Statement, f func(Node) Node) []Statement {
+	if statements == nil {
+		return nil
+	}
+
+	result := []Statement{}
+	for _, statement := range statements {
+		if statement = rewriteStatement(statement, f); statement != nil {
+			result = append(result, statement)
+		}
+	}
+	return result
+}
+
+func rewriteExpression(expr Expression, f func(Node) Node) Expression {
+	if isNil(expr) {
+		return expr
+	}
+
+	result := Rewrite(expr, f)
+	if result == nil {
+		return nil
+	}
+
+	replacement, ok := result.(Expression)
+	if !ok {
+		panic(fmt.Sprintf("parser.Rewrite: cannot replace expression with %T", result))
+	}
+	return replacement
+}
+
+func rewriteBooleanExpression(expr BooleanExpression, f func(Node) Node) BooleanExpression {
+	if isNil(expr) {
+		return expr
+	}
+
+	result := Rewrite(expr, f)
+	if result == nil {
+		return nil
+	}
+
+	replacement, ok := result.(BooleanExpression)
+	if !ok {
+		panic(fmt.Sprintf("parser.Rewrite: cannot replace boolean expression with %T", result))
+	}
+	return replacement
+}
+
+// isNil returns true if the node is nil, or is a nil pointer stored in an interface.
+func isNil(node Node) bool {
+	return node == nil || reflect.ValueOf(node).IsNil()
+}
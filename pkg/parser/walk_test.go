@@ -0,0 +1,222 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const walkProgram = `
+a, b: int;
+c: float;
+{
+	input(a);
+	if (a > 1 || !(b == 2)) b = a + 1; else c = 2.5;
+	while (a < 10) {
+		switch (a) {
+			case 1: output(a); break;
+			default: a = a * 2;
+		}
+	}
+}`
+
+type kindCollector struct {
+	kinds []string
+}
+
+func (c *kindCollector) Visit(node parser.Node) parser.Visitor {
+	if node != nil {
+		c.kinds = append(c.kinds, parser.KindOf(node))
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	program, errors := parser.Parse(walkProgram)
+	assert.Empty(t, errors)
+
+	collector := &kindCollector{}
+	parser.Walk(collector, program)
+
+	assert.EqualValues(t, []string{
+		"Program",
+		"Declaration",
+		"Declaration",
+		"StatementsBlock",
+		"InputStatement",
+		"IfStatement",
+		"OrBooleanExpression",
+		"CompareBooleanExpression",
+		"VariableExpression",
+		"IntLiteral",
+		"NotBooleanExpression",
+		"CompareBooleanExpression",
+		"VariableExpression",
+		"IntLiteral",
+		"AssignmentStatement",
+		"ArithmeticExpression",
+		"VariableExpression",
+		"IntLiteral",
+		"AssignmentStatement",
+		"FloatLiteral",
+		"WhileStatement",
+		"CompareBooleanExpression",
+		"VariableExpression",
+		"IntLiteral",
+		"StatementsBlock",
+		"SwitchStatement",
+		"VariableExpression",
+		"SwitchCase",
+		"OutputStatement",
+		"VariableExpression",
+		"BreakStatement",
+		"AssignmentStatement",
+		"ArithmeticExpression",
+		"VariableExpression",
+		"IntLiteral",
+	}, collector.kinds)
+}
+
+func TestWalkSkipsNilChildren(t *testing.T) {
+	collector := &kindCollector{}
+	parser.Walk(collector, &parser.IfStatement{
+		IfBranch: &parser.BreakStatement{},
+	})
+
+	assert.EqualValues(t, []string{"IfStatement", "BreakStatement"}, collector.kinds)
+}
+
+func TestInspect(t *testing.T) {
+	program, errors := parser.Parse(walkProgram)
+	assert.Empty(t, errors)
+
+	// Collect variables that are used outside of boolean expressions.
+	variables := []string{}
+	parser.Inspect(program, func(node parser.Node) bool {
+		switch n := node.(type) {
+		case *parser.VariableExpression:
+			variables = append(variables, n.Variable)
+		case parser.BooleanExpression:
+			return false
+		}
+		return true
+	})
+
+	assert.EqualValues(t, []string{"a", "a", "a", "a"}, variables)
+}
+
+func TestInspectCallsNilAfterChildren(t *testing.T) {
+	depth, maxDepth := 0, 0
+	parser.Inspect(&parser.ArithmeticExpression{
+		LHS: &parser.IntLiteral{Value: 1},
+		RHS: &parser.ArithmeticExpression{
+			LHS: &parser.IntLiteral{Value: 2},
+			RHS: &parser.IntLiteral{Value: 3},
+		},
+	}, func(node parser.Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		return true
+	})
+
+	assert.EqualValues(t, 0, depth)
+	assert.EqualValues(t, 3, maxDepth)
+}
+
+func TestRewrite(t *testing.T) {
+	program, errors := parser.Parse(walkProgram)
+	assert.Empty(t, errors)
+
+	// Rename all variables and declarations, and replace every integer literal with 0.
+	parser.Rewrite(program, func(node parser.Node) parser.Node {
+		switch n := node.(type) {
+		case *parser.Declaration:
+			for i, name := range n.Names {
+				n.Names[i] = name + "_"
+			}
+		case *parser.VariableExpression:
+			n.Variable += "_"
+		case *parser.InputStatement:
+			n.Variable += "_"
+		case *parser.AssignmentStatement:
+			n.Variable += "_"
+		case *parser.IntLiteral:
+			return &parser.IntLiteral{Value: 0, Position: n.Position}
+		}
+		return node
+	})
+
+	assert.EqualValues(t, []string{"a_", "b_"}, program.Declarations[0].Names)
+	assert.EqualValues(t, []string{"c_"}, program.Declarations[1].Names)
+
+	parser.Inspect(program, func(node parser.Node) bool {
+		switch n := node.(type) {
+		case *parser.VariableExpression:
+			assert.Contains(t, n.Variable, "_")
+		case *parser.AssignmentStatement:
+			assert.Contains(t, n.Variable, "_")
+		case *parser.IntLiteral:
+			assert.EqualValues(t, 0, n.Value)
+		}
+		return true
+	})
+}
+
+func TestRewriteRemovesStatements(t *testing.T) {
+	program, errors := parser.Parse(walkProgram)
+	assert.Empty(t, errors)
+
+	parser.Rewrite(program, func(node parser.Node) parser.Node {
+		if _, ok := node.(*parser.BreakStatement); ok {
+			return nil
+		}
+		return node
+	})
+
+	parser.Inspect(program, func(node parser.Node) bool {
+		_, ok := node.(*parser.BreakStatement)
+		assert.False(t, ok)
+		return true
+	})
+
+	switchStatement := program.StatementsBlock.Statements[2].(*parser.WhileStatement).
+		Body.(*parser.StatementsBlock).Statements[0].(*parser.SwitchStatement)
+	assert.Len(t, switchStatement.Cases[0].Statements, 1)
+}
+
+func TestRewriteReplacesRoot(t *testing.T) {
+	result := parser.Rewrite(&parser.ArithmeticExpression{
+		LHS:      &parser.IntLiteral{Value: 2},
+		Operator: parser.Add,
+		RHS:      &parser.IntLiteral{Value: 3},
+	}, func(node parser.Node) parser.Node {
+		if n, ok := node.(*parser.ArithmeticExpression); ok {
+			return &parser.IntLiteral{
+				Value: n.LHS.(*parser.IntLiteral).Value + n.RHS.(*parser.IntLiteral).Value,
+			}
+		}
+		return node
+	})
+
+	assert.EqualValues(t, &parser.IntLiteral{Value: 5}, result)
+}
+
+func TestRewriteInvalidReplacement(t *testing.T) {
+	assert.Panics(t, func() {
+		parser.Rewrite(&parser.OutputStatement{Value: &parser.IntLiteral{}},
+			func(node parser.Node) parser.Node {
+				if _, ok := node.(*parser.IntLiteral); ok {
+					return &parser.BreakStatement{}
+				}
+				return node
+			})
+	})
+}
@@ -0,0 +1,77 @@
+package quad
+
+import (
+	"fmt"
+)
+
+// Assemble resolves every label reference to the number of the instruction the label
+// marks, and removes the LABEL pseudo-instructions. The instructions are processed in
+// two passes: the first pass records where each label is defined and the second one
+// replaces label operands, so labels may be referenced before they are defined.
+func Assemble(instructions []Instruction) ([]Instruction, []Error) {
+	errors := []Error{}
+	targets := map[int]int{}
+	definitions := map[int]int{}
+
+	// First pass: find the instruction number of every label.
+	number := 1
+	for i, instruction := range instructions {
+		if instruction.Opcode != LABEL {
+			number++
+			continue
+		}
+
+		label := instruction.Operands[0]
+		if _, exists := targets[label.Index]; exists {
+			errors = append(errors, Error{
+				Message: fmt.Sprintf("label %s already defined at line %d", label,
+					lineOf(instructions, definitions[label.Index])),
+				Line: lineOf(instructions, i),
+			})
+			continue
+		}
+
+		targets[label.Index] = number
+		definitions[label.Index] = i
+	}
+
+	// Second pass: replace label references with instruction numbers.
+	result := make([]Instruction, 0, number-1)
+	for i, instruction := range instructions {
+		if instruction.Opcode == LABEL {
+			continue
+		}
+
+		operands := make([]Operand, len(instruction.Operands))
+		for j, operand := range instruction.Operands {
+			operands[j] = operand
+			if operand.Kind != Label {
+				continue
+			}
+
+			if target, exists := targets[operand.Index]; exists {
+				operands[j] = NewIntLiteral(int64(target))
+			} else {
+				errors = append(errors, Error{
+					Message: fmt.Sprintf("undefined label %s", operand),
+					Line:    lineOf(instructions, i),
+				})
+			}
+		}
+
+		instruction.Operands = operands
+		result = append(result, instruction)
+	}
+
+	return result, errors
+}
+
+// lineOf returns the source line of an instruction, or its position in the list if it
+// wasn't parsed from text.
+func lineOf(instructions []Instruction, i int) int {
+	if instructions[i].Line != 0 {
+		return instructions[i].Line
+	}
+
+	return i + 1
+}
@@ -0,0 +1,83 @@
+package quad_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssemble(t *testing.T) {
+	instructions := parseProgram(t, `IINP a
+ILSS _t1 a 0
+JMPZ @2 _t1
+IPRT a
+JUMP @1
+@2:
+IPRT 0
+@1:
+HALT`)
+
+	result, errors := quad.Assemble(instructions)
+	assert.Empty(t, errors)
+	assert.EqualValues(t, `IINP a
+ILSS _t1 a 0
+JMPZ 6 _t1
+IPRT a
+JUMP 7
+IPRT 0
+HALT`, quad.Format(result))
+}
+
+func TestAssembleBackwardReference(t *testing.T) {
+	instructions := parseProgram(t, `@1:
+IINP a
+JMPZ @2 a
+JUMP @1
+@2:
+HALT`)
+
+	result, errors := quad.Assemble(instructions)
+	assert.Empty(t, errors)
+	assert.EqualValues(t, "IINP a\nJMPZ 4 a\nJUMP 1\nHALT", quad.Format(result))
+}
+
+func TestAssembleLabelPrefixes(t *testing.T) {
+	// @1 is a prefix of @12, which must not confuse the resolver.
+	lines := []string{}
+	for i := 1; i <= 12; i++ {
+		lines = append(lines, "JUMP @12")
+	}
+	lines = append(lines, "@1:", "IPRT 1", "@12:", "HALT")
+
+	result, errors := quad.Assemble(parseProgram(t, strings.Join(lines, "\n")))
+	assert.Empty(t, errors)
+	assert.EqualValues(t, "JUMP 14", result[0].String())
+	assert.EqualValues(t, "HALT", result[13].String())
+}
+
+func TestAssembleMultipleLabels(t *testing.T) {
+	instructions := parseProgram(t, "JUMP @2\n@1:\n@2:\nIPRT 1\nJUMP @1\nHALT")
+
+	result, errors := quad.Assemble(instructions)
+	assert.Empty(t, errors)
+	assert.EqualValues(t, "JUMP 2\nIPRT 1\nJUMP 2\nHALT", quad.Format(result))
+}
+
+func TestAssembleUndefinedLabel(t *testing.T) {
+	_, errors := quad.Assemble(parseProgram(t, "IINP a\nJMPZ @3 a\nHALT"))
+	assert.EqualValues(t, []quad.Error{{Message: "undefined label @3", Line: 2}}, errors)
+}
+
+func TestAssembleDuplicateLabel(t *testing.T) {
+	_, errors := quad.Assemble(parseProgram(t, "@1:\nIINP a\n@1:\nJUMP @1\nHALT"))
+	assert.EqualValues(t, []quad.Error{{Message: "label @1 already defined at line 1", Line: 3}}, errors)
+}
+
+func parseProgram(t *testing.T, program string) []quad.Instruction {
+	instructions, err := quad.Parse(strings.NewReader(program))
+	assert.NoError(t, err)
+
+	return instructions
+}
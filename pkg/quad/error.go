@@ -0,0 +1,16 @@
+package quad
+
+import (
+	"fmt"
+)
+
+// Error represents an error that occurred while reading or running a Quad program.
+type Error struct {
+	Message string
+	Line    int
+}
+
+// Error returns the string representation of the error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at line %d", e.Message, e.Line)
+}
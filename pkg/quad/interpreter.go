@@ -0,0 +1,347 @@
+package quad
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// value is the content of a Quad variable. Quad variables are dynamically typed: their type
+// is determined by the first instruction that assigns them, and can't change afterwards.
+type value struct {
+	isFloat bool
+	i       int64
+	f       float64
+}
+
+// Interpreter executes Quad programs.
+type Interpreter struct {
+	// Prompt receives a short prompt before every input instruction. If Prompt is nil,
+	// no prompts are written and invalid input stops the program with an error.
+	Prompt       io.Writer
+	input        *bufio.Reader
+	output       io.Writer
+	instructions []Instruction
+	pc           int
+	variables    map[string]value
+}
+
+// NewInterpreter returns a new instance of Interpreter.
+func NewInterpreter(instructions []Instruction, input io.Reader, output io.Writer) *Interpreter {
+	return &Interpreter{
+		input:        bufio.NewReader(input),
+		output:       output,
+		instructions: instructions,
+		pc:           1,
+		variables:    map[string]value{},
+	}
+}
+
+// Run parses a Quad program and executes it.
+func Run(program io.Reader, input io.Reader, output io.Writer) error {
+	instructions, err := Parse(program)
+	if err != nil {
+		return err
+	}
+
+	return NewInterpreter(instructions, input, output).Run()
+}
+
+// Run executes the program until it reaches a HALT instruction.
+func (interp *Interpreter) Run() error {
+	for {
+		if interp.pc < 1 || interp.pc > len(interp.instructions) {
+			return &Error{Message: fmt.Sprintf("invalid instruction number: %d", interp.pc), Line: interp.pc}
+		}
+
+		instruction := interp.instructions[interp.pc-1]
+		interp.pc++
+
+		if instruction.Opcode == HALT {
+			return nil
+		}
+
+		if err := interp.execute(instruction); err != nil {
+			return err
+		}
+	}
+}
+
+// execute runs a single instruction.
+func (interp *Interpreter) execute(inst Instruction) error {
+	if len(inst.Operands) != operandCounts[inst.Opcode] {
+		return interp.errorf(inst, "%s expects %d operands, found %d", inst.Opcode,
+			operandCounts[inst.Opcode], len(inst.Operands))
+	}
+
+	switch inst.Opcode {
+	case IASN, RASN:
+		v, err := interp.get(inst, inst.Operands[1], inst.Opcode == RASN)
+		if err != nil {
+			return err
+		}
+		return interp.set(inst, inst.Operands[0], v)
+
+	case IPRT, RPRT:
+		v, err := interp.get(inst, inst.Operands[0], inst.Opcode == RPRT)
+		if err != nil {
+			return err
+		}
+
+		if v.isFloat {
+			_, err = fmt.Fprintln(interp.output, FormatFloat(v.f))
+		} else {
+			_, err = fmt.Fprintln(interp.output, v.i)
+		}
+		return err
+
+	case IINP, RINP:
+		v, err := interp.read(inst, inst.Opcode == RINP)
+		if err != nil {
+			return err
+		}
+		return interp.set(inst, inst.Operands[0], v)
+
+	case IEQL, INQL, ILSS, IGRT, REQL, RNQL, RLSS, RGRT:
+		return interp.compare(inst)
+
+	case IADD, ISUB, IMLT, IDIV, RADD, RSUB, RMLT, RDIV:
+		return interp.arithmetic(inst)
+
+	case ITOR:
+		v, err := interp.get(inst, inst.Operands[1], false)
+		if err != nil {
+			return err
+		}
+		return interp.set(inst, inst.Operands[0], value{isFloat: true, f: float64(v.i)})
+
+	case RTOI:
+		v, err := interp.get(inst, inst.Operands[1], true)
+		if err != nil {
+			return err
+		}
+		return interp.set(inst, inst.Operands[0], value{i: int64(v.f)})
+
+	case JUMP:
+		return interp.jump(inst, inst.Operands[0])
+
+	case JMPZ:
+		v, err := interp.get(inst, inst.Operands[1], false)
+		if err != nil {
+			return err
+		}
+
+		if v.i == 0 {
+			return interp.jump(inst, inst.Operands[0])
+		}
+		return nil
+	}
+
+	return interp.errorf(inst, "unknown op: '%s'", inst.Opcode)
+}
+
+// compare executes the comparison instructions, which always store an integer.
+func (interp *Interpreter) compare(inst Instruction) error {
+	isFloat := inst.Opcode >= RASN
+	lhs, err := interp.get(inst, inst.Operands[1], isFloat)
+	if err != nil {
+		return err
+	}
+
+	rhs, err := interp.get(inst, inst.Operands[2], isFloat)
+	if err != nil {
+		return err
+	}
+
+	var result bool
+	switch inst.Opcode {
+	case IEQL:
+		result = lhs.i == rhs.i
+	case INQL:
+		result = lhs.i != rhs.i
+	case ILSS:
+		result = lhs.i < rhs.i
+	case IGRT:
+		result = lhs.i > rhs.i
+	case REQL:
+		result = lhs.f == rhs.f
+	case RNQL:
+		result = lhs.f != rhs.f
+	case RLSS:
+		result = lhs.f < rhs.f
+	case RGRT:
+		result = lhs.f > rhs.f
+	}
+
+	if result {
+		return interp.set(inst, inst.Operands[0], value{i: 1})
+	}
+	return interp.set(inst, inst.Operands[0], value{i: 0})
+}
+
+// arithmetic executes the arithmetic instructions.
+func (interp *Interpreter) arithmetic(inst Instruction) error {
+	isFloat := inst.Opcode >= RASN
+	lhs, err := interp.get(inst, inst.Operands[1], isFloat)
+	if err != nil {
+		return err
+	}
+
+	rhs, err := interp.get(inst, inst.Operands[2], isFloat)
+	if err != nil {
+		return err
+	}
+
+	result := value{isFloat: isFloat}
+	switch inst.Opcode {
+	case IADD:
+		result.i = lhs.i + rhs.i
+	case ISUB:
+		result.i = lhs.i - rhs.i
+	case IMLT:
+		result.i = lhs.i * rhs.i
+	case IDIV:
+		// Integer division truncates toward zero, like in C.
+		if rhs.i == 0 {
+			return interp.errorf(inst, "division by zero")
+		}
+		result.i = lhs.i / rhs.i
+	case RADD:
+		result.f = lhs.f + rhs.f
+	case RSUB:
+		result.f = lhs.f - rhs.f
+	case RMLT:
+		result.f = lhs.f * rhs.f
+	case RDIV:
+		if rhs.f == 0 {
+			return interp.errorf(inst, "division by zero")
+		}
+		result.f = lhs.f / rhs.f
+	}
+
+	return interp.set(inst, inst.Operands[0], result)
+}
+
+// get returns the value of an operand, and makes sure it has the expected type.
+func (interp *Interpreter) get(inst Instruction, operand Operand, isFloat bool) (value, error) {
+	var v value
+	switch operand.Kind {
+	case IntLiteral:
+		v = value{i: operand.Int}
+	case FloatLiteral:
+		v = value{isFloat: true, f: operand.Float}
+	default:
+		var exists bool
+		if v, exists = interp.variables[operand.String()]; !exists {
+			return v, interp.errorf(inst, "undefined variable '%s'", operand)
+		}
+	}
+
+	if v.isFloat != isFloat {
+		return v, interp.errorf(inst, "type mismatch for operand '%s', expected %s, found %s",
+			operand, typeName(isFloat), typeName(v.isFloat))
+	}
+
+	return v, nil
+}
+
+// set stores a value in a variable. Variables can't change their type once assigned.
+func (interp *Interpreter) set(inst Instruction, operand Operand, v value) error {
+	if operand.Kind != Variable && operand.Kind != Temporary {
+		return interp.errorf(inst, "invalid identifier '%s'", operand)
+	}
+
+	if old, exists := interp.variables[operand.String()]; exists && old.isFloat != v.isFloat {
+		return interp.errorf(inst, "type mismatch for variable '%s', expected %s, found %s",
+			operand, typeName(old.isFloat), typeName(v.isFloat))
+	}
+
+	interp.variables[operand.String()] = v
+	return nil
+}
+
+// read reads a single line of input and parses it as an integer or a float.
+func (interp *Interpreter) read(inst Instruction, isFloat bool) (value, error) {
+	for {
+		if interp.Prompt != nil {
+			fmt.Fprintf(interp.Prompt, "%s (%s)? ", inst.Operands[0], typeName(isFloat))
+		}
+
+		line, err := interp.input.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return value{}, interp.errorf(inst, "cannot read input: %s", err)
+		}
+
+		line = strings.TrimSpace(line)
+		if isFloat {
+			if f, err := strconv.ParseFloat(line, 64); err == nil {
+				return value{isFloat: true, f: f}, nil
+			}
+		} else if i, err := strconv.ParseInt(line, 10, 64); err == nil {
+			return value{i: i}, nil
+		}
+
+		if interp.Prompt == nil {
+			return value{}, interp.errorf(inst, "invalid input '%s'", line)
+		}
+
+		fmt.Fprintln(interp.Prompt, "Invalid input!")
+	}
+}
+
+// jump moves the program counter to the instruction number stored in target.
+func (interp *Interpreter) jump(inst Instruction, target Operand) error {
+	if target.Kind != IntLiteral {
+		return interp.errorf(inst, "invalid instruction number: '%s'", target)
+	}
+
+	interp.pc = int(target.Int)
+	return nil
+}
+
+func (interp *Interpreter) errorf(inst Instruction, format string, args ...interface{}) error {
+	line := inst.Line
+	if line == 0 {
+		line = interp.pc - 1
+	}
+
+	return &Error{Message: fmt.Sprintf(format, args...), Line: line}
+}
+
+func typeName(isFloat bool) string {
+	if isFloat {
+		return "float"
+	}
+	return "int"
+}
+
+// FormatFloat formats a float the same way the reference Python interpreter prints it:
+// the shortest representation that round-trips, always with a decimal point or an exponent.
+func FormatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+
+	// Find out the decimal exponent of the shortest representation.
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	exponent, _ := strconv.Atoi(s[strings.IndexByte(s, 'e')+1:])
+
+	if exponent < -4 || exponent >= 16 {
+		return s
+	}
+
+	s = strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.ContainsRune(s, '.') {
+		s += ".0"
+	}
+
+	return s
+}
@@ -0,0 +1,189 @@
+package quad_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProgram(t *testing.T) {
+	instructions, err := quad.Parse(strings.NewReader(`IINP a
+/* comment */
+RADD _t1 x 16.500000 # another comment
+JMPZ 4 a
+HALT
+CPL Compiler by Alon Gubkin`))
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, []quad.Instruction{
+		{Opcode: quad.IINP, Operands: []quad.Operand{{Kind: quad.Variable, Name: "a"}}, Line: 1},
+		{Opcode: quad.RADD, Operands: []quad.Operand{
+			{Kind: quad.Temporary, Index: 1},
+			{Kind: quad.Variable, Name: "x"},
+			{Kind: quad.FloatLiteral, Float: 16.5},
+		}, Line: 3},
+		{Opcode: quad.JMPZ, Operands: []quad.Operand{
+			{Kind: quad.IntLiteral, Int: 4},
+			{Kind: quad.Variable, Name: "a"},
+		}, Line: 4},
+		{Opcode: quad.HALT, Line: 5},
+	}, instructions)
+}
+
+func TestParseMissingHalt(t *testing.T) {
+	_, err := quad.Parse(strings.NewReader("IASN a 5\nIPRT a"))
+	assert.EqualValues(t, &quad.Error{Message: "missing HALT", Line: 2}, err)
+}
+
+func TestParseInvalidOpcode(t *testing.T) {
+	_, err := quad.Parse(strings.NewReader("IASN a 5\nIFOO a\nHALT"))
+	assert.EqualValues(t, &quad.Error{Message: "invalid op: 'IFOO'", Line: 2}, err)
+}
+
+func TestParseWrongOperandCount(t *testing.T) {
+	_, err := quad.Parse(strings.NewReader("IADD a 5\nHALT"))
+	assert.EqualValues(t, &quad.Error{Message: "IADD expects 3 operands, found 2", Line: 1}, err)
+}
+
+func TestRunArithmetic(t *testing.T) {
+	output := runProgram(t, `IASN a 7
+IADD b a 3
+ISUB c b 20
+IMLT d c 2
+IDIV e d 3
+IPRT b
+IPRT c
+IPRT d
+IPRT e
+HALT`, "")
+
+	assert.EqualValues(t, "10\n-10\n-20\n-6\n", output)
+}
+
+func TestRunFloats(t *testing.T) {
+	output := runProgram(t, `RASN a 1.5
+ITOR b 3
+RMLT c a b
+RDIV d 1.0 3.0
+RTOI e c
+RPRT c
+RPRT d
+RPRT b
+IPRT e
+RDIV f 1.0 100000.0
+RPRT f
+HALT`, "")
+
+	assert.EqualValues(t, "4.5\n0.3333333333333333\n3.0\n4\n1e-05\n", output)
+}
+
+func TestRunComparisons(t *testing.T) {
+	output := runProgram(t, `IEQL a 5 5
+INQL b 5 5
+ILSS c 4 5
+IGRT d 4 5
+RLSS e 1.5 2.5
+RGRT f 1.5 2.5
+IPRT a
+IPRT b
+IPRT c
+IPRT d
+IPRT e
+IPRT f
+HALT`, "")
+
+	assert.EqualValues(t, "1\n0\n1\n0\n1\n0\n", output)
+}
+
+func TestRunLoop(t *testing.T) {
+	// Prints the numbers from 1 to n.
+	output := runProgram(t, `IINP n
+IASN i 1
+IGRT _t1 i n
+ISUB _t2 1 _t1
+JMPZ 9 _t2
+IPRT i
+IADD i i 1
+JUMP 3
+HALT`, "4\n")
+
+	assert.EqualValues(t, "1\n2\n3\n4\n", output)
+}
+
+func TestRunInput(t *testing.T) {
+	output := runProgram(t, `IINP a
+RINP b
+IPRT a
+RPRT b
+HALT`, " 12\n3\n")
+
+	assert.EqualValues(t, "12\n3.0\n", output)
+}
+
+func TestRunPrompt(t *testing.T) {
+	instructions, err := quad.Parse(strings.NewReader("IINP a\nIPRT a\nHALT"))
+	assert.NoError(t, err)
+
+	output, prompt := new(bytes.Buffer), new(bytes.Buffer)
+	interpreter := quad.NewInterpreter(instructions, strings.NewReader("x\n5\n"), output)
+	interpreter.Prompt = prompt
+
+	assert.NoError(t, interpreter.Run())
+	assert.EqualValues(t, "5\n", output.String())
+	assert.EqualValues(t, "a (int)? Invalid input!\na (int)? ", prompt.String())
+}
+
+func TestRunInvalidInput(t *testing.T) {
+	err := quad.Run(strings.NewReader("IINP a\nHALT"), strings.NewReader("1.5\n"), new(bytes.Buffer))
+	assert.EqualValues(t, &quad.Error{Message: "invalid input '1.5'", Line: 1}, err)
+}
+
+func TestRunTypeMismatch(t *testing.T) {
+	err := quad.Run(strings.NewReader("IASN a 5\nRADD b a 1.0\nHALT"), strings.NewReader(""), new(bytes.Buffer))
+	assert.EqualValues(t, &quad.Error{
+		Message: "type mismatch for operand 'a', expected float, found int", Line: 2}, err)
+}
+
+func TestRunUndefinedVariable(t *testing.T) {
+	err := quad.Run(strings.NewReader("IPRT a\nHALT"), strings.NewReader(""), new(bytes.Buffer))
+	assert.EqualValues(t, &quad.Error{Message: "undefined variable 'a'", Line: 1}, err)
+}
+
+func TestRunDivisionByZero(t *testing.T) {
+	err := quad.Run(strings.NewReader("IASN a 0\nIDIV b 5 a\nHALT"), strings.NewReader(""), new(bytes.Buffer))
+	assert.EqualValues(t, &quad.Error{Message: "division by zero", Line: 2}, err)
+}
+
+func runProgram(t *testing.T, program string, input string) string {
+	output := new(bytes.Buffer)
+	err := quad.Run(strings.NewReader(program), strings.NewReader(input), output)
+	assert.NoError(t, err)
+
+	return output.String()
+}
+
+func TestFormatInstructions(t *testing.T) {
+	assert.EqualValues(t, `IADD _t1 x 5
+JMPZ @2 _t1
+RPRT 1.500000
+@2:
+HALT`, quad.Format([]quad.Instruction{
+		{Opcode: quad.IADD, Operands: []quad.Operand{
+			quad.NewTemporary(1), quad.NewVariable("x"), quad.NewIntLiteral(5)}},
+		{Opcode: quad.JMPZ, Operands: []quad.Operand{quad.NewLabel(2), quad.NewTemporary(1)}},
+		{Opcode: quad.RPRT, Operands: []quad.Operand{quad.NewFloatLiteral(1.5)}},
+		{Opcode: quad.LABEL, Operands: []quad.Operand{quad.NewLabel(2)}},
+		{Opcode: quad.HALT},
+	}))
+}
+
+func TestParseFormattedInstructions(t *testing.T) {
+	text := "ILSS _t1 a b\nJMPZ @1 _t1\nIPRT a\n@1:\nHALT"
+	instructions, err := quad.Parse(strings.NewReader(text))
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, text, quad.Format(instructions))
+}
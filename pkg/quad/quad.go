@@ -0,0 +1,349 @@
+package quad
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+)
+
+// Opcode represents a Quad instruction.
+type Opcode int
+
+// Quad's instructions
+const (
+	ILLEGAL Opcode = iota
+
+	// Integer instructions
+	IASN // IASN A B: A := B
+	IPRT // IPRT B: print the value of B
+	IINP // IINP A: read an integer into A
+	IEQL // IEQL A B C: if B = C then A := 1 else A := 0
+	INQL // INQL A B C: if B <> C then A := 1 else A := 0
+	ILSS // ILSS A B C: if B < C then A := 1 else A := 0
+	IGRT // IGRT A B C: if B > C then A := 1 else A := 0
+	IADD // IADD A B C: A := B + C
+	ISUB // ISUB A B C: A := B - C
+	IMLT // IMLT A B C: A := B * C
+	IDIV // IDIV A B C: A := B / C
+
+	// Float instructions
+	RASN // RASN A B: A := B
+	RPRT // RPRT B: print the value of B
+	RINP // RINP A: read a float into A
+	REQL // REQL A B C: if B = C then A := 1 else A := 0
+	RNQL // RNQL A B C: if B <> C then A := 1 else A := 0
+	RLSS // RLSS A B C: if B < C then A := 1 else A := 0
+	RGRT // RGRT A B C: if B > C then A := 1 else A := 0
+	RADD // RADD A B C: A := B + C
+	RSUB // RSUB A B C: A := B - C
+	RMLT // RMLT A B C: A := B * C
+	RDIV // RDIV A B C: A := B / C
+
+	// Conversions
+	ITOR // ITOR A B: A := integer B converted to float
+	RTOI // RTOI A B: A := float B converted to integer
+
+	// Control flow
+	JUMP // JUMP L: jump to instruction number L
+	JMPZ // JMPZ L A: if A = 0 then jump to instruction number L
+	HALT // HALT: stop immediately
+
+	// LABEL L is a pseudo-instruction that marks a jump target. Labels are generated by
+	// the code generator and are replaced with instruction numbers before execution.
+	LABEL
+)
+
+var opcodes = [...]string{
+	ILLEGAL: "ILLEGAL",
+
+	IASN: "IASN",
+	IPRT: "IPRT",
+	IINP: "IINP",
+	IEQL: "IEQL",
+	INQL: "INQL",
+	ILSS: "ILSS",
+	IGRT: "IGRT",
+	IADD: "IADD",
+	ISUB: "ISUB",
+	IMLT: "IMLT",
+	IDIV: "IDIV",
+
+	RASN: "RASN",
+	RPRT: "RPRT",
+	RINP: "RINP",
+	REQL: "REQL",
+	RNQL: "RNQL",
+	RLSS: "RLSS",
+	RGRT: "RGRT",
+	RADD: "RADD",
+	RSUB: "RSUB",
+	RMLT: "RMLT",
+	RDIV: "RDIV",
+
+	ITOR: "ITOR",
+	RTOI: "RTOI",
+
+	JUMP: "JUMP",
+	JMPZ: "JMPZ",
+	HALT: "HALT",
+
+	LABEL: "LABEL",
+}
+
+// operandCounts holds the number of operands each instruction expects.
+var operandCounts = [...]int{
+	IASN: 2, IPRT: 1, IINP: 1, IEQL: 3, INQL: 3, ILSS: 3, IGRT: 3, IADD: 3, ISUB: 3, IMLT: 3, IDIV: 3,
+	RASN: 2, RPRT: 1, RINP: 1, REQL: 3, RNQL: 3, RLSS: 3, RGRT: 3, RADD: 3, RSUB: 3, RMLT: 3, RDIV: 3,
+	ITOR: 2, RTOI: 2,
+	JUMP: 1, JMPZ: 2, HALT: 0,
+	LABEL: 1,
+}
+
+// String returns the string representation of the opcode.
+func (op Opcode) String() string {
+	if op >= 0 && op < Opcode(len(opcodes)) {
+		return opcodes[op]
+	}
+	return ""
+}
+
+// OperandCount returns the number of operands instructions with the opcode expect.
+func OperandCount(op Opcode) int {
+	if op >= 0 && op < Opcode(len(operandCounts)) {
+		return operandCounts[op]
+	}
+	return 0
+}
+
+// LookupOpcode returns the opcode with the given name, or ILLEGAL if there is none.
+func LookupOpcode(name string) Opcode {
+	for op, opName := range opcodes {
+		if op != int(ILLEGAL) && op != int(LABEL) && opName == name {
+			return Opcode(op)
+		}
+	}
+
+	return ILLEGAL
+}
+
+// OperandKind represents the kind of value an operand refers to.
+type OperandKind int
+
+// Kinds of operands
+const (
+	// Variable is a named memory location, e.g x.
+	Variable OperandKind = iota
+	// IntLiteral is a constant integer, e.g 5. Jump targets are also integer literals.
+	IntLiteral
+	// FloatLiteral is a constant float, e.g 5.000000.
+	FloatLiteral
+	// Temporary is a variable generated by the compiler, e.g _t1.
+	Temporary
+	// Label is a symbolic jump target, e.g @1.
+	Label
+)
+
+// Operand represents a single argument of a Quad instruction.
+type Operand struct {
+	Kind OperandKind
+	// Name is the name of a variable.
+	Name string
+	// Index is the number of a temporary or a label.
+	Index int
+	Int   int64
+	Float float64
+}
+
+// NewVariable returns an operand that refers to a variable.
+func NewVariable(name string) Operand {
+	return Operand{Kind: Variable, Name: name}
+}
+
+// NewTemporary returns an operand that refers to a compiler-generated temporary variable.
+func NewTemporary(index int) Operand {
+	return Operand{Kind: Temporary, Index: index}
+}
+
+// NewLabel returns an operand that refers to a jump target.
+func NewLabel(index int) Operand {
+	return Operand{Kind: Label, Index: index}
+}
+
+// NewIntLiteral returns an operand that contains a constant integer.
+func NewIntLiteral(value int64) Operand {
+	return Operand{Kind: IntLiteral, Int: value}
+}
+
+// NewFloatLiteral returns an operand that contains a constant float.
+func NewFloatLiteral(value float64) Operand {
+	return Operand{Kind: FloatLiteral, Float: value}
+}
+
+// String returns the string representation of the operand.
+func (o Operand) String() string {
+	switch o.Kind {
+	case IntLiteral:
+		return strconv.FormatInt(o.Int, 10)
+	case FloatLiteral:
+		return fmt.Sprintf("%f", o.Float)
+	case Temporary:
+		return fmt.Sprintf("_t%d", o.Index)
+	case Label:
+		return fmt.Sprintf("@%d", o.Index)
+	}
+
+	return o.Name
+}
+
+// Instruction represents a single Quad instruction, e.g IADD a b c.
+type Instruction struct {
+	Opcode   Opcode
+	Operands []Operand
+	// Position is the location of the CPL code this instruction was generated from.
+	Position lexer.Position
+	// Line is the line number of the instruction in its source file, if it was parsed from text.
+	Line int
+}
+
+// String returns the string representation of the instruction.
+func (i Instruction) String() string {
+	if i.Opcode == LABEL {
+		return i.Operands[0].String() + ":"
+	}
+
+	var b strings.Builder
+	b.WriteString(i.Opcode.String())
+	for _, operand := range i.Operands {
+		b.WriteString(" ")
+		b.WriteString(operand.String())
+	}
+
+	return b.String()
+}
+
+// Format returns the textual Quad representation of a list of instructions, one per line.
+func Format(instructions []Instruction) string {
+	lines := make([]string, len(instructions))
+	for i, instruction := range instructions {
+		lines[i] = instruction.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Write writes the textual Quad representation of a list of instructions to w.
+func Write(w io.Writer, instructions []Instruction) error {
+	_, err := io.WriteString(w, Format(instructions))
+	return err
+}
+
+var (
+	commentsRegexp  = regexp.MustCompile(`/\*(?:.|\n)*?\*/|#.*`)
+	opcodeRegexp    = regexp.MustCompile(`^[A-Z]+$`)
+	labelRegexp     = regexp.MustCompile(`^@([0-9]+)$`)
+	temporaryRegexp = regexp.MustCompile(`^_t([0-9]+)$`)
+	idRegexp        = regexp.MustCompile(`^[a-zA-Z_]+[a-zA-Z0-9_]*$`)
+	intRegexp       = regexp.MustCompile(`^[0-9]+$`)
+	floatRegexp     = regexp.MustCompile(`^[0-9]+\.[0-9]*$`)
+)
+
+// Parse reads a Quad program. Everything after the first HALT instruction is ignored,
+// which lets us skip the signature line at the end of files generated by cpq.
+func Parse(r io.Reader) ([]Instruction, error) {
+	instructions := []Instruction{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		// Strip comments and leading/trailing whitespace
+		line := strings.TrimSpace(commentsRegexp.ReplaceAllString(scanner.Text(), ""))
+
+		// Skip empty lines
+		if line == "" {
+			continue
+		}
+
+		instruction, err := parseInstruction(line, lineNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		instructions = append(instructions, instruction)
+		if instruction.Opcode == HALT {
+			return instructions, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, &Error{Message: "missing HALT", Line: lineNumber}
+}
+
+func parseInstruction(line string, lineNumber int) (Instruction, error) {
+	fields := strings.Fields(line)
+
+	// Label definitions, e.g @1:
+	if len(fields) == 1 && strings.HasSuffix(line, ":") {
+		if operand, ok := parseOperand(strings.TrimSuffix(line, ":")); ok && operand.Kind == Label {
+			return Instruction{Opcode: LABEL, Operands: []Operand{operand}, Line: lineNumber}, nil
+		}
+	}
+	instruction := Instruction{Opcode: LookupOpcode(fields[0]), Line: lineNumber}
+
+	if !opcodeRegexp.MatchString(fields[0]) || instruction.Opcode == ILLEGAL {
+		return instruction, &Error{Message: fmt.Sprintf("invalid op: '%s'", fields[0]), Line: lineNumber}
+	}
+
+	if len(fields)-1 != operandCounts[instruction.Opcode] {
+		return instruction, &Error{
+			Message: fmt.Sprintf("%s expects %d operands, found %d", instruction.Opcode,
+				operandCounts[instruction.Opcode], len(fields)-1),
+			Line: lineNumber,
+		}
+	}
+
+	for _, field := range fields[1:] {
+		operand, ok := parseOperand(field)
+		if !ok {
+			return instruction, &Error{Message: fmt.Sprintf("invalid oper: '%s'", field), Line: lineNumber}
+		}
+
+		instruction.Operands = append(instruction.Operands, operand)
+	}
+
+	return instruction, nil
+}
+
+func parseOperand(field string) (Operand, bool) {
+	switch {
+	case labelRegexp.MatchString(field):
+		index, err := strconv.Atoi(labelRegexp.FindStringSubmatch(field)[1])
+		return NewLabel(index), err == nil
+
+	case temporaryRegexp.MatchString(field):
+		index, err := strconv.Atoi(temporaryRegexp.FindStringSubmatch(field)[1])
+		return NewTemporary(index), err == nil
+
+	case idRegexp.MatchString(field):
+		return Operand{Kind: Variable, Name: field}, true
+
+	case intRegexp.MatchString(field):
+		value, err := strconv.ParseInt(field, 10, 64)
+		return Operand{Kind: IntLiteral, Int: value}, err == nil
+
+	case floatRegexp.MatchString(field):
+		value, err := strconv.ParseFloat(field, 64)
+		return Operand{Kind: FloatLiteral, Float: value}, err == nil
+	}
+
+	return Operand{}, false
+}
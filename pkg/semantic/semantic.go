@@ -0,0 +1,245 @@
+package semantic
+
+import (
+	"fmt"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+)
+
+// Analyzer checks that a CPL program is semantically valid, and annotates every
+// expression in the AST with its type.
+type Analyzer struct {
+	Errors     []diagnostic.Diagnostic
+	Symbols    *SymbolTable
+	breakDepth int
+}
+
+// NewAnalyzer returns a new instance of Analyzer.
+func NewAnalyzer() *Analyzer {
+	return &Analyzer{
+		Errors:     []diagnostic.Diagnostic{},
+		Symbols:    NewSymbolTable(),
+		breakDepth: 0,
+	}
+}
+
+// Analyze runs semantic analysis on a CPL program, and returns its symbol table.
+func Analyze(program *parser.Program) (*SymbolTable, []diagnostic.Diagnostic) {
+	a := NewAnalyzer()
+	a.AnalyzeProgram(program)
+
+	return a.Symbols, a.Errors
+}
+
+// AnalyzeProgram analyzes a CPL program.
+func (a *Analyzer) AnalyzeProgram(node *parser.Program) {
+	// Go over variable declarations
+	for _, declaration := range node.Declarations {
+		for _, name := range declaration.Names {
+			if symbol, ok := a.Symbols.Declare(name, declaration.Type, declaration.Position); !ok {
+				err := diagnostic.NewError(diagnostic.VariableRedefined,
+					source.PointSpan(declaration.Position), fmt.Sprintf("variable %s already defined", name))
+				err.Related = []diagnostic.Related{{
+					Span:    source.PointSpan(symbol.Position),
+					Message: fmt.Sprintf("%s is first defined here", name),
+				}}
+				a.Errors = append(a.Errors, err)
+			}
+		}
+	}
+
+	if node.StatementsBlock != nil {
+		a.AnalyzeStatement(node.StatementsBlock)
+	}
+}
+
+// AnalyzeStatement analyzes a CPL statement.
+func (a *Analyzer) AnalyzeStatement(node parser.Statement) {
+	switch s := node.(type) {
+	case *parser.AssignmentStatement:
+		a.AnalyzeAssignmentStatement(s)
+	case *parser.InputStatement:
+		a.AnalyzeInputStatement(s)
+	case *parser.OutputStatement:
+		a.AnalyzeOutputStatement(s)
+	case *parser.IfStatement:
+		a.AnalyzeIfStatement(s)
+	case *parser.WhileStatement:
+		a.AnalyzeWhileStatement(s)
+	case *parser.SwitchStatement:
+		a.AnalyzeSwitchStatement(s)
+	case *parser.BreakStatement:
+		a.AnalyzeBreakStatement(s)
+	case *parser.StatementsBlock:
+		a.AnalyzeStatementsBlock(s)
+	}
+}
+
+// AnalyzeAssignmentStatement analyzes assignment statements.
+func (a *Analyzer) AnalyzeAssignmentStatement(node *parser.AssignmentStatement) {
+	expType := a.AnalyzeExpression(node.Value)
+
+	// Make sure the variable is defined.
+	symbol, exists := a.Symbols.Lookup(node.Variable)
+	if !exists {
+		a.addError(diagnostic.UndefinedVariable, source.NewSpan(node.Position, len(node.Variable)),
+			fmt.Sprintf("undefined variable %s", node.Variable))
+		return
+	}
+
+	if expType == parser.Unknown {
+		return
+	}
+
+	// static_cast changes the type of the expression
+	if node.CastType != parser.Unknown {
+		expType = node.CastType
+	}
+
+	// Make sure the expression's type is okay. Integers are implicitly converted to floats,
+	// but not the other way around.
+	if symbol.Type == parser.Integer && expType == parser.Float {
+		a.addError(diagnostic.FloatToIntAssignment, source.NewSpan(node.Position, len(node.Variable)),
+			fmt.Sprintf("cannot assign float value to int variable %s", node.Variable))
+	}
+}
+
+// AnalyzeInputStatement analyzes input statements.
+func (a *Analyzer) AnalyzeInputStatement(node *parser.InputStatement) {
+	// Make sure the variable is defined.
+	// The position of the variable isn't known, so the error points at the statement.
+	if _, exists := a.Symbols.Lookup(node.Variable); !exists {
+		a.addError(diagnostic.UndefinedVariable, source.NewSpan(node.Position, len("input")),
+			fmt.Sprintf("undefined variable %s", node.Variable))
+	}
+}
+
+// AnalyzeOutputStatement analyzes output statements.
+func (a *Analyzer) AnalyzeOutputStatement(node *parser.OutputStatement) {
+	a.AnalyzeExpression(node.Value)
+}
+
+// AnalyzeIfStatement analyzes if statements.
+func (a *Analyzer) AnalyzeIfStatement(node *parser.IfStatement) {
+	a.AnalyzeBooleanExpression(node.Condition)
+	a.AnalyzeStatement(node.IfBranch)
+	a.AnalyzeStatement(node.ElseBranch)
+}
+
+// AnalyzeWhileStatement analyzes while statements.
+func (a *Analyzer) AnalyzeWhileStatement(node *parser.WhileStatement) {
+	a.AnalyzeBooleanExpression(node.Condition)
+
+	a.breakDepth++
+	a.AnalyzeStatement(node.Body)
+	a.breakDepth--
+}
+
+// AnalyzeSwitchStatement analyzes switch statements.
+func (a *Analyzer) AnalyzeSwitchStatement(node *parser.SwitchStatement) {
+	expType := a.AnalyzeExpression(node.Expression)
+	if expType == parser.Float {
+		a.addError(diagnostic.FloatSwitchExpression, node.Expression.Span(),
+			"switch expression must be an integer")
+	}
+
+	a.breakDepth++
+	for _, switchCase := range node.Cases {
+		for _, statement := range switchCase.Statements {
+			a.AnalyzeStatement(statement)
+		}
+	}
+
+	for _, statement := range node.DefaultCase {
+		a.AnalyzeStatement(statement)
+	}
+	a.breakDepth--
+}
+
+// AnalyzeBreakStatement analyzes break statements.
+func (a *Analyzer) AnalyzeBreakStatement(node *parser.BreakStatement) {
+	if a.breakDepth == 0 {
+		a.addError(diagnostic.BreakOutsideLoop, source.NewSpan(node.Position, len("break")),
+			"break statement must be inside a while loop or a switch case")
+	}
+}
+
+// AnalyzeStatementsBlock analyzes a statements block.
+func (a *Analyzer) AnalyzeStatementsBlock(node *parser.StatementsBlock) {
+	for _, statement := range node.Statements {
+		a.AnalyzeStatement(statement)
+	}
+}
+
+// AnalyzeExpression resolves the type of a CPL expression and stores it in the AST.
+// If the type can't be resolved, AnalyzeExpression returns Unknown.
+func (a *Analyzer) AnalyzeExpression(node parser.Expression) parser.DataType {
+	switch s := node.(type) {
+	case *parser.ArithmeticExpression:
+		return a.AnalyzeArithmeticExpression(s)
+	case *parser.VariableExpression:
+		return a.AnalyzeVariableExpression(s)
+	case *parser.IntLiteral:
+		s.Type = parser.Integer
+		return s.Type
+	case *parser.FloatLiteral:
+		s.Type = parser.Float
+		return s.Type
+	}
+
+	return parser.Unknown
+}
+
+// AnalyzeArithmeticExpression resolves the type of an arithmetic expression. If one
+// of the operands is a float, the result is a float as well.
+func (a *Analyzer) AnalyzeArithmeticExpression(node *parser.ArithmeticExpression) parser.DataType {
+	lhs := a.AnalyzeExpression(node.LHS)
+	rhs := a.AnalyzeExpression(node.RHS)
+	if lhs == parser.Unknown || rhs == parser.Unknown {
+		return parser.Unknown
+	}
+
+	node.Type = parser.Integer
+	if lhs == parser.Float || rhs == parser.Float {
+		node.Type = parser.Float
+	}
+
+	return node.Type
+}
+
+// AnalyzeVariableExpression resolves the type of a variable expression.
+func (a *Analyzer) AnalyzeVariableExpression(node *parser.VariableExpression) parser.DataType {
+	// Make sure the variable is defined.
+	symbol, exists := a.Symbols.Lookup(node.Variable)
+	if !exists {
+		a.addError(diagnostic.UndefinedVariable, source.NewSpan(node.Position, len(node.Variable)),
+			fmt.Sprintf("undefined variable %s", node.Variable))
+		return parser.Unknown
+	}
+
+	node.Type = symbol.Type
+	return node.Type
+}
+
+// AnalyzeBooleanExpression analyzes a CPL boolean expression.
+func (a *Analyzer) AnalyzeBooleanExpression(node parser.BooleanExpression) {
+	switch s := node.(type) {
+	case *parser.OrBooleanExpression:
+		a.AnalyzeBooleanExpression(s.LHS)
+		a.AnalyzeBooleanExpression(s.RHS)
+	case *parser.AndBooleanExpression:
+		a.AnalyzeBooleanExpression(s.LHS)
+		a.AnalyzeBooleanExpression(s.RHS)
+	case *parser.NotBooleanExpression:
+		a.AnalyzeBooleanExpression(s.Value)
+	case *parser.CompareBooleanExpression:
+		a.AnalyzeExpression(s.LHS)
+		a.AnalyzeExpression(s.RHS)
+	}
+}
+
+func (a *Analyzer) addError(code diagnostic.Code, span source.Span, message string) {
+	a.Errors = append(a.Errors, diagnostic.NewError(code, span, message))
+}
@@ -0,0 +1,234 @@
+package semantic_test
+
+import (
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/diagnostic"
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/semantic"
+	"github.com/alongubkin/cpl-compiler/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotateExpressionTypes(t *testing.T) {
+	a := semantic.NewAnalyzer()
+	a.Symbols.Declare("x", parser.Float, lexer.Position{})
+	a.Symbols.Declare("y", parser.Integer, lexer.Position{})
+
+	expr := &parser.ArithmeticExpression{
+		LHS: &parser.ArithmeticExpression{
+			LHS:      &parser.IntLiteral{Value: 16},
+			Operator: parser.Subtract,
+			RHS:      &parser.VariableExpression{Variable: "y"},
+		},
+		Operator: parser.Divide,
+		RHS:      &parser.VariableExpression{Variable: "x"},
+	}
+
+	assert.EqualValues(t, parser.Float, a.AnalyzeExpression(expr))
+	assert.Empty(t, a.Errors)
+	assert.EqualValues(t, &parser.ArithmeticExpression{
+		LHS: &parser.ArithmeticExpression{
+			LHS:      &parser.IntLiteral{Value: 16, Type: parser.Integer},
+			Operator: parser.Subtract,
+			RHS:      &parser.VariableExpression{Variable: "y", Type: parser.Integer},
+			Type:     parser.Integer,
+		},
+		Operator: parser.Divide,
+		RHS:      &parser.VariableExpression{Variable: "x", Type: parser.Float},
+		Type:     parser.Float,
+	}, expr)
+}
+
+func TestAnalyzeProgram(t *testing.T) {
+	program, parseErrors := parser.Parse(`a, b : int;
+c : float;
+{
+  input(a);
+  c = a / 2.0;
+  b = static_cast(int) c;
+  while (a > 0) {
+    if (a == b) break; else output(c);
+  }
+}`)
+	assert.Empty(t, parseErrors)
+
+	symbols, errors := semantic.Analyze(program)
+	assert.Empty(t, errors)
+	assert.EqualValues(t, []*semantic.Symbol{
+		{Name: "a", Type: parser.Integer, Position: lexer.Position{Line: 0, Column: 0}},
+		{Name: "b", Type: parser.Integer, Position: lexer.Position{Line: 0, Column: 0}},
+		{Name: "c", Type: parser.Float, Position: lexer.Position{Line: 1, Column: 0, Offset: 12}},
+	}, symbols.Symbols())
+}
+
+func TestUndefinedVariableInExpression(t *testing.T) {
+	a := semantic.NewAnalyzer()
+	assert.EqualValues(t, parser.Unknown, a.AnalyzeExpression(&parser.ArithmeticExpression{
+		LHS:      &parser.IntLiteral{Value: 5},
+		Operator: parser.Add,
+		RHS:      &parser.VariableExpression{Variable: "x"},
+	}))
+
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.UndefinedVariable, source.NewSpan(lexer.Position{}, 1), "undefined variable x"),
+	}, a.Errors)
+}
+
+func TestUndefinedVariableInInput(t *testing.T) {
+	a := semantic.NewAnalyzer()
+	a.AnalyzeStatement(&parser.InputStatement{Variable: "x"})
+
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.UndefinedVariable, source.NewSpan(lexer.Position{}, 5), "undefined variable x"),
+	}, a.Errors)
+}
+
+func TestUndefinedVariableInAssignment(t *testing.T) {
+	a := semantic.NewAnalyzer()
+	a.AnalyzeStatement(&parser.AssignmentStatement{
+		Variable: "x",
+		Value:    &parser.IntLiteral{Value: 5},
+	})
+
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.UndefinedVariable, source.NewSpan(lexer.Position{}, 1), "undefined variable x"),
+	}, a.Errors)
+}
+
+func TestFloatToIntAssignment(t *testing.T) {
+	a := semantic.NewAnalyzer()
+	a.Symbols.Declare("x", parser.Integer, lexer.Position{})
+	a.AnalyzeStatement(&parser.AssignmentStatement{
+		Variable: "x",
+		Value:    &parser.FloatLiteral{Value: 5},
+	})
+
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.FloatToIntAssignment, source.NewSpan(lexer.Position{}, 1), "cannot assign float value to int variable x"),
+	}, a.Errors)
+}
+
+func TestFloatToIntAssignmentWithCast(t *testing.T) {
+	a := semantic.NewAnalyzer()
+	a.Symbols.Declare("x", parser.Integer, lexer.Position{})
+	a.AnalyzeStatement(&parser.AssignmentStatement{
+		Variable: "x",
+		Value:    &parser.FloatLiteral{Value: 5},
+		CastType: parser.Integer,
+	})
+
+	assert.Empty(t, a.Errors)
+}
+
+func TestFloatByCastToIntAssignment(t *testing.T) {
+	a := semantic.NewAnalyzer()
+	a.Symbols.Declare("x", parser.Integer, lexer.Position{})
+	a.AnalyzeStatement(&parser.AssignmentStatement{
+		Variable: "x",
+		Value:    &parser.IntLiteral{Value: 5},
+		CastType: parser.Float,
+	})
+
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.FloatToIntAssignment, source.NewSpan(lexer.Position{}, 1), "cannot assign float value to int variable x"),
+	}, a.Errors)
+}
+
+func TestDuplicateDeclaration(t *testing.T) {
+	program, parseErrors := parser.Parse("a, b : int;\nb : float;\n{}")
+	assert.Empty(t, parseErrors)
+
+	symbols, errors := semantic.Analyze(program)
+	assert.EqualValues(t, []diagnostic.Diagnostic{{
+		Severity: diagnostic.Error,
+		Code:     diagnostic.VariableRedefined,
+		Message:  "variable b already defined",
+		Span:     source.PointSpan(lexer.Position{Line: 1, Column: 0, Offset: 12}),
+		Related: []diagnostic.Related{{
+			Span:    source.PointSpan(lexer.Position{Line: 0, Column: 0}),
+			Message: "b is first defined here",
+		}},
+	}}, errors)
+
+	// The first declaration wins.
+	symbol, _ := symbols.Lookup("b")
+	assert.EqualValues(t, parser.Integer, symbol.Type)
+}
+
+func TestFloatSwitchExpression(t *testing.T) {
+	a := semantic.NewAnalyzer()
+	a.Symbols.Declare("x", parser.Float, lexer.Position{})
+	a.AnalyzeStatement(&parser.SwitchStatement{
+		Expression:  &parser.VariableExpression{Variable: "x"},
+		DefaultCase: []parser.Statement{&parser.BreakStatement{}},
+	})
+
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.FloatSwitchExpression, source.Span{}, "switch expression must be an integer"),
+	}, a.Errors)
+}
+
+func TestFloatSwitchExpressionSpan(t *testing.T) {
+	program, parseErrors := parser.Parse("x : float;\n{ switch (x * 2) { default: break; } }")
+	assert.Empty(t, parseErrors)
+
+	_, errors := semantic.Analyze(program)
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.FloatSwitchExpression,
+			source.NewSpan(lexer.Position{Line: 1, Column: 10, Offset: 21}, len("x * 2")),
+			"switch expression must be an integer"),
+	}, errors)
+}
+
+func TestBreakStatementNoContext(t *testing.T) {
+	a := semantic.NewAnalyzer()
+	a.AnalyzeStatement(&parser.BreakStatement{})
+
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.BreakOutsideLoop, source.NewSpan(lexer.Position{}, 5), "break statement must be inside a while loop or a switch case"),
+	}, a.Errors)
+}
+
+func TestBreakStatementAfterLoop(t *testing.T) {
+	a := semantic.NewAnalyzer()
+	a.Symbols.Declare("x", parser.Integer, lexer.Position{})
+	a.AnalyzeStatement(&parser.StatementsBlock{
+		Statements: []parser.Statement{
+			&parser.WhileStatement{
+				Condition: &parser.CompareBooleanExpression{
+					LHS:      &parser.VariableExpression{Variable: "x"},
+					Operator: parser.LessThan,
+					RHS:      &parser.IntLiteral{Value: 5},
+				},
+				Body: &parser.BreakStatement{},
+			},
+			&parser.BreakStatement{},
+		},
+	})
+
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.BreakOutsideLoop, source.NewSpan(lexer.Position{}, 5), "break statement must be inside a while loop or a switch case"),
+	}, a.Errors)
+}
+
+func TestMultipleErrors(t *testing.T) {
+	program, parseErrors := parser.Parse(`a : int;
+{
+  a = b;
+  input(c);
+  a = 1.5;
+}`)
+	assert.Empty(t, parseErrors)
+
+	_, errors := semantic.Analyze(program)
+	assert.EqualValues(t, []diagnostic.Diagnostic{
+		diagnostic.NewError(diagnostic.UndefinedVariable,
+			source.NewSpan(lexer.Position{Line: 2, Column: 6, Offset: 17}, 1), "undefined variable b"),
+		diagnostic.NewError(diagnostic.UndefinedVariable,
+			source.NewSpan(lexer.Position{Line: 3, Column: 2, Offset: 22}, 5), "undefined variable c"),
+		diagnostic.NewError(diagnostic.FloatToIntAssignment,
+			source.NewSpan(lexer.Position{Line: 4, Column: 2, Offset: 34}, 1), "cannot assign float value to int variable a"),
+	}, errors)
+}
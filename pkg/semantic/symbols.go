@@ -0,0 +1,52 @@
+package semantic
+
+import (
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+)
+
+// Symbol represents a declared CPL variable.
+type Symbol struct {
+	Name     string
+	Type     parser.DataType
+	Position lexer.Position
+}
+
+// SymbolTable holds every variable declared in a CPL program. CPL has a single global
+// scope, so a flat table is enough.
+type SymbolTable struct {
+	symbols map[string]*Symbol
+	order   []*Symbol
+}
+
+// NewSymbolTable returns a new instance of SymbolTable.
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		symbols: map[string]*Symbol{},
+		order:   []*Symbol{},
+	}
+}
+
+// Declare adds a variable to the table. If the variable is already declared, Declare
+// returns the existing symbol and false.
+func (t *SymbolTable) Declare(name string, dataType parser.DataType, pos lexer.Position) (*Symbol, bool) {
+	if symbol, exists := t.symbols[name]; exists {
+		return symbol, false
+	}
+
+	symbol := &Symbol{Name: name, Type: dataType, Position: pos}
+	t.symbols[name] = symbol
+	t.order = append(t.order, symbol)
+	return symbol, true
+}
+
+// Lookup returns the symbol of a declared variable.
+func (t *SymbolTable) Lookup(name string) (*Symbol, bool) {
+	symbol, exists := t.symbols[name]
+	return symbol, exists
+}
+
+// Symbols returns every declared variable, in declaration order.
+func (t *SymbolTable) Symbols() []*Symbol {
+	return t.order
+}
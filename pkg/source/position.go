@@ -0,0 +1,43 @@
+package source
+
+// Position specifies the line and character position in a source file.
+// The Column and Line are both zero-based indexes, and Offset is the zero-based
+// byte offset from the start of the file.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// Before returns true if p is before q in the source file.
+func (p Position) Before(q Position) bool {
+	return p.Line < q.Line || (p.Line == q.Line && p.Column < q.Column)
+}
+
+// Span specifies a range in a source file. End is exclusive; an empty span (where
+// End equals Start) points at a single location.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// NewSpan returns a span that starts at pos and contains length single-byte
+// characters on the same line.
+func NewSpan(pos Position, length int) Span {
+	return Span{Start: pos, End: Position{Line: pos.Line, Column: pos.Column + length,
+		Offset: pos.Offset + length}}
+}
+
+// PointSpan returns an empty span at pos.
+func PointSpan(pos Position) Span {
+	return Span{Start: pos, End: pos}
+}
+
+// Contains returns true if pos is inside the span. The end of a span is exclusive,
+// but an empty span contains its own position.
+func (s Span) Contains(pos Position) bool {
+	if s.Start == s.End {
+		return s.Start.Line == pos.Line && s.Start.Column == pos.Column
+	}
+	return !pos.Before(s.Start) && pos.Before(s.End)
+}
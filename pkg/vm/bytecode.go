@@ -0,0 +1,258 @@
+// Package vm compiles CPL programs to a compact stack-based bytecode, and runs it with a
+// fast virtual machine.
+//
+// The bytecode is an alternative to Quad for executing programs: instead of looking up
+// variables by name, every variable has a numbered slot, and instructions take their
+// operands from a stack. A compiled program can be encoded to a binary file and decoded
+// again, so it can be cached and run without compiling it again.
+//
+// Programs behave like their Quad code: ints are 64 bit, floats are printed like the
+// Quad interpreter prints them, and division by zero and invalid input are runtime
+// errors. Unlike in Quad, variables start at 0.
+package vm
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+)
+
+// Opcode represents the operation of a bytecode instruction.
+type Opcode byte
+
+// Bytecode instructions. Instructions that operate on values pop their operands from
+// the stack, and push their result. Ints and floats are both stored in 64 bit slots, so
+// the instructions of each type interpret the slots differently.
+const (
+	ILLEGAL Opcode = iota
+
+	PUSHI // PUSHI n: push the int n
+	PUSHF // PUSHF n: push the float n
+	LOAD  // LOAD v: push the value of variable number v
+	STORE // STORE v: pop a value into variable number v
+
+	IADD // IADD: pop b and a, push a + b
+	ISUB // ISUB: pop b and a, push a - b
+	IMUL // IMUL: pop b and a, push a * b
+	IDIV // IDIV: pop b and a, push a / b
+	IEQ  // IEQ: pop b and a, push 1 if a = b, 0 otherwise
+	INE  // INE: pop b and a, push 1 if a <> b, 0 otherwise
+	ILT  // ILT: pop b and a, push 1 if a < b, 0 otherwise
+	IGT  // IGT: pop b and a, push 1 if a > b, 0 otherwise
+
+	FADD // FADD: pop b and a, push a + b
+	FSUB // FSUB: pop b and a, push a - b
+	FMUL // FMUL: pop b and a, push a * b
+	FDIV // FDIV: pop b and a, push a / b
+	FEQ  // FEQ: pop b and a, push 1 if a = b, 0 otherwise
+	FNE  // FNE: pop b and a, push 1 if a <> b, 0 otherwise
+	FLT  // FLT: pop b and a, push 1 if a < b, 0 otherwise
+	FGT  // FGT: pop b and a, push 1 if a > b, 0 otherwise
+	FGE  // FGE: pop b and a, push 1 if a >= b, 0 otherwise
+	FLE  // FLE: pop b and a, push 1 if a <= b, 0 otherwise
+
+	ITOF // ITOF: pop an int, push it converted to float
+	FTOI // FTOI: pop a float, push it converted to int
+
+	IIN  // IIN v: read an int into variable number v
+	FIN  // FIN v: read a float into variable number v
+	IOUT // IOUT: pop an int and print it
+	FOUT // FOUT: pop a float and print it
+
+	JUMP   // JUMP a: jump to instruction number a
+	JUMPZ  // JUMPZ a: pop an int, and jump to instruction number a if it's 0
+	JUMPNZ // JUMPNZ a: pop an int, and jump to instruction number a if it isn't 0
+	HALT   // HALT: stop immediately
+
+	opcodeCount
+)
+
+var opcodes = [...]string{
+	ILLEGAL: "ILLEGAL",
+	PUSHI:   "PUSHI", PUSHF: "PUSHF", LOAD: "LOAD", STORE: "STORE",
+	IADD: "IADD", ISUB: "ISUB", IMUL: "IMUL", IDIV: "IDIV",
+	IEQ: "IEQ", INE: "INE", ILT: "ILT", IGT: "IGT",
+	FADD: "FADD", FSUB: "FSUB", FMUL: "FMUL", FDIV: "FDIV",
+	FEQ: "FEQ", FNE: "FNE", FLT: "FLT", FGT: "FGT", FGE: "FGE", FLE: "FLE",
+	ITOF: "ITOF", FTOI: "FTOI",
+	IIN: "IIN", FIN: "FIN", IOUT: "IOUT", FOUT: "FOUT",
+	JUMP: "JUMP", JUMPZ: "JUMPZ", JUMPNZ: "JUMPNZ", HALT: "HALT",
+}
+
+// String returns the string representation of the opcode.
+func (op Opcode) String() string {
+	if op < opcodeCount {
+		return opcodes[op]
+	}
+	return ""
+}
+
+// hasArgument returns true if instructions with the opcode have an argument.
+func (op Opcode) hasArgument() bool {
+	switch op {
+	case PUSHI, PUSHF, LOAD, STORE, IIN, FIN, JUMP, JUMPZ, JUMPNZ:
+		return true
+	}
+	return false
+}
+
+// isVariableOperation returns true if the argument of the opcode is a variable number.
+func (op Opcode) isVariableOperation() bool {
+	return op == LOAD || op == STORE || op == IIN || op == FIN
+}
+
+// isJump returns true if the argument of the opcode is an instruction number.
+func (op Opcode) isJump() bool {
+	return op == JUMP || op == JUMPZ || op == JUMPNZ
+}
+
+// stackEffect returns the number of values an instruction pops, and the number of values
+// it pushes.
+func (op Opcode) stackEffect() (int, int) {
+	switch op {
+	case PUSHI, PUSHF, LOAD:
+		return 0, 1
+	case STORE, IOUT, FOUT, JUMPZ, JUMPNZ:
+		return 1, 0
+	case ITOF, FTOI:
+		return 1, 1
+	case IIN, FIN, JUMP, HALT:
+		return 0, 0
+	}
+	return 2, 1
+}
+
+// Instruction represents a single bytecode instruction.
+type Instruction struct {
+	Opcode Opcode
+	// Argument is the argument of the instruction, if it has one. Floats are stored as
+	// their IEEE 754 bits.
+	Argument int64
+	// Line is the line of the CPL code this instruction was generated from, starting at
+	// 1. It's used in runtime errors.
+	Line int
+}
+
+// Variable describes the slot of a variable.
+type Variable struct {
+	Name string
+	Type parser.DataType
+}
+
+// Program is a compiled bytecode program.
+type Program struct {
+	Variables    []Variable
+	Instructions []Instruction
+}
+
+// String returns the string representation of the instruction.
+func (i Instruction) String() string {
+	switch {
+	case i.Opcode == PUSHF:
+		return fmt.Sprintf("%s %s", i.Opcode, quad.FormatFloat(math.Float64frombits(uint64(i.Argument))))
+	case i.Opcode.hasArgument():
+		return fmt.Sprintf("%s %d", i.Opcode, i.Argument)
+	}
+	return i.Opcode.String()
+}
+
+// Format returns a human readable listing of a program: its variables, and its
+// instructions with their numbers. The variable of LOAD, STORE and input instructions
+// is shown in a comment.
+func Format(program *Program) string {
+	var b strings.Builder
+	for i, variable := range program.Variables {
+		fmt.Fprintf(&b, "; variable %d: %s (%s)\n", i, variable.Name, variable.Type)
+	}
+
+	for i, instruction := range program.Instructions {
+		fmt.Fprintf(&b, "%04d %s", i, instruction)
+		if instruction.Opcode.isVariableOperation() {
+			fmt.Fprintf(&b, " ; %s", program.Variables[instruction.Argument].Name)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// Verify makes sure a program can be executed safely: every instruction is valid, every
+// jump and variable number exists, the stack never underflows, and execution can't run
+// past the last instruction. It returns the maximum depth of the stack.
+func Verify(program *Program) (int, error) {
+	instructions := program.Instructions
+	if len(instructions) == 0 {
+		return 0, fmt.Errorf("empty program")
+	}
+
+	for i, instruction := range instructions {
+		op := instruction.Opcode
+		switch {
+		case op == ILLEGAL || op >= opcodeCount:
+			return 0, fmt.Errorf("invalid opcode %d at instruction %d", op, i)
+		case op.isVariableOperation() && (instruction.Argument < 0 ||
+			instruction.Argument >= int64(len(program.Variables))):
+			return 0, fmt.Errorf("invalid variable number %d at instruction %d",
+				instruction.Argument, i)
+		case op.isJump() && (instruction.Argument < 0 ||
+			instruction.Argument >= int64(len(instructions))):
+			return 0, fmt.Errorf("invalid instruction number %d at instruction %d",
+				instruction.Argument, i)
+		}
+	}
+
+	// Every instruction must be reached with the same stack depth from all of its
+	// predecessors, so the depth can be computed by following the control flow once.
+	depths := make([]int, len(instructions))
+	for i := range depths {
+		depths[i] = -1
+	}
+	depths[0] = 0
+	maxDepth := 0
+	pending := []int{0}
+
+	for len(pending) > 0 {
+		i := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		instruction := instructions[i]
+		pops, pushes := instruction.Opcode.stackEffect()
+		if depths[i] < pops {
+			return 0, fmt.Errorf("stack underflow at instruction %d", i)
+		}
+
+		depth := depths[i] - pops + pushes
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+
+		successors := []int{}
+		switch instruction.Opcode {
+		case HALT:
+		case JUMP:
+			successors = append(successors, int(instruction.Argument))
+		case JUMPZ, JUMPNZ:
+			successors = append(successors, int(instruction.Argument), i+1)
+		default:
+			successors = append(successors, i+1)
+		}
+
+		for _, successor := range successors {
+			if successor >= len(instructions) {
+				return 0, fmt.Errorf("instruction %d runs past the end of the program", i)
+			}
+
+			if depths[successor] == -1 {
+				depths[successor] = depth
+				pending = append(pending, successor)
+			} else if depths[successor] != depth {
+				return 0, fmt.Errorf("inconsistent stack depth at instruction %d", successor)
+			}
+		}
+	}
+
+	return maxDepth, nil
+}
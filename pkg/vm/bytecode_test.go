@@ -0,0 +1,83 @@
+package vm_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	program := &vm.Program{
+		Variables: []vm.Variable{{Name: "a", Type: parser.Integer}, {Name: "x", Type: parser.Float}},
+		Instructions: []vm.Instruction{
+			{Opcode: vm.IIN, Argument: 0},
+			{Opcode: vm.PUSHF, Argument: int64(math.Float64bits(2))},
+			{Opcode: vm.STORE, Argument: 1},
+			{Opcode: vm.LOAD, Argument: 0},
+			{Opcode: vm.IOUT},
+			{Opcode: vm.HALT},
+		},
+	}
+
+	assert.EqualValues(t, `; variable 0: a (int)
+; variable 1: x (float)
+0000 IIN 0 ; a
+0001 PUSHF 2.0
+0002 STORE 1 ; x
+0003 LOAD 0 ; a
+0004 IOUT
+0005 HALT
+`, vm.Format(program))
+}
+
+func TestVerify(t *testing.T) {
+	program := &vm.Program{
+		Instructions: []vm.Instruction{
+			{Opcode: vm.PUSHI, Argument: 1},
+			{Opcode: vm.PUSHI, Argument: 2},
+			{Opcode: vm.PUSHI, Argument: 3},
+			{Opcode: vm.IMUL},
+			{Opcode: vm.IADD},
+			{Opcode: vm.IOUT},
+			{Opcode: vm.HALT},
+		},
+	}
+
+	maxDepth, err := vm.Verify(program)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, maxDepth)
+}
+
+func TestVerifyErrors(t *testing.T) {
+	variables := []vm.Variable{{Name: "a", Type: parser.Integer}}
+	tests := []struct {
+		instructions []vm.Instruction
+		err          string
+	}{
+		{[]vm.Instruction{}, "empty program"},
+		{[]vm.Instruction{{Opcode: vm.ILLEGAL}}, "invalid opcode 0 at instruction 0"},
+		{[]vm.Instruction{{Opcode: 200}}, "invalid opcode 200 at instruction 0"},
+		{[]vm.Instruction{{Opcode: vm.LOAD, Argument: 1}, {Opcode: vm.HALT}},
+			"invalid variable number 1 at instruction 0"},
+		{[]vm.Instruction{{Opcode: vm.JUMP, Argument: -1}, {Opcode: vm.HALT}},
+			"invalid instruction number -1 at instruction 0"},
+		{[]vm.Instruction{{Opcode: vm.PUSHI}, {Opcode: vm.IADD}, {Opcode: vm.HALT}},
+			"stack underflow at instruction 1"},
+		{[]vm.Instruction{{Opcode: vm.LOAD}, {Opcode: vm.IOUT}},
+			"instruction 1 runs past the end of the program"},
+		{[]vm.Instruction{
+			{Opcode: vm.LOAD},
+			{Opcode: vm.JUMPZ, Argument: 3},
+			{Opcode: vm.PUSHI},
+			{Opcode: vm.HALT},
+		}, "inconsistent stack depth at instruction 3"},
+	}
+
+	for _, test := range tests {
+		_, err := vm.Verify(&vm.Program{Variables: variables, Instructions: test.instructions})
+		assert.EqualError(t, err, test.err)
+	}
+}
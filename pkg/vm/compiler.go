@@ -0,0 +1,348 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/alongubkin/cpl-compiler/pkg/lexer"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+)
+
+// Compiler translates a CPL AST to bytecode. The AST must be annotated by semantic
+// analysis first, and must not contain semantic errors.
+type Compiler struct {
+	Program    *Program
+	variables  map[string]int
+	labels     []int
+	breakStack []int
+}
+
+// NewCompiler returns a new instance of Compiler.
+func NewCompiler() *Compiler {
+	return &Compiler{
+		Program:    &Program{Variables: []Variable{}, Instructions: []Instruction{}},
+		variables:  map[string]int{},
+		labels:     []int{},
+		breakStack: []int{},
+	}
+}
+
+// Compile compiles a CPL program that passed semantic analysis to bytecode.
+func Compile(program *parser.Program) *Program {
+	c := NewCompiler()
+	c.CompileProgram(program)
+
+	return c.Program
+}
+
+// CompileProgram compiles a CPL program. Jumps are compiled with label numbers as their
+// argument, and are replaced with instruction numbers when the whole program is compiled.
+func (c *Compiler) CompileProgram(node *parser.Program) {
+	for _, declaration := range node.Declarations {
+		for _, name := range declaration.Names {
+			if _, exists := c.variables[name]; !exists {
+				c.variables[name] = c.newVariable(name, declaration.Type)
+			}
+		}
+	}
+
+	if node.StatementsBlock != nil {
+		c.CompileStatement(node.StatementsBlock)
+	}
+	c.emit(node.Position, HALT, 0)
+
+	for i, instruction := range c.Program.Instructions {
+		if instruction.Opcode.isJump() {
+			c.Program.Instructions[i].Argument = int64(c.labels[instruction.Argument])
+		}
+	}
+}
+
+// CompileStatement compiles a CPL statement.
+func (c *Compiler) CompileStatement(node parser.Statement) {
+	switch s := node.(type) {
+	case *parser.AssignmentStatement:
+		c.CompileAssignmentStatement(s)
+	case *parser.InputStatement:
+		c.CompileInputStatement(s)
+	case *parser.OutputStatement:
+		c.CompileOutputStatement(s)
+	case *parser.IfStatement:
+		c.CompileIfStatement(s)
+	case *parser.WhileStatement:
+		c.CompileWhileStatement(s)
+	case *parser.SwitchStatement:
+		c.CompileSwitchStatement(s)
+	case *parser.BreakStatement:
+		c.CompileBreakStatement(s)
+	case *parser.StatementsBlock:
+		c.CompileStatementsBlock(s)
+	}
+}
+
+// CompileAssignmentStatement compiles assignment statements.
+func (c *Compiler) CompileAssignmentStatement(node *parser.AssignmentStatement) {
+	dataType := c.CompileExpression(node.Value)
+	if node.CastType != parser.Unknown {
+		dataType = c.convert(node.Position, dataType, node.CastType)
+	}
+
+	variable := c.variables[node.Variable]
+	c.convert(node.Position, dataType, c.Program.Variables[variable].Type)
+	c.emit(node.Position, STORE, int64(variable))
+}
+
+// CompileInputStatement compiles input statements.
+func (c *Compiler) CompileInputStatement(node *parser.InputStatement) {
+	variable := c.variables[node.Variable]
+	if c.Program.Variables[variable].Type == parser.Float {
+		c.emit(node.Position, FIN, int64(variable))
+	} else {
+		c.emit(node.Position, IIN, int64(variable))
+	}
+}
+
+// CompileOutputStatement compiles output statements.
+func (c *Compiler) CompileOutputStatement(node *parser.OutputStatement) {
+	if c.CompileExpression(node.Value) == parser.Float {
+		c.emit(node.Position, FOUT, 0)
+	} else {
+		c.emit(node.Position, IOUT, 0)
+	}
+}
+
+// CompileIfStatement compiles if statements.
+func (c *Compiler) CompileIfStatement(node *parser.IfStatement) {
+	elseLabel := c.newLabel()
+	endLabel := c.newLabel()
+
+	c.CompileBooleanExpression(node.Condition, false, elseLabel)
+	c.CompileStatement(node.IfBranch)
+	c.emit(node.Position, JUMP, int64(endLabel))
+
+	c.placeLabel(elseLabel)
+	if node.ElseBranch != nil {
+		c.CompileStatement(node.ElseBranch)
+	}
+	c.placeLabel(endLabel)
+}
+
+// CompileWhileStatement compiles while statements.
+func (c *Compiler) CompileWhileStatement(node *parser.WhileStatement) {
+	conditionLabel := c.newLabel()
+	endLabel := c.newLabel()
+
+	c.placeLabel(conditionLabel)
+	c.CompileBooleanExpression(node.Condition, false, endLabel)
+
+	c.breakStack = append(c.breakStack, endLabel)
+	c.CompileStatement(node.Body)
+	c.breakStack = c.breakStack[:len(c.breakStack)-1]
+
+	c.emit(node.Position, JUMP, int64(conditionLabel))
+	c.placeLabel(endLabel)
+}
+
+// CompileSwitchStatement compiles switch statements. The value of the expression is
+// stored in a hidden variable, and compared with every case in order, so a duplicate
+// case is reachable only by falling through. Like in Quad, a case without a break falls
+// through to the next case.
+func (c *Compiler) CompileSwitchStatement(node *parser.SwitchStatement) {
+	value := c.newVariable(fmt.Sprintf("_switch%d", len(c.Program.Variables)), parser.Integer)
+	c.CompileExpression(node.Expression)
+	c.emit(node.Position, STORE, int64(value))
+
+	caseLabels := make([]int, len(node.Cases))
+	for i, switchCase := range node.Cases {
+		caseLabels[i] = c.newLabel()
+		c.emit(switchCase.Position, LOAD, int64(value))
+		c.emit(switchCase.Position, PUSHI, switchCase.Value)
+		c.emit(switchCase.Position, IEQ, 0)
+		c.emit(switchCase.Position, JUMPNZ, int64(caseLabels[i]))
+	}
+
+	defaultLabel := c.newLabel()
+	endLabel := c.newLabel()
+	c.emit(node.Position, JUMP, int64(defaultLabel))
+
+	c.breakStack = append(c.breakStack, endLabel)
+	for i, switchCase := range node.Cases {
+		c.placeLabel(caseLabels[i])
+		for _, statement := range switchCase.Statements {
+			c.CompileStatement(statement)
+		}
+	}
+
+	c.placeLabel(defaultLabel)
+	for _, statement := range node.DefaultCase {
+		c.CompileStatement(statement)
+	}
+	c.breakStack = c.breakStack[:len(c.breakStack)-1]
+
+	c.placeLabel(endLabel)
+}
+
+// CompileBreakStatement compiles break statements.
+func (c *Compiler) CompileBreakStatement(node *parser.BreakStatement) {
+	c.emit(node.Position, JUMP, int64(c.breakStack[len(c.breakStack)-1]))
+}
+
+// CompileStatementsBlock compiles a statements block.
+func (c *Compiler) CompileStatementsBlock(node *parser.StatementsBlock) {
+	for _, statement := range node.Statements {
+		c.CompileStatement(statement)
+	}
+}
+
+// CompileExpression compiles a CPL expression, which pushes its value, and returns its
+// type.
+func (c *Compiler) CompileExpression(node parser.Expression) parser.DataType {
+	switch s := node.(type) {
+	case *parser.ArithmeticExpression:
+		return c.CompileArithmeticExpression(s)
+	case *parser.VariableExpression:
+		c.emit(s.Position, LOAD, int64(c.variables[s.Variable]))
+		return s.Type
+	case *parser.IntLiteral:
+		c.emit(s.Position, PUSHI, s.Value)
+		return s.Type
+	case *parser.FloatLiteral:
+		c.emit(s.Position, PUSHF, int64(math.Float64bits(s.Value)))
+		return s.Type
+	}
+
+	panic(fmt.Sprintf("vm: unexpected expression %T", node))
+}
+
+// CompileArithmeticExpression compiles an arithmetic expression.
+func (c *Compiler) CompileArithmeticExpression(node *parser.ArithmeticExpression) parser.DataType {
+	c.convert(node.Position, c.CompileExpression(node.LHS), node.Type)
+	c.convert(node.Position, c.CompileExpression(node.RHS), node.Type)
+
+	opcodes := map[parser.Operator]Opcode{parser.Add: IADD, parser.Subtract: ISUB,
+		parser.Multiply: IMUL, parser.Divide: IDIV}
+	if node.Type == parser.Float {
+		opcodes = map[parser.Operator]Opcode{parser.Add: FADD, parser.Subtract: FSUB,
+			parser.Multiply: FMUL, parser.Divide: FDIV}
+	}
+
+	c.emit(node.Position, opcodes[node.Operator], 0)
+	return node.Type
+}
+
+// CompileBooleanExpression compiles jumping code for a CPL boolean expression: if the
+// expression evaluates to jumpIf, control is transferred to label. Otherwise, control
+// falls through to the next instruction. Like in C, the RHS of && and || is only
+// evaluated if the LHS doesn't decide the result of the whole expression.
+func (c *Compiler) CompileBooleanExpression(node parser.BooleanExpression, jumpIf bool,
+	label int) {
+	switch s := node.(type) {
+	case *parser.OrBooleanExpression:
+		if jumpIf {
+			c.CompileBooleanExpression(s.LHS, true, label)
+			c.CompileBooleanExpression(s.RHS, true, label)
+			return
+		}
+
+		skipLabel := c.newLabel()
+		c.CompileBooleanExpression(s.LHS, true, skipLabel)
+		c.CompileBooleanExpression(s.RHS, false, label)
+		c.placeLabel(skipLabel)
+
+	case *parser.AndBooleanExpression:
+		if !jumpIf {
+			c.CompileBooleanExpression(s.LHS, false, label)
+			c.CompileBooleanExpression(s.RHS, false, label)
+			return
+		}
+
+		skipLabel := c.newLabel()
+		c.CompileBooleanExpression(s.LHS, false, skipLabel)
+		c.CompileBooleanExpression(s.RHS, true, label)
+		c.placeLabel(skipLabel)
+
+	case *parser.NotBooleanExpression:
+		c.CompileBooleanExpression(s.Value, !jumpIf, label)
+
+	case *parser.CompareBooleanExpression:
+		c.CompileCompareBooleanExpression(s, jumpIf, label)
+	}
+}
+
+// CompileCompareBooleanExpression compiles jumping code for an expression comparison.
+// There are no int instructions for x >= y and x <= y, so they're compiled as the opposite
+// of x < y and x > y. Floats have their own instructions, because a comparison with NaN is
+// false, except for !=.
+func (c *Compiler) CompileCompareBooleanExpression(node *parser.CompareBooleanExpression,
+	jumpIf bool, label int) {
+	lhs := c.CompileExpression(node.LHS)
+	if lhs == parser.Integer && parser.TypeOf(node.RHS) == parser.Float {
+		c.convert(node.Position, lhs, parser.Float)
+		lhs = parser.Float
+	}
+	rhs := c.convert(node.Position, c.CompileExpression(node.RHS), lhs)
+
+	if rhs == parser.Float {
+		opcodes := map[parser.Operator]Opcode{parser.EqualTo: FEQ, parser.NotEqualTo: FNE,
+			parser.LessThan: FLT, parser.GreaterThan: FGT, parser.GreaterThanOrEqualTo: FGE,
+			parser.LessThenOrEqualTo: FLE}
+		c.emit(node.Position, opcodes[node.Operator], 0)
+	} else {
+		operator := node.Operator
+		switch operator {
+		case parser.GreaterThanOrEqualTo:
+			operator, jumpIf = parser.LessThan, !jumpIf
+		case parser.LessThenOrEqualTo:
+			operator, jumpIf = parser.GreaterThan, !jumpIf
+		}
+
+		opcodes := map[parser.Operator]Opcode{parser.EqualTo: IEQ, parser.NotEqualTo: INE,
+			parser.LessThan: ILT, parser.GreaterThan: IGT}
+		c.emit(node.Position, opcodes[operator], 0)
+	}
+
+	if jumpIf {
+		c.emit(node.Position, JUMPNZ, int64(label))
+	} else {
+		c.emit(node.Position, JUMPZ, int64(label))
+	}
+}
+
+// convert converts the value on top of the stack from one type to another, and returns
+// the new type.
+func (c *Compiler) convert(pos lexer.Position, from parser.DataType,
+	to parser.DataType) parser.DataType {
+	switch {
+	case from == parser.Integer && to == parser.Float:
+		c.emit(pos, ITOF, 0)
+	case from == parser.Float && to == parser.Integer:
+		c.emit(pos, FTOI, 0)
+	}
+	return to
+}
+
+// emit appends an instruction to the program.
+func (c *Compiler) emit(pos lexer.Position, opcode Opcode, argument int64) {
+	c.Program.Instructions = append(c.Program.Instructions, Instruction{
+		Opcode:   opcode,
+		Argument: argument,
+		Line:     pos.Line + 1,
+	})
+}
+
+// newVariable allocates a slot for a variable, and returns its number.
+func (c *Compiler) newVariable(name string, dataType parser.DataType) int {
+	c.Program.Variables = append(c.Program.Variables, Variable{Name: name, Type: dataType})
+	return len(c.Program.Variables) - 1
+}
+
+// newLabel returns a new label, which has to be placed before the end of the program.
+func (c *Compiler) newLabel() int {
+	c.labels = append(c.labels, -1)
+	return len(c.labels) - 1
+}
+
+// placeLabel marks the position of the next instruction as the target of label.
+func (c *Compiler) placeLabel(label int) {
+	c.labels[label] = len(c.Program.Instructions)
+}
@@ -0,0 +1,180 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/internal/cpltest"
+	"github.com/alongubkin/cpl-compiler/pkg/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func compile(t *testing.T, code string) string {
+	return vm.Format(vm.Compile(cpltest.Analyze(t, code)))
+}
+
+func TestCompileArithmetic(t *testing.T) {
+	assert.EqualValues(t, `; variable 0: a (int)
+; variable 1: x (float)
+0000 LOAD 0 ; a
+0001 PUSHI 3
+0002 PUSHI 2
+0003 IMUL
+0004 IADD
+0005 STORE 0 ; a
+0006 LOAD 0 ; a
+0007 ITOF
+0008 PUSHF 2.5
+0009 FDIV
+0010 STORE 1 ; x
+0011 LOAD 1 ; x
+0012 FOUT
+0013 HALT
+`, compile(t, `a : int;
+x : float;
+{
+    a = a + 3 * 2;
+    x = a / 2.5;
+    output(x);
+}`))
+}
+
+func TestCompileCast(t *testing.T) {
+	assert.EqualValues(t, `; variable 0: a (int)
+; variable 1: x (float)
+0000 PUSHF 3.7
+0001 FTOI
+0002 STORE 0 ; a
+0003 LOAD 0 ; a
+0004 ITOF
+0005 STORE 1 ; x
+0006 HALT
+`, compile(t, `a : int;
+x : float;
+{
+    a = static_cast(int) 3.7;
+    x = a;
+}`))
+}
+
+func TestCompileInputOutput(t *testing.T) {
+	assert.EqualValues(t, `; variable 0: a (int)
+; variable 1: x (float)
+0000 IIN 0 ; a
+0001 FIN 1 ; x
+0002 LOAD 0 ; a
+0003 IOUT
+0004 HALT
+`, compile(t, `a : int;
+x : float;
+{
+    input(a);
+    input(x);
+    output(a);
+}`))
+}
+
+func TestCompileIfElse(t *testing.T) {
+	assert.EqualValues(t, `; variable 0: a (int)
+0000 LOAD 0 ; a
+0001 PUSHI 0
+0002 IGT
+0003 JUMPZ 8
+0004 LOAD 0 ; a
+0005 PUSHI 10
+0006 ILT
+0007 JUMPNZ 11
+0008 PUSHI 0
+0009 IOUT
+0010 JUMP 13
+0011 PUSHI 1
+0012 IOUT
+0013 HALT
+`, compile(t, `a : int;
+{
+    if (a <= 0 || a >= 10) output(0); else output(1);
+}`))
+}
+
+func TestCompileWhile(t *testing.T) {
+	assert.EqualValues(t, `; variable 0: a (int)
+0000 LOAD 0 ; a
+0001 PUSHI 5
+0002 IGT
+0003 JUMPZ 8
+0004 LOAD 0 ; a
+0005 PUSHI 8
+0006 INE
+0007 JUMPNZ 21
+0008 LOAD 0 ; a
+0009 PUSHI 1
+0010 IADD
+0011 STORE 0 ; a
+0012 LOAD 0 ; a
+0013 PUSHI 3
+0014 IEQ
+0015 JUMPZ 18
+0016 JUMP 21
+0017 JUMP 20
+0018 LOAD 0 ; a
+0019 IOUT
+0020 JUMP 0
+0021 HALT
+`, compile(t, `a : int;
+{
+    while (!(a > 5 && a != 8)) {
+        a = a + 1;
+        if (a == 3) break; else output(a);
+    }
+}`))
+}
+
+func TestCompileSwitch(t *testing.T) {
+	assert.EqualValues(t, `; variable 0: a (int)
+; variable 1: _switch1 (int)
+0000 LOAD 0 ; a
+0001 STORE 1 ; _switch1
+0002 LOAD 1 ; _switch1
+0003 PUSHI 1
+0004 IEQ
+0005 JUMPNZ 11
+0006 LOAD 1 ; _switch1
+0007 PUSHI 2
+0008 IEQ
+0009 JUMPNZ 14
+0010 JUMP 16
+0011 PUSHI 1
+0012 IOUT
+0013 JUMP 18
+0014 PUSHI 2
+0015 IOUT
+0016 PUSHI 0
+0017 IOUT
+0018 HALT
+`, compile(t, `a : int;
+{
+    switch (a) {
+        case 1: output(1); break;
+        case 2: output(2);
+        default: output(0);
+    }
+}`))
+}
+
+func TestCompileFloatComparison(t *testing.T) {
+	assert.EqualValues(t, `; variable 0: x (float)
+0000 LOAD 0 ; x
+0001 PUSHI 1
+0002 ITOF
+0003 FGE
+0004 JUMPZ 8
+0005 PUSHI 1
+0006 IOUT
+0007 JUMP 10
+0008 PUSHI 0
+0009 IOUT
+0010 HALT
+`, compile(t, `x : float;
+{
+    if (x >= 1) output(1); else output(0);
+}`))
+}
@@ -0,0 +1,169 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+)
+
+// Magic is the first bytes of every encoded program.
+const Magic = "CPLB"
+
+// Version is the version of the binary encoding. Programs are only decoded if they were
+// encoded with the same version.
+const Version = 1
+
+// Encode returns the binary encoding of a program:
+//
+//	magic      "CPLB"
+//	version    1 byte
+//	variables  uvarint count, then for every variable: its type (1 for float, 2 for
+//	           int) as 1 byte, and its name as a uvarint length and the bytes
+//	code       uvarint count, then for every instruction: its opcode as 1 byte, its
+//	           argument if it has one, and its line as a varint difference from the
+//	           line of the previous instruction
+//
+// Arguments are varints, except for the argument of PUSHF, which is the 8 bytes of the
+// float in little endian.
+func Encode(program *Program) []byte {
+	b := new(bytes.Buffer)
+	b.WriteString(Magic)
+	b.WriteByte(Version)
+
+	writeUvarint(b, uint64(len(program.Variables)))
+	for _, variable := range program.Variables {
+		b.WriteByte(byte(variable.Type))
+		writeUvarint(b, uint64(len(variable.Name)))
+		b.WriteString(variable.Name)
+	}
+
+	writeUvarint(b, uint64(len(program.Instructions)))
+	line := 0
+	for _, instruction := range program.Instructions {
+		b.WriteByte(byte(instruction.Opcode))
+		switch {
+		case instruction.Opcode == PUSHF:
+			binary.Write(b, binary.LittleEndian, instruction.Argument)
+		case instruction.Opcode.hasArgument():
+			writeVarint(b, instruction.Argument)
+		}
+
+		writeVarint(b, int64(instruction.Line-line))
+		line = instruction.Line
+	}
+
+	return b.Bytes()
+}
+
+// Decode decodes a program encoded by Encode, and verifies it, so it can be executed
+// safely.
+func Decode(data []byte) (*Program, error) {
+	r := bytes.NewReader(data)
+	header := make([]byte, len(Magic)+1)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(Magic)]) != Magic {
+		return nil, errors.New("not a CPL bytecode file")
+	}
+	if header[len(Magic)] != Version {
+		return nil, fmt.Errorf("unsupported bytecode version %d", header[len(Magic)])
+	}
+
+	program := &Program{Variables: []Variable{}, Instructions: []Instruction{}}
+	count, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < count; i++ {
+		dataType, err := r.ReadByte()
+		if err != nil {
+			return nil, errTruncated
+		}
+		if parser.DataType(dataType) != parser.Integer && parser.DataType(dataType) != parser.Float {
+			return nil, fmt.Errorf("invalid type %d of variable %d", dataType, i)
+		}
+
+		length, err := readCount(r)
+		if err != nil {
+			return nil, err
+		}
+		name := make([]byte, length)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, errTruncated
+		}
+
+		program.Variables = append(program.Variables,
+			Variable{Name: string(name), Type: parser.DataType(dataType)})
+	}
+
+	if count, err = readCount(r); err != nil {
+		return nil, err
+	}
+
+	line := int64(0)
+	for i := 0; i < count; i++ {
+		opcode, err := r.ReadByte()
+		if err != nil {
+			return nil, errTruncated
+		}
+
+		instruction := Instruction{Opcode: Opcode(opcode)}
+		switch {
+		case instruction.Opcode == PUSHF:
+			err = binary.Read(r, binary.LittleEndian, &instruction.Argument)
+		case instruction.Opcode.hasArgument():
+			instruction.Argument, err = binary.ReadVarint(r)
+		}
+		if err != nil {
+			return nil, errTruncated
+		}
+
+		delta, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, errTruncated
+		}
+		line += delta
+		instruction.Line = int(line)
+
+		program.Instructions = append(program.Instructions, instruction)
+	}
+
+	if r.Len() > 0 {
+		return nil, errors.New("unexpected data after the last instruction")
+	}
+
+	if _, err := Verify(program); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+var errTruncated = errors.New("unexpected end of bytecode")
+
+// readCount reads the number of variables, instructions or bytes that follow. A count
+// can't be larger than the remaining data, so corrupted data never allocates too much
+// memory.
+func readCount(r *bytes.Reader) (int, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, errTruncated
+	}
+	if count > uint64(r.Len()) || count > math.MaxInt32 {
+		return 0, errTruncated
+	}
+	return int(count), nil
+}
+
+func writeUvarint(b *bytes.Buffer, value uint64) {
+	var buffer [binary.MaxVarintLen64]byte
+	b.Write(buffer[:binary.PutUvarint(buffer[:], value)])
+}
+
+func writeVarint(b *bytes.Buffer, value int64) {
+	var buffer [binary.MaxVarintLen64]byte
+	b.Write(buffer[:binary.PutVarint(buffer[:], value)])
+}
@@ -0,0 +1,100 @@
+package vm_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/internal/cpltest"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode(t *testing.T) {
+	program := &vm.Program{
+		Variables: []vm.Variable{{Name: "a", Type: parser.Integer}},
+		Instructions: []vm.Instruction{
+			{Opcode: vm.PUSHI, Argument: -2, Line: 3},
+			{Opcode: vm.STORE, Argument: 0, Line: 3},
+			{Opcode: vm.HALT, Line: 1},
+		},
+	}
+
+	assert.EqualValues(t, []byte{
+		'C', 'P', 'L', 'B', vm.Version,
+		1, byte(parser.Integer), 1, 'a',
+		3,
+		byte(vm.PUSHI), 3, 6,
+		byte(vm.STORE), 0, 0,
+		byte(vm.HALT), 3,
+	}, vm.Encode(program))
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	program := vm.Compile(cpltest.Analyze(t, `a, b : int;
+x : float;
+{
+    input(a);
+    x = a / 0.1;
+    b = static_cast(int) x;
+    while (b > 0 - 100000) {
+        b = b - 99999;
+        output(b);
+    }
+    switch (a) {
+        case 1: output(0.00001); break;
+        default: output(x);
+    }
+}`))
+
+	decoded, err := vm.Decode(vm.Encode(program))
+	assert.NoError(t, err)
+	assert.EqualValues(t, program, decoded)
+}
+
+func TestEncodeFloat(t *testing.T) {
+	for _, f := range []float64{0, 1.5, -2.25, math.Inf(1), math.MaxFloat64} {
+		program := &vm.Program{
+			Variables: []vm.Variable{},
+			Instructions: []vm.Instruction{
+				{Opcode: vm.PUSHF, Argument: int64(math.Float64bits(f)), Line: 1},
+				{Opcode: vm.FOUT, Line: 1},
+				{Opcode: vm.HALT, Line: 1},
+			},
+		}
+
+		decoded, err := vm.Decode(vm.Encode(program))
+		assert.NoError(t, err)
+		assert.EqualValues(t, program, decoded)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid := vm.Encode(vm.Compile(cpltest.Analyze(t, `a : int;
+{
+    input(a);
+    output(a * 2);
+}`)))
+
+	tests := []struct {
+		data []byte
+		err  string
+	}{
+		{[]byte{}, "not a CPL bytecode file"},
+		{[]byte("IADD a 1 2\nHALT\n"), "not a CPL bytecode file"},
+		{[]byte{'C', 'P', 'L', 'B', 2}, "unsupported bytecode version 2"},
+		{valid[:len(valid)-1], "unexpected end of bytecode"},
+		{append(valid[:len(valid):len(valid)], 0), "unexpected data after the last instruction"},
+		{[]byte{'C', 'P', 'L', 'B', vm.Version, 1, 3, 1, 'a', 0}, "invalid type 3 of variable 0"},
+		{[]byte{'C', 'P', 'L', 'B', vm.Version, 0, 0xff, 0xff, 0xff, 0xff, 0x0f},
+			"unexpected end of bytecode"},
+		{[]byte{'C', 'P', 'L', 'B', vm.Version, 0, 0}, "empty program"},
+		{[]byte{'C', 'P', 'L', 'B', vm.Version, 0, 1, byte(vm.IOUT), 2},
+			"stack underflow at instruction 0"},
+	}
+
+	for _, test := range tests {
+		_, err := vm.Decode(test.data)
+		assert.EqualError(t, err, test.err)
+	}
+}
@@ -0,0 +1,240 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+)
+
+// Error represents an error that occurred while running a bytecode program.
+type Error struct {
+	Message string
+	// Line is the line of the CPL code that caused the error, starting at 1.
+	Line int
+}
+
+// Error returns the string representation of the error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at line %d", e.Message, e.Line)
+}
+
+// VM executes bytecode programs.
+type VM struct {
+	// Prompt receives a short prompt before every input instruction. If Prompt is nil,
+	// no prompts are written and invalid input stops the program with an error.
+	Prompt    io.Writer
+	input     *bufio.Reader
+	output    *bufio.Writer
+	program   *Program
+	variables []int64
+}
+
+// NewVM returns a new instance of VM.
+func NewVM(program *Program, input io.Reader, output io.Writer) *VM {
+	return &VM{
+		input:     bufio.NewReader(input),
+		output:    bufio.NewWriter(output),
+		program:   program,
+		variables: make([]int64, len(program.Variables)),
+	}
+}
+
+// Run executes the program until it reaches a HALT instruction. The program is verified
+// first, so invalid programs are rejected before they run.
+func (vm *VM) Run() error {
+	maxDepth, err := Verify(vm.program)
+	if err != nil {
+		return err
+	}
+
+	err = vm.run(make([]int64, maxDepth))
+	if flushErr := vm.output.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// run is the main loop of the VM. Verify guarantees that the stack is large enough, and
+// that every jump and variable number is valid.
+func (vm *VM) run(stack []int64) error {
+	instructions := vm.program.Instructions
+	variables := vm.variables
+	sp := 0
+	pc := 0
+
+	for {
+		instruction := &instructions[pc]
+		pc++
+
+		switch instruction.Opcode {
+		case PUSHI, PUSHF:
+			stack[sp] = instruction.Argument
+			sp++
+		case LOAD:
+			stack[sp] = variables[instruction.Argument]
+			sp++
+		case STORE:
+			sp--
+			variables[instruction.Argument] = stack[sp]
+
+		case IADD:
+			sp--
+			stack[sp-1] += stack[sp]
+		case ISUB:
+			sp--
+			stack[sp-1] -= stack[sp]
+		case IMUL:
+			sp--
+			stack[sp-1] *= stack[sp]
+		case IDIV:
+			sp--
+			if stack[sp] == 0 {
+				return vm.errorf(instruction, "division by zero")
+			}
+			// Integer division truncates toward zero, like in C.
+			stack[sp-1] /= stack[sp]
+		case IEQ:
+			sp--
+			stack[sp-1] = boolean(stack[sp-1] == stack[sp])
+		case INE:
+			sp--
+			stack[sp-1] = boolean(stack[sp-1] != stack[sp])
+		case ILT:
+			sp--
+			stack[sp-1] = boolean(stack[sp-1] < stack[sp])
+		case IGT:
+			sp--
+			stack[sp-1] = boolean(stack[sp-1] > stack[sp])
+
+		case FADD:
+			sp--
+			stack[sp-1] = fromFloat(toFloat(stack[sp-1]) + toFloat(stack[sp]))
+		case FSUB:
+			sp--
+			stack[sp-1] = fromFloat(toFloat(stack[sp-1]) - toFloat(stack[sp]))
+		case FMUL:
+			sp--
+			stack[sp-1] = fromFloat(toFloat(stack[sp-1]) * toFloat(stack[sp]))
+		case FDIV:
+			sp--
+			if toFloat(stack[sp]) == 0 {
+				return vm.errorf(instruction, "division by zero")
+			}
+			stack[sp-1] = fromFloat(toFloat(stack[sp-1]) / toFloat(stack[sp]))
+		case FEQ:
+			sp--
+			stack[sp-1] = boolean(toFloat(stack[sp-1]) == toFloat(stack[sp]))
+		case FNE:
+			sp--
+			stack[sp-1] = boolean(toFloat(stack[sp-1]) != toFloat(stack[sp]))
+		case FLT:
+			sp--
+			stack[sp-1] = boolean(toFloat(stack[sp-1]) < toFloat(stack[sp]))
+		case FGT:
+			sp--
+			stack[sp-1] = boolean(toFloat(stack[sp-1]) > toFloat(stack[sp]))
+		case FGE:
+			sp--
+			stack[sp-1] = boolean(toFloat(stack[sp-1]) >= toFloat(stack[sp]))
+		case FLE:
+			sp--
+			stack[sp-1] = boolean(toFloat(stack[sp-1]) <= toFloat(stack[sp]))
+
+		case ITOF:
+			stack[sp-1] = fromFloat(float64(stack[sp-1]))
+		case FTOI:
+			stack[sp-1] = int64(toFloat(stack[sp-1]))
+
+		case IIN, FIN:
+			value, err := vm.read(instruction)
+			if err != nil {
+				return err
+			}
+			variables[instruction.Argument] = value
+		case IOUT:
+			sp--
+			vm.output.WriteString(strconv.FormatInt(stack[sp], 10))
+			vm.output.WriteByte('\n')
+		case FOUT:
+			sp--
+			vm.output.WriteString(quad.FormatFloat(toFloat(stack[sp])))
+			vm.output.WriteByte('\n')
+
+		case JUMP:
+			pc = int(instruction.Argument)
+		case JUMPZ:
+			sp--
+			if stack[sp] == 0 {
+				pc = int(instruction.Argument)
+			}
+		case JUMPNZ:
+			sp--
+			if stack[sp] != 0 {
+				pc = int(instruction.Argument)
+			}
+		case HALT:
+			return nil
+		}
+	}
+}
+
+// read reads a single line of input and parses it as the type of the input variable.
+func (vm *VM) read(instruction *Instruction) (int64, error) {
+	variable := vm.program.Variables[instruction.Argument]
+	isFloat := instruction.Opcode == FIN
+
+	// Prompts and output are written in the same order they were executed.
+	if err := vm.output.Flush(); err != nil {
+		return 0, err
+	}
+
+	for {
+		if vm.Prompt != nil {
+			fmt.Fprintf(vm.Prompt, "%s (%s)? ", variable.Name, variable.Type)
+		}
+
+		line, err := vm.input.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return 0, vm.errorf(instruction, "cannot read input: %s", err)
+		}
+
+		line = strings.TrimSpace(line)
+		if isFloat {
+			if f, err := strconv.ParseFloat(line, 64); err == nil {
+				return fromFloat(f), nil
+			}
+		} else if i, err := strconv.ParseInt(line, 10, 64); err == nil {
+			return i, nil
+		}
+
+		if vm.Prompt == nil {
+			return 0, vm.errorf(instruction, "invalid input '%s'", line)
+		}
+
+		fmt.Fprintln(vm.Prompt, "Invalid input!")
+	}
+}
+
+func (vm *VM) errorf(instruction *Instruction, format string, args ...interface{}) error {
+	return &Error{Message: fmt.Sprintf(format, args...), Line: instruction.Line}
+}
+
+func boolean(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func toFloat(v int64) float64 {
+	return math.Float64frombits(uint64(v))
+}
+
+func fromFloat(f float64) int64 {
+	return int64(math.Float64bits(f))
+}
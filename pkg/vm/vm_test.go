@@ -0,0 +1,145 @@
+package vm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/codegen"
+	"github.com/alongubkin/cpl-compiler/pkg/internal/cpltest"
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+	"github.com/alongubkin/cpl-compiler/pkg/quad"
+	"github.com/alongubkin/cpl-compiler/pkg/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// primes prints the prime numbers up to its input.
+const primes = `a, b, stop, max : int;
+{
+    input(max);
+    a = 2;
+    while (a <= max) {
+        b = 2;
+        stop = 1;
+        while (stop == 1 && b * b <= a) {
+            if (a / b * b == a) stop = 0; else b = b + 1;
+        }
+        if (stop == 1) output(a); else { }
+        a = a + 1;
+    }
+}`
+
+func run(program *parser.Program, input string) (string, error) {
+	output := new(bytes.Buffer)
+	err := vm.NewVM(vm.Compile(program), strings.NewReader(input), output).Run()
+	return output.String(), err
+}
+
+func TestRunExamples(t *testing.T) {
+	for _, example := range cpltest.Examples(t) {
+		output, err := run(example.Program, example.Input)
+		assert.NoError(t, err, example.Name)
+		assert.EqualValues(t, example.Output, output, example.Name)
+	}
+}
+
+func TestRunPrimes(t *testing.T) {
+	output, err := run(cpltest.Analyze(t, primes), "30\n")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "2\n3\n5\n7\n11\n13\n17\n19\n23\n29\n", output)
+}
+
+func TestRunFloats(t *testing.T) {
+	program := cpltest.Analyze(t, `x, y : float;
+i : int;
+{
+    output(0.1 + 0.2);
+    output(100000000000000000000.0);
+    output(0.00001);
+    output(1 / 3.0);
+    i = static_cast(int) 2.9;
+    output(i);
+    input(x);
+    output(x * x);
+    y = x * x - x * x;
+    output(y);
+    if (y == y) output(1); else output(0);
+    if (y != y) output(1); else output(0);
+    if (y < 1.0) output(1); else output(0);
+    if (y >= 1.0) output(1); else output(0);
+    if (y <= 1.0) output(1); else output(0);
+}`)
+
+	output, err := run(program, "1e200\n")
+	assert.NoError(t, err)
+	assert.EqualValues(t, cpltest.InterpretProgram(t, program, "1e200\n"), output)
+}
+
+func TestRunRuntimeErrors(t *testing.T) {
+	program := cpltest.Analyze(t, `a : int;
+x : float;
+{
+    input(a);
+    output(10 / a);
+    output(a / (0 - 1));
+    input(x);
+    output(x / (x - 1));
+}`)
+
+	tests := []struct {
+		input  string
+		output string
+		err    error
+	}{
+		{"4\n0.5\n", "2\n-4\n-1.0\n", nil},
+		{"-9223372036854775808\n0.5\n", "0\n-9223372036854775808\n-1.0\n", nil},
+		{"0\n", "", &vm.Error{Message: "division by zero", Line: 5}},
+		{"4\n1\n", "2\n-4\n", &vm.Error{Message: "division by zero", Line: 8}},
+		{"4\nabc\n", "2\n-4\n", &vm.Error{Message: "invalid input 'abc'", Line: 7}},
+		{"4\n", "2\n-4\n", &vm.Error{Message: "cannot read input: EOF", Line: 7}},
+	}
+
+	for _, test := range tests {
+		output, err := run(program, test.input)
+		assert.EqualValues(t, test.err, err, test.input)
+		assert.EqualValues(t, test.output, output, test.input)
+	}
+}
+
+func TestRunPrompt(t *testing.T) {
+	output, prompt := new(bytes.Buffer), new(bytes.Buffer)
+	machine := vm.NewVM(vm.Compile(cpltest.Analyze(t, `a : int;
+{
+    output(1);
+    input(a);
+    output(a);
+}`)), strings.NewReader("x\n5\n"), output)
+	machine.Prompt = prompt
+
+	assert.NoError(t, machine.Run())
+	assert.EqualValues(t, "1\n5\n", output.String())
+	assert.EqualValues(t, "a (int)? Invalid input!\na (int)? ", prompt.String())
+}
+
+func TestRunInvalidProgram(t *testing.T) {
+	err := vm.NewVM(&vm.Program{Instructions: []vm.Instruction{{Opcode: vm.IADD}}},
+		strings.NewReader(""), new(bytes.Buffer)).Run()
+	assert.EqualError(t, err, "stack underflow at instruction 0")
+}
+
+func BenchmarkRunPrimes(b *testing.B) {
+	program := vm.Compile(cpltest.Analyze(b, primes))
+	for i := 0; i < b.N; i++ {
+		assert.NoError(b, vm.NewVM(program, strings.NewReader("5000\n"), ioutil.Discard).Run())
+	}
+}
+
+func BenchmarkInterpretPrimes(b *testing.B) {
+	instructions, errors := quad.Assemble(codegen.Codegen(cpltest.Analyze(b, primes)))
+	assert.Empty(b, errors)
+	for i := 0; i < b.N; i++ {
+		interpreter := quad.NewInterpreter(instructions, strings.NewReader("5000\n"), ioutil.Discard)
+		assert.NoError(b, interpreter.Run())
+	}
+}
@@ -0,0 +1,454 @@
+// Package wat translates CPL programs to WebAssembly text format (WAT), so they can run
+// in the browser or any other WebAssembly runtime.
+//
+// The generated module imports its input and output functions from the host:
+//
+//	(import "env" "input_int" (func $input_int (result i64)))
+//	(import "env" "input_float" (func $input_float (result f64)))
+//	(import "env" "output_int" (func $output_int (param i64)))
+//	(import "env" "output_float" (func $output_float (param f64)))
+//
+// and exports a "main" function that runs the program. Ints are i64 and floats are f64.
+// Division by zero traps, like the runtime error of the Quad interpreter. The host is
+// responsible for parsing the input, and for printing floats like the interpreter does.
+package wat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alongubkin/cpl-compiler/pkg/parser"
+)
+
+// indentation is the text that indents every nesting level of the generated code.
+const indentation = "  "
+
+// Helper functions that the generated code may call. Only the helpers that a program
+// uses are written to its module.
+const (
+	intDivideFunction   = "$idiv"
+	floatDivideFunction = "$rdiv"
+)
+
+// helpers contains the source of every helper function, in the order they're written.
+// WebAssembly traps on integer division by zero but not on float division, and
+// traps when dividing the smallest int by -1 instead of wrapping around like Quad.
+var helpers = []struct {
+	name   string
+	source string
+}{
+	{intDivideFunction, `(func $idiv (param $a i64) (param $b i64) (result i64)
+  (if (i64.eqz (local.get $b))
+    (then (unreachable)))
+  (if (i64.eq (local.get $b) (i64.const -1))
+    (then (return (i64.sub (i64.const 0) (local.get $a)))))
+  (i64.div_s (local.get $a) (local.get $b)))
+`},
+	{floatDivideFunction, `(func $rdiv (param $a f64) (param $b f64) (result f64)
+  (if (f64.eq (local.get $b) (f64.const 0))
+    (then (unreachable)))
+  (f64.div (local.get $a) (local.get $b)))
+`},
+}
+
+// imports are the host functions that every module imports.
+const imports = `(import "env" "input_int" (func $input_int (result i64)))
+(import "env" "input_float" (func $input_float (result f64)))
+(import "env" "output_int" (func $output_int (param i64)))
+(import "env" "output_float" (func $output_float (param f64)))
+`
+
+// Generator translates a CPL AST to a WebAssembly module. The AST must be annotated by
+// semantic analysis first, and must not contain semantic errors.
+type Generator struct {
+	Variables  map[string]parser.DataType
+	body       strings.Builder
+	indent     int
+	locals     []string
+	used       map[string]bool
+	labelIndex int
+	breakStack []string
+}
+
+// NewGenerator returns a new instance of Generator.
+func NewGenerator() *Generator {
+	return &Generator{
+		Variables:  map[string]parser.DataType{},
+		indent:     2,
+		locals:     []string{},
+		used:       map[string]bool{},
+		labelIndex: 0,
+		breakStack: []string{},
+	}
+}
+
+// Generate generates a WebAssembly module from a CPL program that passed semantic
+// analysis.
+func Generate(program *parser.Program) string {
+	return NewGenerator().GenerateProgram(program)
+}
+
+// GenerateProgram generates a module with a main function that runs the statements of
+// the CPL program. Every CPL variable is a local of the main function.
+func (g *Generator) GenerateProgram(node *parser.Program) string {
+	for _, declaration := range node.Declarations {
+		for _, name := range declaration.Names {
+			if _, exists := g.Variables[name]; !exists {
+				g.Variables[name] = declaration.Type
+				g.locals = append(g.locals, fmt.Sprintf("(local $%s %s)", name,
+					valueType(declaration.Type)))
+			}
+		}
+	}
+
+	if node.StatementsBlock != nil {
+		for _, statement := range node.StatementsBlock.Statements {
+			g.GenerateStatement(statement)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("(module\n")
+	writeIndented(&b, imports, 1)
+
+	for _, helper := range helpers {
+		if g.used[helper.name] {
+			b.WriteString("\n")
+			writeIndented(&b, helper.source, 1)
+		}
+	}
+
+	b.WriteString("\n" + indentation + "(func $main (export \"main\")\n")
+	for _, local := range g.locals {
+		b.WriteString(strings.Repeat(indentation, 2) + local + "\n")
+	}
+	b.WriteString(g.body.String())
+	b.WriteString(indentation + ")\n)\n")
+
+	return b.String()
+}
+
+// GenerateStatement generates code for a CPL statement.
+func (g *Generator) GenerateStatement(node parser.Statement) {
+	switch s := node.(type) {
+	case *parser.AssignmentStatement:
+		g.GenerateAssignmentStatement(s)
+	case *parser.InputStatement:
+		g.GenerateInputStatement(s)
+	case *parser.OutputStatement:
+		g.GenerateOutputStatement(s)
+	case *parser.IfStatement:
+		g.GenerateIfStatement(s)
+	case *parser.WhileStatement:
+		g.GenerateWhileStatement(s)
+	case *parser.SwitchStatement:
+		g.GenerateSwitchStatement(s)
+	case *parser.BreakStatement:
+		g.GenerateBreakStatement(s)
+	case *parser.StatementsBlock:
+		g.GenerateStatementsBlock(s)
+	}
+}
+
+// GenerateAssignmentStatement generates code for assignment statements.
+func (g *Generator) GenerateAssignmentStatement(node *parser.AssignmentStatement) {
+	value := g.GenerateExpression(node.Value)
+	valueType := parser.TypeOf(node.Value)
+
+	// Cast type if there's a static_cast
+	if node.CastType != parser.Unknown {
+		value = convert(value, valueType, node.CastType)
+		valueType = node.CastType
+	}
+
+	// If the variable is float but the expression is integer, cast it to float.
+	value = convert(value, valueType, g.Variables[node.Variable])
+
+	g.line("(local.set $%s %s)", node.Variable, value)
+}
+
+// GenerateInputStatement generates code for input statements.
+func (g *Generator) GenerateInputStatement(node *parser.InputStatement) {
+	function := "$input_int"
+	if g.Variables[node.Variable] == parser.Float {
+		function = "$input_float"
+	}
+
+	g.line("(local.set $%s (call %s))", node.Variable, function)
+}
+
+// GenerateOutputStatement generates code for output statements.
+func (g *Generator) GenerateOutputStatement(node *parser.OutputStatement) {
+	function := "$output_int"
+	if parser.TypeOf(node.Value) == parser.Float {
+		function = "$output_float"
+	}
+
+	g.line("(call %s %s)", function, g.GenerateExpression(node.Value))
+}
+
+// GenerateIfStatement generates code for if statements.
+func (g *Generator) GenerateIfStatement(node *parser.IfStatement) {
+	g.line("(if %s", g.GenerateBooleanExpression(node.Condition))
+	g.indent++
+
+	g.line("(then")
+	g.generateNested(node.IfBranch)
+	g.line(")")
+
+	// CPL requires an else branch, so it's often an empty block.
+	if block, ok := node.ElseBranch.(*parser.StatementsBlock); node.ElseBranch != nil &&
+		(!ok || len(block.Statements) > 0) {
+		g.line("(else")
+		g.generateNested(node.ElseBranch)
+		g.line(")")
+	}
+
+	g.indent--
+	g.line(")")
+}
+
+// GenerateWhileStatement generates code for while statements. The loop is wrapped in a
+// block, so the condition and break statements can branch out of it.
+func (g *Generator) GenerateWhileStatement(node *parser.WhileStatement) {
+	breakLabel, continueLabel := g.getNewLabel("break"), g.getNewLabel("continue")
+
+	g.line("(block %s", breakLabel)
+	g.indent++
+	g.line("(loop %s", continueLabel)
+	g.indent++
+	g.line("(br_if %s (i32.eqz %s))", breakLabel, g.GenerateBooleanExpression(node.Condition))
+
+	g.breakStack = append(g.breakStack, breakLabel)
+	g.generateStatements(node.Body)
+	g.breakStack = g.breakStack[:len(g.breakStack)-1]
+
+	g.line("(br %s)", continueLabel)
+	g.indent--
+	g.line(")")
+	g.indent--
+	g.line(")")
+}
+
+// GenerateSwitchStatement generates code for switch statements.
+//
+// Every case is a block nested in the blocks of the cases that follow it. The innermost
+// block compares the expression with every case and branches out of the block of the
+// matching case, so execution continues at its statements and falls through to the
+// statements of the next cases, exactly like in C.
+func (g *Generator) GenerateSwitchStatement(node *parser.SwitchStatement) {
+	breakLabel := g.getNewLabel("break")
+	value := g.getNewLabel("switch")
+	g.locals = append(g.locals, fmt.Sprintf("(local %s i64)", value))
+
+	caseLabels := []string{}
+	for range node.Cases {
+		caseLabels = append(caseLabels, g.getNewLabel("case"))
+	}
+	defaultLabel := g.getNewLabel("default")
+
+	g.line("(block %s", breakLabel)
+	g.indent++
+	g.line("(block %s", defaultLabel)
+	g.indent++
+	for i := len(caseLabels) - 1; i >= 0; i-- {
+		g.line("(block %s", caseLabels[i])
+		g.indent++
+	}
+
+	g.line("(local.set %s %s)", value, g.GenerateExpression(node.Expression))
+	for i, switchCase := range node.Cases {
+		g.line("(br_if %s (i64.eq (local.get %s) (i64.const %d)))", caseLabels[i], value,
+			switchCase.Value)
+	}
+	g.line("(br %s)", defaultLabel)
+
+	g.breakStack = append(g.breakStack, breakLabel)
+	for _, switchCase := range node.Cases {
+		g.indent--
+		g.line(")")
+		g.line(";; case %d", switchCase.Value)
+		g.generateList(switchCase.Statements)
+	}
+
+	g.indent--
+	g.line(")")
+	g.line(";; default")
+	g.generateList(node.DefaultCase)
+	g.breakStack = g.breakStack[:len(g.breakStack)-1]
+
+	g.indent--
+	g.line(")")
+}
+
+// GenerateBreakStatement generates code for break statements.
+func (g *Generator) GenerateBreakStatement(node *parser.BreakStatement) {
+	if len(g.breakStack) == 0 {
+		return
+	}
+
+	g.line("(br %s)", g.breakStack[len(g.breakStack)-1])
+}
+
+// GenerateStatementsBlock generates code for a statements block.
+func (g *Generator) GenerateStatementsBlock(node *parser.StatementsBlock) {
+	for _, statement := range node.Statements {
+		g.GenerateStatement(statement)
+	}
+}
+
+// GenerateExpression returns the code of a CPL expression, which leaves an i64 or an
+// f64 on the stack according to the type of the expression.
+func (g *Generator) GenerateExpression(node parser.Expression) string {
+	switch s := node.(type) {
+	case *parser.ArithmeticExpression:
+		return g.GenerateArithmeticExpression(s)
+	case *parser.VariableExpression:
+		return fmt.Sprintf("(local.get $%s)", s.Variable)
+	case *parser.IntLiteral:
+		return fmt.Sprintf("(i64.const %d)", s.Value)
+	case *parser.FloatLiteral:
+		return fmt.Sprintf("(f64.const %s)", strconv.FormatFloat(s.Value, 'g', -1, 64))
+	}
+
+	panic(fmt.Sprintf("wat: unexpected expression %T", node))
+}
+
+// GenerateArithmeticExpression returns the code of an arithmetic expression. If the
+// result is a float, int operands are converted to floats first.
+func (g *Generator) GenerateArithmeticExpression(node *parser.ArithmeticExpression) string {
+	lhs := convert(g.GenerateExpression(node.LHS), parser.TypeOf(node.LHS), node.Type)
+	rhs := convert(g.GenerateExpression(node.RHS), parser.TypeOf(node.RHS), node.Type)
+
+	if node.Operator == parser.Divide {
+		function := intDivideFunction
+		if node.Type == parser.Float {
+			function = floatDivideFunction
+		}
+		g.used[function] = true
+		return fmt.Sprintf("(call %s %s %s)", function, lhs, rhs)
+	}
+
+	instructions := map[parser.Operator]string{
+		parser.Add:      "add",
+		parser.Subtract: "sub",
+		parser.Multiply: "mul",
+	}
+	return fmt.Sprintf("(%s.%s %s %s)", valueType(node.Type), instructions[node.Operator],
+		lhs, rhs)
+}
+
+// GenerateBooleanExpression returns the code of a CPL boolean expression, which leaves
+// an i32 on the stack: 1 if the expression is true, and 0 otherwise. Like in C, the RHS
+// of && and || is only evaluated if the LHS doesn't decide the result.
+func (g *Generator) GenerateBooleanExpression(node parser.BooleanExpression) string {
+	switch s := node.(type) {
+	case *parser.OrBooleanExpression:
+		return fmt.Sprintf("(if (result i32) %s (then (i32.const 1)) (else %s))",
+			g.GenerateBooleanExpression(s.LHS), g.GenerateBooleanExpression(s.RHS))
+	case *parser.AndBooleanExpression:
+		return fmt.Sprintf("(if (result i32) %s (then %s) (else (i32.const 0)))",
+			g.GenerateBooleanExpression(s.LHS), g.GenerateBooleanExpression(s.RHS))
+	case *parser.NotBooleanExpression:
+		return fmt.Sprintf("(i32.eqz %s)", g.GenerateBooleanExpression(s.Value))
+	case *parser.CompareBooleanExpression:
+		return g.GenerateCompareBooleanExpression(s)
+	}
+
+	panic(fmt.Sprintf("wat: unexpected boolean expression %T", node))
+}
+
+// GenerateCompareBooleanExpression returns the code of a comparison. If one of the sides
+// is a float, both of them are compared as floats.
+func (g *Generator) GenerateCompareBooleanExpression(node *parser.CompareBooleanExpression) string {
+	compareType := parser.Integer
+	if parser.TypeOf(node.LHS) == parser.Float || parser.TypeOf(node.RHS) == parser.Float {
+		compareType = parser.Float
+	}
+
+	lhs := convert(g.GenerateExpression(node.LHS), parser.TypeOf(node.LHS), compareType)
+	rhs := convert(g.GenerateExpression(node.RHS), parser.TypeOf(node.RHS), compareType)
+
+	instructions := map[parser.Operator]string{
+		parser.EqualTo:              "eq",
+		parser.NotEqualTo:           "ne",
+		parser.GreaterThan:          "gt",
+		parser.LessThan:             "lt",
+		parser.GreaterThanOrEqualTo: "ge",
+		parser.LessThenOrEqualTo:    "le",
+	}
+
+	instruction := instructions[node.Operator]
+	if compareType == parser.Integer && node.Operator != parser.EqualTo &&
+		node.Operator != parser.NotEqualTo {
+		instruction += "_s"
+	}
+
+	return fmt.Sprintf("(%s.%s %s %s)", valueType(compareType), instruction, lhs, rhs)
+}
+
+// generateNested generates the statements of an if branch one level deeper than the
+// current statement. A block doesn't need its own nesting level.
+func (g *Generator) generateNested(node parser.Statement) {
+	g.indent++
+	g.generateStatements(node)
+	g.indent--
+}
+
+// generateStatements generates a statement, or the statements of a block.
+func (g *Generator) generateStatements(node parser.Statement) {
+	if block, ok := node.(*parser.StatementsBlock); ok {
+		g.GenerateStatementsBlock(block)
+	} else {
+		g.GenerateStatement(node)
+	}
+}
+
+// generateList generates the statements of a switch case.
+func (g *Generator) generateList(statements []parser.Statement) {
+	for _, statement := range statements {
+		g.GenerateStatement(statement)
+	}
+}
+
+// line writes a line of code at the current indentation.
+func (g *Generator) line(format string, args ...interface{}) {
+	g.body.WriteString(strings.Repeat(indentation, g.indent))
+	fmt.Fprintf(&g.body, format, args...)
+	g.body.WriteString("\n")
+}
+
+// getNewLabel returns a new unique name for a label or a local.
+func (g *Generator) getNewLabel(kind string) string {
+	g.labelIndex++
+	return fmt.Sprintf("$%s_%d", kind, g.labelIndex)
+}
+
+// writeIndented writes lines of code, indented by the given number of levels.
+func writeIndented(b *strings.Builder, code string, levels int) {
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(code, "\n"), "\n") {
+		b.WriteString(strings.Repeat(indentation, levels) + line)
+	}
+	b.WriteString("\n")
+}
+
+// convert returns code that converts a value from one type to another. Floats are
+// converted to ints by truncation, and values that don't fit in an int saturate
+// instead of trapping.
+func convert(value string, from parser.DataType, to parser.DataType) string {
+	switch {
+	case from == parser.Integer && to == parser.Float:
+		return fmt.Sprintf("(f64.convert_i64_s %s)", value)
+	case from == parser.Float && to == parser.Integer:
+		return fmt.Sprintf("(i64.trunc_sat_f64_s %s)", value)
+	}
+	return value
+}
+
+func valueType(dataType parser.DataType) string {
+	if dataType == parser.Float {
+		return "f64"
+	}
+	return "i64"
+}
@@ -0,0 +1,543 @@
+package wat_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alongubkin/cpl-compiler/pkg/internal/cpltest"
+	"github.com/alongubkin/cpl-compiler/pkg/wat"
+	"github.com/stretchr/testify/assert"
+)
+
+// host runs a WebAssembly module with Node.js. It reads the input from stdin, one value
+// per line, and prints floats like the Quad interpreter.
+const host = `
+const fs = require("fs");
+const lines = fs.readFileSync(0, "utf8").split("\n");
+let next = 0;
+
+function formatFloat(f) {
+  if (Number.isNaN(f)) return "nan";
+  if (f === Infinity) return "inf";
+  if (f === -Infinity) return "-inf";
+
+  const [mantissa, exponent] = f.toExponential().split("e");
+  const e = Number(exponent);
+  if (e < -4 || e >= 16) {
+    return mantissa + "e" + (e < 0 ? "-" : "+") + String(Math.abs(e)).padStart(2, "0");
+  }
+
+  const digits = mantissa.replace("-", "").replace(".", "").length;
+  let s = f.toFixed(Math.max(digits - 1 - e, 0));
+  if (Object.is(f, -0)) s = "-" + s;
+  return s.includes(".") ? s : s + ".0";
+}
+
+const env = {
+  input_int: () => BigInt(lines[next++].trim()),
+  input_float: () => Number(lines[next++].trim()),
+  output_int: (value) => console.log(value.toString()),
+  output_float: (value) => console.log(formatFloat(value)),
+};
+
+WebAssembly.instantiate(fs.readFileSync(process.argv[2]), { env })
+  .then(({ instance }) => instance.exports.main())
+  .catch((error) => {
+    console.error("RuntimeError: " + error.message);
+    process.exit(1);
+  });
+`
+
+// mainBody returns the instructions of the main function, without the locals.
+func mainBody(t *testing.T, code string) string {
+	output := wat.Generate(cpltest.Analyze(t, code))
+	start := strings.Index(output, "  (func $main (export \"main\")\n")
+	if !assert.True(t, start >= 0) {
+		return ""
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(output[start:], "\n")[1:] {
+		if !strings.HasPrefix(line, "    (local ") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSuffix(strings.Join(lines, "\n"), "  )\n)\n")
+}
+
+func TestGenerateProgram(t *testing.T) {
+	assert.EqualValues(t, `(module
+  (import "env" "input_int" (func $input_int (result i64)))
+  (import "env" "input_float" (func $input_float (result f64)))
+  (import "env" "output_int" (func $output_int (param i64)))
+  (import "env" "output_float" (func $output_float (param f64)))
+
+  (func $main (export "main")
+    (local $a i64)
+    (local $b i64)
+    (local $x f64)
+    (local.set $a (call $input_int))
+    (local.set $x (f64.convert_i64_s (local.get $a)))
+    (call $output_float (local.get $x))
+  )
+)
+`, wat.Generate(cpltest.Analyze(t, "a, b : int;\nx : float;\n{ input(a); x = a; output(x); }")))
+}
+
+func TestGenerateDivision(t *testing.T) {
+	output := wat.Generate(cpltest.Analyze(t, "a : int;\n{ a = a / 2; }"))
+	assert.Contains(t, output, "(func $idiv (param $a i64) (param $b i64) (result i64)")
+	assert.NotContains(t, output, "$rdiv")
+	assert.Contains(t, output, "(local.set $a (call $idiv (local.get $a) (i64.const 2)))")
+
+	output = wat.Generate(cpltest.Analyze(t, "x : float;\n{ x = 1 / x; }"))
+	assert.Contains(t, output, "(func $rdiv (param $a f64) (param $b f64) (result f64)")
+	assert.NotContains(t, output, "$idiv")
+	assert.Contains(t, output,
+		"(local.set $x (call $rdiv (f64.convert_i64_s (i64.const 1)) (local.get $x)))")
+}
+
+func TestGenerateExpressions(t *testing.T) {
+	assert.EqualValues(t, `    (local.set $a (i64.sub (local.get $a) (i64.mul (local.get $a) (i64.const 2))))
+    (local.set $x (f64.add (local.get $x) (f64.convert_i64_s (i64.mul (local.get $a) (i64.const 2)))))
+    (local.set $x (f64.mul (local.get $x) (f64.const 1e-07)))
+    (local.set $a (i64.trunc_sat_f64_s (f64.mul (local.get $x) (f64.const 2.5))))
+    (local.set $x (f64.convert_i64_s (i64.trunc_sat_f64_s (local.get $x))))
+    (local.set $x (f64.convert_i64_s (local.get $a)))
+    (call $output_int (i64.add (local.get $a) (i64.const 1)))
+`, mainBody(t, `a : int;
+x : float;
+{
+    a = a - a * 2;
+    x = x + a * 2;
+    x = x * 0.0000001;
+    a = static_cast(int) (x * 2.5);
+    x = static_cast(int) x;
+    x = static_cast(float) a;
+    output(a + 1);
+}`))
+}
+
+func TestGenerateBooleanExpressions(t *testing.T) {
+	assert.EqualValues(t, `    (if (if (result i32) (i64.lt_s (local.get $a) (i64.const 1)) (then (i32.const 1)) (else (f64.ge (f64.convert_i64_s (local.get $a)) (local.get $x))))
+      (then
+        (call $output_int (i64.const 1))
+      )
+    )
+    (if (if (result i32) (i64.ne (local.get $a) (i64.const 1)) (then (i32.eqz (f64.le (local.get $x) (f64.const 2)))) (else (i32.const 0)))
+      (then
+      )
+      (else
+        (call $output_int (i64.const 2))
+      )
+    )
+`, mainBody(t, `a : int;
+x : float;
+{
+    if (a < 1 || a >= x) { output(1); } else { }
+    if (a != 1 && !(x <= 2.0)) { } else output(2);
+}`))
+}
+
+func TestGenerateWhile(t *testing.T) {
+	assert.EqualValues(t, `    (block $break_1
+      (loop $continue_2
+        (br_if $break_1 (i32.eqz (i64.gt_s (local.get $a) (i64.const 0))))
+        (local.set $a (i64.sub (local.get $a) (i64.const 1)))
+        (if (i64.eq (local.get $a) (i64.const 5))
+          (then
+            (br $break_1)
+          )
+        )
+        (br $continue_2)
+      )
+    )
+`, mainBody(t, `a : int;
+{
+    while (a > 0) {
+        a = a - 1;
+        if (a == 5) break; else { }
+    }
+}`))
+}
+
+func TestGenerateSwitch(t *testing.T) {
+	assert.EqualValues(t, `    (block $break_1
+      (block $default_5
+        (block $case_4
+          (block $case_3
+            (local.set $switch_2 (i64.add (local.get $a) (i64.const 1)))
+            (br_if $case_3 (i64.eq (local.get $switch_2) (i64.const 1)))
+            (br_if $case_4 (i64.eq (local.get $switch_2) (i64.const 2)))
+            (br $default_5)
+          )
+          ;; case 1
+          (call $output_int (i64.const 1))
+          (br $break_1)
+        )
+        ;; case 2
+        (block $break_6
+          (loop $continue_7
+            (br_if $break_6 (i32.eqz (i64.gt_s (local.get $a) (i64.const 0))))
+            (br $break_6)
+            (br $continue_7)
+          )
+        )
+        (call $output_int (i64.const 2))
+      )
+      ;; default
+      (call $output_int (i64.const 0))
+    )
+`, mainBody(t, `a : int;
+{
+    switch (a + 1) {
+        case 1: output(1); break;
+        case 2: while (a > 0) break; output(2);
+        default: output(0);
+    }
+}`))
+}
+
+// TestValidateExamples checks the modules of the examples without external tools, so the
+// generated code is validated even when TestGenerateExamples is skipped.
+func TestValidateExamples(t *testing.T) {
+	for _, example := range cpltest.Examples(t) {
+		module, err := parseModule(wat.Generate(example.Program))
+		if assert.NoError(t, err, example.Name) {
+			assert.Empty(t, validate(module), example.Name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		code   string
+		errors []string
+	}{
+		{`(module (func $main (local $a i64) (local.set $a (i64.const 1))))`, nil},
+		{`(module (func $main (local.set $a (i64.const 1))))`, []string{"unknown local $a"}},
+		{`(module (func $main (local $a i64) (local.set $a (f64.const 1))))`,
+			[]string{"local.set: expected i64, found f64"}},
+		{`(module (func $main (br $break_1)))`, []string{"unknown label $break_1"}},
+		{`(module (func $main (call $f (i64.const 1))))`, []string{"unknown function $f"}},
+		{`(module (func $main (result i64) (f64.const +Inf)))`,
+			[]string{"invalid f64.const +Inf", "$main: expected result i64, found f64"}},
+		{`(module (func $main (i64.rem_s (i64.const 1) (i64.const 2))))`,
+			[]string{"unknown instruction i64.rem_s"}},
+	}
+
+	for _, test := range tests {
+		module, err := parseModule(test.code)
+		assert.NoError(t, err, test.code)
+		assert.EqualValues(t, test.errors, validate(module), test.code)
+	}
+
+	_, err := parseModule("(module (func $main)")
+	assert.EqualError(t, err, "unbalanced parentheses")
+}
+
+func TestGenerateExamples(t *testing.T) {
+	wat2wasm, err := exec.LookPath("wat2wasm")
+	if err != nil {
+		t.Skip("wat2wasm is required to test the generated code")
+	}
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("Node.js is required to test the generated code")
+	}
+
+	dir, err := ioutil.TempDir("", "wat")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hostFile := filepath.Join(dir, "host.js")
+	assert.NoError(t, ioutil.WriteFile(hostFile, []byte(host), 0644))
+
+	for _, example := range cpltest.Examples(t) {
+		source := filepath.Join(dir, "program.wat")
+		binary := filepath.Join(dir, "program.wasm")
+		assert.NoError(t, ioutil.WriteFile(source, []byte(wat.Generate(example.Program)), 0644))
+
+		output, err := exec.Command(wat2wasm, "-o", binary, source).CombinedOutput()
+		if !assert.NoError(t, err, "%s: %s", example.Name, output) {
+			continue
+		}
+
+		stdout, _, err := cpltest.Run(exec.Command(node, hostFile, binary), example.Input)
+		assert.NoError(t, err, example.Name)
+		assert.EqualValues(t, example.Output, stdout, example.Name)
+	}
+}
+
+// sexpr is an S-expression of a WAT module: either an atom, or a list of S-expressions.
+type sexpr struct {
+	atom string
+	list []*sexpr
+}
+
+// head returns the first atom of a list, which is the name of a module field or an
+// instruction.
+func (s *sexpr) head() string {
+	if len(s.list) > 0 {
+		return s.list[0].atom
+	}
+	return ""
+}
+
+// parseModule parses the S-expressions of a WAT module.
+func parseModule(code string) (*sexpr, error) {
+	stack := []*sexpr{{}}
+	for i := 0; i < len(code); {
+		top := stack[len(stack)-1]
+		switch {
+		case code[i] == ' ' || code[i] == '\n':
+			i++
+		case strings.HasPrefix(code[i:], ";;"):
+			for i < len(code) && code[i] != '\n' {
+				i++
+			}
+		case code[i] == '(':
+			stack = append(stack, &sexpr{})
+			i++
+		case code[i] == ')':
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("unbalanced parentheses")
+			}
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1].list = append(stack[len(stack)-1].list, top)
+			i++
+		default:
+			end := i + strings.IndexAny(code[i:]+" ", " \n()")
+			if code[i] == '"' {
+				end = i + 2 + strings.IndexByte(code[i+1:], '"')
+			}
+			top.list = append(top.list, &sexpr{atom: code[i:end]})
+			i = end
+		}
+	}
+
+	if len(stack) != 1 || len(stack[0].list) != 1 || stack[0].list[0].head() != "module" {
+		return nil, fmt.Errorf("unbalanced parentheses")
+	}
+	return stack[0].list[0], nil
+}
+
+// signature is the type of a WebAssembly function.
+type signature struct {
+	params []string
+	result string
+}
+
+// validator type-checks the subset of WebAssembly that the generator emits.
+type validator struct {
+	functions map[string]signature
+	function  string
+	locals    map[string]string
+	labels    []string
+	errors    []string
+}
+
+var numberRegexp = regexp.MustCompile(`^-?(\d+(\.\d*)?([eE][+-]?\d+)?|inf|nan)$`)
+
+// validate returns the errors in a parsed module. Every local, function and label must
+// be declared, and the operands of every instruction must have the right types.
+func validate(module *sexpr) []string {
+	v := &validator{functions: map[string]signature{}}
+	for _, field := range module.list[1:] {
+		switch field.head() {
+		case "import":
+			function := field.list[3]
+			v.functions[function.list[1].atom] = v.signature(function.list[2:])
+		case "func":
+			v.functions[field.list[1].atom] = v.signature(field.list[2:])
+		default:
+			v.errorf("unexpected module field %s", field.head())
+		}
+	}
+
+	for _, field := range module.list[1:] {
+		if field.head() != "func" {
+			continue
+		}
+
+		v.function, v.locals, v.labels = field.list[1].atom, map[string]string{}, nil
+		result := v.functions[v.function].result
+		last := ""
+		for _, item := range field.list[2:] {
+			switch item.head() {
+			case "param", "local":
+				v.locals[item.list[1].atom] = item.list[2].atom
+			case "export", "result":
+			default:
+				last = v.expression(item)
+			}
+		}
+		if last != result {
+			v.errorf("%s: expected result %s, found %s", v.function, result, last)
+		}
+	}
+
+	return v.errors
+}
+
+func (v *validator) errorf(format string, args ...interface{}) {
+	v.errors = append(v.errors, fmt.Sprintf(format, args...))
+}
+
+// signature returns the signature declared by the params and result of a function.
+func (v *validator) signature(items []*sexpr) signature {
+	result := signature{}
+	for _, item := range items {
+		switch item.head() {
+		case "param":
+			result.params = append(result.params, item.list[len(item.list)-1].atom)
+		case "result":
+			result.result = item.list[1].atom
+		}
+	}
+	return result
+}
+
+// expression checks a folded instruction, and returns the type of its result. An empty
+// type means the instruction doesn't return a value.
+func (v *validator) expression(e *sexpr) string {
+	if e.atom == "unreachable" {
+		return ""
+	}
+
+	name := e.head()
+	args := e.list[1:]
+	switch name {
+	case "local.get":
+		return v.local(args[0])
+	case "local.set":
+		v.operands(e, "", v.local(args[0]))
+		return ""
+	case "call":
+		function, ok := v.functions[args[0].atom]
+		if !ok {
+			v.errorf("unknown function %s", args[0].atom)
+			return ""
+		}
+		v.operands(e, append([]string{""}, function.params...)...)
+		return function.result
+	case "block", "loop":
+		v.labels = append(v.labels, args[0].atom)
+		for _, instruction := range args[1:] {
+			v.expression(instruction)
+		}
+		v.labels = v.labels[:len(v.labels)-1]
+		return ""
+	case "br", "br_if":
+		v.label(args[0])
+		if name == "br_if" {
+			v.operands(e, "", "i32")
+		}
+		return ""
+	case "return":
+		v.operands(e, v.functions[v.function].result)
+		return ""
+	case "unreachable":
+		return ""
+	case "if":
+		result := ""
+		if args[0].head() == "result" {
+			result = args[0].list[1].atom
+			args = args[1:]
+		}
+		v.expect(name, args[0], "i32")
+		for _, branch := range args[1:] {
+			last := ""
+			for _, instruction := range branch.list[1:] {
+				last = v.expression(instruction)
+			}
+			if last != result {
+				v.errorf("if: expected %s, found %s", result, last)
+			}
+		}
+		return result
+	}
+
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) != 2 {
+		v.errorf("unknown instruction %s", name)
+		return ""
+	}
+
+	valueType := parts[0]
+	switch parts[1] {
+	case "const":
+		valid := numberRegexp.MatchString(args[0].atom)
+		if valueType != "f64" {
+			_, err := strconv.ParseInt(args[0].atom, 10, 64)
+			valid = err == nil
+		}
+		if !valid {
+			v.errorf("invalid %s %s", name, args[0].atom)
+		}
+		return valueType
+	case "add", "sub", "mul", "div", "div_s":
+		v.operands(e, valueType, valueType)
+		return valueType
+	case "eq", "ne", "lt", "gt", "le", "ge", "lt_s", "gt_s", "le_s", "ge_s":
+		v.operands(e, valueType, valueType)
+		return "i32"
+	case "eqz":
+		v.operands(e, valueType)
+		return "i32"
+	case "convert_i64_s":
+		v.operands(e, "i64")
+		return valueType
+	case "trunc_sat_f64_s":
+		v.operands(e, "f64")
+		return valueType
+	}
+
+	v.errorf("unknown instruction %s", name)
+	return ""
+}
+
+// operands checks the number and the types of the operands of an instruction. An empty
+// type skips the operand, e.g the name of a local.
+func (v *validator) operands(e *sexpr, types ...string) {
+	if len(e.list)-1 != len(types) {
+		v.errorf("%s: expected %d operands, found %d", e.head(), len(types), len(e.list)-1)
+		return
+	}
+
+	for i, expected := range types {
+		if expected != "" {
+			v.expect(e.head(), e.list[i+1], expected)
+		}
+	}
+}
+
+func (v *validator) expect(name string, operand *sexpr, expected string) {
+	if found := v.expression(operand); found != expected {
+		v.errorf("%s: expected %s, found %s", name, expected, found)
+	}
+}
+
+func (v *validator) local(name *sexpr) string {
+	valueType, ok := v.locals[name.atom]
+	if !ok {
+		v.errorf("unknown local %s", name.atom)
+	}
+	return valueType
+}
+
+func (v *validator) label(name *sexpr) {
+	for _, label := range v.labels {
+		if label == name.atom {
+			return
+		}
+	}
+	v.errorf("unknown label %s", name.atom)
+}